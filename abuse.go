@@ -0,0 +1,182 @@
+package dmsg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// AbuseKind is the kind of abuse detected by a dmsg server.
+type AbuseKind string
+
+// Kinds of abuse.
+const (
+	AbuseStreamRate     AbuseKind = "stream_rate"     // stream requests of a session exceed the rate limit
+	AbuseStreamQuota    AbuseKind = "stream_quota"    // concurrent streams of a session exceed the quota
+	AbuseHandshakeFlood AbuseKind = "handshake_flood" // failed session handshakes from a host exceed the threshold
+)
+
+// AbuseReport describes abuse detected by a dmsg server.
+type AbuseReport struct {
+	Kind       AbuseKind
+	RemotePK   cipher.PubKey // null if the remote is not authenticated (such as for handshake floods)
+	RemoteAddr net.Addr
+	Time       time.Time
+	Detail     string
+}
+
+// AbuseReporter is notified by a dmsg server when abuse is detected. It allows operators to wire in fail2ban-style
+// automation or central reputation services.
+// ReportAbuse may be called concurrently, and should not block.
+type AbuseReporter interface {
+	ReportAbuse(report AbuseReport)
+}
+
+// AbuseReporterFunc implements AbuseReporter.
+type AbuseReporterFunc func(report AbuseReport)
+
+// ReportAbuse implements AbuseReporter.
+func (f AbuseReporterFunc) ReportAbuse(report AbuseReport) { f(report) }
+
+// reportAbuse notifies the abuse reporter of the server (if any).
+func (s *Server) reportAbuse(kind AbuseKind, rPK cipher.PubKey, rAddr net.Addr, detail string) {
+	s.log.
+		WithField("kind", kind).
+		WithField("remote_pk", rPK).
+		WithField("remote_addr", rAddr).
+		Warn("Detected abuse: ", detail)
+
+	if s.conf.AbuseReporter != nil {
+		s.conf.AbuseReporter.ReportAbuse(AbuseReport{
+			Kind:       kind,
+			RemotePK:   rPK,
+			RemoteAddr: rAddr,
+			Time:       time.Now(),
+			Detail:     detail,
+		})
+	}
+}
+
+// sessionGuard enforces the stream rate limit and quota of a server session.
+// A nil sessionGuard enforces nothing.
+type sessionGuard struct {
+	limiter    *rateLimiter // nil for no rate limit
+	maxStreams int32        // 0 for no quota
+	streams    int32
+	report     func(kind AbuseKind, detail string)
+}
+
+// acquire should be called before serving a stream. If nil is returned, release should be called once the stream
+// is served.
+func (g *sessionGuard) acquire() error {
+	if g == nil {
+		return nil
+	}
+	if g.limiter != nil && !g.limiter.allow() {
+		detail := fmt.Sprintf("stream requests exceed %v per second", g.limiter.rate)
+		g.report(AbuseStreamRate, detail)
+		return ErrReqRateLimited.Wrap(errors.New(detail))
+	}
+	if n := atomic.AddInt32(&g.streams, 1); g.maxStreams > 0 && n > g.maxStreams {
+		atomic.AddInt32(&g.streams, -1)
+		detail := fmt.Sprintf("concurrent streams exceed %d", g.maxStreams)
+		g.report(AbuseStreamQuota, detail)
+		return ErrReqQuotaExceeded.Wrap(errors.New(detail))
+	}
+	return nil
+}
+
+func (g *sessionGuard) release() {
+	if g != nil {
+		atomic.AddInt32(&g.streams, -1)
+	}
+}
+
+// rateLimiter is a token bucket with a burst equal to the rate.
+type rateLimiter struct {
+	rate   float64 // tokens per second
+	tokens float64
+	last   time.Time
+	mx     sync.Mutex
+}
+
+func newRateLimiter(rate int) *rateLimiter {
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+func (l *rateLimiter) allow() bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// handshakeTracker counts failed session handshakes per remote host within a fixed window.
+type handshakeTracker struct {
+	threshold int
+	window    time.Duration
+
+	fails map[string]*handshakeFails
+	sweep time.Time // last time expired entries were removed
+	mx    sync.Mutex
+}
+
+type handshakeFails struct {
+	n     int
+	start time.Time
+}
+
+func newHandshakeTracker(threshold int, window time.Duration) *handshakeTracker {
+	return &handshakeTracker{
+		threshold: threshold,
+		window:    window,
+		fails:     make(map[string]*handshakeFails),
+		sweep:     time.Now(),
+	}
+}
+
+// fail records a failed handshake from the given address. It returns true once per window when the number of failed
+// handshakes from the host reaches the threshold.
+func (t *handshakeTracker) fail(addr net.Addr) bool {
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.sweep) > t.window {
+		for k, f := range t.fails {
+			if now.Sub(f.start) > t.window {
+				delete(t.fails, k)
+			}
+		}
+		t.sweep = now
+	}
+
+	f, ok := t.fails[host]
+	if !ok || now.Sub(f.start) > t.window {
+		f = &handshakeFails{start: now}
+		t.fails[host] = f
+	}
+	f.n++
+	return f.n == t.threshold
+}
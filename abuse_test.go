@@ -0,0 +1,106 @@
+package dmsg
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(3)
+	for i := 0; i < 3; i++ {
+		require.True(t, l.allow())
+	}
+	require.False(t, l.allow())
+
+	l.last = l.last.Add(-time.Second)
+	require.True(t, l.allow())
+}
+
+func TestSessionGuard(t *testing.T) {
+	var kinds []AbuseKind
+	g := &sessionGuard{
+		maxStreams: 2,
+		report:     func(kind AbuseKind, _ string) { kinds = append(kinds, kind) },
+	}
+	require.NoError(t, g.acquire())
+	require.NoError(t, g.acquire())
+	err := g.acquire()
+	require.True(t, errors.Is(err, ErrReqQuotaExceeded))
+	require.Equal(t, "concurrent streams exceed 2", rejectionReason(err))
+	g.release()
+	require.NoError(t, g.acquire())
+
+	g.limiter = newRateLimiter(1)
+	g.release()
+	require.NoError(t, g.acquire())
+	require.True(t, errors.Is(g.acquire(), ErrReqRateLimited))
+	require.Equal(t, []AbuseKind{AbuseStreamQuota, AbuseStreamRate}, kinds)
+
+	// A nil guard enforces nothing.
+	var nilG *sessionGuard
+	require.NoError(t, nilG.acquire())
+	nilG.release()
+}
+
+func TestHandshakeTracker(t *testing.T) {
+	tr := newHandshakeTracker(3, time.Minute)
+	addr1 := &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1000}
+	addr2 := &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 2000} // same host as addr1
+	addr3 := &net.TCPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 1000}
+
+	require.False(t, tr.fail(addr1))
+	require.False(t, tr.fail(addr3))
+	require.False(t, tr.fail(addr2))
+	require.True(t, tr.fail(addr1))
+	require.False(t, tr.fail(addr1)) // only reported once per window
+
+	// A new window starts once the previous expires.
+	tr.fails["1.2.3.4"].start = time.Now().Add(-2 * time.Minute)
+	require.False(t, tr.fail(addr1))
+}
+
+func TestServer_admitConn(t *testing.T) {
+	pk, sk := GenKeyPair(t, "server")
+	srv := NewServerWithConfig(pk, sk, disc.NewMock(), &ServerConfig{MaxPendingHandshakes: 2})
+
+	conns := make([]net.Conn, 3)
+	for i := range conns {
+		conns[i], _ = net.Pipe()
+	}
+	require.True(t, srv.admitConn(conns[0]))
+	require.True(t, srv.admitConn(conns[1]))
+	require.False(t, srv.admitConn(conns[2]))
+
+	// Once a handshake is done, another connection is admitted.
+	atomic.AddInt32(&srv.pendingHS, -1)
+	require.True(t, srv.admitConn(conns[2]))
+}
+
+func TestServer_handshakeSession(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	pk, sk := GenKeyPair(t, "server")
+	srv := NewServerWithConfig(pk, sk, disc.NewMock(), &ServerConfig{
+		MaxPendingHandshakes:    1,
+		SessionHandshakeTimeout: timeout,
+	})
+
+	// The remote never writes its handshake, so the handshake fails once the timeout passes.
+	conn, rConn := net.Pipe()
+	defer func() { require.NoError(t, rConn.Close()) }()
+	require.True(t, srv.admitConn(conn))
+	start := time.Now()
+	_, err := srv.handshakeSession(conn)
+	require.Error(t, err)
+	require.True(t, time.Since(start) < DefaultSessionHandshakeTimeout)
+
+	// The pending handshake is released.
+	require.Zero(t, atomic.LoadInt32(&srv.pendingHS))
+}
@@ -0,0 +1,111 @@
+// Package agent implements the dmsg agent, which holds the keypair and sessions of a dmsg client and lets local
+// processes open dmsg streams through it via a unix socket (similar to ssh-agent with connection sharing).
+//
+// Each connection to the agent's socket starts with a request, which is answered with a response. Messages are JSON
+// objects, each prefixed with its length (as a big-endian uint16). Once a stream is established, the connection
+// carries the payload of the stream:
+//   - OpDial dials a stream to a remote client.
+//   - OpListen listens on a dmsg port. The agent then writes a response for each accepted stream, which carries the
+//     ID of the stream.
+//   - OpAccept picks up the accepted stream of the given ID.
+package agent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+
+	"github.com/SkycoinProject/dmsg"
+)
+
+// DefaultSocket is the default path of the agent's socket.
+const DefaultSocket = "/tmp/dmsg-agent.sock"
+
+// Operations of requests.
+const (
+	OpDial   = "dial"
+	OpListen = "listen"
+	OpAccept = "accept"
+)
+
+// maxMsgSize is the maximum size of an encoded message.
+const maxMsgSize = 1<<16 - 1
+
+// Errors of the agent.
+var (
+	ErrUnknownOp       = errors.New("unknown agent operation")
+	ErrNoPendingStream = errors.New("no pending stream of the given ID")
+	ErrSocketInUse     = errors.New("agent socket is already served by another process")
+)
+
+// Request is the first message of a connection to the agent.
+type Request struct {
+	Op   string    `json:"op"`
+	Addr dmsg.Addr `json:"addr,omitempty"` // remote address (OpDial)
+	Port uint16    `json:"port,omitempty"` // local port (OpListen)
+	ID   uint64    `json:"id,omitempty"`   // ID of the accepted stream (OpAccept)
+}
+
+// Response answers a request. For OpListen, a response is also written for each accepted stream.
+type Response struct {
+	Error  string    `json:"error,omitempty"`
+	ID     uint64    `json:"id,omitempty"` // ID of an accepted stream (OpListen)
+	Local  dmsg.Addr `json:"local"`
+	Remote dmsg.Addr `json:"remote"`
+}
+
+func (r Response) err() error {
+	if r.Error == "" {
+		return nil
+	}
+	return errors.New(r.Error)
+}
+
+func writeMsg(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxMsgSize {
+		return errors.New("agent message is too large")
+	}
+	msg := make([]byte, 2, 2+len(b))
+	binary.BigEndian.PutUint16(msg, uint16(len(b)))
+	_, err = w.Write(append(msg, b...))
+	return err
+}
+
+func readMsg(r io.Reader, v interface{}) error {
+	lb := make([]byte, 2)
+	if _, err := io.ReadFull(r, lb); err != nil {
+		return err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(lb))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Listen listens on the unix socket of the given path, which is only accessible by the owner.
+// The socket of a previous run is removed, unless it is still served.
+func Listen(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close() //nolint:errcheck
+		return nil, ErrSocketInUse
+	}
+	_ = os.Remove(path) //nolint:errcheck
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = lis.Close() //nolint:errcheck
+		return nil, err
+	}
+	return lis, nil
+}
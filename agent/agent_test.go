@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+func TestAgent(t *testing.T) {
+	const port = uint16(80)
+
+	// Prepare dmsg env.
+	env := dmsgtest.NewEnv(t, dmsgtest.DefaultTimeout)
+	require.NoError(t, env.Startup(1, 2, nil))
+	defer env.Shutdown()
+
+	dcA := env.AllClients()[0]
+	dcB := env.AllClients()[1]
+
+	// Serve agent of client A.
+	dir, err := ioutil.TempDir("", "dmsg_agent")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	socket := filepath.Join(dir, "agent.sock")
+	lis, err := Listen(socket)
+	require.NoError(t, err)
+	defer func() { _ = lis.Close() }() //nolint:errcheck
+
+	go func() { _ = New(dcA, logging.MustGetLogger("agent")).Serve(lis) }() //nolint:errcheck
+
+	// The socket is not taken over while it is served.
+	_, err = Listen(socket)
+	require.Equal(t, ErrSocketInUse, err)
+
+	c := NewClient(socket)
+
+	t.Run("dial", func(t *testing.T) {
+		lisB, err := dcB.Listen(port)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, lisB.Close()) }()
+
+		conn, err := c.Dial(context.TODO(), dmsg.Addr{PK: dcB.LocalPK(), Port: port})
+		require.NoError(t, err)
+		require.Equal(t, dcB.LocalPK(), conn.RemoteAddr().(dmsg.Addr).PK)
+
+		connB, err := lisB.Accept()
+		require.NoError(t, err)
+		checkPipe(t, conn, connB)
+	})
+
+	t.Run("listen", func(t *testing.T) {
+		lisA, err := c.Listen(port)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, lisA.Close()) }()
+
+		connB, err := dcB.Dial(context.TODO(), dmsg.Addr{PK: dcA.LocalPK(), Port: port})
+		require.NoError(t, err)
+
+		conn, err := lisA.Accept()
+		require.NoError(t, err)
+		require.Equal(t, dcB.LocalPK(), conn.RemoteAddr().(dmsg.Addr).PK)
+		checkPipe(t, connB, conn)
+	})
+
+	t.Run("dial_failure", func(t *testing.T) {
+		_, err := c.Dial(context.TODO(), dmsg.Addr{PK: dcB.LocalPK(), Port: port + 1})
+		require.Error(t, err)
+	})
+}
+
+// checkPipe writes to c1 and reads from c2, and closes both.
+func checkPipe(t *testing.T, c1, c2 io.ReadWriteCloser) {
+	msg := []byte("hello world")
+	_, err := c1.Write(msg)
+	require.NoError(t, err)
+
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(c2, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+
+	require.NoError(t, c1.Close())
+	require.NoError(t, c2.Close())
+}
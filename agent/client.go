@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/netutil"
+)
+
+// Client opens dmsg streams via a dmsg agent.
+type Client struct {
+	socket string
+}
+
+// NewClient creates a client of the agent which serves the unix socket of the given path.
+func NewClient(socket string) *Client {
+	return &Client{socket: socket}
+}
+
+// Dial dials a stream to the remote client of the given address via the agent.
+func (c *Client) Dial(ctx context.Context, addr dmsg.Addr) (net.Conn, error) {
+	return c.request(ctx, Request{Op: OpDial, Addr: addr})
+}
+
+// Listen listens on the given dmsg port via the agent. The port is released once the listener is closed.
+func (c *Client) Listen(port uint16) (net.Listener, error) {
+	ctrl, err := net.Dial("unix", c.socket)
+	if err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := c.exchange(context.Background(), ctrl, Request{Op: OpListen, Port: port}, &resp); err != nil {
+		_ = ctrl.Close() //nolint:errcheck
+		return nil, err
+	}
+	return &listener{c: c, ctrl: ctrl, addr: resp.Local}, nil
+}
+
+// request opens a connection to the agent which carries a stream once the request succeeds.
+func (c *Client) request(ctx context.Context, req Request) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := c.exchange(ctx, conn, req, &resp); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return nil, err
+	}
+	return &streamConn{Conn: conn, lAddr: resp.Local, rAddr: resp.Remote}, nil
+}
+
+// exchange writes the request and reads the response, within the deadline of the context (if any).
+func (c *Client) exchange(ctx context.Context, conn net.Conn, req Request, resp *Response) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	if err := writeMsg(conn, req); err != nil {
+		return err
+	}
+	if err := readMsg(conn, resp); err != nil {
+		return err
+	}
+	if err := resp.err(); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
+// listener implements net.Listener for a dmsg port which is listened on via the agent.
+type listener struct {
+	c    *Client
+	ctrl net.Conn // receives a response for each accepted stream
+	addr dmsg.Addr
+	mx   sync.Mutex
+}
+
+// Accept implements net.Listener
+func (l *listener) Accept() (net.Conn, error) {
+	l.mx.Lock()
+	var resp Response
+	err := readMsg(l.ctrl, &resp)
+	l.mx.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return l.c.request(context.Background(), Request{Op: OpAccept, ID: resp.ID})
+}
+
+// Close implements net.Listener
+func (l *listener) Close() error {
+	return l.ctrl.Close()
+}
+
+// Addr implements net.Listener
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+// streamConn is a connection to the agent which carries a stream.
+type streamConn struct {
+	net.Conn
+	lAddr dmsg.Addr
+	rAddr dmsg.Addr
+}
+
+// LocalAddr implements net.Conn
+func (c *streamConn) LocalAddr() net.Addr {
+	return c.lAddr
+}
+
+// RemoteAddr implements net.Conn
+func (c *streamConn) RemoteAddr() net.Addr {
+	return c.rAddr
+}
+
+// CloseWrite closes the write side of the stream, so that the remote reads io.EOF.
+func (c *streamConn) CloseWrite() error {
+	if cw, ok := c.Conn.(netutil.CloseWriter); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/netutil"
+)
+
+// PendingTimeout is the duration after which an accepted stream which is not picked up (with OpAccept) is closed.
+var PendingTimeout = dmsg.HandshakeTimeout
+
+// Agent shares the sessions of a dmsg client with local processes.
+type Agent struct {
+	c   *dmsg.Client
+	log logrus.FieldLogger
+
+	pending map[uint64]*dmsg.Stream // accepted streams which are yet to be picked up
+	nextID  uint64
+	mx      sync.Mutex
+}
+
+// New creates an agent of the given dmsg client.
+func New(c *dmsg.Client, log logrus.FieldLogger) *Agent {
+	return &Agent{
+		c:       c,
+		log:     log,
+		pending: make(map[uint64]*dmsg.Stream),
+	}
+}
+
+// Serve serves local processes on the listener (see Listen), until the listener is closed.
+func (a *Agent) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go a.handle(conn)
+	}
+}
+
+func (a *Agent) handle(conn net.Conn) {
+	var req Request
+	if err := readMsg(conn, &req); err != nil {
+		a.log.WithError(err).Debug("Failed to read request.")
+		_ = conn.Close() //nolint:errcheck
+		return
+	}
+	log := a.log.WithField("op", req.Op)
+
+	var err error
+	switch req.Op {
+	case OpDial:
+		err = a.serveDial(conn, req.Addr)
+	case OpListen:
+		err = a.serveListen(conn, req.Port)
+	case OpAccept:
+		err = a.serveAccept(conn, req.ID)
+	default:
+		err = ErrUnknownOp
+		_ = writeMsg(conn, Response{Error: err.Error()}) //nolint:errcheck
+	}
+	log.WithError(err).Debug("Served connection.")
+	_ = conn.Close() //nolint:errcheck
+}
+
+func (a *Agent) serveDial(conn net.Conn, addr dmsg.Addr) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dmsg.HandshakeTimeout)
+	defer cancel()
+
+	str, err := a.c.DialStream(ctx, addr)
+	if err != nil {
+		_ = writeMsg(conn, Response{Error: err.Error()}) //nolint:errcheck
+		return err
+	}
+	return a.serveStream(conn, str, Response{})
+}
+
+func (a *Agent) serveListen(conn net.Conn, port uint16) error {
+	lis, err := a.c.Listen(port)
+	if err != nil {
+		_ = writeMsg(conn, Response{Error: err.Error()}) //nolint:errcheck
+		return err
+	}
+	defer func() { _ = lis.Close() }() //nolint:errcheck
+
+	if err := writeMsg(conn, Response{Local: lis.DmsgAddr()}); err != nil {
+		return err
+	}
+
+	// The listener is closed once the process closes the connection.
+	go func() {
+		_, _ = conn.Read(make([]byte, 1)) //nolint:errcheck
+		_ = lis.Close()                   //nolint:errcheck
+	}()
+
+	for {
+		str, err := lis.AcceptStream()
+		if err != nil {
+			return err
+		}
+		id := a.addPending(str)
+		resp := Response{ID: id, Local: str.RawLocalAddr(), Remote: str.RawRemoteAddr()}
+		if err := writeMsg(conn, resp); err != nil {
+			a.closePending(id)
+			return err
+		}
+	}
+}
+
+func (a *Agent) serveAccept(conn net.Conn, id uint64) error {
+	a.mx.Lock()
+	str, ok := a.pending[id]
+	delete(a.pending, id)
+	a.mx.Unlock()
+
+	if !ok {
+		_ = writeMsg(conn, Response{Error: ErrNoPendingStream.Error()}) //nolint:errcheck
+		return ErrNoPendingStream
+	}
+	return a.serveStream(conn, str, Response{ID: id})
+}
+
+// serveStream writes the response of the established stream, and then relays between the connection and the stream.
+func (a *Agent) serveStream(conn net.Conn, str *dmsg.Stream, resp Response) error {
+	resp.Local, resp.Remote = str.RawLocalAddr(), str.RawRemoteAddr()
+	if err := writeMsg(conn, resp); err != nil {
+		_ = str.Close() //nolint:errcheck
+		return err
+	}
+	return netutil.CopyReadWriteCloser(conn, str)
+}
+
+// addPending records an accepted stream until it is picked up, or until PendingTimeout.
+func (a *Agent) addPending(str *dmsg.Stream) uint64 {
+	a.mx.Lock()
+	a.nextID++
+	id := a.nextID
+	a.pending[id] = str
+	a.mx.Unlock()
+
+	time.AfterFunc(PendingTimeout, func() { a.closePending(id) })
+	return id
+}
+
+func (a *Agent) closePending(id uint64) {
+	a.mx.Lock()
+	str, ok := a.pending[id]
+	delete(a.pending, id)
+	a.mx.Unlock()
+
+	if ok {
+		a.log.WithError(str.Close()).WithField("id", id).Debug("Closed stream which was not picked up.")
+	}
+}
@@ -0,0 +1,319 @@
+package dmsg
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// Audit log events.
+const (
+	AuditSessionStart = "session_start"
+	AuditSessionEnd   = "session_end"
+)
+
+const (
+	// DefaultAuditLogMaxSize is the default size (in bytes) after which an audit log file is rotated.
+	DefaultAuditLogMaxSize = 64 << 20
+
+	auditFilePrefix = "audit-"
+	auditFileSuffix = ".log"
+)
+
+// AuditRecord is a record of the audit log of a dmsg server.
+// Each record contains the hash of the previous record, so that removing or altering records breaks the hash chain.
+// Records are also signed by the dmsg server.
+type AuditRecord struct {
+	Seq        uint64        `json:"seq"`
+	Time       int64         `json:"time"` // unix nano
+	Event      string        `json:"event"`
+	RemotePK   cipher.PubKey `json:"remote_pk"`
+	RemoteAddr string        `json:"remote_addr,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`  // session duration (only for session_end)
+	BytesIn    uint64        `json:"bytes_in,omitempty"`  // bytes read from the remote (only for session_end)
+	BytesOut   uint64        `json:"bytes_out,omitempty"` // bytes written to the remote (only for session_end)
+	PrevHash   string        `json:"prev_hash"`
+	Hash       string        `json:"hash"`
+	Sig        cipher.Sig    `json:"sig"`
+}
+
+// equalHex compares hex-encoded hashes in constant time.
+func equalHex(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// computeHash returns the hash of the record (excluding the hash and signature fields).
+func (r AuditRecord) computeHash() (string, error) {
+	r.Hash, r.Sig = "", cipher.Sig{}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditLog is an append-only, hash-chained log of session establishment and teardown of a dmsg server.
+// Records are written as JSON lines to files within a directory. Files are rotated once they exceed a maximum size,
+// and the hash chain continues across files.
+type AuditLog struct {
+	dir     string
+	sk      cipher.SecKey
+	maxSize int64
+
+	f    *os.File
+	size int64
+	seq  uint64
+	prev string // hash of the previous record
+	mx   sync.Mutex
+}
+
+// OpenAuditLog opens the audit log within the given directory. Records are signed with 'sk'.
+// If the directory already contains an audit log, the hash chain is continued in a new file.
+// If 'maxSize' is 0, DefaultAuditLogMaxSize is used.
+func OpenAuditLog(dir string, sk cipher.SecKey, maxSize int64) (*AuditLog, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultAuditLogMaxSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	l := &AuditLog{dir: dir, sk: sk, maxSize: maxSize}
+
+	files, err := auditFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		last, err := lastAuditRecord(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.seq, l.prev = last.Seq+1, last.Hash
+			break
+		}
+	}
+	if err := l.rotate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append appends a record to the audit log. The sequence, hashes and signature of the record are set here.
+// The time is set if it is not already set.
+func (l *AuditLog) Append(r AuditRecord) error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.f == nil {
+		return ErrAuditLogClosed
+	}
+	if l.size >= l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if r.Time == 0 {
+		r.Time = time.Now().UnixNano()
+	}
+	r.Seq, r.PrevHash = l.seq, l.prev
+
+	hash, err := r.computeHash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	if r.Sig, err = cipher.SignPayload([]byte(hash), l.sk); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	n, err := l.f.Write(append(b, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	l.seq, l.prev = r.Seq+1, r.Hash
+	return nil
+}
+
+// Export writes all records of the audit log (across rotated files) to 'w' in order, as JSON lines.
+func (l *AuditLog) Export(w io.Writer) error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	return ExportAuditLog(l.dir, w)
+}
+
+// Close closes the audit log.
+func (l *AuditLog) Close() error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// rotate closes the current file (if any) and starts a new one.
+func (l *AuditLog) rotate() error {
+	if l.f != nil {
+		if err := l.f.Close(); err != nil {
+			return err
+		}
+	}
+	name := fmt.Sprintf("%s%020d%s", auditFilePrefix, time.Now().UnixNano(), auditFileSuffix)
+	f, err := os.OpenFile(filepath.Join(l.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	l.f, l.size = f, 0
+	return nil
+}
+
+// ExportAuditLog writes all records of the audit log within the given directory to 'w' in order, as JSON lines.
+func ExportAuditLog(dir string, w io.Writer) error {
+	files, err := auditFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		b, err := ioutil.ReadFile(name) //nolint:gosec
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyAuditLog verifies the hash chain of exported audit records. If 'pk' is not null, the signatures of the
+// records are also verified. It returns the number of verified records.
+func VerifyAuditLog(r io.Reader, pk cipher.PubKey) (int, error) {
+	dec := json.NewDecoder(r)
+	var prev *AuditRecord
+	n := 0
+	for {
+		var rec AuditRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+
+		hash, err := rec.computeHash()
+		if err != nil {
+			return n, err
+		}
+		if !equalHex(hash, rec.Hash) {
+			return n, ErrAuditRecordInvalidHash
+		}
+		if prev != nil && (rec.Seq != prev.Seq+1 || !equalHex(rec.PrevHash, prev.Hash)) {
+			return n, ErrAuditChainBroken
+		}
+		if !pk.Null() {
+			if err := cipher.VerifyPubKeySignedPayload(pk, rec.Sig, []byte(rec.Hash)); err != nil {
+				return n, ErrAuditRecordInvalidSig
+			}
+		}
+		prev = &rec
+		n++
+	}
+}
+
+// auditFiles returns the audit log files within the directory, in order.
+func auditFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, info := range infos {
+		name := info.Name()
+		if !info.IsDir() && strings.HasPrefix(name, auditFilePrefix) && strings.HasSuffix(name, auditFileSuffix) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// lastAuditRecord returns the last complete record of the given file (or nil if there are none).
+// A partially written last line (such as from a crash) is ignored.
+func lastAuditRecord(name string) (*AuditRecord, error) {
+	f, err := os.Open(name) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() //nolint:errcheck
+
+	var last *AuditRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 4096), 1<<20)
+	for sc.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			break
+		}
+		last = &rec
+	}
+	return last, sc.Err()
+}
+
+// countingConn counts the bytes read from and written to a net.Conn.
+// If set, totalIn and totalOut are also incremented (such as to count the bytes of all sessions of a server).
+type countingConn struct {
+	net.Conn
+	in  uint64
+	out uint64
+
+	totalIn  *uint64
+	totalOut *uint64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddUint64(&c.in, uint64(n))
+	if c.totalIn != nil {
+		atomic.AddUint64(c.totalIn, uint64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddUint64(&c.out, uint64(n))
+	if c.totalOut != nil {
+		atomic.AddUint64(c.totalOut, uint64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) counts() (in, out uint64) {
+	return atomic.LoadUint64(&c.in), atomic.LoadUint64(&c.out)
+}
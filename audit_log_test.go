@@ -0,0 +1,72 @@
+package dmsg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmsg_audit")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	pk, sk := cipher.GenerateKeyPair()
+	rPK, _ := cipher.GenerateKeyPair()
+
+	appendN := func(l *AuditLog, n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, l.Append(AuditRecord{Event: AuditSessionStart, RemotePK: rPK}))
+		}
+	}
+
+	// Small max size results in rotation.
+	l, err := OpenAuditLog(dir, sk, 512)
+	require.NoError(t, err)
+	appendN(l, 5)
+	require.NoError(t, l.Close())
+	assert.Equal(t, ErrAuditLogClosed, l.Append(AuditRecord{}))
+
+	// Re-opening continues the hash chain.
+	l, err = OpenAuditLog(dir, sk, 512)
+	require.NoError(t, err)
+	appendN(l, 3)
+	require.NoError(t, l.Close())
+
+	files, err := auditFiles(dir)
+	require.NoError(t, err)
+	assert.True(t, len(files) > 2)
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportAuditLog(dir, &buf))
+	exported := buf.String()
+
+	n, err := VerifyAuditLog(strings.NewReader(exported), pk)
+	require.NoError(t, err)
+	assert.Equal(t, 8, n)
+
+	t.Run("wrong_pk", func(t *testing.T) {
+		_, err := VerifyAuditLog(strings.NewReader(exported), rPK)
+		assert.Equal(t, ErrAuditRecordInvalidSig, err)
+	})
+
+	t.Run("altered_record", func(t *testing.T) {
+		altered := strings.Replace(exported, AuditSessionStart, AuditSessionEnd, 1)
+		_, err := VerifyAuditLog(strings.NewReader(altered), pk)
+		assert.Equal(t, ErrAuditRecordInvalidHash, err)
+	})
+
+	t.Run("removed_record", func(t *testing.T) {
+		lines := strings.SplitAfter(exported, "\n")
+		removed := strings.Join(append(lines[:2:2], lines[3:]...), "")
+		_, err := VerifyAuditLog(strings.NewReader(removed), pk)
+		assert.Equal(t, ErrAuditChainBroken, err)
+	})
+}
@@ -0,0 +1,221 @@
+package dmsg
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// DefaultBandwidthReportHistory is the number of most recent bandwidth reports which are retained by a dmsg server.
+const DefaultBandwidthReportHistory = 48
+
+// BandwidthUsage is the bandwidth which a dmsg server relayed for a client within the period of a BandwidthReport.
+type BandwidthUsage struct {
+	ClientPK cipher.PubKey `json:"client_pk"`
+	BytesIn  uint64        `json:"bytes_in"`  // bytes read from the client's sessions
+	BytesOut uint64        `json:"bytes_out"` // bytes written to the client's sessions
+	Sessions int           `json:"sessions"`  // sessions of the client which were served within the period
+}
+
+// BandwidthReport is a summary of the bandwidth which a dmsg server relayed for each of its clients within a period.
+// Reports are signed by the dmsg server, so that they can be submitted to third parties (such as reward systems which
+// pay operators of dmsg servers for the capacity that they donate) as proof of the server's claims.
+type BandwidthReport struct {
+	ServerPK cipher.PubKey    `json:"server_pk"`
+	Seq      uint64           `json:"seq"`   // sequence of the report (since the server started)
+	Start    int64            `json:"start"` // start of the period (unix nano)
+	End      int64            `json:"end"`   // end of the period (unix nano)
+	Clients  []BandwidthUsage `json:"clients"`
+	Sig      cipher.Sig       `json:"sig"`
+}
+
+// payload returns the signed payload of the report (excluding the signature).
+func (r BandwidthReport) payload() ([]byte, error) {
+	r.Sig = cipher.Sig{}
+	return json.Marshal(r)
+}
+
+// Sign signs the report with the secret key of the server.
+func (r *BandwidthReport) Sign(sk cipher.SecKey) error {
+	b, err := r.payload()
+	if err != nil {
+		return err
+	}
+	r.Sig, err = cipher.SignPayload(b, sk)
+	return err
+}
+
+// Verify verifies the signature of the report against the public key of the server.
+func (r *BandwidthReport) Verify() error {
+	b, err := r.payload()
+	if err != nil {
+		return err
+	}
+	if err := cipher.VerifyPubKeySignedPayload(r.ServerPK, r.Sig, b); err != nil {
+		return ErrBandwidthReportInvalidSig
+	}
+	return nil
+}
+
+// BandwidthReporter is notified by a dmsg server of each bandwidth report (such as to submit it to a reward system).
+// ReportBandwidth should not block.
+type BandwidthReporter interface {
+	ReportBandwidth(report *BandwidthReport)
+}
+
+// BandwidthReporterFunc implements BandwidthReporter.
+type BandwidthReporterFunc func(report *BandwidthReport)
+
+// ReportBandwidth implements BandwidthReporter.
+func (f BandwidthReporterFunc) ReportBandwidth(report *BandwidthReport) { f(report) }
+
+// trackedConn is a session connection whose bytes are accounted to a client.
+type trackedConn struct {
+	pk      cipher.PubKey
+	in, out uint64 // bytes of the connection which are already accounted
+}
+
+// bandwidthLedger accounts the bytes of session connections to clients, and summarizes them into reports.
+type bandwidthLedger struct {
+	start   time.Time
+	seq     uint64
+	usage   map[cipher.PubKey]*BandwidthUsage
+	live    map[*countingConn]*trackedConn
+	reports []*BandwidthReport // most recent first
+	history int
+	mx      sync.Mutex
+}
+
+func newBandwidthLedger(start time.Time, history int) *bandwidthLedger {
+	return &bandwidthLedger{
+		start:   start,
+		usage:   make(map[cipher.PubKey]*BandwidthUsage),
+		live:    make(map[*countingConn]*trackedConn),
+		history: history,
+	}
+}
+
+// track starts accounting the bytes of the session connection to the client.
+// It is a no-op if the ledger is nil (bandwidth accounting is disabled).
+func (l *bandwidthLedger) track(pk cipher.PubKey, conn *countingConn) {
+	if l == nil {
+		return
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	in, out := conn.counts()
+	l.live[conn] = &trackedConn{pk: pk, in: in, out: out}
+	l.usageLocked(pk).Sessions++
+}
+
+// untrack accounts the remaining bytes of the session connection, and stops tracking it.
+func (l *bandwidthLedger) untrack(conn *countingConn) {
+	if l == nil {
+		return
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if tc, ok := l.live[conn]; ok {
+		l.collectLocked(conn, tc)
+		delete(l.live, conn)
+	}
+}
+
+func (l *bandwidthLedger) usageLocked(pk cipher.PubKey) *BandwidthUsage {
+	u, ok := l.usage[pk]
+	if !ok {
+		u = &BandwidthUsage{ClientPK: pk}
+		l.usage[pk] = u
+	}
+	return u
+}
+
+// collectLocked accounts the bytes of the connection since they were last accounted.
+func (l *bandwidthLedger) collectLocked(conn *countingConn, tc *trackedConn) {
+	in, out := conn.counts()
+	u := l.usageLocked(tc.pk)
+	u.BytesIn += in - tc.in
+	u.BytesOut += out - tc.out
+	tc.in, tc.out = in, out
+}
+
+// report summarizes the usage since the previous report into a signed report, which is retained, and starts the next
+// period. Sessions which are still served are counted in the next period as well.
+func (l *bandwidthLedger) report(pk cipher.PubKey, sk cipher.SecKey, end time.Time) (*BandwidthReport, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	for conn, tc := range l.live {
+		l.collectLocked(conn, tc)
+	}
+	r := &BandwidthReport{
+		ServerPK: pk,
+		Seq:      l.seq,
+		Start:    l.start.UnixNano(),
+		End:      end.UnixNano(),
+		Clients:  make([]BandwidthUsage, 0, len(l.usage)),
+	}
+	for _, u := range l.usage {
+		r.Clients = append(r.Clients, *u)
+	}
+	sort.Slice(r.Clients, func(i, j int) bool { return r.Clients[i].ClientPK.Hex() < r.Clients[j].ClientPK.Hex() })
+	if err := r.Sign(sk); err != nil {
+		return nil, err
+	}
+
+	l.seq++
+	l.start = end
+	l.usage = make(map[cipher.PubKey]*BandwidthUsage)
+	for _, tc := range l.live {
+		l.usageLocked(tc.pk).Sessions++
+	}
+	l.reports = append([]*BandwidthReport{r}, l.reports...)
+	if len(l.reports) > l.history {
+		l.reports = l.reports[:l.history]
+	}
+	return r, nil
+}
+
+// retained returns the retained reports, most recent first.
+func (l *bandwidthLedger) retained() []*BandwidthReport {
+	if l == nil {
+		return nil
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return append([]*BandwidthReport(nil), l.reports...)
+}
+
+// BandwidthReports returns the retained bandwidth reports of the server (see BandwidthReportInterval of ServerConfig),
+// most recent first. It returns nil if bandwidth accounting is disabled.
+func (s *Server) BandwidthReports() []*BandwidthReport {
+	return s.bandwidth.retained()
+}
+
+// reportBandwidthPeriodically issues a bandwidth report every interval, until the server is closed.
+func (s *Server) reportBandwidthPeriodically(interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.Chan():
+			r, err := s.bandwidth.report(s.pk, s.sk, s.clock.Now())
+			if err != nil {
+				s.log.WithError(err).Error("Failed to issue bandwidth report.")
+				continue
+			}
+			s.log.WithField("seq", r.Seq).WithField("clients", len(r.Clients)).Debug("Issued bandwidth report.")
+			if s.conf.BandwidthReporter != nil {
+				s.conf.BandwidthReporter.ReportBandwidth(r)
+			}
+		}
+	}
+}
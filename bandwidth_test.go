@@ -0,0 +1,65 @@
+package dmsg
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestBandwidthLedger(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	cPK, _ := cipher.GenerateKeyPair()
+
+	// Data written to 'c1' is read from 'c2', which is the session connection of the client as seen by the server.
+	c1, c2 := net.Pipe()
+	defer func() { require.NoError(t, c1.Close()) }()
+	go func() { _, _ = ioutil.ReadAll(c1) }() //nolint:errcheck
+	conn := &countingConn{Conn: c2}
+
+	start := time.Unix(100, 0)
+	l := newBandwidthLedger(start, 2)
+	l.track(cPK, conn)
+
+	exchange := func(in, out int) {
+		go func() { _, _ = c1.Write(make([]byte, in)) }() //nolint:errcheck
+		_, err := conn.Read(make([]byte, in))
+		require.NoError(t, err)
+		_, err = conn.Write(make([]byte, out))
+		require.NoError(t, err)
+	}
+
+	exchange(10, 20)
+	r, err := l.report(pk, sk, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.NoError(t, r.Verify())
+	require.Equal(t, uint64(0), r.Seq)
+	require.Equal(t, start.UnixNano(), r.Start)
+	require.Equal(t, []BandwidthUsage{{ClientPK: cPK, BytesIn: 10, BytesOut: 20, Sessions: 1}}, r.Clients)
+
+	// Only the bytes since the previous report are accounted, including those of sessions which have ended.
+	exchange(5, 7)
+	l.untrack(conn)
+	r, err = l.report(pk, sk, start.Add(time.Minute*2))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), r.Seq)
+	require.Equal(t, []BandwidthUsage{{ClientPK: cPK, BytesIn: 5, BytesOut: 7, Sessions: 1}}, r.Clients)
+
+	r, err = l.report(pk, sk, start.Add(time.Minute*3))
+	require.NoError(t, err)
+	require.Empty(t, r.Clients)
+
+	// Reports are retained up to the history, most recent first.
+	reports := l.retained()
+	require.Len(t, reports, 2)
+	require.Equal(t, uint64(2), reports[0].Seq)
+
+	// Altered reports fail verification.
+	r = reports[1]
+	r.Clients[0].BytesOut++
+	require.Equal(t, ErrBandwidthReportInvalidSig, r.Verify())
+}
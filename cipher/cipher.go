@@ -4,9 +4,14 @@ package cipher
 
 import (
 	"bytes"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"math/big"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/SkycoinProject/skycoin/src/cipher"
 )
@@ -47,6 +52,11 @@ func (pk PubKey) Null() bool {
 	return cipher.PubKey(pk).Null()
 }
 
+// Equal returns true if the public keys are equal, in constant time.
+func (pk PubKey) Equal(other PubKey) bool {
+	return subtle.ConstantTimeCompare(pk[:], other[:]) == 1
+}
+
 // String implements fmt.Stringer for PubKey. Returns Hex representation.
 func (pk PubKey) String() string {
 	return pk.Hex()
@@ -145,7 +155,12 @@ func (sk SecKey) Hex() string {
 
 // Null returns true if SecKey is the null SecKey.
 func (sk SecKey) Null() bool {
-	return cipher.SecKey(sk).Null()
+	return sk.Equal(SecKey{})
+}
+
+// Equal returns true if the secret keys are equal, in constant time.
+func (sk SecKey) Equal(other SecKey) bool {
+	return subtle.ConstantTimeCompare(sk[:], other[:]) == 1
 }
 
 // String implements fmt.Stringer for SecKey. Returns Hex representation.
@@ -202,6 +217,18 @@ func (sk SecKey) PubKey() (PubKey, error) {
 	return PubKey(pk), err
 }
 
+// VerifyKeyPair returns an error if the public key is not that of the secret key.
+func VerifyKeyPair(pk PubKey, sk SecKey) error {
+	sPK, err := sk.PubKey()
+	if err != nil {
+		return err
+	}
+	if !sPK.Equal(pk) {
+		return errors.New("public key does not match secret key")
+	}
+	return nil
+}
+
 // Sig is a wrapper type for cipher.Sig that implements common golang interfaces.
 type Sig cipher.Sig
 
@@ -217,7 +244,12 @@ func (sig Sig) String() string {
 
 // Null returns true if Sig is a null Sig
 func (sig Sig) Null() bool {
-	return sig == Sig{}
+	return sig.Equal(Sig{})
+}
+
+// Equal returns true if the signatures are equal, in constant time.
+func (sig Sig) Equal(other Sig) bool {
+	return subtle.ConstantTimeCompare(sig[:], other[:]) == 1
 }
 
 // MarshalText implements encoding.TextMarshaler.
@@ -254,6 +286,11 @@ func RandByte(n int) []byte {
 // golang interfaces.
 type SHA256 cipher.SHA256
 
+// Equal returns true if the hashes are equal, in constant time.
+func (h SHA256) Equal(other SHA256) bool {
+	return subtle.ConstantTimeCompare(h[:], other[:]) == 1
+}
+
 // SHA256FromBytes converts []byte to SHA256
 func SHA256FromBytes(b []byte) (SHA256, error) {
 	h, err := cipher.SHA256FromBytes(b)
@@ -264,3 +301,48 @@ func SHA256FromBytes(b []byte) (SHA256, error) {
 func SumSHA256(b []byte) SHA256 {
 	return SHA256(cipher.SumSHA256(b))
 }
+
+// BatchError is returned by VerifyBatch for the first signature which fails verification.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+// Error implements error
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("signature %d: %v", e.Index, e.Err)
+}
+
+// VerifyBatch verifies that the SHA256 hash of each payload was signed by the public key of the same index.
+// ECDSA signatures of secp256k1 cannot be verified as a batch, so signatures are verified concurrently (on up to
+// GOMAXPROCS goroutines) instead. If any signature is invalid, a *BatchError of the lowest such index is returned.
+func VerifyBatch(pks []PubKey, sigs []Sig, payloads [][]byte) error {
+	if len(pks) != len(sigs) || len(pks) != len(payloads) {
+		return errors.New("batch has mismatching numbers of public keys, signatures and payloads")
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(pks) {
+		workers = len(pks)
+	}
+	errs := make([]error, len(pks))
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := int(atomic.AddInt64(&next, 1)); i < len(pks); i = int(atomic.AddInt64(&next, 1)) {
+				errs[i] = VerifyPubKeySignedPayload(pks[i], sigs[i], payloads[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return &BatchError{Index: i, Err: err}
+		}
+	}
+	return nil
+}
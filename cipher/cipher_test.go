@@ -79,6 +79,57 @@ func TestSecKeyBinaryMarshaller(t *testing.T) {
 	require.Equal(t, s, s2)
 }
 
+func TestVerifyKeyPair(t *testing.T) {
+	p, s := GenerateKeyPair()
+	require.NoError(t, VerifyKeyPair(p, s))
+
+	p2, _ := GenerateKeyPair()
+	require.Error(t, VerifyKeyPair(p2, s))
+}
+
+func TestVerifyBatch(t *testing.T) {
+	const n = 20
+	pks := make([]PubKey, n)
+	sigs := make([]Sig, n)
+	payloads := make([][]byte, n)
+	for i := range pks {
+		var sk SecKey
+		pks[i], sk = GenerateKeyPair()
+		payloads[i] = RandByte(32)
+		sig, err := SignPayload(payloads[i], sk)
+		require.NoError(t, err)
+		sigs[i] = sig
+	}
+	require.NoError(t, VerifyBatch(pks, sigs, payloads))
+	require.NoError(t, VerifyBatch(nil, nil, nil))
+	require.Error(t, VerifyBatch(pks, sigs[1:], payloads))
+
+	sigs[3], sigs[12] = sigs[12], sigs[3]
+	err := VerifyBatch(pks, sigs, payloads)
+	require.Error(t, err)
+	require.Equal(t, 3, err.(*BatchError).Index)
+}
+
+func TestEqual(t *testing.T) {
+	p1, s1 := GenerateKeyPair()
+	p2, s2 := GenerateKeyPair()
+	require.True(t, p1.Equal(p1))
+	require.False(t, p1.Equal(p2))
+	require.True(t, s1.Equal(s1))
+	require.False(t, s1.Equal(s2))
+	require.True(t, SecKey{}.Null())
+	require.False(t, s1.Null())
+
+	sig, err := SignPayload([]byte("payload"), s1)
+	require.NoError(t, err)
+	require.True(t, sig.Equal(sig))
+	require.False(t, sig.Equal(Sig{}))
+	require.True(t, Sig{}.Null())
+
+	require.True(t, SumSHA256([]byte("a")).Equal(SumSHA256([]byte("a"))))
+	require.False(t, SumSHA256([]byte("a")).Equal(SumSHA256([]byte("b"))))
+}
+
 func TestSigString(t *testing.T) {
 	_, sk := GenerateKeyPair()
 	sig, err := SignPayload([]byte("foo"), sk)
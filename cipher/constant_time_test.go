@@ -0,0 +1,85 @@
+package cipher
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// secretNames are the names of values (variables, fields and methods) which hold signatures, secret keys, hashes or
+// nonces, and so should only be compared in constant time (such as with the Equal methods of this package).
+var secretNames = map[string]bool{
+	"sig": true, "Sig": true, "Signature": true,
+	"sk": true, "SK": true, "SecKey": true,
+	"Hash": true, "ReqHash": true, "PrevHash": true,
+	"nonce": true, "Nonce": true,
+	"passphrase": true,
+}
+
+// TestNoSecretComparisons asserts that no values of secretNames are compared with '==' or '!=' (outside of tests),
+// except for checks of whether they are set.
+func TestNoSecretComparisons(t *testing.T) {
+	root := ".."
+	fset := token.NewFileSet()
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && (info.Name() == "vendor" || strings.HasPrefix(info.Name(), ".")) && path != root {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			if e, ok := n.(*ast.BinaryExpr); ok && (e.Op == token.EQL || e.Op == token.NEQ) {
+				if !isUnset(e.X) && !isUnset(e.Y) && (isSecret(e.X) || isSecret(e.Y)) {
+					t.Errorf("%s: secret compared with '%s' (use a constant-time comparison)", fset.Position(e.Pos()), e.Op)
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+// isUnset returns true for nil and the empty string.
+func isUnset(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name == "nil"
+	case *ast.BasicLit:
+		return e.Kind == token.STRING && (e.Value == `""` || e.Value == "``")
+	}
+	return false
+}
+
+func isSecret(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return secretNames[e.Name]
+	case *ast.SelectorExpr:
+		return secretNames[e.Sel.Name]
+	case *ast.CompositeLit:
+		return e.Type != nil && isSecret(e.Type)
+	case *ast.CallExpr:
+		if id, ok := e.Fun.(*ast.Ident); ok && id.Name == "string" && len(e.Args) == 1 {
+			return isSecret(e.Args[0]) // conversion
+		}
+		return isSecret(e.Fun) // such as req.Hash()
+	case *ast.ParenExpr:
+		return isSecret(e.X)
+	}
+	return false
+}
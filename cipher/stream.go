@@ -0,0 +1,209 @@
+package cipher
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// StreamKeySize is the size of keys of sealed streams (AES-256).
+	StreamKeySize = 32
+
+	// StreamChunkSize is the maximum size of the plaintext of each chunk of a sealed stream.
+	StreamChunkSize = 64 * 1024
+
+	streamPrefixSize = 7 // size of the random nonce prefix, which is written at the start of a sealed stream
+	streamLenSize    = 4 // size of the length prefix of each sealed chunk
+	streamLastBit    = 1 << 31
+)
+
+// Errors of sealed streams.
+var (
+	ErrStreamKeySize      = fmt.Errorf("stream key should be of %d bytes", StreamKeySize)
+	ErrStreamClosed       = errors.New("stream sealer is closed")
+	ErrStreamChunkInvalid = errors.New("sealed stream has an invalid chunk")
+)
+
+// Sealed streams consist of a random nonce prefix, followed by chunks of up to StreamChunkSize bytes of plaintext
+// which are each sealed with AES-256-GCM and prefixed with their length (as a big-endian uint32, of which the highest
+// bit marks the last chunk). The nonce of each chunk consists of the prefix, the index of the chunk (as a big-endian
+// uint32) and a byte which is 1 for the last chunk (and 0 otherwise). Chunks therefore cannot be reordered or marked
+// as last, and truncation of the stream is detected.
+
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != StreamKeySize {
+		return nil, ErrStreamKeySize
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type streamNonce [12]byte
+
+func (n *streamNonce) set(index uint32, last bool) []byte {
+	binary.BigEndian.PutUint32(n[streamPrefixSize:], index)
+	n[11] = 0
+	if last {
+		n[11] = 1
+	}
+	return n[:]
+}
+
+// StreamSealer encrypts a stream of data in chunks, so that large payloads are encrypted without being held in memory.
+// Close must be called to write the last chunk.
+type StreamSealer struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce streamNonce
+	index uint32
+	buf   []byte // plaintext of the pending chunk
+	out   []byte
+	done  bool
+}
+
+// NewStreamSealer returns a StreamSealer which writes the sealed stream to w. The random nonce prefix is written
+// immediately.
+func NewStreamSealer(w io.Writer, key []byte) (*StreamSealer, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	s := &StreamSealer{w: w, aead: aead, buf: make([]byte, 0, StreamChunkSize)}
+	if _, err := rand.Read(s.nonce[:streamPrefixSize]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(s.nonce[:streamPrefixSize]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write implements io.Writer
+func (s *StreamSealer) Write(p []byte) (int, error) {
+	if s.done {
+		return 0, ErrStreamClosed
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(s.buf) == StreamChunkSize {
+			if err := s.writeChunk(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(s.buf[len(s.buf):StreamChunkSize], p)
+		s.buf = s.buf[:len(s.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// Close writes the last chunk. It does not close the underlying writer.
+func (s *StreamSealer) Close() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	return s.writeChunk(true)
+}
+
+func (s *StreamSealer) writeChunk(last bool) error {
+	if s.index == ^uint32(0) && !last {
+		return errors.New("sealed stream exceeds the maximum number of chunks")
+	}
+	s.out = append(s.out[:0], make([]byte, streamLenSize)...)
+	s.out = s.aead.Seal(s.out, s.nonce.set(s.index, last), s.buf, nil)
+	size := uint32(len(s.out) - streamLenSize)
+	if last {
+		size |= streamLastBit
+	}
+	binary.BigEndian.PutUint32(s.out, size)
+	s.index++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(s.out)
+	return err
+}
+
+// StreamOpener decrypts a stream of data which is sealed by a StreamSealer. Read returns io.EOF once the last chunk is
+// read, and io.ErrUnexpectedEOF if the sealed stream is truncated.
+type StreamOpener struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	nonce streamNonce
+	index uint32
+	in    []byte
+	buf   []byte // unread plaintext of the current chunk
+	done  bool
+	err   error
+}
+
+// NewStreamOpener returns a StreamOpener which reads the sealed stream from r. The nonce prefix is read immediately.
+func NewStreamOpener(r io.Reader, key []byte) (*StreamOpener, error) {
+	aead, err := newStreamAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	o := &StreamOpener{r: r, aead: aead}
+	if _, err := io.ReadFull(r, o.nonce[:streamPrefixSize]); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Read implements io.Reader
+func (o *StreamOpener) Read(p []byte) (int, error) {
+	for len(o.buf) == 0 {
+		if o.err != nil {
+			return 0, o.err
+		}
+		if o.done {
+			return 0, io.EOF
+		}
+		o.err = o.readChunk()
+	}
+	n := copy(p, o.buf)
+	o.buf = o.buf[n:]
+	return n, nil
+}
+
+func (o *StreamOpener) readChunk() error {
+	var lb [streamLenSize]byte
+	if _, err := io.ReadFull(o.r, lb[:]); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(lb[:])
+	last := size&streamLastBit != 0
+	size &^= streamLastBit
+	if size < uint32(o.aead.Overhead()) || size > uint32(StreamChunkSize+o.aead.Overhead()) {
+		return ErrStreamChunkInvalid
+	}
+	if cap(o.in) < int(size) {
+		o.in = make([]byte, StreamChunkSize+o.aead.Overhead())
+	}
+	o.in = o.in[:size]
+	if _, err := io.ReadFull(o.r, o.in); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	plain, err := o.aead.Open(o.in[:0], o.nonce.set(o.index, last), o.in, nil)
+	if err != nil {
+		return ErrStreamChunkInvalid
+	}
+	o.done = last
+	o.index++
+	o.buf = plain
+	return nil
+}
@@ -0,0 +1,65 @@
+package cipher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamSealer(t *testing.T) {
+	key := make([]byte, StreamKeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	seal := func(t *testing.T, plain []byte) []byte {
+		var sealed bytes.Buffer
+		s, err := NewStreamSealer(&sealed, key)
+		require.NoError(t, err)
+		_, err = io.Copy(s, bytes.NewReader(plain))
+		require.NoError(t, err)
+		require.NoError(t, s.Close())
+		return sealed.Bytes()
+	}
+	open := func(sealed []byte) ([]byte, error) {
+		o, err := NewStreamOpener(bytes.NewReader(sealed), key)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadAll(o)
+	}
+
+	for _, size := range []int{0, 1, StreamChunkSize, StreamChunkSize*3 + 7} {
+		plain := make([]byte, size)
+		_, err := rand.Read(plain)
+		require.NoError(t, err)
+
+		got, err := open(seal(t, plain))
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(plain, got), size)
+	}
+
+	sealed := seal(t, make([]byte, StreamChunkSize*2))
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := open(sealed[:len(sealed)-(streamLenSize+16)]) // without the (empty) last chunk
+		require.Equal(t, io.ErrUnexpectedEOF, err)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := append([]byte(nil), sealed...)
+		tampered[len(tampered)/2] ^= 1
+		_, err := open(tampered)
+		require.Equal(t, ErrStreamChunkInvalid, err)
+	})
+
+	t.Run("marked_last", func(t *testing.T) {
+		tampered := append([]byte(nil), sealed...)
+		tampered[streamPrefixSize] |= 0x80 // first chunk marked as last
+		_, err := open(tampered)
+		require.Equal(t, ErrStreamChunkInvalid, err)
+	})
+}
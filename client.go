@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"time"
@@ -14,11 +15,123 @@ import (
 	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/SkycoinProject/dmsg/disc"
 	"github.com/SkycoinProject/dmsg/netutil"
+	"github.com/SkycoinProject/dmsg/noise"
 )
 
 // Config configures a dmsg client entity.
 type Config struct {
 	MinSessions int
+
+	// SessionHandshakeTimeout is the maximum duration allowed for establishing a session with a dmsg server.
+	// This includes dialing the underlying connection and the noise handshake.
+	SessionHandshakeTimeout time.Duration
+
+	// StreamHandshakeTimeout is the maximum duration allowed for the handshake of a dmsg stream.
+	StreamHandshakeTimeout time.Duration
+
+	// EntryUpdateInterval is the interval at which the client re-announces its entry in dmsg discovery (optional).
+	// A value of 0 (the default) results in the entry only being announced when the client's sessions change, or when
+	// (*Client).UpdateEntryNow is called.
+	EntryUpdateInterval time.Duration
+
+	// PoWDifficulty is the proof-of-work difficulty required by dmsg discovery for entry registration.
+	// A value of 0 results in entries being registered without a proof-of-work.
+	PoWDifficulty int
+
+	// TrustedOperator, if set, restricts the client to establishing sessions with servers of ServerList, which must
+	// be signed by the operator. This allows private dmsg networks to use public dmsg discovery.
+	TrustedOperator cipher.PubKey
+
+	// ServerList is the signed list of approved servers (see disc.FetchServerList).
+	// It is only used if TrustedOperator is set. If it is missing or invalid, no server is trusted.
+	ServerList *disc.ServerList
+
+	// NetworkID isolates dmsg networks which share binaries or dmsg discovery (such as test, staging and production).
+	// Sessions are only established with servers of the same network ID. Empty is the default network.
+	NetworkID string
+
+	// ServerBusyRetries is the number of times a dial is retried via other delegated servers of the remote client,
+	// after a server rejects the dial with ErrServerBusy. Retries back off exponentially, starting at ServerBusyBackoff.
+	// A value of 0 results in such dials failing immediately.
+	ServerBusyRetries int
+
+	// StreamLinger is the maximum duration that closing a dmsg stream waits for pending writes to complete.
+	// A negative value results in streams being reset on close, discarding pending writes (see (*Stream).SetLinger).
+	// A value of 0 (the default) results in Close not waiting for pending writes.
+	StreamLinger time.Duration
+
+	// StreamCoalesceDelay is the maximum duration that small writes to dmsg streams are held back, so that they are
+	// coalesced into a single frame. It only applies to streams with delayed writes (see (*Stream).SetNoDelay).
+	// A value of 0 results in DefaultStreamCoalesceDelay being used.
+	StreamCoalesceDelay time.Duration
+
+	// SocketOptions are applied to the TCP connections of sessions with dmsg servers (such as TCP_NODELAY and
+	// keep-alive settings).
+	SocketOptions netutil.SocketOptions
+
+	// LogConfig sets the log levels of subsystems of the client (such as sessions and streams).
+	LogConfig LogConfig
+
+	// SessionRekey sets when the encryption keys of sessions with dmsg servers, and of streams, are rotated. Keys are
+	// only rotated if the remote (the dmsg server or the remote client) also configures rekeying. Zero values disable
+	// rekeying by volume and time respectively, and rekeying altogether if both are zero.
+	SessionRekey noise.RekeyConfig
+
+	// StreamKeepAlive is the interval at which keepalive frames are written to established streams which have nothing
+	// written to them within the interval, so that quiet streams are not closed by the idle timeouts of dmsg servers
+	// (see StreamIdleTimeout of ServerConfig). Keepalive frames are discarded by the remote.
+	// A value of 0 disables keepalives.
+	StreamKeepAlive time.Duration
+
+	// SessionKeepAlive is the interval at which the multiplexers of sessions ping dmsg servers, so that dead sessions
+	// are detected. A value of 0 results in an interval of 30s.
+	SessionKeepAlive time.Duration
+
+	// StreamWindowSize is the maximum receive window (in bytes) of each stream. Larger windows improve throughput over
+	// links with high latency, at the cost of memory. A value of 0 results in MinStreamWindowSize being used.
+	StreamWindowSize uint32
+
+	// MaxSessionStreams is the maximum number of concurrent streams which remote clients may open via each session.
+	// The limit is advertised to dmsg servers during the session handshake, and exceeding requests are rejected with
+	// ErrSessionStreamLimit. A value of 0 disables the limit.
+	MaxSessionStreams int
+
+	// CompressFrameHeaders compresses the frame headers of sessions with dmsg servers which also enable it, which
+	// reduces the overhead of small frames (such as of IoT devices) from 12 bytes to 2-4 bytes per frame.
+	CompressFrameHeaders bool
+
+	// MaxConcurrentDials is the maximum number of stream dials (see DialStream) which are in progress at once. Further
+	// dials queue until a dial completes, or until their context is done. This keeps applications which dial many
+	// remotes at once from exhausting file descriptors and the rate limits of dmsg discovery.
+	// A value of 0 disables the limit.
+	MaxConcurrentDials int
+
+	// FDMetrics, if set, records the file descriptor usage of the process (see FDCheckInterval).
+	FDMetrics FDMetrics
+
+	// FDReserve is the number of file descriptors below the limit (RLIMIT_NOFILE) which are reserved for existing
+	// sessions and streams. Once fewer remain, new sessions with dmsg servers fail with ErrFDBudgetExhausted, rather
+	// than failing midway with EMFILE. A value of 0 disables this. Only supported on Linux.
+	FDReserve int
+
+	// IntrospectSocket, if set, is the path of the unix socket which the introspection API (sessions, streams and
+	// log level control) is served on, such as for dmsg-inspect. The socket is only accessible by the owner.
+	IntrospectSocket string
+
+	// FrameTrace, if set, receives a record (see FrameRecord) of each multiplexer frame of sessions, for debugging
+	// ordering and flow-control issues. Payloads are not recorded.
+	FrameTrace io.Writer
+
+	// Telemetry, if set, receives events of dials and streams (see Telemetry).
+	Telemetry Telemetry
+
+	// Clock, if set, replaces the system clock for the client's timers (such as entry updates and retry back-offs).
+	// This is intended for tests.
+	Clock Clock
+
+	// Resolvers are consulted in order for the entries of remote clients and servers, before dmsg discovery is
+	// queried (see Resolver). This allows static peers and LAN peer discovery.
+	Resolvers []Resolver
 }
 
 // PrintWarnings prints warnings with config.
@@ -27,12 +140,65 @@ func (c Config) PrintWarnings(log logrus.FieldLogger) {
 	if c.MinSessions < 1 {
 		log.Warn("Field 'MinSessions' has value < 1 : This will disallow establishment of dmsg streams.")
 	}
+	if !c.TrustedOperator.Null() && c.ServerList == nil {
+		log.Warn("Field 'TrustedOperator' is set without 'ServerList' : No dmsg server will be trusted.")
+	}
+	c.LogConfig.printWarnings(log)
 }
 
 // DefaultConfig returns the default configuration for a dmsg client entity.
 func DefaultConfig() *Config {
 	return &Config{
-		MinSessions: DefaultMinSessions,
+		MinSessions:             DefaultMinSessions,
+		SessionHandshakeTimeout: DefaultSessionHandshakeTimeout,
+		StreamHandshakeTimeout:  HandshakeTimeout,
+		StreamLinger:            DefaultStreamLinger,
+		StreamCoalesceDelay:     DefaultStreamCoalesceDelay,
+	}
+}
+
+// LowLatencyProfile returns a config for clients which favor latency over bandwidth and memory usage, such as
+// interactive sessions. Dead sessions are detected sooner, dials fail over to other servers sooner, and stream windows
+// are larger so that bursts are not stalled by window updates.
+func LowLatencyProfile() *Config {
+	c := DefaultConfig()
+	c.MinSessions = 2
+	c.SessionHandshakeTimeout = time.Second * 10
+	c.StreamHandshakeTimeout = time.Second * 10
+	c.ServerBusyRetries = 2
+	c.SessionKeepAlive = time.Second * 10
+	c.StreamKeepAlive = time.Second * 30
+	c.StreamWindowSize = MinStreamWindowSize * 4
+	return c
+}
+
+// LowBandwidthProfile returns a config for clients on slow or metered links, such as mobile and IoT devices.
+// Keepalives are infrequent, small writes are coalesced, and windows and socket buffers are small.
+func LowBandwidthProfile() *Config {
+	c := DefaultConfig()
+	c.SessionHandshakeTimeout = time.Minute
+	c.StreamHandshakeTimeout = time.Minute
+	c.EntryUpdateInterval = time.Minute * 15
+	c.SessionKeepAlive = time.Minute * 2
+	c.StreamWindowSize = MinStreamWindowSize
+	c.SocketOptions = netutil.SocketOptions{
+		DelayWrites: true,
+		ReadBuffer:  64 * 1024,
+		WriteBuffer: 64 * 1024,
+	}
+	return c
+}
+
+// fillDefaults sets zero-value fields of the config to their default values.
+func (c *Config) fillDefaults() {
+	if c.SessionHandshakeTimeout == 0 {
+		c.SessionHandshakeTimeout = DefaultSessionHandshakeTimeout
+	}
+	if c.StreamHandshakeTimeout == 0 {
+		c.StreamHandshakeTimeout = HandshakeTimeout
+	}
+	if c.StreamCoalesceDelay == 0 {
+		c.StreamCoalesceDelay = DefaultStreamCoalesceDelay
 	}
 }
 
@@ -49,10 +215,24 @@ type Client struct {
 	done  chan struct{}
 	once  sync.Once
 
-	sesMx sync.Mutex
+	// ctx is canceled once the client is closed. It is used by work which outlives the calls that start it, such as
+	// deregistering sessions which were dialed with the context of a single dial.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sesMx    sync.Mutex
+	sesLocks map[cipher.PubKey]*sync.Mutex // serializes session establishment per server
+
+	unreachable  *unreachableCache
+	dialSlots    chan struct{} // limits concurrent dials (nil if there is no limit)
+	dialServers  *serverCache
+	interceptors *interceptorChain
+	servers      *disc.ServerList // verified list of trusted servers (only used if conf.TrustedOperator is set)
+	confErr      error            // returned by Serve and dials if the config is invalid
 }
 
 // NewClient creates a dmsg client entity.
+// If the config is invalid (see Validate) or 'dc' is nil, Serve returns immediately and dials fail with the error.
 func NewClient(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClient, conf *Config) *Client {
 	c := new(Client)
 	c.ready = make(chan struct{})
@@ -71,55 +251,115 @@ func NewClient(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClient, conf *Conf
 	c.EntityCommon.delSessionCallback = func(ctx context.Context) error {
 		return c.EntityCommon.updateClientEntry(ctx, c.done)
 	}
+	c.EntityCommon.recycleSessionCallback = c.recycleSession
 
 	// Init config.
+	// The config is copied, so that filling in defaults does not modify the config of the caller.
 	if conf == nil {
 		conf = DefaultConfig()
 	}
-	c.conf = conf
+	confCopy := *conf
+	c.conf = &confCopy
+	c.conf.fillDefaults()
 	c.conf.PrintWarnings(c.log)
+	c.confErr = validateEntity(dc, c.conf.Validate())
+	c.powDifficulty = c.conf.PoWDifficulty
+	c.networkID = c.conf.NetworkID
+	c.logConf = c.conf.LogConfig
+	c.sessionRekey = c.conf.SessionRekey
+	c.maxSessionStreams = c.conf.MaxSessionStreams
+	c.compressHeaders = c.conf.CompressFrameHeaders
+	c.sessionKeepAlive = c.conf.SessionKeepAlive
+	c.streamWindow = c.conf.StreamWindowSize
+	c.tracer = newFrameTracer(c.conf.FrameTrace)
+	if c.conf.Clock != nil {
+		c.clock = c.conf.Clock
+	}
+	c.servers = verifiedServerList(c.log, c.conf)
 
 	c.porter = netutil.NewPorter(netutil.PorterMinEphemeral)
+	c.sesLocks = make(map[cipher.PubKey]*sync.Mutex)
+	c.unreachable = newUnreachableCache(UnreachableCacheTTL, c.clock)
+	c.dialServers = newServerCache(DialServerCacheSize)
+	c.initFDBudget(c.conf.FDReserve, c.conf.FDMetrics)
+	if c.conf.MaxConcurrentDials > 0 {
+		c.dialSlots = make(chan struct{}, c.conf.MaxConcurrentDials)
+	}
+	c.interceptors = new(interceptorChain)
+	c.entries = newEntryTracker(pk)
 	c.errCh = make(chan error, 10)
 	c.done = make(chan struct{})
+	c.ctx, c.cancel = context.WithCancel(context.Background())
 
 	return c
 }
 
 // Serve serves the client.
 // It blocks until the client is closed.
+//
+// Deprecated: use ServeContext, which also returns when the context is done and reports invalid configs.
 func (ce *Client) Serve() {
-	defer func() {
-		ce.log.Info("Stopped serving client!")
-	}()
+	_ = ce.ServeContext(context.Background()) //nolint:errcheck
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// ServeContext serves the client. It blocks until the client is closed (in which case nil is returned), or until the
+// context is done (in which case the client is closed and the context error is returned).
+func (ce *Client) ServeContext(ctx context.Context) error {
+	if ce.confErr != nil {
+		ce.log.WithError(ce.confErr).Error("Failed to serve client.")
+		return ce.confErr
+	}
 
-	go func(ctx context.Context) {
+	sCtx, cancel := context.WithCancel(ctx)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
 		select {
-		case <-ctx.Done():
+		case <-sCtx.Done():
+			if ctx.Err() != nil {
+				ce.log.WithError(ce.Close()).Info("Closed client as context is done.")
+			}
 		case <-ce.done:
 			cancel()
 		}
-	}(ctx)
+	}()
+
+	ce.serve(sCtx)
+	cancel()
+	<-watchDone
+	return ctx.Err()
+}
+
+// serve discovers servers and ensures sessions with them until the client is closed.
+func (ce *Client) serve(ctx context.Context) {
+	defer func() {
+		ce.log.Info("Stopped serving client!")
+	}()
+
+	if ce.conf.EntryUpdateInterval > 0 {
+		go ce.updateEntryPeriodically(ctx, ce.conf.EntryUpdateInterval)
+	}
+	if ce.conf.IntrospectSocket != "" {
+		go ce.serveIntrospection(ce.conf.IntrospectSocket)
+	}
+	go ce.monitorFDs(ctx.Done(), FDCheckInterval)
 
 	for {
 		if isClosed(ce.done) {
 			return
 		}
 
-		ce.log.Info("Discovering dmsg servers...")
+		ce.subLog(LogDiscovery).Info("Discovering dmsg servers...")
 		entries, err := ce.discoverServers(ctx)
 		if err != nil {
-			ce.log.WithError(err).Warn("Failed to discover dmsg servers.")
-			time.Sleep(time.Second) // TODO(evanlinjin): Implement exponential back off.
+			ce.subLog(LogDiscovery).WithError(err).Warn("Failed to discover dmsg servers.")
+			<-ce.clock.After(time.Second) // TODO(evanlinjin): Implement exponential back off.
 			continue
 		}
 		if len(entries) == 0 {
 			wait := time.Second
-			ce.log.Warnf("No entries found. Retrying after %s...", wait.String())
-			time.Sleep(wait)
+			ce.subLog(LogDiscovery).Warnf("No entries found. Retrying after %s...", wait.String())
+			<-ce.clock.After(wait)
 		}
 
 		for _, entry := range entries {
@@ -133,7 +373,7 @@ func (ce *Client) Serve() {
 				case <-ce.done:
 					return
 				case err := <-ce.errCh:
-					ce.log.WithError(err).Info("Session stopped.")
+					ce.subLog(LogSession).WithError(err).Info("Session stopped.")
 					if isClosed(ce.done) {
 						return
 					}
@@ -141,7 +381,8 @@ func (ce *Client) Serve() {
 			}
 
 			if err := ce.ensureSession(ctx, entry); err != nil {
-				ce.log.WithField("remote_pk", entry.Static).WithError(err).Warn("Failed to establish session.")
+				ce.subLog(LogSession).WithField("remote_pk", entry.Static).WithError(err).
+					Warn("Failed to establish session.")
 			}
 		}
 	}
@@ -153,28 +394,108 @@ func (ce *Client) Ready() <-chan struct{} {
 	return ce.ready
 }
 
+// UpdateEntryNow re-announces the client's entry in dmsg discovery immediately, rather than waiting for the next
+// periodic update. This is useful after the client's listeners or sessions have changed.
+func (ce *Client) UpdateEntryNow(ctx context.Context) error {
+	if isClosed(ce.done) {
+		return ErrEntityClosed
+	}
+	ce.sessionsMx.Lock()
+	srvPKs := ce.sessionPKs()
+	ce.sessionsMx.Unlock()
+
+	// The sessions are not locked while discovery is called, so that a slow discovery does not block them.
+	ctx, cancel := context.WithTimeout(ctx, entryUpdateTimeout)
+	defer cancel()
+	return ce.announceClientEntry(ctx, ce.done, srvPKs)
+}
+
+// updateEntryPeriodically re-announces the client's entry in dmsg discovery every interval, until the context is done.
+// The entry is only re-announced once the client is ready.
+func (ce *Client) updateEntryPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := ce.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+			if !isClosed(ce.ready) {
+				continue
+			}
+			if err := ce.UpdateEntryNow(ctx); err != nil && ctx.Err() == nil {
+				ce.subLog(LogDiscovery).WithError(err).Warn("Failed to update discovery entry.")
+			}
+		}
+	}
+}
+
 func (ce *Client) discoverServers(ctx context.Context) (entries []*disc.Entry, err error) {
+	var opts []disc.ServersOption
+	if ce.networkID != "" {
+		opts = append(opts, disc.WithNetworkID(ce.networkID))
+	}
 	err = netutil.NewDefaultRetrier(ce.log).Do(ctx, func() error {
-		entries, err = ce.dc.AvailableServers(ctx)
+		entries, err = ce.dc.AvailableServers(ctx, opts...)
 		return err
 	})
-	return entries, err
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter servers of other networks, in case dmsg discovery does not support the query.
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if ce.checkNetworkID(entry) == nil {
+			filtered = append(filtered, entry)
+		}
+	}
+	if ce.conf.TrustedOperator.Null() {
+		return filtered, nil
+	}
+	return ce.trustedServers(filtered), nil
 }
 
 // Close closes the dmsg client entity.
+// The client's entry is deregistered from dmsg discovery before all sessions are closed.
 // TODO(evanlinjin): Have waitgroup.
 func (ce *Client) Close() error {
+	return ce.CloseContext(context.Background())
+}
+
+// CloseContext is Close, but deregistration from dmsg discovery is abandoned once the context is done (or after
+// 'deregisterTimeout'). Sessions are closed regardless.
+func (ce *Client) CloseContext(ctx context.Context) error {
 	if ce == nil {
 		return nil
 	}
 
 	ce.once.Do(func() {
 		close(ce.done)
+		ce.cancel()
+
+		// The entry is deregistered once closed, so that it is not announced again.
+		ctx, cancel := context.WithTimeout(ctx, deregisterTimeout)
+		if err := ce.deregisterClientEntry(ctx); err != nil {
+			ce.log.WithError(err).Warn("Failed to deregister entry from discovery.")
+		}
+		cancel()
 
 		ce.sesMx.Lock()
 		close(ce.errCh)
+		locks := make([]*sync.Mutex, 0, len(ce.sesLocks))
+		for _, mx := range ce.sesLocks {
+			locks = append(locks, mx)
+		}
 		ce.sesMx.Unlock()
 
+		// Wait for in-flight session dials, which do not set their sessions once the client is closed.
+		for _, mx := range locks {
+			mx.Lock()
+			mx.Unlock() //nolint:staticcheck
+		}
+
 		ce.sessionsMx.Lock()
 		for _, dSes := range ce.sessions {
 			ce.log.
@@ -191,9 +512,100 @@ func (ce *Client) Close() error {
 	return nil
 }
 
+// AddStreamInterceptor adds an interceptor which is called on every remote-initiated stream before it is accepted by
+// a listener of this client. Interceptors are called in the order they are added.
+func (ce *Client) AddStreamInterceptor(fn StreamInterceptor) {
+	ce.interceptors.add(fn)
+}
+
+// AddEntryObserver adds an observer which is called whenever a changed version of a client entry (local or remote)
+// is observed in dmsg discovery. Observers are called synchronously, so they should not block.
+func (ce *Client) AddEntryObserver(fn EntryObserver) {
+	ce.entries.addObserver(fn)
+}
+
+// Shutdown gracefully closes the dmsg client entity.
+// All listeners are closed and the servers are sent a go-away frame, so that no new streams are accepted. Then we wait
+// for all established streams to be closed (or for the context to be done) before calling Close.
+// The context error is returned if the context is done before all streams are closed.
+func (ce *Client) Shutdown(ctx context.Context) error {
+	if ce == nil {
+		return nil
+	}
+
+	// Stop accepting new streams.
+	var (
+		listeners []*Listener
+		claims    = make(map[*PortClaim]bool)
+	)
+	ce.porter.RangePortValues(func(_ uint16, v interface{}) bool {
+		switch v := v.(type) {
+		case *Listener:
+			listeners = append(listeners, v)
+		case *PortClaim:
+			claims[v] = true
+		}
+		return true
+	})
+	for _, lis := range listeners {
+		ce.log.WithError(lis.Close()).
+			WithField("port", lis.addr.Port).
+			Debug("Listener closed on shutdown.")
+	}
+	for pc := range claims {
+		ce.log.WithError(pc.Release()).
+			WithField("ports", pc.ports).
+			Debug("Port claim released on shutdown.")
+	}
+
+	// Signal the servers that no new streams are accepted, so that dials of remote clients fail fast while draining.
+	for _, dSes := range ce.AllSessions() {
+		if err := dSes.ys.GoAway(); err != nil {
+			ce.log.WithError(err).WithField("remote_pk", dSes.RemotePK()).Debug("Failed to send go-away frame.")
+		}
+	}
+
+	// Wait for established streams to be closed.
+	err := ce.awaitStreams(ctx)
+	if err != nil {
+		ce.log.WithError(err).Warn("Shutdown proceeding without all streams closed.")
+	}
+
+	// Deregister from discovery and close sessions.
+	if cErr := ce.Close(); cErr != nil {
+		return cErr
+	}
+	return err
+}
+
+// awaitStreams blocks until all sessions have no established streams, or the context is done.
+// Streams which the remote closed are not waited for (see (*Stream).Read).
+func (ce *Client) awaitStreams(ctx context.Context) error {
+	const interval = time.Millisecond * 100
+
+	ticker := ce.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n := 0
+		for _, dSes := range ce.AllSessions() {
+			n += dSes.StreamCount()
+		}
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.Chan():
+		}
+	}
+}
+
 // Listen listens on a given dmsg port.
 func (ce *Client) Listen(port uint16) (*Listener, error) {
 	lis := newListener(Addr{PK: ce.pk, Port: port})
+	lis.interceptors = ce.interceptors
 	ok, doneFn := ce.porter.Reserve(port, lis)
 	if !ok {
 		lis.close()
@@ -204,109 +616,452 @@ func (ce *Client) Listen(port uint16) (*Listener, error) {
 }
 
 // Dial wraps DialStream to output net.Conn instead of *Stream.
-func (ce *Client) Dial(ctx context.Context, addr Addr) (net.Conn, error) {
-	return ce.DialStream(ctx, addr)
+func (ce *Client) Dial(ctx context.Context, addr Addr, opts ...DialOption) (net.Conn, error) {
+	return ce.DialStream(ctx, addr, opts...)
 }
 
 // DialStream dials to a remote client entity with the given address.
-func (ce *Client) DialStream(ctx context.Context, addr Addr) (*Stream, error) {
-	entry, err := getClientEntry(ctx, ce.dc, addr.PK)
+// If the remote client failed to be dialed within the last 'UnreachableCacheTTL', ErrPeerRecentlyUnreachable is
+// returned without attempting the dial (unless the BypassUnreachableCache option is provided).
+// Other failures are reported as *DialError.
+func (ce *Client) DialStream(ctx context.Context, addr Addr, opts ...DialOption) (*Stream, error) {
+	if t := ce.conf.Telemetry; t != nil {
+		start := time.Now()
+		t.DialStart(addr)
+		dStr, err := ce.dialStreamOpts(ctx, addr, opts)
+		t.DialEnd(addr, time.Since(start), err)
+		return dStr, err
+	}
+	return ce.dialStreamOpts(ctx, addr, opts)
+}
+
+func (ce *Client) dialStreamOpts(ctx context.Context, addr Addr, opts []DialOption) (*Stream, error) {
+	if ce.confErr != nil {
+		return nil, ce.confErr
+	}
+	dOpts := makeDialOptions(opts)
+	if !dOpts.bypassUnreachable && ce.unreachable.contains(addr.PK) {
+		return nil, ErrPeerRecentlyUnreachable
+	}
+	if err := ce.acquireDialSlot(ctx, addr); err != nil {
+		return nil, err
+	}
+	defer ce.releaseDialSlot()
+
+	dStr, err := ce.dialStream(ctx, addr)
+	ce.unreachable.update(addr.PK, err)
+	return dStr, err
+}
+
+// acquireDialSlot waits for a dial slot (see Config.MaxConcurrentDials), or until the context is done.
+func (ce *Client) acquireDialSlot(ctx context.Context, addr Addr) error {
+	if ce.dialSlots == nil {
+		return nil
+	}
+	select {
+	case ce.dialSlots <- struct{}{}:
+		return nil
+	default:
+	}
+	ce.subLog(LogHandshake).WithField("remote_pk", addr.PK).Debug("Dial is queued, as too many dials are in progress.")
+	select {
+	case ce.dialSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return &DialError{Phase: DialPhaseQueued, Remote: addr.PK, Err: ctx.Err()}
+	case <-ce.done:
+		return &DialError{Phase: DialPhaseQueued, Remote: addr.PK, Err: ErrEntityClosed}
+	}
+}
+
+func (ce *Client) releaseDialSlot() {
+	if ce.dialSlots != nil {
+		<-ce.dialSlots
+	}
+}
+
+func (ce *Client) dialStream(ctx context.Context, addr Addr) (*Stream, error) {
+	entry, err := ce.remoteEntry(ctx, addr.PK)
 	if err != nil {
 		return nil, err
 	}
 
+	// Servers which rejected the dial with ErrServerBusy are avoided on retries.
+	busy := make(map[cipher.PubKey]struct{})
+	backoff := ServerBusyBackoff
+
+	for retries := 0; ; retries++ {
+		srvPKs := make([]cipher.PubKey, 0, len(entry.Client.DelegatedServers))
+		for _, srvPK := range entry.Client.DelegatedServers {
+			if _, ok := busy[srvPK]; !ok {
+				srvPKs = append(srvPKs, srvPK)
+			}
+		}
+		if len(srvPKs) == 0 {
+			srvPKs = entry.Client.DelegatedServers
+		}
+		srvPKs = ce.dialServers.prioritize(addr.PK, srvPKs)
+
+		dStr, srvPK, err := ce.dialStreamVia(ctx, addr, srvPKs)
+		ce.dialServers.update(addr.PK, srvPK, err)
+		if !errors.Is(err, ErrServerBusy) || retries >= ce.conf.ServerBusyRetries {
+			return dStr, err
+		}
+		busy[srvPK] = struct{}{}
+		ce.subLog(LogHandshake).WithField("srv_pk", srvPK).WithField("backoff", backoff).
+			Debug("Server is busy, retrying dial...")
+
+		select {
+		case <-ctx.Done():
+			return nil, &DialError{Phase: DialPhaseServerRejected, Remote: addr.PK, Server: srvPK, Err: ctx.Err()}
+		case <-ce.clock.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+// entryGetter returns the chain of resolvers of the client, which falls back to dmsg discovery.
+func (ce *Client) entryGetter() entryGetter {
+	if len(ce.conf.Resolvers) == 0 {
+		return ce.dc
+	}
+	return resolverChain{resolvers: ce.conf.Resolvers, dc: ce.dc}
+}
+
+// remoteEntry obtains the entry of the remote client which is to be dialed. Errors are of type *DialError.
+func (ce *Client) remoteEntry(ctx context.Context, rPK cipher.PubKey) (*disc.Entry, error) {
+	entry, err := getClientEntry(ctx, ce.entryGetter(), rPK)
+	ce.entries.observe(ce.log, entry)
+	if err != nil {
+		phase := DialPhaseEntry
+		if errors.Is(err, ErrDiscEntryNotFound) {
+			phase = DialPhaseDiscovery
+		}
+		return nil, &DialError{Phase: phase, Remote: rPK, Err: err}
+	}
+	if err := ce.checkNetworkID(entry); err != nil {
+		return nil, &DialError{Phase: DialPhaseEntry, Remote: rPK, Err: err}
+	}
+	return entry, nil
+}
+
+// dialStreamVia dials a stream via any of the given delegated servers of the remote client.
+// The public key of the server which the dial was attempted via is also returned. Errors are of type *DialError.
+func (ce *Client) dialStreamVia(
+	ctx context.Context, addr Addr, srvPKs []cipher.PubKey,
+) (*Stream, cipher.PubKey, error) {
 	// Range client's delegated servers.
 	// See if we are already connected to a delegated server.
-	for _, srvPK := range entry.Client.DelegatedServers {
-		if dSes, ok := ce.clientSession(ce.porter, srvPK); ok {
-			return dSes.DialStream(addr)
+	for _, srvPK := range srvPKs {
+		if dSes, ok := ce.clientSession(ce.porter, ce.conf, srvPK); ok {
+			dStr, err := dSes.DialStream(addr)
+			return dStr, srvPK, streamDialError(addr.PK, srvPK, err)
 		}
 	}
 
 	// Range client's delegated servers.
-	// Attempt to connect to a delegated server.
-	for _, srvPK := range entry.Client.DelegatedServers {
-		dSes, err := ce.EnsureAndObtainSession(ctx, srvPK)
-		if err != nil {
-			continue
+	// Attempt to connect to delegated servers concurrently, and use the first session established.
+	dSes, err := ce.ensureAnySession(ctx, srvPKs)
+	if err != nil {
+		// Fall back to dialing via the servers we are connected to, which relay the request to a delegated server of
+		// the remote client.
+		if dStr, rErr := ce.dialStreamViaRelay(ctx, addr); rErr == nil {
+			return dStr, cipher.PubKey{}, nil
 		}
-		return dSes.DialStream(addr)
+		dErr, ok := err.(*DialError)
+		if !ok {
+			dErr = &DialError{Phase: DialPhaseServerConnect, Err: err}
+		}
+		dErr.Remote = addr.PK
+		return nil, dErr.Server, dErr
 	}
+	dStr, err := dSes.DialStream(addr)
+	return dStr, dSes.RemotePK(), streamDialError(addr.PK, dSes.RemotePK(), err)
+}
+
+// streamDialError wraps a failure of the stream handshake with the remote client as a *DialError.
+func streamDialError(rPK, srvPK cipher.PubKey, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &DialError{Phase: streamDialPhase(err), Remote: rPK, Server: srvPK, Err: err}
+}
+
+// dialStreamViaRelay attempts to dial a stream via each established session until one succeeds.
+func (ce *Client) dialStreamViaRelay(ctx context.Context, addr Addr) (*Stream, error) {
+	var err error = ErrCannotConnectToDelegated
+	for _, dSes := range ce.AllSessions() {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var dStr *Stream
+		if dStr, err = dSes.DialStream(addr); err == nil {
+			return dStr, nil
+		}
+		ce.subLog(LogHandshake).WithError(err).WithField("srv_pk", dSes.RemotePK()).
+			Debug("Failed to dial stream via relay.")
+	}
+	return nil, err
+}
+
+// ensureAnySession attempts to obtain a session with any of the given servers.
+// Up to 'DialParallelism' sessions are dialed concurrently, and the first session to be established is returned.
+// If all dials fail, the returned *DialError reports the last failure.
+func (ce *Client) ensureAnySession(ctx context.Context, srvPKs []cipher.PubKey) (ClientSession, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		ses ClientSession
+		err error
+	}
+	resCh := make(chan result, len(srvPKs)) // buffered so that late dials do not block
+	sem := make(chan struct{}, DialParallelism)
+
+	go func() {
+		for _, srvPK := range srvPKs {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(srvPK cipher.PubKey) {
+				dSes, err := ce.EnsureAndObtainSession(ctx, srvPK)
+				<-sem
+				resCh <- result{ses: dSes, err: err}
+			}(srvPK)
+		}
+	}()
 
-	return nil, ErrCannotConnectToDelegated
+	lastErr := &DialError{Phase: DialPhaseServerConnect, Err: ErrCannotConnectToDelegated}
+	for range srvPKs {
+		select {
+		case res := <-resCh:
+			if res.err == nil {
+				return res.ses, nil
+			}
+			ce.subLog(LogHandshake).WithError(res.err).Debug("Failed to establish session with delegated server.")
+			if dErr, ok := res.err.(*DialError); ok {
+				lastErr = &DialError{
+					Phase:  dErr.Phase,
+					Server: dErr.Server,
+					Err:    ErrCannotConnectToDelegated.Wrap(dErr.Err),
+				}
+			}
+		case <-ctx.Done():
+			return ClientSession{}, ctx.Err()
+		}
+	}
+	return ClientSession{}, lastErr
 }
 
 // Session obtains an established session.
 func (ce *Client) Session(pk cipher.PubKey) (ClientSession, bool) {
-	return ce.clientSession(ce.porter, pk)
+	return ce.clientSession(ce.porter, ce.conf, pk)
 }
 
 // AllSessions obtains all established sessions.
 func (ce *Client) AllSessions() []ClientSession {
-	return ce.allClientSessions(ce.porter)
+	return ce.allClientSessions(ce.porter, ce.conf)
 }
 
 // EnsureAndObtainSession attempts to obtain a session.
 // If the session does not exist, we will attempt to establish one.
 // It returns an error if the session does not exist AND cannot be established.
 func (ce *Client) EnsureAndObtainSession(ctx context.Context, srvPK cipher.PubKey) (ClientSession, error) {
-	ce.sesMx.Lock()
-	defer ce.sesMx.Unlock()
+	if ce.confErr != nil {
+		return ClientSession{}, ce.confErr
+	}
+	mx := ce.sessionLock(srvPK)
+	mx.Lock()
+	defer mx.Unlock()
 
-	if dSes, ok := ce.clientSession(ce.porter, srvPK); ok {
+	if dSes, ok := ce.clientSession(ce.porter, ce.conf, srvPK); ok {
 		return dSes, nil
 	}
 
-	srvEntry, err := getServerEntry(ctx, ce.dc, srvPK)
+	srvEntry, err := getServerEntry(ctx, ce.entryGetter(), srvPK)
+	if err != nil {
+		if srvEntry = ce.serverListEntry(srvPK); srvEntry == nil {
+			return ClientSession{}, &DialError{Phase: DialPhaseDiscovery, Server: srvPK, Err: err}
+		}
+	}
+
+	return ce.dialSession(ctx, srvEntry, nil)
+}
+
+// EnsureSession establishes a session with the given dmsg server ahead of time (if one does not exist already), so
+// that the first stream dialed via the server does not wait for the session to be established.
+func (ce *Client) EnsureSession(ctx context.Context, srvPK cipher.PubKey) error {
+	_, err := ce.EnsureAndObtainSession(ctx, srvPK)
+	return err
+}
+
+// Preconnect establishes a session with a delegated server of the given remote client ahead of time (if there is no
+// session with any of them already), so that the first stream dialed to the remote client does not wait for the
+// session to be established. Errors are of type *DialError.
+func (ce *Client) Preconnect(ctx context.Context, rPK cipher.PubKey) error {
+	if ce.confErr != nil {
+		return ce.confErr
+	}
+	entry, err := ce.remoteEntry(ctx, rPK)
 	if err != nil {
-		return ClientSession{}, err
+		return err
 	}
 
-	return ce.dialSession(ctx, srvEntry)
+	srvPKs := ce.dialServers.prioritize(rPK, entry.Client.DelegatedServers)
+	for _, srvPK := range srvPKs {
+		if _, ok := ce.Session(srvPK); ok {
+			return nil
+		}
+	}
+	if _, err := ce.ensureAnySession(ctx, srvPKs); err != nil {
+		if dErr, ok := err.(*DialError); ok {
+			dErr.Remote = rPK
+			return dErr
+		}
+		return &DialError{Phase: DialPhaseServerConnect, Remote: rPK, Err: err}
+	}
+	return nil
 }
 
 // ensureSession ensures the existence of a session.
 // It returns an error if the session does not exist AND cannot be established.
 func (ce *Client) ensureSession(ctx context.Context, entry *disc.Entry) error {
-	ce.sesMx.Lock()
-	defer ce.sesMx.Unlock()
+	mx := ce.sessionLock(entry.Static)
+	mx.Lock()
+	defer mx.Unlock()
 
 	// If session with server of pk already exists, skip.
-	if _, ok := ce.clientSession(ce.porter, entry.Static); ok {
+	if _, ok := ce.clientSession(ce.porter, ce.conf, entry.Static); ok {
 		return nil
 	}
 
 	// Dial session.
-	_, err := ce.dialSession(ctx, entry)
+	_, err := ce.dialSession(ctx, entry, nil)
 	return err
 }
 
+// sessionLock obtains the mutex which serializes session establishment with the given server.
+// Sessions with different servers can be established concurrently.
+func (ce *Client) sessionLock(srvPK cipher.PubKey) *sync.Mutex {
+	ce.sesMx.Lock()
+	defer ce.sesMx.Unlock()
+
+	mx, ok := ce.sesLocks[srvPK]
+	if !ok {
+		mx = new(sync.Mutex)
+		ce.sesLocks[srvPK] = mx
+	}
+	return mx
+}
+
 // It is expected that the session is created and served before the context cancels, otherwise an error will be returned.
 // NOTE: This should not be called directly as it may lead to session duplicates.
-// Only `ensureSession` or `EnsureAndObtainSession` should call this function.
-func (ce *Client) dialSession(ctx context.Context, entry *disc.Entry) (ClientSession, error) {
-	ce.log.WithField("remote_pk", entry.Static).Info("Dialing session...")
+// Only `ensureSession`, `EnsureAndObtainSession` or `recycleSession` should call this function.
+// If 'old' is non-nil, the dialed session replaces it.
+func (ce *Client) dialSession(ctx context.Context, entry *disc.Entry, old *SessionCommon) (ClientSession, error) {
+	fail := func(phase DialPhase, err error) (ClientSession, error) {
+		return ClientSession{}, &DialError{Phase: phase, Server: entry.Static, Err: err}
+	}
+	if !ce.isTrustedServer(entry.Static) {
+		return fail(DialPhaseEntry, ErrDiscServerNotTrusted)
+	}
+	if err := ce.checkNetworkID(entry); err != nil {
+		return fail(DialPhaseEntry, err)
+	}
+	if ce.fdsExhausted() {
+		return fail(DialPhaseServerConnect, ErrFDBudgetExhausted)
+	}
+	ce.subLog(LogHandshake).WithField("remote_pk", entry.Static).Info("Dialing session...")
 
-	conn, err := net.Dial("tcp", entry.Server.Address)
+	deadline := time.Now().Add(ce.conf.SessionHandshakeTimeout)
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialServerConn(ctx, &dialer, entry.Server)
 	if err != nil {
-		return ClientSession{}, err
+		return fail(DialPhaseServerConnect, err)
+	}
+	if err := ce.conf.SocketOptions.Apply(conn); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return fail(DialPhaseServerConnect, err)
 	}
-	dSes, err := makeClientSession(&ce.EntityCommon, ce.porter, conn, entry.Static)
+	if err := conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return fail(DialPhaseServerConnect, err)
+	}
+	stop := interruptOnDone(ctx, conn)
+	stopOnClose := interruptOnDone(ce.ctx, conn)
+	dSes, err := makeClientSession(&ce.EntityCommon, ce.porter, ce.conf, conn, entry.Static)
+	stopOnClose()
+	stop()
 	if err != nil {
-		return ClientSession{}, err
+		_ = conn.Close() //nolint:errcheck
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		} else if isClosed(ce.done) {
+			err = ErrEntityClosed
+		}
+		return fail(DialPhaseSessionHandshake, err)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = dSes.Close() //nolint:errcheck
+		return fail(DialPhaseSessionHandshake, err)
 	}
 
-	if !ce.setSession(ctx, dSes.SessionCommon) {
+	// The caller holds the lock of the server, so Close waits for the session to be set before closing sessions.
+	if isClosed(ce.done) {
 		_ = dSes.Close() //nolint:errcheck
-		return ClientSession{}, errors.New("session already exists")
+		return fail(DialPhaseSessionHandshake, ErrEntityClosed)
+	}
+	if old != nil {
+		ce.replaceSession(ctx, dSes.SessionCommon)
+	} else if !ce.setSession(ctx, dSes.SessionCommon) {
+		_ = dSes.Close() //nolint:errcheck
+		return fail(DialPhaseSessionHandshake, errors.New("session already exists"))
 	}
 	go func() {
-		ce.log.WithField("remote_pk", dSes.RemotePK()).Info("Serving session.")
-		if err := dSes.serve(); !isClosed(ce.done) {
-			ce.errCh <- fmt.Errorf("failed to serve dialed session to %s: %v", dSes.RemotePK(), err)
-			ce.delSession(ctx, dSes.RemotePK())
+		ce.subLog(LogSession).WithField("remote_pk", dSes.RemotePK()).Info("Serving session.")
+		// The session outlives the dial, so it is deleted with the context of the client rather than that of the dial.
+		if err := dSes.serve(); !isClosed(ce.done) && ce.delSession(ce.ctx, dSes.SessionCommon) {
+			ce.reportErr(fmt.Errorf("failed to serve dialed session to %s: %v", dSes.RemotePK(), err))
 		}
 	}()
 
 	return dSes, nil
 }
+
+// reportErr reports an error to the serve loop of the client. It is discarded if the client is closed, or if the serve
+// loop is behind.
+func (ce *Client) reportErr(err error) {
+	ce.sesMx.Lock()
+	defer ce.sesMx.Unlock()
+
+	if isClosed(ce.done) {
+		return
+	}
+	select {
+	case ce.errCh <- err:
+	default:
+		ce.log.WithError(err).Warn("Discarded error as the client is behind on handling errors.")
+	}
+}
+
+// dialServerConn dials a connection to a dmsg server via TCP (in Happy Eyeballs order), falling back to the other
+// advertised underlays (such as websocket) on failure.
+func dialServerConn(ctx context.Context, dialer *net.Dialer, srv *disc.Server) (net.Conn, error) {
+	conn, err := dialHappyEyeballs(ctx, dialer, srv.AllAddresses())
+	if err == nil {
+		return conn, nil
+	}
+	if !dialer.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, dialer.Deadline)
+		defer cancel()
+	}
+	for _, addr := range srv.AddrsOfType(disc.UnderlayWS) {
+		if conn, wsErr := netutil.DialWS(ctx, addr); wsErr == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
@@ -12,34 +12,43 @@ import (
 type ClientSession struct {
 	*SessionCommon
 	porter *netutil.Porter
+	conf   *Config
 }
 
-func makeClientSession(entity *EntityCommon, porter *netutil.Porter, conn net.Conn, rPK cipher.PubKey) (ClientSession, error) {
+func makeClientSession(entity *EntityCommon, porter *netutil.Porter, conf *Config, conn net.Conn, rPK cipher.PubKey) (ClientSession, error) {
 	var cSes ClientSession
 	cSes.SessionCommon = new(SessionCommon)
 	if err := cSes.SessionCommon.initClient(entity, conn, rPK); err != nil {
 		return cSes, err
 	}
 	cSes.porter = porter
+	cSes.conf = conf
 	return cSes, nil
 }
 
 // DialStream attempts to dial a stream to a remote client via the dmsg server that this session is connected to.
+// ErrSessionStreamLimit is returned if the dmsg server's limit of concurrent streams per session is reached.
 func (cs *ClientSession) DialStream(dst Addr) (dStr *Stream, err error) {
+	release, err := cs.opened.acquire()
+	if err != nil {
+		return nil, err
+	}
 	if dStr, err = newInitiatingStream(cs); err != nil {
+		release()
 		return nil, err
 	}
+	dStr.release = release
 
 	// Close stream on failure.
 	defer func() {
 		if err != nil {
-			cs.log.WithError(dStr.Close()).
+			cs.entity.subLog(LogHandshake).WithError(dStr.Close()).
 				Debug("Stream closed on DialStream() failure.")
 		}
 	}()
 
 	// Prepare deadline.
-	if err = dStr.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+	if err = dStr.SetDeadline(time.Now().Add(cs.conf.StreamHandshakeTimeout)); err != nil {
 		return nil, err
 	}
 
@@ -58,6 +67,7 @@ func (cs *ClientSession) DialStream(dst Addr) (dStr *Stream, err error) {
 		return nil, err
 	}
 
+	dStr.track()
 	return dStr, err
 }
 
@@ -87,19 +97,21 @@ func (cs *ClientSession) acceptStream() (dStr *Stream, err error) {
 	if dStr, err = newRespondingStream(cs); err != nil {
 		return nil, err
 	}
+	release, limitErr := cs.accepted.acquire()
+	dStr.release = release
 
 	// Close stream on failure.
 	defer func() {
 		if err != nil {
 			if scErr := dStr.Close(); scErr != nil {
-				cs.log.WithError(scErr).
+				cs.entity.subLog(LogHandshake).WithError(scErr).
 					Debug("On (*ClientSession).acceptStream() failure, close stream resulted in error.")
 			}
 		}
 	}()
 
 	// Prepare deadline.
-	if err = dStr.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+	if err = dStr.SetDeadline(time.Now().Add(cs.conf.StreamHandshakeTimeout)); err != nil {
 		return nil, err
 	}
 
@@ -108,6 +120,9 @@ func (cs *ClientSession) acceptStream() (dStr *Stream, err error) {
 	if err != nil {
 		return nil, err
 	}
+	if limitErr != nil {
+		return nil, dStr.writeRejection(req.raw.Hash(), ErrSessionStreamLimit)
+	}
 	if err = dStr.writeResponse(req.raw.Hash()); err != nil {
 		return nil, err
 	}
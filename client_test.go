@@ -0,0 +1,352 @@
+package dmsg
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestClient_dialSession(t *testing.T) {
+	dc := disc.NewMock()
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServer(srvPK, srvSK, dc)
+	srvLis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(srvLis, "") }() //nolint:errcheck
+	<-srv.Ready()
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	pkA, skA := cipher.GenerateKeyPair()
+	clientA := NewClient(pkA, skA, dc, nil)
+	go clientA.Serve()
+	<-clientA.Ready()
+	defer func() { require.NoError(t, clientA.Close()) }()
+
+	lis, err := clientA.Listen(1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	t.Run("session_teardown_outlives_dial", func(t *testing.T) {
+		// Client B is not served, so its only session is the one opened by DialStream.
+		pkB, skB := cipher.GenerateKeyPair()
+		clientB := NewClient(pkB, skB, dc, nil)
+		defer func() { require.NoError(t, clientB.Close()) }()
+
+		dStr, err := clientB.DialStream(context.TODO(), Addr{PK: pkA, Port: 1})
+		require.NoError(t, err)
+		require.NoError(t, dStr.Close())
+
+		entry, err := dc.Entry(context.TODO(), pkB)
+		require.NoError(t, err)
+		require.Equal(t, []cipher.PubKey{srvPK}, entry.Client.DelegatedServers)
+
+		// Once the session dies, the server is removed from the entry, even though the dial is long done.
+		dSes, ok := clientB.session(srvPK)
+		require.True(t, ok)
+		require.NoError(t, dSes.Close())
+		require.Eventually(t, func() bool {
+			entry, err := dc.Entry(context.TODO(), pkB)
+			return err == nil && len(entry.Client.DelegatedServers) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("close_during_dials", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			pkB, skB := cipher.GenerateKeyPair()
+			clientB := NewClient(pkB, skB, dc, nil)
+
+			var wg sync.WaitGroup
+			for j := 0; j < 4; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if dStr, err := clientB.DialStream(context.TODO(), Addr{PK: pkA, Port: 1}); err == nil {
+						_ = dStr.Close() //nolint:errcheck
+					}
+				}()
+			}
+			time.Sleep(time.Duration(i) * time.Millisecond)
+			require.NoError(t, clientB.Close())
+			wg.Wait()
+
+			// Dials which complete after Close do not leave sessions behind.
+			require.Zero(t, clientB.SessionCount())
+		}
+	})
+}
+
+func TestClient_Shutdown(t *testing.T) {
+	dc := disc.NewMock()
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServer(srvPK, srvSK, dc)
+	srvLis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(srvLis, "") }() //nolint:errcheck
+	<-srv.Ready()
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	// newClients returns a served client which listens on port 1 and a client which dials it, and a function which
+	// dials a stream between them.
+	newClients := func(t *testing.T) (*Client, *Client, func() (*Stream, *Stream)) {
+		pkA, skA := cipher.GenerateKeyPair()
+		clientA := NewClient(pkA, skA, dc, nil)
+		go clientA.Serve()
+		<-clientA.Ready()
+		lis, err := clientA.Listen(1)
+		require.NoError(t, err)
+
+		pkB, skB := cipher.GenerateKeyPair()
+		clientB := NewClient(pkB, skB, dc, nil)
+
+		return clientA, clientB, func() (*Stream, *Stream) {
+			dStr, err := clientB.DialStream(context.TODO(), Addr{PK: pkA, Port: 1})
+			require.NoError(t, err)
+			rStr, err := lis.AcceptStream()
+			require.NoError(t, err)
+			return dStr, rStr
+		}
+	}
+
+	t.Run("waits_for_streams", func(t *testing.T) {
+		clientA, clientB, dial := newClients(t)
+		defer func() { require.NoError(t, clientB.Close()) }()
+
+		dStr1, rStr1 := dial()
+		dStr2, rStr2 := dial()
+		defer func() { _ = dStr1.Close() }()                  //nolint:errcheck
+		go func() { _, _ = io.Copy(ioutil.Discard, rStr2) }() //nolint:errcheck
+
+		done := make(chan error, 1)
+		go func() { done <- clientA.Shutdown(context.Background()) }()
+		select {
+		case err := <-done:
+			t.Fatalf("shutdown returned with open streams: %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		// Streams which the remote closes are not waited for, even though they are not closed locally.
+		require.NoError(t, dStr2.Close())
+		select {
+		case err := <-done:
+			t.Fatalf("shutdown returned with open streams: %v", err)
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		require.NoError(t, rStr1.Close())
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("shutdown did not return once streams were closed")
+		}
+		require.True(t, isClosed(clientA.done))
+	})
+
+	t.Run("context_done", func(t *testing.T) {
+		clientA, clientB, dial := newClients(t)
+		defer func() { require.NoError(t, clientB.Close()) }()
+
+		dStr, rStr := dial()
+		defer func() {
+			_ = dStr.Close() //nolint:errcheck
+			_ = rStr.Close() //nolint:errcheck
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		require.Equal(t, context.DeadlineExceeded, clientA.Shutdown(ctx))
+		require.True(t, isClosed(clientA.done))
+	})
+}
+
+// blockingDisc is a discovery client of which Entry and SetEntry block while blocked, until the context is done.
+type blockingDisc struct {
+	disc.APIClient
+	blocked int32 // accessed atomically
+}
+
+func (d *blockingDisc) block(ctx context.Context) error {
+	if atomic.LoadInt32(&d.blocked) == 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (d *blockingDisc) Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	if err := d.block(ctx); err != nil {
+		return nil, err
+	}
+	return d.APIClient.Entry(ctx, pk)
+}
+
+func (d *blockingDisc) SetEntry(ctx context.Context, entry *disc.Entry) error {
+	if err := d.block(ctx); err != nil {
+		return err
+	}
+	return d.APIClient.SetEntry(ctx, entry)
+}
+
+// clearDelegatedServers removes the delegated servers from the client entry in discovery.
+func clearDelegatedServers(t *testing.T, dc disc.APIClient, pk cipher.PubKey, sk cipher.SecKey) {
+	entry, err := dc.Entry(context.TODO(), pk)
+	require.NoError(t, err)
+	entry.Client.DelegatedServers = nil
+	require.NoError(t, dc.UpdateEntry(context.TODO(), sk, entry))
+}
+
+func TestClient_UpdateEntryNow(t *testing.T) {
+	dc := &blockingDisc{APIClient: disc.NewMock()}
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServer(srvPK, srvSK, dc)
+	srvLis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(srvLis, "") }() //nolint:errcheck
+	<-srv.Ready()
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	pk, sk := cipher.GenerateKeyPair()
+	c := NewClient(pk, sk, dc, nil)
+	go c.Serve()
+	<-c.Ready()
+
+	t.Run("reannounces", func(t *testing.T) {
+		clearDelegatedServers(t, dc, pk, sk)
+		require.NoError(t, c.UpdateEntryNow(context.TODO()))
+
+		entry, err := dc.Entry(context.TODO(), pk)
+		require.NoError(t, err)
+		require.Equal(t, []cipher.PubKey{srvPK}, entry.Client.DelegatedServers)
+	})
+
+	t.Run("slow_discovery", func(t *testing.T) {
+		atomic.StoreInt32(&dc.blocked, 1)
+		defer atomic.StoreInt32(&dc.blocked, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		errCh := make(chan error, 1)
+		go func() { errCh <- c.UpdateEntryNow(ctx) }()
+
+		// Sessions are not locked while discovery is called.
+		time.Sleep(100 * time.Millisecond)
+		counted := make(chan int, 1)
+		go func() { counted <- c.SessionCount() }()
+		select {
+		case n := <-counted:
+			require.Equal(t, 1, n)
+		case <-time.After(200 * time.Millisecond):
+			t.Fatal("sessions are locked during the discovery call")
+		}
+		require.Len(t, errCh, 0)
+		require.Equal(t, context.DeadlineExceeded, <-errCh)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		require.NoError(t, c.Close())
+		require.Equal(t, ErrEntityClosed, c.UpdateEntryNow(context.TODO()))
+	})
+}
+
+func TestClient_updateEntryPeriodically(t *testing.T) {
+	require.Zero(t, DefaultConfig().EntryUpdateInterval)
+
+	dc := disc.NewMock()
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServer(srvPK, srvSK, dc)
+	srvLis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(srvLis, "") }() //nolint:errcheck
+	<-srv.Ready()
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	pk, sk := cipher.GenerateKeyPair()
+	conf := DefaultConfig()
+	conf.EntryUpdateInterval = 50 * time.Millisecond
+	c := NewClient(pk, sk, dc, conf)
+	go c.Serve()
+	<-c.Ready()
+	defer func() { require.NoError(t, c.Close()) }()
+
+	// An entry which is lost by discovery is re-announced without session changes.
+	clearDelegatedServers(t, dc, pk, sk)
+	require.Eventually(t, func() bool {
+		entry, err := dc.Entry(context.TODO(), pk)
+		return err == nil && len(entry.Client.DelegatedServers) == 1 && entry.Client.DelegatedServers[0] == srvPK
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// slowAnnounceDisc is a discovery client which delays updates of client entries with delegated servers.
+type slowAnnounceDisc struct {
+	disc.APIClient
+	delay int64 // nanoseconds, accessed atomically
+}
+
+func (d *slowAnnounceDisc) UpdateEntry(ctx context.Context, sk cipher.SecKey, entry *disc.Entry) error {
+	if entry.Client != nil && len(entry.Client.DelegatedServers) > 0 {
+		time.Sleep(time.Duration(atomic.LoadInt64(&d.delay)))
+	}
+	return d.APIClient.UpdateEntry(ctx, sk, entry)
+}
+
+func TestClient_Close(t *testing.T) {
+	dc := &slowAnnounceDisc{APIClient: disc.NewMock()}
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServer(srvPK, srvSK, dc)
+	srvLis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(srvLis, "") }() //nolint:errcheck
+	<-srv.Ready()
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	// delegatedServers returns the delegated servers of the client entry of 'pk' in discovery.
+	delegatedServers := func(pk cipher.PubKey) []cipher.PubKey {
+		entry, err := dc.Entry(context.TODO(), pk)
+		require.NoError(t, err)
+		return entry.Client.DelegatedServers
+	}
+
+	t.Run("deregisters", func(t *testing.T) {
+		pk, sk := cipher.GenerateKeyPair()
+		c := NewClient(pk, sk, dc, nil)
+		go c.Serve()
+		<-c.Ready()
+		require.Equal(t, []cipher.PubKey{srvPK}, delegatedServers(pk))
+
+		require.NoError(t, c.Close())
+		require.Empty(t, delegatedServers(pk))
+	})
+
+	t.Run("awaits_announcement", func(t *testing.T) {
+		pk, sk := cipher.GenerateKeyPair()
+		c := NewClient(pk, sk, dc, nil)
+		go c.Serve()
+		<-c.Ready()
+
+		// An announcement which is in flight when closing does not outlive deregistering.
+		atomic.StoreInt64(&dc.delay, int64(200*time.Millisecond))
+		defer atomic.StoreInt64(&dc.delay, 0)
+		errCh := make(chan error, 1)
+		go func() { errCh <- c.UpdateEntryNow(context.TODO()) }()
+		time.Sleep(50 * time.Millisecond)
+
+		require.NoError(t, c.Close())
+		require.NoError(t, <-errCh)
+		require.Empty(t, delegatedServers(pk))
+	})
+}
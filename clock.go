@@ -0,0 +1,29 @@
+package dmsg
+
+import "time"
+
+// Clock provides the time to the timers of dmsg entities (such as periodic entry updates, polling intervals and retry
+// back-offs). Tests may replace it via Config.Clock or ServerConfig.Clock (see dmsgtest.VirtualClock), so that
+// timeout-heavy behavior is fast and reproducible.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a Clock at intervals.
+type Ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+// systemClock is the Clock of the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct{ *time.Ticker }
+
+func (t systemTicker) Chan() <-chan time.Time { return t.C }
@@ -0,0 +1,184 @@
+package dmsg
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/cluster"
+)
+
+// ClusterConfig configures a dmsg server as an instance of a cluster: multiple dmsg servers of the same public key,
+// behind a load balancer. Instances share which instance each client has a session with via the router, and forward
+// stream requests to the instance which has a session with the destination client.
+type ClusterConfig struct {
+	// Router shares client session routes between the instances (such as cluster.NewRedis).
+	Router cluster.Router
+
+	// Address is the address which other instances dial to reach this instance (such as the private address of the
+	// server's listener). It also identifies the instance within the cluster.
+	Address string
+}
+
+// setClusterRoute records that the client has a session with this instance (if clustered).
+func (s *Server) setClusterRoute(ctx context.Context, clientPK cipher.PubKey) {
+	if s.conf.Cluster == nil {
+		return
+	}
+	if err := s.conf.Cluster.Router.SetRoute(ctx, clientPK, s.conf.Cluster.Address); err != nil {
+		s.log.WithError(err).WithField("remote_pk", clientPK).Warn("Failed to set cluster route.")
+	}
+}
+
+// delClusterRoute removes the route of the client via this instance (if clustered).
+func (s *Server) delClusterRoute(ctx context.Context, clientPK cipher.PubKey) {
+	if s.conf.Cluster == nil {
+		return
+	}
+	if err := s.conf.Cluster.Router.DelRoute(ctx, clientPK, s.conf.Cluster.Address); err != nil {
+		s.log.WithError(err).WithField("remote_pk", clientPK).Warn("Failed to delete cluster route.")
+	}
+}
+
+// refreshClusterRoutes sets the routes of all sessions every interval, so that they do not expire.
+func (s *Server) refreshClusterRoutes(interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.Chan():
+			s.sessionsMx.Lock()
+			pks := make([]cipher.PubKey, 0, len(s.sessions))
+			for pk := range s.sessions {
+				pks = append(pks, pk)
+			}
+			s.sessionsMx.Unlock()
+
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			for _, pk := range pks {
+				s.setClusterRoute(ctx, pk)
+			}
+			cancel()
+		}
+	}
+}
+
+// clusterSession obtains a session with the instance of the cluster which has a session with the destination client.
+func (s *Server) clusterSession(dstPK cipher.PubKey) (ServerSession, bool) {
+	if s.conf.Cluster == nil {
+		return ServerSession{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	go func() {
+		awaitDone(ctx, s.done)
+		cancel()
+	}()
+
+	log := s.log.WithField("dst_pk", dstPK)
+
+	addr, err := s.conf.Cluster.Router.Route(ctx, dstPK)
+	if err != nil {
+		if err != cluster.ErrNoRoute {
+			log.WithError(err).Warn("Failed to obtain cluster route.")
+		}
+		return ServerSession{}, false
+	}
+	if addr == s.conf.Cluster.Address {
+		return ServerSession{}, false
+	}
+
+	ss, err := s.ensurePeerSession(ctx, addr)
+	if err != nil {
+		log.WithError(err).WithField("instance", addr).Warn("Failed to establish session with cluster instance.")
+		return ServerSession{}, false
+	}
+	return ss, true
+}
+
+// ensurePeerSession obtains a session with the instance of the cluster of the given address, dialing it if it does not
+// exist.
+func (s *Server) ensurePeerSession(ctx context.Context, addr string) (ServerSession, error) {
+	mx := s.dialLock(addr)
+	mx.Lock()
+	defer mx.Unlock()
+
+	s.peersMx.Lock()
+	ss, ok := s.peers[addr]
+	s.peersMx.Unlock()
+	if ok {
+		return ss, nil
+	}
+	s.log.WithField("instance", addr).Info("Dialing cluster instance...")
+
+	deadline := time.Now().Add(s.handshakeTimeout())
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return ServerSession{}, err
+	}
+	if err := s.conf.SocketOptions.Apply(conn); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return ServerSession{}, err
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return ServerSession{}, err
+	}
+	ss = ServerSession{SessionCommon: new(SessionCommon), srv: s}
+	if err := ss.initClient(&s.EntityCommon, conn, s.pk); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return ServerSession{}, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = ss.Close() //nolint:errcheck
+		return ServerSession{}, err
+	}
+
+	s.peersMx.Lock()
+	s.peers[addr] = ss
+	s.peersMx.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.servePeerSession(ss)
+
+		s.peersMx.Lock()
+		delete(s.peers, addr)
+		s.peersMx.Unlock()
+	}()
+	return ss, nil
+}
+
+// servePeerSession serves a session with another instance of the cluster. Such sessions are not tracked as client
+// sessions, as all instances share the same public key.
+func (s *Server) servePeerSession(ss ServerSession) {
+	log := s.log.WithField("remote_pk", ss.RemotePK())
+
+	if s.conf.Cluster == nil {
+		log.WithError(ss.Close()).Warn("Rejected session of the local public key, as the server is not clustered.")
+		return
+	}
+	ss.srv = s
+	log.Info("Serving cluster session.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		awaitDone(ctx, s.done)
+		log.WithError(ss.Close()).Info("Stopped cluster session.")
+	}()
+
+	ss.Serve()
+	cancel()
+}
+
+// isClusterPeer returns true if the session is with another instance of the cluster.
+func (ss *ServerSession) isClusterPeer() bool {
+	return ss.rPK == ss.LocalPK()
+}
@@ -0,0 +1,87 @@
+// Package cluster contains the routers which share client session routing state between instances of a dmsg server
+// cluster (multiple dmsg server instances of one public key, behind a load balancer).
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// DefaultRouteTTL is the default duration after which a route expires, unless it is set again.
+const DefaultRouteTTL = time.Minute * 2
+
+// ErrNoRoute occurs when no instance of the cluster has a session with the client.
+var ErrNoRoute = errors.New("no route to client within cluster")
+
+// Router shares which instance of the cluster each client has a session with.
+// Instances are identified by the address which other instances reach them with.
+type Router interface {
+	// SetRoute records that the client has a session with the given instance.
+	// Routes expire after a TTL, unless they are set again.
+	SetRoute(ctx context.Context, client cipher.PubKey, instance string) error
+
+	// DelRoute removes the route of the client, if the route is still via the given instance.
+	DelRoute(ctx context.Context, client cipher.PubKey, instance string) error
+
+	// Route returns the instance which the client has a session with, or ErrNoRoute.
+	Route(ctx context.Context, client cipher.PubKey) (string, error)
+}
+
+type memoryRoute struct {
+	instance string
+	expiry   time.Time
+}
+
+type memoryRouter struct {
+	ttl    time.Duration
+	routes map[cipher.PubKey]memoryRoute
+	mx     sync.Mutex
+}
+
+// NewMemory returns a Router which keeps routes in memory. It can only be shared between instances of a single process,
+// and is intended for testing.
+// If 'ttl' is 0, DefaultRouteTTL is used.
+func NewMemory(ttl time.Duration) Router {
+	if ttl <= 0 {
+		ttl = DefaultRouteTTL
+	}
+	return &memoryRouter{ttl: ttl, routes: make(map[cipher.PubKey]memoryRoute)}
+}
+
+// SetRoute implements Router.
+func (r *memoryRouter) SetRoute(_ context.Context, client cipher.PubKey, instance string) error {
+	r.mx.Lock()
+	r.routes[client] = memoryRoute{instance: instance, expiry: time.Now().Add(r.ttl)}
+	r.mx.Unlock()
+	return nil
+}
+
+// DelRoute implements Router.
+func (r *memoryRouter) DelRoute(_ context.Context, client cipher.PubKey, instance string) error {
+	r.mx.Lock()
+	if route, ok := r.routes[client]; ok && route.instance == instance {
+		delete(r.routes, client)
+	}
+	r.mx.Unlock()
+	return nil
+}
+
+// Route implements Router.
+func (r *memoryRouter) Route(_ context.Context, client cipher.PubKey) (string, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	route, ok := r.routes[client]
+	if !ok {
+		return "", ErrNoRoute
+	}
+	if time.Now().After(route.expiry) {
+		delete(r.routes, client)
+		return "", ErrNoRoute
+	}
+	return route.instance, nil
+}
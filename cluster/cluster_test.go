@@ -0,0 +1,42 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestMemoryRouter(t *testing.T) {
+	ctx := context.TODO()
+	r := NewMemory(time.Minute)
+	pk, _ := cipher.GenerateKeyPair()
+
+	_, err := r.Route(ctx, pk)
+	require.Equal(t, ErrNoRoute, err)
+
+	require.NoError(t, r.SetRoute(ctx, pk, "10.0.0.1:8080"))
+	instance, err := r.Route(ctx, pk)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1:8080", instance)
+
+	// The client reconnected to another instance, so removing the old route should have no effect.
+	require.NoError(t, r.SetRoute(ctx, pk, "10.0.0.2:8080"))
+	require.NoError(t, r.DelRoute(ctx, pk, "10.0.0.1:8080"))
+	instance, err = r.Route(ctx, pk)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.2:8080", instance)
+
+	require.NoError(t, r.DelRoute(ctx, pk, "10.0.0.2:8080"))
+	_, err = r.Route(ctx, pk)
+	require.Equal(t, ErrNoRoute, err)
+
+	// Routes expire.
+	r.(*memoryRouter).ttl = -time.Second
+	require.NoError(t, r.SetRoute(ctx, pk, "10.0.0.1:8080"))
+	_, err = r.Route(ctx, pk)
+	require.Equal(t, ErrNoRoute, err)
+}
@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+const redisKeyPrefix = "dmsg-cluster:route:"
+
+// delRouteScript deletes the route only if it is still via the given instance.
+var delRouteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+type redisRouter struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedis returns a Router which keeps routes in redis, so that it can be shared between instances on multiple hosts.
+// If 'ttl' is 0, DefaultRouteTTL is used.
+func NewRedis(url, password string, ttl time.Duration) (Router, error) {
+	opt, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	opt.Password = password
+
+	client := redis.NewClient(opt)
+	if _, err := client.Ping().Result(); err != nil {
+		return nil, err
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultRouteTTL
+	}
+	return &redisRouter{client: client, ttl: ttl}, nil
+}
+
+// SetRoute implements Router.
+func (r *redisRouter) SetRoute(ctx context.Context, client cipher.PubKey, instance string) error {
+	return r.client.WithContext(ctx).Set(redisKeyPrefix+client.Hex(), instance, r.ttl).Err()
+}
+
+// DelRoute implements Router.
+func (r *redisRouter) DelRoute(ctx context.Context, client cipher.PubKey, instance string) error {
+	return delRouteScript.Run(r.client.WithContext(ctx), []string{redisKeyPrefix + client.Hex()}, instance).Err()
+}
+
+// Route implements Router.
+func (r *redisRouter) Route(ctx context.Context, client cipher.PubKey) (string, error) {
+	instance, err := r.client.WithContext(ctx).Get(redisKeyPrefix + client.Hex()).Result()
+	if err == redis.Nil {
+		return "", ErrNoRoute
+	}
+	return instance, err
+}
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/agent"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/cmdutil"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// skEnv is the env which the secret key is read from if the 'sk' flag is unset, so that the key is not exposed in the
+// process list.
+const skEnv = "DMSG_AGENT_SK"
+
+var (
+	sk           cipher.SecKey
+	keyFile      string
+	dmsgDisc     = dmsg.DefaultDiscAddr
+	dmsgSessions = dmsg.DefaultMinSessions
+	socket       = agent.DefaultSocket
+)
+
+func init() {
+	rootCmd.Flags().Var(&sk, "sk",
+		"secret key of the dmsg client (if unspecified, it is read from the "+skEnv+" env)")
+
+	rootCmd.Flags().StringVarP(&keyFile, "key-file", "k", keyFile,
+		"path of the key file of the dmsg client (see keygen), used instead of 'sk'")
+
+	rootCmd.Flags().StringVar(&dmsgDisc, "dmsgdisc", dmsgDisc,
+		"dmsg discovery address")
+
+	rootCmd.Flags().IntVar(&dmsgSessions, "dmsgsessions", dmsgSessions,
+		"minimum number of dmsg sessions to ensure")
+
+	rootCmd.Flags().StringVarP(&socket, "socket", "s", socket,
+		"path of the agent's unix socket")
+
+	rootCmd.AddCommand(cmdutil.KeygenCmd())
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "dmsg-agent",
+	Short: "Share the keypair and sessions of a dmsg client with local processes",
+	Long: `Share the keypair and sessions of a dmsg client with local processes.
+
+Local processes open dmsg streams through the agent's unix socket (see package agent), so that they share the
+sessions of the agent instead of each establishing their own. The socket is only accessible by the owner.`,
+	Run: func(*cobra.Command, []string) {
+		logger := logging.MustGetLogger("dmsg-agent")
+
+		if keyFile != "" {
+			_, fileSK, err := cmdutil.ReadKeyFile(keyFile, func() ([]byte, error) {
+				return cmdutil.ReadPassphrase(cmdutil.PassphraseEnv, false, false)
+			})
+			cmdutil.CatchWithLog(logger, "failed to read key file", err)
+			sk = fileSK
+		}
+		if sk.Null() {
+			if err := sk.Set(os.Getenv(skEnv)); err != nil {
+				log.Fatalf("Secret key is not set with the 'sk' flag or the %s env: %v", skEnv, err)
+			}
+		}
+		pk, err := sk.PubKey()
+		cmdutil.CatchWithLog(logger, "failed to derive public key from secret key", err)
+
+		ctx, cancel := cmdutil.SignalContext(context.Background(), logger)
+		defer cancel()
+
+		// Prepare and serve dmsg client.
+		dmsgC := dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc), &dmsg.Config{MinSessions: dmsgSessions})
+		dmsgC.SetLogger(logging.MustGetLogger("dmsg_client"))
+		go func() { _ = dmsgC.ServeContext(ctx) }() //nolint:errcheck
+		defer func() { logger.WithError(dmsgC.Close()).Info("Closed dmsg client.") }()
+
+		// Serve agent socket.
+		lis, err := agent.Listen(socket)
+		cmdutil.CatchWithLog(logger, "failed to listen on agent socket", err)
+		go func() {
+			<-ctx.Done()
+			logger.WithError(lis.Close()).Info("Closed agent socket.")
+		}()
+
+		logger.WithField("pk", pk).WithField("socket", socket).Info("Serving agent socket.")
+		err = agent.New(dmsgC, logger).Serve(lis)
+		logger.WithError(err).Info("Stopped serving agent socket.")
+	},
+}
+
+// Execute executes the root command.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
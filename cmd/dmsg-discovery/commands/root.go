@@ -22,12 +22,14 @@ const redisPasswordEnvName = "REDIS_PASSWORD"
 
 var (
 	addr        string
+	grpcAddr    string
 	metricsAddr string
 	redisURL    string
 	logEnabled  bool
 	syslogAddr  string
 	tag         string
 	testMode    bool
+	powDiff     int
 )
 
 var rootCmd = &cobra.Command{
@@ -62,8 +64,9 @@ var rootCmd = &cobra.Command{
 		logger := api.Logger(apiLogger)
 		metrics := api.Metrics(metrics.NewPrometheus("msgdiscovery"))
 		testingMode := api.UseTestingMode(testMode)
+		powDifficulty := api.PoWDifficulty(powDiff)
 
-		api := api.New(s, logger, metrics, testingMode)
+		api := api.New(s, logger, metrics, testingMode, powDifficulty)
 
 		go func() {
 			http.Handle("/metrics", promhttp.Handler())
@@ -72,6 +75,18 @@ var rootCmd = &cobra.Command{
 			}
 		}()
 
+		if grpcAddr != "" {
+			gl, err := net.Listen("tcp", grpcAddr)
+			if err != nil {
+				log.Fatal("Failed to open gRPC listener: ", err)
+			}
+			go func() {
+				if err := api.ServeGRPC(gl); err != nil {
+					log.Println("Failed to serve gRPC API:", err)
+				}
+			}()
+		}
+
 		if apiLogger != nil {
 			apiLogger.Infof("Listening on %s", addr)
 		}
@@ -81,12 +96,14 @@ var rootCmd = &cobra.Command{
 
 func init() {
 	rootCmd.Flags().StringVarP(&addr, "addr", "a", ":9090", "address to bind to")
+	rootCmd.Flags().StringVar(&grpcAddr, "grpc-addr", "", "address to bind the gRPC API to (disabled if empty)")
 	rootCmd.Flags().StringVarP(&metricsAddr, "metrics", "m", ":2121", "address to bind metrics API to")
 	rootCmd.Flags().StringVar(&redisURL, "redis", "redis://localhost:6379", "connections string for a redis store")
 	rootCmd.Flags().BoolVarP(&logEnabled, "log", "l", true, "enable request logging")
 	rootCmd.Flags().StringVar(&syslogAddr, "syslog", "", "syslog server address. E.g. localhost:514")
 	rootCmd.Flags().StringVar(&tag, "tag", "dmsg-discovery", "logging tag")
 	rootCmd.Flags().BoolVarP(&testMode, "test-mode", "t", false, "in testing mode")
+	rootCmd.Flags().IntVar(&powDiff, "pow-difficulty", 0, "required entry proof-of-work difficulty in bits (0 to disable)")
 }
 
 // Execute executes root CLI command.
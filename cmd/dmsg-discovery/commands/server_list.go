@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+var (
+	slSK        cipher.SecKey
+	slServers   cipher.PubKeys
+	slDiscovery string
+	slTimeout   time.Duration
+)
+
+func init() {
+	serverListCmd.Flags().Var(&slSK, "sk", "operator secret key used to sign the server list")
+	serverListCmd.Flags().Var(&slServers, "servers", "comma-separated public keys of approved servers")
+	serverListCmd.Flags().StringVar(&slDiscovery, "discovery", "http://localhost:9090",
+		"dmsg discovery to obtain server entries from")
+	serverListCmd.Flags().DurationVar(&slTimeout, "timeout", time.Second*30, "timeout for obtaining server entries")
+	rootCmd.AddCommand(serverListCmd)
+}
+
+var serverListCmd = &cobra.Command{
+	Use:   "server-list",
+	Short: "Generates a signed list of approved dmsg servers",
+	Long: `Generates a signed list of approved dmsg servers, and writes it to STDOUT.
+
+Clients which are configured with the operator's public key only establish sessions with servers of the published
+list. The entries of the servers are snapshotted from dmsg discovery.`,
+	Run: func(_ *cobra.Command, _ []string) {
+		if slSK.Null() {
+			log.Fatal("Flag 'sk' is required.")
+		}
+		operator, err := slSK.PubKey()
+		if err != nil {
+			log.Fatal("Invalid operator secret key: ", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), slTimeout)
+		defer cancel()
+
+		dc := disc.NewHTTP(slDiscovery)
+		entries := make([]*disc.Entry, 0, len(slServers))
+		for _, pk := range slServers {
+			entry, err := dc.Entry(ctx, pk)
+			if err != nil {
+				log.Fatalf("Failed to obtain entry of server %s: %v", pk, err)
+			}
+			if entry.Server == nil {
+				log.Fatalf("Entry of %s is not of a server.", pk)
+			}
+			entries = append(entries, entry)
+		}
+
+		if err := disc.VerifySignatures(entries); err != nil {
+			log.Fatal("Invalid server entry: ", err)
+		}
+
+		list := disc.NewServerList(operator, entries)
+		if err := list.Sign(slSK); err != nil {
+			log.Fatal("Failed to sign server list: ", err)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(list); err != nil {
+			log.Fatal("Failed to write server list: ", err)
+		}
+	},
+}
@@ -0,0 +1,20 @@
+// Package discserver exposes the dmsg discovery HTTP server so that it can be embedded outside of the dmsg-discovery
+// binary (such as within integration tests).
+package discserver
+
+import (
+	"net/http"
+
+	"github.com/SkycoinProject/dmsg/cmd/dmsg-discovery/internal/api"
+	"github.com/SkycoinProject/dmsg/cmd/dmsg-discovery/internal/store"
+)
+
+// NewInMemory returns the dmsg discovery HTTP handler backed by an in-memory store.
+// If 'testingMode' is set, dmsg servers are allowed to advertise loopback addresses.
+func NewInMemory(testingMode bool) (http.Handler, error) {
+	s, err := store.NewStore("mock")
+	if err != nil {
+		return nil, err
+	}
+	return api.New(s, api.UseTestingMode(testingMode)), nil
+}
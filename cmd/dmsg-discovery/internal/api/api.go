@@ -1,12 +1,14 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 	"github.com/gorilla/handlers"
@@ -24,18 +26,20 @@ const maxServers = 10
 
 // API represents the api of the dmsg-discovery service`
 type API struct {
-	mux         *http.ServeMux
-	store       store2.Storer
-	logger      *logging.Logger
-	metrics     metrics.Recorder
-	testingMode bool
+	mux           *http.ServeMux
+	store         store2.Storer
+	logger        *logging.Logger
+	metrics       metrics.Recorder
+	testingMode   bool
+	powDifficulty int
 }
 
 // Options is a structure with API configurations
 type Options struct {
-	logger      *logging.Logger
-	metrics     metrics.Recorder
-	testingMode bool
+	logger        *logging.Logger
+	metrics       metrics.Recorder
+	testingMode   bool
+	powDifficulty int
 }
 
 // Option is a wrapper that allows Functional Options
@@ -66,6 +70,14 @@ func UseTestingMode(testing bool) Option {
 	}
 }
 
+// PoWDifficulty is a function to pass the required entry proof-of-work difficulty option to API
+// Entries with an insufficient proof-of-work are rejected. A difficulty of 0 disables the check.
+func PoWDifficulty(difficulty int) Option {
+	return func(args *Options) {
+		args.powDifficulty = difficulty
+	}
+}
+
 // New returns a new API object, which can be started as a server
 func New(storer store2.Storer, options ...Option) *API {
 	var args Options
@@ -78,16 +90,18 @@ func New(storer store2.Storer, options ...Option) *API {
 
 	mux := http.NewServeMux()
 	api := &API{
-		mux:         mux,
-		store:       storer,
-		logger:      args.logger,
-		metrics:     args.metrics,
-		testingMode: args.testingMode,
+		mux:           mux,
+		store:         storer,
+		logger:        args.logger,
+		metrics:       args.metrics,
+		testingMode:   args.testingMode,
+		powDifficulty: args.powDifficulty,
 	}
 
 	// routes
 	mux.HandleFunc("/dmsg-discovery/entry/", api.muxEntry())
 	mux.HandleFunc("/dmsg-discovery/available_servers", api.getAvailableServer())
+	mux.HandleFunc("/dmsg-discovery/service/", api.muxService())
 
 	return api
 }
@@ -172,77 +186,101 @@ func (a *API) setEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	msg, err := a.storeEntry(r.Context(), entry)
+	if err != nil {
+		a.handleError(w, err)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, msg)
+}
+
+// storeEntry validates the given entry and stores it, if it is a new entry or a valid iteration of the previous one.
+func (a *API) storeEntry(ctx context.Context, entry *disc.Entry) (disc.HTTPMessage, error) {
 	if entry.Server != nil && !a.testingMode {
-		if ok, err := isLoopbackAddr(entry.Server.Address); ok {
-			if err != nil && a.logger != nil {
-				a.logger.Warningf("failed to parse hostname and port: %s", err)
-			}
+		addrs := entry.Server.AllAddresses()
+		for _, r := range entry.Server.Records {
+			addrs = append(addrs, r.Address)
+		}
+		for _, addr := range addrs {
+			if ok, err := isLoopbackAddr(addr); ok {
+				if err != nil && a.logger != nil {
+					a.logger.Warningf("failed to parse hostname and port: %s", err)
+				}
 
-			a.handleError(w, disc.ErrValidationServerAddress)
+				return disc.HTTPMessage{}, disc.ErrValidationServerAddress
+			}
 		}
 	}
 
-	err = entry.Validate()
-	if err != nil {
-		a.handleError(w, err)
-		return
+	if err := entry.Validate(); err != nil {
+		return disc.HTTPMessage{}, err
 	}
 
-	err = entry.VerifySignature()
-	if err != nil {
-		a.handleError(w, disc.ErrUnauthorized)
-		return
+	if err := entry.VerifySignature(); err != nil {
+		return disc.HTTPMessage{}, disc.ErrUnauthorized
+	}
+
+	// Proof-of-work makes flooding the discovery with cheaply generated keys expensive.
+	if a.powDifficulty > 0 {
+		if err := entry.VerifyPoW(a.powDifficulty); err != nil {
+			return disc.HTTPMessage{}, err
+		}
 	}
 
 	// Recover previous entry. If key not found we insert with sequence 0
 	// If there was a previous entry we check the new one is a valid iteration
-	oldEntry, err := a.store.Entry(r.Context(), entry.Static)
+	oldEntry, err := a.store.Entry(ctx, entry.Static)
 	if err == disc.ErrKeyNotFound {
 		if entry.Sequence != 0 {
-			a.handleError(w, disc.ErrValidationNonZeroSequence)
-			return
+			return disc.HTTPMessage{}, disc.ErrValidationNonZeroSequence
 		}
 
-		setErr := a.store.SetEntry(r.Context(), entry)
-		if setErr != nil {
-			a.handleError(w, setErr)
-			return
+		if err = a.store.SetEntry(ctx, entry); err != nil {
+			return disc.HTTPMessage{}, err
 		}
 
-		a.writeJSON(w, http.StatusOK, disc.MsgEntrySet)
-
-		return
+		return disc.MsgEntrySet, nil
 	} else if err != nil {
-		a.handleError(w, err)
-		return
+		return disc.HTTPMessage{}, err
 	}
 
-	err = oldEntry.ValidateIteration(entry)
-	if err != nil {
-		a.handleError(w, err)
-		return
+	if err = oldEntry.ValidateIteration(entry); err != nil {
+		return disc.HTTPMessage{}, err
 	}
 
-	err = a.store.SetEntry(r.Context(), entry)
-	if err != nil {
-		a.handleError(w, err)
-		return
+	if err = a.store.SetEntry(ctx, entry); err != nil {
+		return disc.HTTPMessage{}, err
 	}
 
-	a.writeJSON(w, http.StatusOK, disc.MsgEntryUpdated)
+	return disc.MsgEntryUpdated, nil
 }
 
 // getAvailableServers returns all available server entries as an array of json codified entry objects
 // URI: /dmsg-discovery/available_servers
 // Method: GET
+// Query (optional): offset, limit, region, min_version, network_id
+// Without a query, a random subset of at most 'maxServers' servers is returned. With a query, servers are filtered,
+// ordered by public key and paginated.
 func (a *API) getAvailableServer() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		entries, err := a.store.AvailableServers(r.Context(), maxServers)
+		q, err := disc.ParseServersQuery(r.URL.Query())
 		if err != nil {
 			a.handleError(w, err)
 			return
 		}
 
+		entries, err := a.availableServers(r.Context(), q)
+		if err != nil {
+			a.handleError(w, err)
+			return
+		}
+		if !q.IsEmpty() {
+			// Paginated listings may legitimately be empty.
+			a.writeJSON(w, http.StatusOK, entries)
+			return
+		}
+
 		if len(entries) == 0 {
 			a.writeJSON(w, http.StatusNotFound, disc.HTTPMessage{
 				Code:    http.StatusNotFound,
@@ -256,6 +294,111 @@ func (a *API) getAvailableServer() http.HandlerFunc {
 	}
 }
 
+// availableServers obtains available servers of the given query.
+// With an empty query, a random subset of at most 'maxServers' servers is returned.
+func (a *API) availableServers(ctx context.Context, q disc.ServersQuery) ([]*disc.Entry, error) {
+	if q.IsEmpty() {
+		return a.store.AvailableServers(ctx, maxServers)
+	}
+	entries, err := a.store.AvailableServers(ctx, 0) // all servers
+	if err != nil {
+		return nil, err
+	}
+	return q.Apply(entries), nil
+}
+
+// muxService calls either getServices or setService depending on the
+// http method used on the endpoint /dmsg-discovery/service/:name
+func (a *API) muxService() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			a.setService(w, r)
+		default:
+			a.getServices(w, r)
+		}
+	}
+}
+
+// getServices returns the valid records of the given service name, of which the newest come first
+// URI: /dmsg-discovery/service/:name
+// Method: GET
+func (a *API) getServices(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/dmsg-discovery/service/")
+	if !disc.ValidServiceName(name) {
+		a.handleError(w, disc.ErrBadInput)
+		return
+	}
+
+	records, err := a.store.Services(r.Context(), name)
+	if err != nil {
+		a.handleError(w, err)
+		return
+	}
+
+	if records = disc.ValidServices(name, records, time.Now()); len(records) == 0 {
+		a.handleError(w, disc.ErrServiceNotFound)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, records)
+}
+
+// setService registers a service record, replacing the previous record of
+// the same name and public key if the new one is more recent
+// URI: /dmsg-discovery/service/
+// Method: POST
+// Args:
+//	json serialized service record
+func (a *API) setService(w http.ResponseWriter, r *http.Request) {
+	record := &disc.ServiceRecord{}
+
+	err := json.NewDecoder(r.Body).Decode(record)
+
+	defer func() {
+		if err := r.Body.Close(); err != nil {
+			log.WithError(err).Warn("Failed to decode HTTP response body")
+		}
+	}()
+
+	if err != nil {
+		a.handleError(w, disc.ErrBadInput)
+		return
+	}
+
+	if err := a.storeService(r.Context(), record); err != nil {
+		a.handleError(w, err)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, disc.MsgServiceSet)
+}
+
+// storeService validates the given service record and stores it, if it is more recent than the previous record of
+// the same name and public key.
+func (a *API) storeService(ctx context.Context, record *disc.ServiceRecord) error {
+	if err := record.Validate(time.Now()); err != nil {
+		return err
+	}
+
+	if err := record.VerifySignature(); err != nil {
+		return disc.ErrUnauthorized
+	}
+
+	records, err := a.store.Services(ctx, record.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, prev := range records {
+		if prev.PK == record.PK && prev.Timestamp >= record.Timestamp {
+			return disc.ErrValidationWrongTime
+		}
+	}
+
+	return a.store.SetService(ctx, record)
+}
+
 // isLoopbackAddr checks if string is loopback interface
 func isLoopbackAddr(addr string) (bool, error) {
 	host, _, err := net.SplitHostPort(addr)
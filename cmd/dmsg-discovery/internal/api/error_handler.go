@@ -23,6 +23,10 @@ var apiErrors = map[error]func() (int, string){
 	disc.ErrBadInput: func() (int, string) {
 		return http.StatusBadRequest, disc.ErrBadInput.Error()
 	},
+
+	disc.ErrServiceNotFound: func() (int, string) {
+		return http.StatusNotFound, disc.ErrServiceNotFound.Error()
+	},
 }
 
 func (a *API) handleError(w http.ResponseWriter, e error) {
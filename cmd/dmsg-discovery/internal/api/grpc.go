@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/disc/discgrpc"
+)
+
+// watchInterval is the interval in which the store is checked for changes of entries watched via gRPC.
+const watchInterval = time.Second
+
+// ServeGRPC serves the API over gRPC on the given listener.
+// Unlike HTTP, the gRPC API supports pushing entry changes to watching clients (see discgrpc.NewClient).
+func (a *API) ServeGRPC(lis net.Listener) error {
+	s := grpc.NewServer()
+	discgrpc.RegisterServer(s, &grpcAPI{a: a})
+	return s.Serve(lis)
+}
+
+// grpcAPI implements discgrpc.Server.
+type grpcAPI struct {
+	a *API
+}
+
+func (g *grpcAPI) Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	return g.a.store.Entry(ctx, pk)
+}
+
+func (g *grpcAPI) SetEntry(ctx context.Context, entry *disc.Entry) error {
+	_, err := g.a.storeEntry(ctx, entry)
+	return err
+}
+
+func (g *grpcAPI) AvailableServers(ctx context.Context, q disc.ServersQuery) ([]*disc.Entry, error) {
+	return g.a.availableServers(ctx, q)
+}
+
+func (g *grpcAPI) WatchEntry(ctx context.Context, pk cipher.PubKey, send func(*disc.Entry) error) error {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	var last *disc.Entry
+	for {
+		entry, err := g.a.store.Entry(ctx, pk)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err == disc.ErrKeyNotFound:
+			// The entry may be set later.
+		case err != nil:
+			return err
+		case last == nil || entry.Sequence != last.Sequence || entry.Timestamp != last.Timestamp:
+			if err := send(entry); err != nil {
+				return err
+			}
+			last = entry
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	store2 "github.com/SkycoinProject/dmsg/cmd/dmsg-discovery/internal/store"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestAPI_PoWDifficulty(t *testing.T) {
+	const difficulty = 8
+	ctx := context.Background()
+
+	dbMock, err := store2.NewStore("mock", "")
+	require.NoError(t, err)
+	api := New(dbMock, PoWDifficulty(difficulty))
+
+	pk, sk := cipher.GenerateKeyPair()
+	entry := disc.NewClientEntry(pk, 0, nil)
+	entry.PoW, err = disc.SolvePoW(ctx, pk, difficulty)
+	require.NoError(t, err)
+
+	// An entry without a sufficient proof-of-work is rejected.
+	noPoW := disc.NewClientEntry(pk, 0, nil)
+	for disc.PoWDifficulty(pk, noPoW.PoW) >= difficulty {
+		noPoW.PoW++
+	}
+	require.NoError(t, noPoW.Sign(sk))
+	_, err = api.storeEntry(ctx, noPoW)
+	require.Equal(t, disc.ErrValidationInsufficientPoW, err)
+
+	require.NoError(t, entry.Sign(sk))
+	msg, err := api.storeEntry(ctx, entry)
+	require.NoError(t, err)
+	require.Equal(t, disc.MsgEntrySet, msg)
+}
@@ -64,7 +64,12 @@ func (r *redisStore) SetEntry(ctx context.Context, entry *disc.Entry) error {
 	}
 
 	if entry.Server != nil {
-		err = r.client.SAdd("servers", entry.Static.Hex()).Err()
+		// Servers with no available connections (such as servers which have shut down) are not advertised.
+		if entry.Server.AvailableConnections > 0 {
+			err = r.client.SAdd("servers", entry.Static.Hex()).Err()
+		} else {
+			err = r.client.SRem("servers", entry.Static.Hex()).Err()
+		}
 		if err != nil {
 			return disc.ErrUnexpected
 		}
@@ -77,7 +82,13 @@ func (r *redisStore) SetEntry(ctx context.Context, entry *disc.Entry) error {
 func (r *redisStore) AvailableServers(ctx context.Context, maxCount int) ([]*disc.Entry, error) {
 	var entries []*disc.Entry
 
-	pks, err := r.client.SRandMemberN("servers", int64(maxCount)).Result()
+	var pks []string
+	var err error
+	if maxCount > 0 {
+		pks, err = r.client.SRandMemberN("servers", int64(maxCount)).Result()
+	} else {
+		pks, err = r.client.SMembers("servers").Result()
+	}
 	if err != nil {
 		return nil, disc.ErrUnexpected
 	}
@@ -103,3 +114,49 @@ func (r *redisStore) AvailableServers(ctx context.Context, maxCount int) ([]*dis
 
 	return entries, nil
 }
+
+// Services implements Storer Services method for redisdb database
+func (r *redisStore) Services(ctx context.Context, name string) ([]*disc.ServiceRecord, error) {
+	payloads, err := r.client.HGetAll(serviceKey(name)).Result()
+	if err != nil {
+		return nil, disc.ErrUnexpected
+	}
+
+	records := make([]*disc.ServiceRecord, 0, len(payloads))
+	for _, payload := range payloads {
+		var record *disc.ServiceRecord
+		if err := json.Unmarshal([]byte(payload), &record); err != nil {
+			log.WithError(err).Warnf("Failed to unmarshal payload %s", payload)
+			continue
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// SetService implements Storer SetService method for redisdb database
+func (r *redisStore) SetService(ctx context.Context, record *disc.ServiceRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return disc.ErrUnexpected
+	}
+
+	// Records of a name expire together once none of them is refreshed within the TTL.
+	key := serviceKey(record.Name)
+	_, err = r.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HSet(key, record.PK.Hex(), payload)
+		pipe.Expire(key, disc.ServiceTTL)
+		return nil
+	})
+	if err != nil {
+		return disc.ErrUnexpected
+	}
+
+	return nil
+}
+
+func serviceKey(name string) string {
+	return "service:" + name
+}
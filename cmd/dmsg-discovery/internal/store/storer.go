@@ -28,7 +28,15 @@ type Storer interface {
 	SetEntry(ctx context.Context, entry *disc.Entry) error
 
 	// AvailableServers discovers available dmsg servers.
+	// At most 'maxCount' random servers are returned, or all servers if 'maxCount' is 0.
 	AvailableServers(ctx context.Context, maxCount int) ([]*disc.Entry, error)
+
+	// Services obtains the service records of the given name (including expired records).
+	Services(ctx context.Context, name string) ([]*disc.ServiceRecord, error)
+
+	// SetService sets a service record, replacing the record of the same name and public key.
+	// This is unsafe and does not check signature.
+	SetService(ctx context.Context, record *disc.ServiceRecord) error
 }
 
 // NewStore returns an initialized store, name represents which
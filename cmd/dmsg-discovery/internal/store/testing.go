@@ -15,6 +15,9 @@ type MockStore struct {
 	serversLock sync.RWMutex
 	m           map[string][]byte
 	servers     map[string][]byte
+
+	servicesLock sync.RWMutex
+	services     map[string]map[string][]byte // by name and public key
 }
 
 func (ms *MockStore) setEntry(staticPubKey string, payload []byte) {
@@ -40,11 +43,19 @@ func (ms *MockStore) setServer(staticPubKey string, payload []byte) {
 	ms.servers[staticPubKey] = payload
 }
 
+func (ms *MockStore) delServer(staticPubKey string) {
+	ms.serversLock.Lock()
+	defer ms.serversLock.Unlock()
+
+	delete(ms.servers, staticPubKey)
+}
+
 // newMock returns a storer mock
 func newMock() Storer {
 	return &MockStore{
-		m:       map[string][]byte{},
-		servers: map[string][]byte{},
+		m:        map[string][]byte{},
+		servers:  map[string][]byte{},
+		services: map[string]map[string][]byte{},
 	}
 }
 
@@ -81,7 +92,11 @@ func (ms *MockStore) SetEntry(ctx context.Context, entry *disc.Entry) error {
 	ms.setEntry(entry.Static.Hex(), payload)
 
 	if entry.Server != nil {
-		ms.setServer(entry.Static.Hex(), payload)
+		if entry.Server.AvailableConnections > 0 {
+			ms.setServer(entry.Static.Hex(), payload)
+		} else {
+			ms.delServer(entry.Static.Hex())
+		}
 	}
 
 	return nil
@@ -91,6 +106,7 @@ func (ms *MockStore) SetEntry(ctx context.Context, entry *disc.Entry) error {
 func (ms *MockStore) Clear() {
 	ms.m = map[string][]byte{}
 	ms.servers = map[string][]byte{}
+	ms.services = map[string]map[string][]byte{}
 }
 
 // AvailableServers implements Storer AvailableServers method for MockStore
@@ -115,6 +131,42 @@ func (ms *MockStore) AvailableServers(ctx context.Context, maxCount int) ([]*dis
 	return entries, nil
 }
 
+// Services implements Storer Services method for MockStore
+func (ms *MockStore) Services(ctx context.Context, name string) ([]*disc.ServiceRecord, error) {
+	ms.servicesLock.RLock()
+	defer ms.servicesLock.RUnlock()
+
+	records := make([]*disc.ServiceRecord, 0, len(ms.services[name]))
+	for _, payload := range ms.services[name] {
+		var r disc.ServiceRecord
+		if err := json.Unmarshal(payload, &r); err != nil {
+			return nil, disc.ErrUnexpected
+		}
+
+		records = append(records, &r)
+	}
+
+	return records, nil
+}
+
+// SetService implements Storer SetService method for MockStore
+func (ms *MockStore) SetService(ctx context.Context, record *disc.ServiceRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return disc.ErrUnexpected
+	}
+
+	ms.servicesLock.Lock()
+	defer ms.servicesLock.Unlock()
+
+	if ms.services[record.Name] == nil {
+		ms.services[record.Name] = map[string][]byte{}
+	}
+	ms.services[record.Name][record.PK.Hex()] = payload
+
+	return nil
+}
+
 func arrayFromMap(m map[string][]byte) [][]byte {
 	entries := make([][]byte, 0)
 
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg/cmdutil"
+	"github.com/SkycoinProject/dmsg/introspect"
+)
+
+var (
+	socket   = introspect.DefaultSocket
+	interval time.Duration
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&socket, "socket", "s", socket,
+		"path of the introspection socket of the dmsg client")
+
+	rootCmd.Flags().DurationVarP(&interval, "watch", "w", 0,
+		"refresh interval (if unspecified, the state is printed once)")
+
+	rootCmd.AddCommand(logLevelCmd)
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "dmsg-inspect",
+	Short: "Print the sessions and streams of a dmsg client",
+	Long: `Print the sessions and streams of a dmsg client.
+
+The dmsg client should be started with its introspection socket enabled.`,
+	RunE: func(*cobra.Command, []string) error {
+		c, err := introspect.Dial(socket)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = c.Close() }() //nolint:errcheck
+
+		if interval <= 0 {
+			return printState(os.Stdout, c)
+		}
+
+		ctx, cancel := cmdutil.SignalContext(context.Background(), nil)
+		defer cancel()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			fmt.Print("\033[H\033[2J") // clear screen
+			fmt.Println(time.Now().Format(time.RFC3339))
+			if err := printState(os.Stdout, c); err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+var logLevelCmd = &cobra.Command{
+	Use:   "log-level <level> [subsystem]",
+	Short: "Set the log level of the dmsg client (or of one of its subsystems)",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		c, err := introspect.Dial(socket)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = c.Close() }() //nolint:errcheck
+
+		var subsystem string
+		if len(args) > 1 {
+			subsystem = args[1]
+		}
+		return c.SetLogLevel(subsystem, args[0])
+	},
+}
+
+// printState prints the sessions and streams of the dmsg client as tables.
+func printState(w io.Writer, c *introspect.Client) error {
+	sessions, err := c.Sessions()
+	if err != nil {
+		return err
+	}
+	streams, err := c.Streams()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "SESSIONS (%d)\n", len(sessions))
+	fmt.Fprintln(tw, "SERVER\tREMOTE ADDR\tSTREAMS")
+	for _, s := range sessions {
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", s.ServerPK, s.RemoteAddr, s.Streams)
+	}
+	fmt.Fprintf(tw, "\nSTREAMS (%d)\n", len(streams))
+	fmt.Fprintln(tw, "ID\tLOCAL\tREMOTE\tSERVER\tDIR\tAGE\tREAD\tWRITTEN\tQUEUED\tBLOCKED")
+	for _, s := range streams {
+		dir := "in"
+		if s.Initiator {
+			dir = "out"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%t\n",
+			s.ID, s.Local, s.Remote, s.ServerPK.String()[:8], dir, s.Age.Truncate(time.Second),
+			s.BytesRead, s.BytesWritten, s.QueuedBytes, s.PendingWrite)
+	}
+	return tw.Flush()
+}
+
+// Execute executes the root command.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
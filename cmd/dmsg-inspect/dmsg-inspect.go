@@ -0,0 +1,7 @@
+package main
+
+import "github.com/SkycoinProject/dmsg/cmd/dmsg-inspect/commands"
+
+func main() {
+	commands.Execute()
+}
@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg/cmdutil"
+	"github.com/SkycoinProject/dmsg/loadtest"
+)
+
+func init() {
+	rootCmd.AddCommand(echoCmd)
+}
+
+var echoCmd = &cobra.Command{
+	Use:   "echo",
+	Short: "runs a dmsg echo service which load tests can be ran against",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := cmdutil.SignalContext(context.Background(), log)
+		defer cancel()
+
+		dmsgC := startClient(ctx)
+		defer func() { log.WithError(dmsgC.Close()).Info("Closed dmsg client.") }()
+
+		lis, err := dmsgC.Listen(dmsgPort)
+		cmdutil.CatchWithLog(log, "failed to listen on dmsg port", err)
+		go func() {
+			<-ctx.Done()
+			log.WithError(lis.Close()).Info("Closed dmsg listener.")
+		}()
+
+		log.WithField("addr", lis.DmsgAddr()).Info("Serving echo service.")
+		log.WithError(loadtest.ServeEcho(lis)).Info("Stopped serving echo service.")
+	},
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/cmdutil"
+	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/loadtest"
+)
+
+var log = logging.MustGetLogger("dmsg-loadgen")
+
+var (
+	sk           cipher.SecKey
+	dmsgDisc     = dmsg.DefaultDiscAddr
+	dmsgSessions = dmsg.DefaultMinSessions
+	dmsgPort     = loadtest.DefaultPort
+
+	dstPK cipher.PubKey
+	conf  = loadtest.DefaultConfig()
+)
+
+func init() {
+	rootCmd.PersistentFlags().Var(&sk, "sk",
+		"secret key of the dmsg client (if unspecified, a random key is generated)")
+
+	rootCmd.PersistentFlags().StringVar(&dmsgDisc, "dmsgdisc", dmsgDisc,
+		"dmsg discovery address")
+
+	rootCmd.PersistentFlags().IntVar(&dmsgSessions, "dmsgsessions", dmsgSessions,
+		"minimum number of dmsg sessions to ensure")
+
+	rootCmd.PersistentFlags().Uint16Var(&dmsgPort, "dmsgport", dmsgPort,
+		"dmsg port of the echo service")
+
+	rootCmd.Flags().Var(&dstPK, "pk",
+		"public key of the dmsg client running the echo service")
+
+	rootCmd.Flags().IntVar(&conf.Streams, "streams", conf.Streams,
+		"number of concurrent streams to open")
+
+	rootCmd.Flags().IntVar(&conf.MsgSize, "msg-size", conf.MsgSize,
+		"size in bytes of each message")
+
+	rootCmd.Flags().IntVar(&conf.MsgRate, "msg-rate", conf.MsgRate,
+		"messages written per second per stream (0 for no limit)")
+
+	rootCmd.Flags().DurationVar(&conf.Duration, "duration", conf.Duration,
+		"duration in which messages are written")
+
+	rootCmd.Flags().DurationVar(&conf.DrainTimeout, "drain", conf.DrainTimeout,
+		"duration to wait for outstanding echoes after writing stops")
+}
+
+var rootCmd = &cobra.Command{
+	Use:   cmdutil.RootCmdName(),
+	Short: "generates load against a dmsg echo service and reports latencies and drops",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := cmdutil.SignalContext(context.Background(), log)
+		defer cancel()
+
+		if dstPK.Null() {
+			log.Fatal("Value 'pk' is required.")
+		}
+
+		dmsgC := startClient(ctx)
+		defer func() { log.WithError(dmsgC.Close()).Info("Closed dmsg client.") }()
+
+		dst := dmsg.Addr{PK: dstPK, Port: dmsgPort}
+		log.WithField("dst", dst).
+			WithField("streams", conf.Streams).
+			WithField("duration", conf.Duration).
+			Info("Starting load test...")
+
+		rep, err := loadtest.Run(ctx, dmsgC, dst, conf)
+		cmdutil.CatchWithLog(log, "load test failed", err)
+
+		fmt.Printf("streams:       %d (dial errors: %d, stream errors: %d)\n",
+			rep.Streams, rep.DialErrors, rep.StreamErrors)
+		fmt.Printf("messages:      %d sent, %d received, %d dropped\n",
+			rep.Sent, rep.Received, rep.Dropped())
+		fmt.Printf("throughput:    %.2f bytes/s\n", rep.Throughput())
+		fmt.Printf("latency p50:   %v\n", rep.Latency(50))
+		fmt.Printf("latency p90:   %v\n", rep.Latency(90))
+		fmt.Printf("latency p99:   %v\n", rep.Latency(99))
+		fmt.Printf("latency max:   %v\n", rep.Latency(100))
+	},
+}
+
+// startClient starts a dmsg client and waits until it is ready.
+func startClient(ctx context.Context) *dmsg.Client {
+	var pk cipher.PubKey
+	if sk.Null() {
+		pk, sk = cipher.GenerateKeyPair()
+	} else {
+		var err error
+		pk, err = sk.PubKey()
+		cmdutil.CatchWithLog(log, "failed to derive public key from secret key", err)
+	}
+
+	dmsgC := dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc), &dmsg.Config{
+		MinSessions: dmsgSessions,
+	})
+	go func() { _ = dmsgC.ServeContext(ctx) }() //nolint:errcheck
+	select {
+	case <-ctx.Done():
+		cmdutil.CatchWithLog(log, "failed to wait until dmsg client to be ready", ctx.Err())
+	case <-dmsgC.Ready():
+	}
+	log.WithField("pk", pk).Info("Dmsg client ready.")
+	return dmsgC
+}
+
+// Execute executes the root command.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,141 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// Config is the config of dmsg-proxy.
+type Config struct {
+	Routes []Route `json:"routes"`
+}
+
+// Route publishes a local HTTP upstream on a dmsg port.
+type Route struct {
+	DmsgPort    uint16          `json:"dmsg_port"`
+	UpstreamURL string          `json:"upstream_url"`
+	AllowedPKs  []cipher.PubKey `json:"allowed_pks,omitempty"` // if empty, all remotes are allowed
+}
+
+// parseConfig reads the config from the file at the given path.
+func parseConfig(path string) (*Config, error) {
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() //nolint:errcheck
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	conf := new(Config)
+	if err := dec.Decode(conf); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %v", err)
+	}
+	return conf, conf.Validate()
+}
+
+// Validate checks that routes have distinct dmsg ports and valid upstream URLs.
+func (c *Config) Validate() error {
+	if len(c.Routes) == 0 {
+		return errors.New("config has no routes")
+	}
+	ports := make(map[uint16]bool, len(c.Routes))
+	for i, r := range c.Routes {
+		if r.DmsgPort == 0 {
+			return fmt.Errorf("routes[%d]: dmsg_port is unset", i)
+		}
+		if ports[r.DmsgPort] {
+			return fmt.Errorf("routes[%d]: dmsg_port %d is used by another route", i, r.DmsgPort)
+		}
+		ports[r.DmsgPort] = true
+		if _, err := r.upstream(); err != nil {
+			return fmt.Errorf("routes[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (r Route) upstream() (*url.URL, error) {
+	u, err := url.Parse(r.UpstreamURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream_url: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("upstream_url '%s' should be an absolute http(s) URL", r.UpstreamURL)
+	}
+	return u, nil
+}
+
+// serveRoute proxies HTTP requests of streams accepted on the route's dmsg port to its upstream, until the context is
+// canceled. The public key of the remote is passed to the upstream in the X-Forwarded-For header.
+func serveRoute(ctx context.Context, lp dmsg.ListenerProvider, r Route, log logrus.FieldLogger) error {
+	u, err := r.upstream()
+	if err != nil {
+		return err
+	}
+	lis, err := lp.ListenNet(r.DmsgPort)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:     httputil.NewSingleHostReverseProxy(u),
+		IdleTimeout: time.Minute,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close() //nolint:errcheck
+	}()
+
+	log.WithField("allowed_pks", len(r.AllowedPKs)).Info("Serving route.")
+	if err := srv.Serve(newAllowListener(lis, r.AllowedPKs, log)); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// allowListener only accepts streams of the allowed remotes. Streams of other remotes are closed.
+type allowListener struct {
+	net.Listener
+	allowed map[cipher.PubKey]bool // nil if all remotes are allowed
+	log     logrus.FieldLogger
+}
+
+func newAllowListener(lis net.Listener, pks []cipher.PubKey, log logrus.FieldLogger) net.Listener {
+	if len(pks) == 0 {
+		return lis
+	}
+	allowed := make(map[cipher.PubKey]bool, len(pks))
+	for _, pk := range pks {
+		allowed[pk] = true
+	}
+	return &allowListener{Listener: lis, allowed: allowed, log: log}
+}
+
+// Accept implements net.Listener
+func (l *allowListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if addr, ok := conn.RemoteAddr().(dmsg.Addr); ok && l.allowed[addr.PK] {
+			return conn, nil
+		}
+		l.log.WithField("remote", conn.RemoteAddr()).Debug("Rejected stream of remote which is not allowed.")
+		_ = conn.Close() //nolint:errcheck
+	}
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/cmdutil"
+	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/dmsglan"
+)
+
+// skEnv is the env which the secret key is read from if neither the 'sk' nor the 'key-file' flag is set.
+const skEnv = "DMSG_PROXY_SK"
+
+var (
+	sk           cipher.SecKey
+	keyFile      string
+	dmsgDisc     = dmsg.DefaultDiscAddr
+	dmsgSessions = dmsg.DefaultMinSessions
+	lan          bool
+)
+
+func init() {
+	rootCmd.Flags().Var(&sk, "sk",
+		"secret key of the dmsg client (if unspecified, it is read from the "+skEnv+" env)")
+
+	rootCmd.Flags().StringVarP(&keyFile, "key-file", "k", keyFile,
+		"path of the key file of the dmsg client (see keygen), used instead of 'sk'")
+
+	rootCmd.Flags().StringVar(&dmsgDisc, "dmsgdisc", dmsgDisc,
+		"dmsg discovery address")
+
+	rootCmd.Flags().IntVar(&dmsgSessions, "dmsgsessions", dmsgSessions,
+		"minimum number of dmsg sessions to ensure")
+
+	rootCmd.Flags().BoolVar(&lan, "lan", lan,
+		"discover dmsg servers and clients of the local network via mDNS (with an empty 'dmsgdisc', only those)")
+
+	rootCmd.AddCommand(cmdutil.KeygenCmd())
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "dmsg-proxy <config.json>",
+	Short: "Publish local HTTP services on dmsg ports",
+	Long: `Publish local HTTP services on dmsg ports.
+
+Each route of the config maps a dmsg port of the proxy's public key to a local HTTP upstream, optionally restricted to
+a list of remote public keys. The public key of the remote is passed to the upstream in the X-Forwarded-For header.
+
+	{
+		"routes": [
+			{"dmsg_port": 80, "upstream_url": "http://127.0.0.1:8080"},
+			{"dmsg_port": 81, "upstream_url": "http://127.0.0.1:9090", "allowed_pks": ["<pk>"]}
+		]
+	}`,
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		logger := logging.MustGetLogger("dmsg-proxy")
+
+		conf, err := parseConfig(args[0])
+		cmdutil.CatchWithLog(logger, "invalid config", err)
+
+		if keyFile != "" {
+			_, fileSK, err := cmdutil.ReadKeyFile(keyFile, func() ([]byte, error) {
+				return cmdutil.ReadPassphrase(cmdutil.PassphraseEnv, false, false)
+			})
+			cmdutil.CatchWithLog(logger, "failed to read key file", err)
+			sk = fileSK
+		}
+		if sk.Null() {
+			if err := sk.Set(os.Getenv(skEnv)); err != nil {
+				log.Fatalf("Secret key is not set with the 'sk' or 'key-file' flag or the %s env: %v", skEnv, err)
+			}
+		}
+		pk, err := sk.PubKey()
+		cmdutil.CatchWithLog(logger, "failed to derive public key from secret key", err)
+
+		ctx, cancel := cmdutil.SignalContext(context.Background(), logger)
+		defer cancel()
+
+		// Prepare and serve dmsg client.
+		var dc disc.APIClient
+		if dmsgDisc != "" {
+			dc = disc.NewHTTP(dmsgDisc)
+		}
+		if lan {
+			lanDisc, err := dmsglan.New(dc, nil)
+			cmdutil.CatchWithLog(logger, "failed to start LAN discovery", err)
+			defer func() { logger.WithError(lanDisc.Close()).Info("Closed LAN discovery.") }()
+			dc = lanDisc
+		}
+		dmsgC := dmsg.NewClient(pk, sk, dc, &dmsg.Config{MinSessions: dmsgSessions})
+		dmsgC.SetLogger(logging.MustGetLogger("dmsg_client"))
+		go func() { _ = dmsgC.ServeContext(ctx) }() //nolint:errcheck
+		defer func() { logger.WithError(dmsgC.Close()).Info("Closed dmsg client.") }()
+
+		// Serve routes.
+		logger.WithField("pk", pk).Info("Serving routes.")
+		wg := new(sync.WaitGroup)
+		for _, r := range conf.Routes {
+			wg.Add(1)
+			go func(r Route) {
+				defer wg.Done()
+				rLog := logger.WithField("port", r.DmsgPort).WithField("upstream", r.UpstreamURL)
+				if err := serveRoute(ctx, dmsgC, r, rLog); err != nil {
+					rLog.WithError(err).Error("Failed to serve route.")
+					cancel()
+					return
+				}
+				rLog.Info("Stopped serving route.")
+			}(r)
+		}
+		wg.Wait()
+	},
+}
+
+// Execute executes the root command.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"bytes"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+var (
+	auditVerify bool
+	auditPK     cipher.PubKey
+)
+
+func init() {
+	auditExportCmd.Flags().BoolVar(&auditVerify, "verify", false, "verify the hash chain of the audit log")
+	auditExportCmd.Flags().Var(&auditPK, "pk", "public key of the server to verify record signatures against")
+	rootCmd.AddCommand(auditExportCmd)
+}
+
+var auditExportCmd = &cobra.Command{
+	Use:   "audit-export <audit_log_dir>",
+	Short: "Exports (and optionally verifies) the session audit log",
+	Long: `Exports the session audit log within the given directory to STDOUT, as JSON lines.
+
+With --verify, the hash chain (and signatures if --pk is set) of the audit log is verified before exporting.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		var buf bytes.Buffer
+		if err := dmsg.ExportAuditLog(args[0], &buf); err != nil {
+			log.Fatal("Failed to export audit log: ", err)
+		}
+		if auditVerify {
+			n, err := dmsg.VerifyAuditLog(bytes.NewReader(buf.Bytes()), auditPK)
+			if err != nil {
+				log.Fatalf("Audit log verification failed after %d records: %v", n, err)
+			}
+			log.Printf("Verified %d audit records.", n)
+		}
+		if _, err := buf.WriteTo(os.Stdout); err != nil {
+			log.Fatal("Failed to write audit log: ", err)
+		}
+	},
+}
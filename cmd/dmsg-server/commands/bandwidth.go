@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/httputil"
+)
+
+// bandwidthReportsPath is the path of the metrics API which serves bandwidth reports.
+const bandwidthReportsPath = "/bandwidth-reports"
+
+// bandwidthReportsHandler serves the retained bandwidth reports of the server as JSON, most recent first.
+// With the '?since=<seq>' query, only reports of the given sequence onwards are served.
+func bandwidthReportsHandler(srv *dmsg.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var since uint64
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = strconv.ParseUint(v, 10, 64); err != nil {
+				httputil.WriteJSON(w, r, http.StatusBadRequest, fmt.Sprintf("invalid 'since' query: %v", err))
+				return
+			}
+		}
+		reports := make([]*dmsg.BandwidthReport, 0)
+		for _, report := range srv.BandwidthReports() {
+			if report.Seq >= since {
+				reports = append(reports, report)
+			}
+		}
+		httputil.WriteJSON(w, r, http.StatusOK, reports)
+	})
+}
+
+var (
+	bwPK    cipher.PubKey
+	bwSince uint64
+	bwCSV   bool
+)
+
+func init() {
+	bandwidthExportCmd.Flags().Var(&bwPK, "pk", "public key which the reports must be signed by")
+	bandwidthExportCmd.Flags().Uint64Var(&bwSince, "since", 0, "export reports of this sequence onwards")
+	bandwidthExportCmd.Flags().BoolVar(&bwCSV, "csv", false, "export as CSV (one row per client of each report)")
+	rootCmd.AddCommand(bandwidthExportCmd)
+}
+
+var bandwidthExportCmd = &cobra.Command{
+	Use:   "bandwidth-export <metrics_api_url>",
+	Short: "Exports the signed bandwidth reports of a dmsg-server",
+	Long: `Exports the bandwidth reports retained by the dmsg-server of the given metrics API (such as
+'http://127.0.0.1:2121') to STDOUT, oldest first. Bandwidth reports are enabled with 'bandwidth_report_seconds'.
+
+The signature of every report is verified before exporting. Reports are exported as JSON lines (which retain the
+signatures, so that they can be submitted to third parties), or as CSV with --csv.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		url := fmt.Sprintf("%s%s?since=%d", strings.TrimSuffix(args[0], "/"), bandwidthReportsPath, bwSince)
+		reports, err := fetchBandwidthReports(url)
+		if err != nil {
+			log.Fatal("Failed to fetch bandwidth reports: ", err)
+		}
+
+		for _, report := range reports {
+			if !bwPK.Null() && report.ServerPK != bwPK {
+				log.Fatalf("Bandwidth report %d is of server %s.", report.Seq, report.ServerPK)
+			}
+			if err := report.Verify(); err != nil {
+				log.Fatalf("Bandwidth report %d failed verification: %v", report.Seq, err)
+			}
+		}
+		if err := writeBandwidthReports(reports); err != nil {
+			log.Fatal("Failed to write bandwidth reports: ", err)
+		}
+		log.Printf("Exported %d verified bandwidth reports.", len(reports))
+	},
+}
+
+func fetchBandwidthReports(url string) ([]*dmsg.BandwidthReport, error) {
+	resp, err := http.Get(url) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httputil.ErrorFromResp(resp)
+	}
+	var reports []*dmsg.BandwidthReport
+	err = json.NewDecoder(resp.Body).Decode(&reports)
+	return reports, err
+}
+
+// writeBandwidthReports writes the reports (which are most recent first) to STDOUT, oldest first.
+func writeBandwidthReports(reports []*dmsg.BandwidthReport) error {
+	if !bwCSV {
+		enc := json.NewEncoder(os.Stdout)
+		for i := len(reports) - 1; i >= 0; i-- {
+			if err := enc.Encode(reports[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := csv.NewWriter(os.Stdout)
+	header := []string{"server_pk", "seq", "start", "end", "client_pk", "bytes_in", "bytes_out", "sessions"}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for i := len(reports) - 1; i >= 0; i-- {
+		r := reports[i]
+		for _, u := range r.Clients {
+			row := []string{
+				r.ServerPK.Hex(),
+				strconv.FormatUint(r.Seq, 10),
+				time.Unix(0, r.Start).UTC().Format(time.RFC3339),
+				time.Unix(0, r.End).UTC().Format(time.RFC3339),
+				u.ClientPK.Hex(),
+				strconv.FormatUint(u.BytesIn, 10),
+				strconv.FormatUint(u.BytesOut, 10),
+				strconv.Itoa(u.Sessions),
+			}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
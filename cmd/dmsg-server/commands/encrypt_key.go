@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/cmdutil"
+)
+
+func init() {
+	encryptKeyCmd.Flags().BoolVar(&passphraseStdin, "passphrase-stdin", false, "read passphrase from STDIN")
+	rootCmd.AddCommand(encryptKeyCmd)
+}
+
+var encryptKeyCmd = &cobra.Command{
+	Use:   "encrypt-key <config.json>",
+	Short: "Encrypts the secret key of a config with a passphrase",
+	Long: `Writes the given config to STDOUT, with 'secret_key' replaced by 'encrypted_secret_key'.
+
+The secret key is encrypted with AES-256-GCM, under a key derived from the passphrase with argon2id. The passphrase is
+read from DMSG_PASSPHRASE if set, from STDIN with --passphrase-stdin, or else prompted for.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		conf, err := parseConfig(args[0], true)
+		if err != nil {
+			log.Fatal("Failed to parse config: ", err)
+		}
+		if conf.SecKey.Null() {
+			log.Fatal("Config has no 'secret_key' to encrypt.")
+		}
+		if conf.PubKey.Null() {
+			pk, err := conf.SecKey.PubKey()
+			if err != nil {
+				log.Fatal("Failed to derive public key: ", err)
+			}
+			conf.PubKey = pk
+		}
+
+		passphrase, err := cmdutil.ReadPassphrase(envPassphrase, passphraseStdin, true)
+		if err != nil {
+			log.Fatal("Failed to read passphrase: ", err)
+		}
+		if len(passphrase) == 0 {
+			log.Fatal("Passphrase is empty.")
+		}
+		if conf.EncryptedSecKey, err = cmdutil.EncryptSecKey(conf.SecKey, passphrase); err != nil {
+			log.Fatal("Failed to encrypt secret key: ", err)
+		}
+		conf.Version = configVersion
+
+		// The 'secret_key' field is omitted.
+		out := struct {
+			*Config
+			SecKey *cipher.SecKey `json:"secret_key,omitempty"`
+		}{Config: conf}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(out); err != nil {
+			log.Fatal("Failed to write config: ", err)
+		}
+	},
+}
@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/SkycoinProject/dmsg/cmdutil"
+)
+
+// Environment variables which take precedence over values of the config file.
+const (
+	envPubKey        = "DMSG_PUBKEY"
+	envSecKey        = "DMSG_SECKEY"
+	envDiscovery     = "DMSG_DISCOVERY"
+	envLocalAddress  = "DMSG_LOCAL_ADDRESS"
+	envPublicAddress = "DMSG_PUBLIC_ADDRESS"
+	envLogLevel      = "DMSG_LOG_LEVEL"
+
+	envPublicAddressDetect  = "DMSG_PUBLIC_ADDRESS_DETECT"
+	envExtraPublicAddresses = "DMSG_EXTRA_PUBLIC_ADDRESSES" // comma-separated
+	envRegion               = "DMSG_REGION"
+	envPoWDifficulty        = "DMSG_POW_DIFFICULTY"
+	envNetworkID            = "DMSG_NETWORK_ID"
+	envAuditLogDir          = "DMSG_AUDIT_LOG_DIR"
+	envClusterRedis         = "DMSG_CLUSTER_REDIS"
+	envClusterAddress       = "DMSG_CLUSTER_ADDRESS"
+	envStandbyActiveAddress = "DMSG_STANDBY_ACTIVE_ADDRESS"
+
+	// envPassphrase is the passphrase of the encrypted secret key (it is not a config value).
+	envPassphrase = cmdutil.PassphraseEnv
+)
+
+// redactedSecKey replaces the secret key in printed configs.
+const redactedSecKey = "REDACTED"
+
+const (
+	defaultLogLevel         = "info"
+	defaultMetricsNamespace = "dmsgserver"
+)
+
+// Supported values of the 'metrics_sink' config.
+const (
+	metricsSinkPrometheus = "prometheus"
+	metricsSinkStatsD     = "statsd"
+)
+
+// applyEnvs overrides config values with those of set environment variables.
+func (c *Config) applyEnvs() error {
+	if v, ok := os.LookupEnv(envPubKey); ok {
+		if err := c.PubKey.Set(v); err != nil {
+			return err
+		}
+	}
+	if v, ok := os.LookupEnv(envSecKey); ok {
+		if err := c.SecKey.Set(v); err != nil {
+			return err
+		}
+	}
+	lookupString(envDiscovery, &c.Discovery)
+	lookupString(envLocalAddress, &c.LocalAddress)
+	lookupString(envPublicAddress, &c.PublicAddress)
+	lookupString(envLogLevel, &c.LogLevel)
+	lookupString(envPublicAddressDetect, &c.PublicAddressDetect)
+	lookupString(envRegion, &c.Region)
+	lookupString(envNetworkID, &c.NetworkID)
+	lookupString(envAuditLogDir, &c.AuditLogDir)
+	lookupString(envClusterRedis, &c.ClusterRedis)
+	lookupString(envClusterAddress, &c.ClusterAddress)
+	lookupString(envStandbyActiveAddress, &c.StandbyActiveAddress)
+	if v, ok := os.LookupEnv(envExtraPublicAddresses); ok {
+		c.ExtraPublicAddresses = splitList(v)
+	}
+	if v, ok := os.LookupEnv(envPoWDifficulty); ok {
+		d, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		c.PoWDifficulty = d
+	}
+	return nil
+}
+
+// decryptSecKey decrypts the encrypted secret key, unless the secret key is set (such as via envs).
+func (c *Config) decryptSecKey(fromStdin bool) error {
+	if c.EncryptedSecKey == nil || !c.SecKey.Null() {
+		return nil
+	}
+	if fromStdin && cfgFromStdin {
+		return errors.New("passphrase cannot be read from STDIN if the config is")
+	}
+	passphrase, err := cmdutil.ReadPassphrase(envPassphrase, fromStdin, false)
+	if err != nil {
+		return err
+	}
+	c.SecKey, err = c.EncryptedSecKey.Decrypt(passphrase)
+	return err
+}
+
+// fillDefaults fills in values which are not set, and derives the public key from the secret key if needed.
+func (c *Config) fillDefaults() error {
+	if c.Version == 0 {
+		c.Version = configVersion
+	}
+	if c.PubKey.Null() && !c.SecKey.Null() {
+		pk, err := c.SecKey.PubKey()
+		if err != nil {
+			return err
+		}
+		c.PubKey = pk
+	}
+	if c.LogLevel == "" {
+		c.LogLevel = defaultLogLevel
+	}
+	if c.MetricsNamespace == "" {
+		c.MetricsNamespace = defaultMetricsNamespace
+	}
+	if c.MetricsSink == "" {
+		c.MetricsSink = metricsSinkPrometheus
+	}
+	if c.MaxOpenFiles == 0 {
+		c.MaxOpenFiles = defaultMaxOpenFiles
+	}
+	return nil
+}
+
+// metricsLabels returns the constant labels of metrics.
+func (c *Config) metricsLabels() map[string]string {
+	labels := make(map[string]string, len(c.MetricsLabels)+2)
+	for k, v := range c.MetricsLabels {
+		labels[k] = v
+	}
+	if c.MetricsInstanceLabels {
+		labels["server_pk"] = c.PubKey.String()[:8]
+		labels["region"] = c.Region
+	}
+	return labels
+}
+
+func lookupString(key string, v *string) {
+	if s, ok := os.LookupEnv(key); ok {
+		*v = s
+	}
+}
+
+// splitList splits a comma-separated list, omitting empty values.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
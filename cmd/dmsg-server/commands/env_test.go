@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// setEnvs sets the given envs, and returns a function which restores their previous values.
+func setEnvs(t *testing.T, envs map[string]string) func() {
+	restore := make(map[string]*string, len(envs))
+	for k, v := range envs {
+		if prev, ok := os.LookupEnv(k); ok {
+			restore[k] = &prev
+		} else {
+			restore[k] = nil
+		}
+		require.NoError(t, os.Setenv(k, v))
+	}
+	return func() {
+		for k, v := range restore {
+			if v != nil {
+				require.NoError(t, os.Setenv(k, *v))
+			} else {
+				require.NoError(t, os.Unsetenv(k))
+			}
+		}
+	}
+}
+
+func TestConfig_applyEnvs(t *testing.T) {
+	t.Run("precedence", func(t *testing.T) {
+		filePK, fileSK := cipher.GenerateKeyPair()
+		envPK, envSK := cipher.GenerateKeyPair()
+		conf := &Config{
+			PubKey:               filePK,
+			SecKey:               fileSK,
+			Discovery:            "http://file.discovery",
+			LocalAddress:         ":8080",
+			ExtraPublicAddresses: []string{"file.example.com:8080"},
+			PoWDifficulty:        4,
+		}
+		defer setEnvs(t, map[string]string{
+			envPubKey:               envPK.Hex(),
+			envSecKey:               envSK.Hex(),
+			envDiscovery:            "http://env.discovery",
+			envExtraPublicAddresses: "a.example.com:8080, ,b.example.com:8080",
+			envPoWDifficulty:        "8",
+		})()
+
+		require.NoError(t, conf.applyEnvs())
+		require.Equal(t, envPK, conf.PubKey)
+		require.Equal(t, envSK, conf.SecKey)
+		require.Equal(t, "http://env.discovery", conf.Discovery)
+		require.Equal(t, []string{"a.example.com:8080", "b.example.com:8080"}, conf.ExtraPublicAddresses)
+		require.Equal(t, 8, conf.PoWDifficulty)
+
+		// Values without envs are kept.
+		require.Equal(t, ":8080", conf.LocalAddress)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, env := range []string{envPubKey, envSecKey, envPoWDifficulty} {
+			t.Run(env, func(t *testing.T) {
+				defer setEnvs(t, map[string]string{env: "invalid"})()
+				require.Error(t, (&Config{}).applyEnvs())
+			})
+		}
+	})
+}
+
+func TestConfig_fillDefaults(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		conf := &Config{}
+		require.NoError(t, conf.fillDefaults())
+		require.Equal(t, &Config{
+			Version:          configVersion,
+			LogLevel:         defaultLogLevel,
+			MetricsNamespace: defaultMetricsNamespace,
+			MetricsSink:      metricsSinkPrometheus,
+			MaxOpenFiles:     defaultMaxOpenFiles,
+		}, conf)
+	})
+
+	t.Run("set_values_kept", func(t *testing.T) {
+		pk, _ := cipher.GenerateKeyPair()
+		_, sk := cipher.GenerateKeyPair()
+		conf := &Config{
+			PubKey:           pk,
+			SecKey:           sk,
+			LogLevel:         "debug",
+			MetricsNamespace: "dmsg",
+			MetricsSink:      metricsSinkStatsD,
+			MaxOpenFiles:     1024,
+		}
+		require.NoError(t, conf.fillDefaults())
+		require.Equal(t, pk, conf.PubKey)
+		require.Equal(t, "debug", conf.LogLevel)
+		require.Equal(t, "dmsg", conf.MetricsNamespace)
+		require.Equal(t, metricsSinkStatsD, conf.MetricsSink)
+		require.Equal(t, 1024, conf.MaxOpenFiles)
+	})
+
+	t.Run("public_key_derived", func(t *testing.T) {
+		pk, sk := cipher.GenerateKeyPair()
+		conf := &Config{SecKey: sk}
+		require.NoError(t, conf.fillDefaults())
+		require.Equal(t, pk, conf.PubKey)
+	})
+}
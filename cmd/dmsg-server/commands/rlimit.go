@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxOpenFiles is the default limit of open files (RLIMIT_NOFILE) which dmsg-server raises to on startup.
+// Each session takes a file descriptor, so the usual default limit of 1024 only serves about as many clients.
+const defaultMaxOpenFiles = 65536
+
+var errRLimitUnsupported = errors.New("raising the limit of open files is not supported on this platform")
+
+// raiseMaxOpenFiles attempts to raise the limit of open files of the process to 'target', and logs the effective
+// limit. If the hard limit is lower and cannot be raised (without privileges), the soft limit is raised to it.
+func raiseMaxOpenFiles(log logrus.FieldLogger, target uint64) {
+	limit, err := setMaxOpenFiles(target)
+	if errors.Is(err, errRLimitUnsupported) {
+		log.WithError(err).Debug("Not raising limit of open files.")
+		return
+	}
+	log = log.WithField("max_open_files", limit)
+	if err != nil {
+		log.WithError(err).WithField("target", target).
+			Warn("Failed to raise limit of open files (RLIMIT_NOFILE), which limits the number of sessions.")
+		return
+	}
+	log.Info("Limit of open files (RLIMIT_NOFILE).")
+}
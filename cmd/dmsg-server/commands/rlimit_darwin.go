@@ -0,0 +1,18 @@
+// +build darwin
+
+package commands
+
+import "syscall"
+
+// openMax is OPEN_MAX of <sys/syslimits.h>, which caps the limit of open files if kern.maxfilesperproc is unavailable.
+const openMax = 10240
+
+// maxOpenFilesCap returns the limit which RLIMIT_NOFILE can be raised to. The hard limit is usually RLIM_INFINITY on
+// darwin, but setting the soft limit above kern.maxfilesperproc fails with EINVAL.
+func maxOpenFilesCap() uint64 {
+	n, err := syscall.SysctlUint32("kern.maxfilesperproc")
+	if err != nil || n == 0 {
+		return openMax
+	}
+	return uint64(n)
+}
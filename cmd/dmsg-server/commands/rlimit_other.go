@@ -0,0 +1,7 @@
+// +build !linux,!darwin
+
+package commands
+
+func setMaxOpenFiles(_ uint64) (uint64, error) {
+	return 0, errRLimitUnsupported
+}
@@ -0,0 +1,50 @@
+// +build linux darwin
+
+package commands
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// setMaxOpenFiles raises RLIMIT_NOFILE to 'target' (it is never lowered), and returns the effective soft limit.
+// The target is clamped to the limit of the platform (see maxOpenFilesCap).
+func setMaxOpenFiles(target uint64) (uint64, error) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, err
+	}
+	hardMax := rl.Max
+	if limit := maxOpenFilesCap(); limit > 0 {
+		if target > limit {
+			target = limit
+		}
+		if hardMax > limit {
+			hardMax = limit
+		}
+	}
+	if rl.Cur >= target {
+		return rl.Cur, nil
+	}
+
+	want := syscall.Rlimit{Cur: target, Max: rl.Max}
+	if want.Max < target {
+		want.Max = target // only permitted with privileges (such as CAP_SYS_RESOURCE)
+	}
+	setErr := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &want)
+	if setErr != nil && rl.Cur < hardMax {
+		// Raise to the hard limit instead.
+		_ = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: hardMax, Max: rl.Max}) //nolint:errcheck
+	}
+
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, err
+	}
+	if rl.Cur < target {
+		if setErr == nil {
+			setErr = fmt.Errorf("limit is %d after raising it", rl.Cur)
+		}
+		return rl.Cur, setErr
+	}
+	return rl.Cur, nil
+}
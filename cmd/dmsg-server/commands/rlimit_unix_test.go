@@ -0,0 +1,55 @@
+// +build linux darwin
+
+package commands
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMaxOpenFiles(t *testing.T) {
+	var orig syscall.Rlimit
+	require.NoError(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &orig))
+	defer func() { require.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &orig)) }()
+
+	// softLimit returns the current soft limit.
+	softLimit := func() uint64 {
+		var rl syscall.Rlimit
+		require.NoError(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl))
+		return rl.Cur
+	}
+
+	// The soft limit is lowered (which needs no privileges), so that there is room to raise it.
+	target := orig.Cur
+	if limit := maxOpenFilesCap(); limit > 0 && target > limit {
+		target = limit
+	}
+	require.NoError(t, syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: target / 2, Max: orig.Max}))
+
+	t.Run("raises", func(t *testing.T) {
+		limit, err := setMaxOpenFiles(target)
+		require.NoError(t, err)
+		require.Equal(t, target, limit)
+		require.Equal(t, target, softLimit())
+	})
+
+	t.Run("never_lowers", func(t *testing.T) {
+		limit, err := setMaxOpenFiles(target / 4)
+		require.NoError(t, err)
+		require.Equal(t, target, limit)
+		require.Equal(t, target, softLimit())
+	})
+
+	t.Run("clamped", func(t *testing.T) {
+		// Targets beyond the limit of the platform (such as darwin's unlimited hard limit) are clamped to it.
+		limit := maxOpenFilesCap()
+		if limit == 0 {
+			t.Skip("the limit of open files is only capped by the hard limit on this platform")
+		}
+		got, err := setMaxOpenFiles(limit + 1)
+		require.NoError(t, err)
+		require.Equal(t, limit, got)
+	})
+}
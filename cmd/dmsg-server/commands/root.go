@@ -2,53 +2,251 @@ package commands
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"log"
-	"log/syslog"
 	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-
-	logrussyslog "github.com/sirupsen/logrus/hooks/syslog"
 	"github.com/spf13/cobra"
 
 	"github.com/SkycoinProject/dmsg"
 	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/cluster"
+	"github.com/SkycoinProject/dmsg/cmdutil"
 	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/dmsglan"
+	"github.com/SkycoinProject/dmsg/metrics"
+	"github.com/SkycoinProject/dmsg/netutil"
 )
 
 var (
 	metricsAddr  string
 	syslogAddr   string
+	syslogCA     string
 	tag          string
 	cfgFromStdin bool
+	printConfig  bool
+
+	passphraseStdin bool
+
+	logFile    string
+	logFileCfg cmdutil.LogFileConfig
+	logMaxSize int // in MB
 )
 
 // Config is a dmsg-server config
 type Config struct {
+	// Version is the version of the config format. Configs of older versions (including unversioned configs) are
+	// migrated when loaded.
+	Version int `json:"version"`
+
 	PubKey        cipher.PubKey `json:"public_key"`
 	SecKey        cipher.SecKey `json:"secret_key"`
 	Discovery     string        `json:"discovery"`
 	LocalAddress  string        `json:"local_address"`
 	PublicAddress string        `json:"public_address"`
 	LogLevel      string        `json:"log_level"`
+
+	// EncryptedSecKey is the secret key encrypted with a passphrase (see encrypt-key), which is used if 'secret_key' is
+	// not set. The passphrase is read from DMSG_PASSPHRASE, from STDIN (with --passphrase-stdin), or prompted for.
+	EncryptedSecKey *cmdutil.EncryptedSecKey `json:"encrypted_secret_key,omitempty"`
+
+	// PublicAddressDetect is the method used to detect the public address if 'public_address' is empty.
+	// Supported formats are 'http(s)://<ip-echo-url>' and 'stun:<host>:<port>'. Detection is disabled if empty.
+	PublicAddressDetect string `json:"public_address_detect,omitempty"`
+
+	// ExtraPublicAddresses are advertised alongside the public address (such as an IPv6 address in addition to an
+	// IPv4 address). Clients try all advertised addresses in Happy Eyeballs order.
+	ExtraPublicAddresses []string `json:"extra_public_addresses,omitempty"`
+
+	// Region is advertised in the discovery entry so that clients can filter servers by region (optional).
+	Region string `json:"region,omitempty"`
+
+	// ExtraListeners are additional underlay listeners (such as websocket), advertised in the same discovery entry.
+	ExtraListeners []ListenerConfig `json:"extra_listeners,omitempty"`
+
+	// PoWDifficulty is the entry proof-of-work difficulty required by the discovery (0 if not required).
+	PoWDifficulty int `json:"pow_difficulty,omitempty"`
+
+	// NetworkID isolates dmsg networks (such as test, staging and production). Empty is the default network.
+	NetworkID string `json:"network_id,omitempty"`
+
+	// LANDiscovery announces the server on the local network via mDNS, so that dmsg clients of the LAN find it without
+	// dmsg discovery (the public address must be reachable from the LAN). If 'discovery' is empty, the server is only
+	// announced on the LAN.
+	LANDiscovery bool `json:"lan_discovery,omitempty"`
+
+	// AuditLogDir is the directory of the session audit log. The audit log is disabled if empty.
+	AuditLogDir string `json:"audit_log_dir,omitempty"`
+
+	// AuditLogMaxSize is the size (in bytes) after which an audit log file is rotated (0 uses the default).
+	AuditLogMaxSize int64 `json:"audit_log_max_size,omitempty"`
+
+	// StreamRateLimit is the maximum rate (streams per second) of stream requests per session (0 for no limit).
+	StreamRateLimit int `json:"stream_rate_limit,omitempty"`
+
+	// MaxSessionStreams is the maximum number of concurrent streams per session (0 for no quota).
+	MaxSessionStreams int `json:"max_session_streams,omitempty"`
+
+	// MaxRelayHops is the maximum number of servers which a stream request may traverse when it is relayed to the
+	// delegated servers of other clients (0 disables relaying).
+	MaxRelayHops int `json:"max_relay_hops,omitempty"`
+
+	// HandshakeFloodThreshold is the number of failed session handshakes from a host per minute which is logged as a
+	// handshake flood (0 disables detection). Detected abuse is logged with the 'kind' and 'remote_addr' fields.
+	HandshakeFloodThreshold int `json:"handshake_flood_threshold,omitempty"`
+
+	// LogSampleRate is the maximum number of log entries per second of each class of session and stream events of a
+	// client (0 uses the default, -1 disables sampling). Suppressed entries are counted in the 'suppressed' field.
+	LogSampleRate int `json:"log_sample_rate,omitempty"`
+
+	// ClusterRedis is the redis URL which shares client session routes between instances of a cluster (multiple
+	// dmsg-servers of the same keys behind a load balancer). Clustering is disabled if empty.
+	ClusterRedis         string `json:"cluster_redis,omitempty"`
+	ClusterRedisPassword string `json:"cluster_redis_password,omitempty"`
+
+	// ClusterAddress is the address which other instances of the cluster reach this instance with.
+	ClusterAddress string `json:"cluster_address,omitempty"`
+
+	// StandbyActiveAddress, if set, runs the dmsg-server as the hot standby of the active dmsg-server (of the same keys)
+	// of the given address. The standby takes over the discovery entry once the active dmsg-server fails.
+	StandbyActiveAddress string `json:"standby_active_address,omitempty"`
+
+	// TCPDelayWrites enables Nagle's algorithm on session connections (TCP_NODELAY is set by default).
+	TCPDelayWrites bool `json:"tcp_delay_writes,omitempty"`
+
+	// TCPKeepAliveSeconds is the TCP keep-alive period of session connections (0 uses the default, -1 disables).
+	TCPKeepAliveSeconds int `json:"tcp_keep_alive_seconds,omitempty"`
+
+	// TCPReadBuffer and TCPWriteBuffer are the OS buffer sizes (in bytes) of session connections (0 uses the default).
+	TCPReadBuffer  int `json:"tcp_read_buffer,omitempty"`
+	TCPWriteBuffer int `json:"tcp_write_buffer,omitempty"`
+
+	// AcceptSockets is the number of SO_REUSEPORT sockets (each with an independent accept loop) which listen on
+	// LocalAddress. This speeds up accepting reconnection storms. Values above 1 are only supported on Linux.
+	AcceptSockets int `json:"accept_sockets,omitempty"`
+
+	// AcceptRateLimit is the maximum rate (connections per second) at which connections are accepted (0 for no limit).
+	AcceptRateLimit int `json:"accept_rate_limit,omitempty"`
+
+	// MaxPendingHandshakes is the maximum number of concurrent session handshakes (0 for no limit).
+	MaxPendingHandshakes int `json:"max_pending_handshakes,omitempty"`
+
+	// MemoryBudget is the heap usage (in bytes) above which the dmsg-server sheds load by rejecting new streams and
+	// closing the sessions with the most streams (0 disables the budget).
+	MemoryBudget uint64 `json:"memory_budget,omitempty"`
+
+	// FDReserve is the number of file descriptors below RLIMIT_NOFILE which are reserved for existing sessions and
+	// streams. Once fewer remain, new connections are closed straight away (0 never refuses connections).
+	FDReserve int `json:"fd_reserve,omitempty"`
+
+	// MaxOpenFiles is the limit of open files (RLIMIT_NOFILE) which is raised to on startup, as each session takes a
+	// file descriptor (0 uses the default of 65536, -1 keeps the limit which the process is started with).
+	MaxOpenFiles int `json:"max_open_files,omitempty"`
+
+	// StreamStallSeconds is the duration (in seconds) after which a blocked write to the receiving client of a stream
+	// is logged as a stall (0 disables stall detection).
+	StreamStallSeconds int `json:"stream_stall_seconds,omitempty"`
+
+	// SessionIdleSeconds is the duration (in seconds) after which sessions which receive no traffic are closed, and
+	// StreamIdleSeconds is that of streams with no traffic in either direction (0 disables them).
+	SessionIdleSeconds int `json:"session_idle_seconds,omitempty"`
+	StreamIdleSeconds  int `json:"stream_idle_seconds,omitempty"`
+
+	// BandwidthReportSeconds is the interval (in seconds) at which the bandwidth relayed for each client is summarized
+	// into a report signed by the dmsg-server. Recent reports are served by the metrics API at '/bandwidth-reports'
+	// (see bandwidth-export). Bandwidth accounting is disabled if 0.
+	BandwidthReportSeconds int `json:"bandwidth_report_seconds,omitempty"`
+
+	// StatsAddress is the address of the read-only public stats page (uptime, version, session count and bandwidth),
+	// which is served separately from the metrics API. The stats page is disabled if empty.
+	StatsAddress string `json:"stats_address,omitempty"`
+
+	// MetricsSink selects where stream metrics are recorded: "prometheus" (default, served by the metrics API) or
+	// "statsd" (sent to MetricsStatsDAddress, such as for Telegraf and InfluxDB).
+	MetricsSink string `json:"metrics_sink,omitempty"`
+
+	// MetricsStatsDAddress is the UDP address of the StatsD daemon (required if 'metrics_sink' is "statsd").
+	MetricsStatsDAddress string `json:"metrics_statsd_address,omitempty"`
+
+	// MetricsNamespace is the prefix of the names of metrics (defaults to "dmsgserver").
+	MetricsNamespace string `json:"metrics_namespace,omitempty"`
+
+	// MetricsLabels are constant labels which are added to all metrics.
+	MetricsLabels map[string]string `json:"metrics_labels,omitempty"`
+
+	// MetricsInstanceLabels adds the 'server_pk' (shortened public key) and 'region' labels to all metrics, so that
+	// the metrics of multiple dmsg-servers can be told apart.
+	MetricsInstanceLabels bool `json:"metrics_instance_labels,omitempty"`
+
+	// MetricsPushGateway is the URL of a Prometheus Pushgateway which metrics are pushed to (such as for dmsg-servers
+	// behind NAT, which cannot be scraped). Pushing is disabled if empty.
+	MetricsPushGateway string `json:"metrics_push_gateway,omitempty"`
+
+	// MetricsPushSeconds is the interval (in seconds) at which metrics are pushed (0 uses the default).
+	MetricsPushSeconds int `json:"metrics_push_seconds,omitempty"`
+
+	// FrameTraceFile is the file which a JSON record of each multiplexer frame header of sessions is appended to, for
+	// protocol-level debugging. Payloads are not recorded. Frame tracing is disabled if empty.
+	FrameTraceFile string `json:"frame_trace_file,omitempty"`
+
+	// StatsShowPKs includes the public keys of the dmsg-server and its clients in the stats page.
+	StatsShowPKs bool `json:"stats_show_pks,omitempty"`
+}
+
+// ListenerConfig configures an additional underlay listener of a dmsg-server.
+type ListenerConfig struct {
+	Type          string `json:"type"` // "tcp" or "ws"
+	LocalAddress  string `json:"local_address"`
+	PublicAddress string `json:"public_address"`
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "dmsg-server [config.json]",
 	Short: "Dmsg Server for skywire",
+	Long: `Dmsg Server for skywire.
+
+Config values can be overridden with the following envs:
+  DMSG_PUBKEY, DMSG_SECKEY, DMSG_DISCOVERY, DMSG_LOCAL_ADDRESS, DMSG_PUBLIC_ADDRESS, DMSG_PUBLIC_ADDRESS_DETECT,
+  DMSG_EXTRA_PUBLIC_ADDRESSES (comma-separated), DMSG_REGION, DMSG_POW_DIFFICULTY, DMSG_NETWORK_ID,
+  DMSG_AUDIT_LOG_DIR, DMSG_CLUSTER_REDIS, DMSG_CLUSTER_ADDRESS, DMSG_STANDBY_ACTIVE_ADDRESS, DMSG_LOG_LEVEL
+
+The passphrase of an encrypted secret key (see encrypt-key) is read from DMSG_PASSPHRASE if set.`,
 	Run: func(_ *cobra.Command, args []string) {
 		// Config
 		configFile := "config.json"
 		if len(args) > 0 {
 			configFile = args[0]
 		}
-		conf := parseConfig(configFile)
+		conf, err := parseConfig(configFile, len(args) > 0)
+		if err != nil {
+			log.Fatalf("Failed to parse config: %s", err)
+		}
+		if err := conf.applyEnvs(); err != nil {
+			log.Fatalf("Failed to apply config from envs: %s", err)
+		}
+		if !printConfig {
+			if err := conf.decryptSecKey(passphraseStdin); err != nil {
+				log.Fatalf("Failed to decrypt secret key: %s", err)
+			}
+		}
+		if err := conf.fillDefaults(); err != nil {
+			log.Fatalf("Failed to fill config defaults: %s", err)
+		}
+		if printConfig {
+			if err := conf.print(os.Stdout); err != nil {
+				log.Fatalf("Failed to print config: %s", err)
+			}
+			return
+		}
 
 		// Logger
 		logger := logging.MustGetLogger(tag)
@@ -58,12 +256,24 @@ var rootCmd = &cobra.Command{
 		}
 		logging.SetLevel(logLevel)
 
-		if syslogAddr != "" {
-			hook, err := logrussyslog.NewSyslogHook("udp", syslogAddr, syslog.LOG_INFO, tag)
+		if logFile != "" {
+			logFileCfg.MaxSize = int64(logMaxSize) << 20
+			f, err := cmdutil.OpenLogFile(logFile, logFileCfg)
 			if err != nil {
-				logger.Fatalf("Unable to connect to syslog daemon on %v", syslogAddr)
+				log.Fatalf("Failed to open log file: %s", err)
 			}
-			logging.AddHook(hook)
+			logging.SetOutputTo(f)
+			defer func() { _ = f.Close() }() //nolint:errcheck
+		}
+
+		if syslogAddr != "" {
+			if err := addSyslogHook(syslogAddr, tag, syslogCA, conf.PubKey); err != nil {
+				logger.Fatalf("Unable to connect to syslog daemon on %v: %v", syslogAddr, err)
+			}
+		}
+
+		if conf.MaxOpenFiles > 0 {
+			raiseMaxOpenFiles(logger, uint64(conf.MaxOpenFiles))
 		}
 
 		// Metrics
@@ -74,48 +284,251 @@ var rootCmd = &cobra.Command{
 			}
 		}()
 
-		lis, err := net.Listen("tcp", conf.LocalAddress)
+		var lis net.Listener
+		if conf.AcceptSockets > 1 {
+			lis, err = netutil.ListenReusePort("tcp", conf.LocalAddress, conf.AcceptSockets)
+		} else {
+			lis, err = net.Listen("tcp", conf.LocalAddress)
+		}
 		if err != nil {
 			logger.Fatalf("Error listening on %s: %v", conf.LocalAddress, err)
 		}
+		uls := []dmsg.UnderlayListener{{Type: disc.UnderlayTCP, Listener: lis, Addr: conf.PublicAddress}}
+		for _, lc := range conf.ExtraListeners {
+			l, err := net.Listen("tcp", lc.LocalAddress)
+			if err != nil {
+				logger.Fatalf("Error listening on %s: %v", lc.LocalAddress, err)
+			}
+			uls = append(uls, dmsg.UnderlayListener{Type: lc.Type, Listener: l, Addr: lc.PublicAddress})
+		}
+
+		srvConf := dmsg.DefaultServerConfig()
+		srvConf.ExtraAddrs = conf.ExtraPublicAddresses
+		srvConf.Region = conf.Region
+		srvConf.PoWDifficulty = conf.PoWDifficulty
+		srvConf.NetworkID = conf.NetworkID
+		srvConf.StreamRateLimit = conf.StreamRateLimit
+		srvConf.MaxSessionStreams = conf.MaxSessionStreams
+		srvConf.MaxRelayHops = conf.MaxRelayHops
+		srvConf.HandshakeFloodThreshold = conf.HandshakeFloodThreshold
+		switch {
+		case conf.LogSampleRate < 0:
+			srvConf.LogSampleRate = 0
+		case conf.LogSampleRate > 0:
+			srvConf.LogSampleRate = conf.LogSampleRate
+		}
+		srvConf.AcceptRateLimit = conf.AcceptRateLimit
+		srvConf.MaxPendingHandshakes = conf.MaxPendingHandshakes
+		srvConf.MemoryBudget = conf.MemoryBudget
+		srvConf.FDReserve = conf.FDReserve
+		switch conf.MetricsSink {
+		case metricsSinkPrometheus:
+			reg := metrics.Registerer(conf.metricsLabels())
+			srvConf.StreamMetrics = metrics.NewStreamMetricsWith(reg, conf.MetricsNamespace)
+			srvConf.FDMetrics = metrics.NewFDMetricsWith(reg, conf.MetricsNamespace)
+		case metricsSinkStatsD:
+			m, err := metrics.NewStatsD(conf.MetricsStatsDAddress, conf.MetricsNamespace)
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to connect to StatsD daemon.")
+			}
+			defer func() { logger.WithError(m.Close()).Info("Closed StatsD connection.") }()
+			srvConf.StreamMetrics = m
+			srvConf.FDMetrics = m
+		default:
+			logger.Fatalf("Unsupported metrics sink '%s'.", conf.MetricsSink)
+		}
+		srvConf.StreamStallThreshold = time.Duration(conf.StreamStallSeconds) * time.Second
+		srvConf.SessionIdleTimeout = time.Duration(conf.SessionIdleSeconds) * time.Second
+		srvConf.StreamIdleTimeout = time.Duration(conf.StreamIdleSeconds) * time.Second
+		srvConf.BandwidthReportInterval = time.Duration(conf.BandwidthReportSeconds) * time.Second
+		srvConf.SocketOptions = netutil.SocketOptions{
+			DelayWrites:     conf.TCPDelayWrites,
+			KeepAlivePeriod: time.Duration(conf.TCPKeepAliveSeconds) * time.Second,
+			ReadBuffer:      conf.TCPReadBuffer,
+			WriteBuffer:     conf.TCPWriteBuffer,
+		}
+		if conf.AuditLogDir != "" {
+			auditLog, err := dmsg.OpenAuditLog(conf.AuditLogDir, conf.SecKey, conf.AuditLogMaxSize)
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to open audit log.")
+			}
+			defer func() { logger.WithError(auditLog.Close()).Info("Closed audit log.") }()
+			srvConf.AuditLog = auditLog
+		}
+		if conf.FrameTraceFile != "" {
+			f, err := os.OpenFile(conf.FrameTraceFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to open frame trace file.")
+			}
+			defer func() { logger.WithError(f.Close()).Info("Closed frame trace file.") }()
+			srvConf.FrameTrace = f
+		}
+		if conf.ClusterRedis != "" {
+			if conf.ClusterAddress == "" {
+				logger.Fatal("Config 'cluster_address' is required for clustering.")
+			}
+			router, err := cluster.NewRedis(conf.ClusterRedis, conf.ClusterRedisPassword, cluster.DefaultRouteTTL)
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to connect to cluster redis.")
+			}
+			srvConf.Cluster = &dmsg.ClusterConfig{Router: router, Address: conf.ClusterAddress}
+		}
+		if conf.StandbyActiveAddress != "" {
+			srvConf.Standby = &dmsg.StandbyConfig{ActiveAddr: conf.StandbyActiveAddress}
+		}
+		if conf.PublicAddress == "" && conf.PublicAddressDetect != "" {
+			if srvConf.PublicIP, err = netutil.PublicIPFromString(conf.PublicAddressDetect); err != nil {
+				logger.WithError(err).Fatal("Invalid public address detection method.")
+			}
+		}
+		if err := srvConf.Validate(); err != nil {
+			logger.WithError(err).Fatal("Invalid server config.")
+		}
 
 		// Start
-		srv := dmsg.NewServer(conf.PubKey, conf.SecKey, disc.NewHTTP(conf.Discovery))
-		srv.SetLogger(logger)
+		run := func(ctx context.Context, ready func()) {
+			var dc disc.APIClient
+			if conf.Discovery != "" {
+				dc = disc.NewHTTP(conf.Discovery)
+			}
+			if conf.LANDiscovery {
+				lanDisc, err := dmsglan.New(dc, nil)
+				if err != nil {
+					logger.WithError(err).Fatal("Failed to start LAN discovery.")
+				}
+				defer func() { logger.WithError(lanDisc.Close()).Info("Closed LAN discovery.") }()
+				dc = lanDisc
+			}
+			srv := dmsg.NewServerWithConfig(conf.PubKey, conf.SecKey, dc, srvConf)
+			srv.SetLogger(logger)
+
+			defer func() { logger.WithError(srv.Close()).Info("Closed server.") }()
+
+			if conf.BandwidthReportSeconds > 0 {
+				http.Handle(bandwidthReportsPath, bandwidthReportsHandler(srv))
+			}
+			if conf.StatsAddress != "" {
+				go func() {
+					if err := http.ListenAndServe(conf.StatsAddress, statsHandler(srv, conf.StatsShowPKs)); err != nil {
+						logger.WithError(err).Error("Failed to serve stats page.")
+					}
+				}()
+			}
 
-		defer func() { logger.WithError(srv.Close()).Info("Closed server.") }()
+			errCh := make(chan error, 1)
+			go func() { errCh <- srv.ServeUnderlaysContext(ctx, uls...) }()
+
+			select {
+			case err := <-errCh:
+				log.Fatal(err)
+			case <-srv.Ready():
+				ready()
+			}
 
-		if err := srv.Serve(lis, conf.PublicAddress); err != nil {
-			log.Fatal(err)
+			select {
+			case <-ctx.Done():
+			case err := <-errCh:
+				logger.WithError(err).Error("Stopped serving.")
+			}
 		}
+
+		// Run as a Windows service if started by the service control manager.
+		if isService, err := runAsService(tag, run); isService {
+			if err != nil {
+				logger.WithError(err).Fatal("Failed to run as service.")
+			}
+			return
+		}
+
+		ctx, cancel := cmdutil.SignalContext(context.Background(), logger)
+		defer cancel()
+
+		if conf.MetricsPushGateway != "" {
+			grouping := map[string]string{"server_pk": conf.PubKey.String()}
+			interval := time.Duration(conf.MetricsPushSeconds) * time.Second
+			go metrics.PushPeriodically(ctx, logger, conf.MetricsPushGateway, tag, grouping, interval)
+		}
+
+		// Notify the service manager (if any) of readiness, and keep the watchdog (if enabled) fed.
+		run(ctx, func() {
+			if _, err := cmdutil.SdNotify(cmdutil.SdNotifyReady); err != nil {
+				logger.WithError(err).Warn("Failed to notify service manager of readiness.")
+			}
+			go cmdutil.SdWatchdog(ctx, logger)
+		})
+		_, _ = cmdutil.SdNotify(cmdutil.SdNotifyStopping) //nolint:errcheck
 	},
 }
 
 func init() {
 	rootCmd.Flags().StringVarP(&metricsAddr, "metrics", "m", ":2121", "address to bind metrics API to")
-	rootCmd.Flags().StringVar(&syslogAddr, "syslog", "", "syslog server address. E.g. localhost:514")
+	rootCmd.Flags().StringVar(&syslogAddr, "syslog", "",
+		"syslog server address, as [udp|tcp|tls]://host:port (udp if omitted). E.g. tls://localhost:6514")
+	rootCmd.Flags().StringVar(&syslogCA, "syslog-ca", "",
+		"PEM file of CAs to verify the syslog server against (for tls, defaults to the system's CAs)")
 	rootCmd.Flags().StringVar(&tag, "tag", "dmsg-server", "logging tag")
+	rootCmd.Flags().StringVar(&logFile, "log-file", "", "file to write logs to (instead of the console)")
+	rootCmd.Flags().IntVar(&logMaxSize, "log-max-size", cmdutil.DefaultLogFileMaxSize>>20,
+		"size (in MB) after which the log file is rotated")
+	rootCmd.Flags().DurationVar(&logFileCfg.MaxAge, "log-max-age", 0,
+		"age after which the log file is rotated (0 disables age-based rotation)")
+	rootCmd.Flags().IntVar(&logFileCfg.MaxBackups, "log-max-backups", 0,
+		"number of rotated log files to keep (0 keeps all)")
+	rootCmd.Flags().BoolVar(&logFileCfg.Compress, "log-compress", false, "compress rotated log files with gzip")
 	rootCmd.Flags().BoolVarP(&cfgFromStdin, "stdin", "i", false, "read configuration from STDIN")
+	rootCmd.Flags().BoolVar(&printConfig, "print-config", false,
+		"print final configuration (with envs applied and the secret key redacted) and exit")
+	rootCmd.Flags().BoolVar(&passphraseStdin, "passphrase-stdin", false, "read passphrase of secret key from STDIN")
+	rootCmd.AddCommand(cmdutil.KeygenCmd())
 }
 
-func parseConfig(configFile string) *Config {
+// parseConfig reads the config from the config file (or STDIN).
+// If the config file is not explicitly specified and does not exist, an empty config is returned so that the config
+// can be sourced entirely from envs.
+func parseConfig(configFile string, explicit bool) (*Config, error) {
 	var rdr io.Reader
-	var err error
 	if !cfgFromStdin {
-		rdr, err = os.Open(filepath.Clean(configFile))
+		f, err := os.Open(filepath.Clean(configFile))
+		if os.IsNotExist(err) && !explicit {
+			return &Config{}, nil
+		}
 		if err != nil {
-			log.Fatalf("Failed to open config: %s", err)
+			return nil, err
 		}
+		defer func() { _ = f.Close() }() //nolint:errcheck
+		rdr = f
 	} else {
 		rdr = bufio.NewReader(os.Stdin)
 	}
 
-	conf := &Config{}
-	if err := json.NewDecoder(rdr).Decode(&conf); err != nil {
-		log.Fatalf("Failed to decode %s: %s", rdr, err)
+	data, err := ioutil.ReadAll(rdr)
+	if err != nil {
+		return nil, err
+	}
+	conf, version, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if version < configVersion {
+		log.Printf("Migrated config from version %d to %d. Run with --print-config to obtain the migrated config "+
+			"(the secret key is redacted).", version, configVersion)
+	}
+	return conf, nil
+}
+
+// print writes the config as indented JSON, with the secret key redacted.
+func (c *Config) print(w io.Writer) error {
+	out := struct {
+		*Config
+		SecKey string `json:"secret_key,omitempty"`
+	}{Config: c}
+	if !c.SecKey.Null() {
+		out.SecKey = redactedSecKey
 	}
 
-	return conf
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(out)
 }
 
 // Execute executes root CLI command.
@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestParseConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmsg-server-config")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	// writeConfig writes a config file with the given contents, and returns its path.
+	writeConfig := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+		return path
+	}
+
+	t.Run("missing_default", func(t *testing.T) {
+		// Configs can be sourced entirely from envs.
+		conf, err := parseConfig(filepath.Join(dir, "config.json"), false)
+		require.NoError(t, err)
+		require.Equal(t, &Config{}, conf)
+	})
+
+	t.Run("missing_explicit", func(t *testing.T) {
+		_, err := parseConfig(filepath.Join(dir, "missing.json"), true)
+		require.True(t, os.IsNotExist(err), err)
+	})
+
+	t.Run("envs_over_file", func(t *testing.T) {
+		path := writeConfig("envs.json", `{
+			"version": 1,
+			"discovery": "http://file.discovery",
+			"local_address": ":8080"
+		}`)
+		conf, err := parseConfig(path, true)
+		require.NoError(t, err)
+		require.Equal(t, "http://file.discovery", conf.Discovery)
+
+		defer setEnvs(t, map[string]string{envDiscovery: "http://env.discovery"})()
+		require.NoError(t, conf.applyEnvs())
+		require.Equal(t, "http://env.discovery", conf.Discovery)
+		require.Equal(t, ":8080", conf.LocalAddress)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseConfig(writeConfig("invalid.json", `{"pow_difficulty": "8"}`), true)
+		var cErr configError
+		require.True(t, errors.As(err, &cErr), err)
+		require.Equal(t, "pow_difficulty", cErr.Path)
+	})
+}
+
+func TestConfig_print(t *testing.T) {
+	// printed returns the printed config, decoded as a map.
+	printed := func(conf *Config) (string, map[string]interface{}) {
+		var buf bytes.Buffer
+		require.NoError(t, conf.print(&buf))
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+		return buf.String(), out
+	}
+
+	t.Run("redacted", func(t *testing.T) {
+		pk, sk := cipher.GenerateKeyPair()
+		conf := &Config{PubKey: pk, SecKey: sk, Discovery: "http://discovery"}
+		raw, out := printed(conf)
+		require.NotContains(t, raw, sk.Hex())
+		require.Equal(t, redactedSecKey, out["secret_key"])
+		require.Equal(t, pk.Hex(), out["public_key"])
+		require.Equal(t, "http://discovery", out["discovery"])
+
+		// The config itself is not modified.
+		require.Equal(t, sk, conf.SecKey)
+	})
+
+	t.Run("no_secret_key", func(t *testing.T) {
+		_, out := printed(&Config{})
+		require.NotContains(t, out, "secret_key")
+	})
+}
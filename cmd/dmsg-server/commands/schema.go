@@ -0,0 +1,213 @@
+package commands
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// configVersion is the current version of the config format. It is incremented whenever the format changes in a way
+// which requires existing configs to be migrated (see configMigrations).
+const configVersion = 1
+
+// configMigrations migrate raw configs of the version of the index to the next version.
+var configMigrations = []func(raw map[string]interface{}) error{
+	// 0 -> 1: unversioned configs have the same format as version 1.
+	func(map[string]interface{}) error { return nil },
+}
+
+// configError locates an invalid value of a config.
+type configError struct {
+	Path string // path of the value, such as 'extra_listeners[0].type' (empty for the config itself)
+	Msg  string
+}
+
+// Error implements error
+func (e configError) Error() string {
+	if e.Path == "" {
+		return "config: " + e.Msg
+	}
+	return fmt.Sprintf("config: '%s': %s", e.Path, e.Msg)
+}
+
+// decodeConfig migrates the config to the current version (if needed), checks it against the schema of Config, and
+// decodes it. The returned version is that of the config before migration.
+func decodeConfig(data []byte) (conf *Config, version int, err error) {
+	var raw map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // so that values of large integers are retained
+	if err := dec.Decode(&raw); err != nil {
+		if sErr, ok := err.(*json.SyntaxError); ok {
+			line, col := position(data, sErr.Offset)
+			return nil, 0, configError{Msg: fmt.Sprintf("line %d, column %d: %v", line, col, sErr)}
+		}
+		return nil, 0, configError{Msg: err.Error()}
+	}
+	if raw == nil {
+		raw = make(map[string]interface{})
+	}
+
+	if version, err = rawVersion(raw); err != nil {
+		return nil, 0, err
+	}
+	for v := version; v < configVersion; v++ {
+		if err := configMigrations[v](raw); err != nil {
+			return nil, version, configError{Msg: fmt.Sprintf("failed to migrate from version %d: %v", v, err)}
+		}
+	}
+	raw["version"] = configVersion
+
+	if err := checkSchema("", raw, reflect.TypeOf(Config{})); err != nil {
+		return nil, version, err
+	}
+	if data, err = json.Marshal(raw); err != nil {
+		return nil, version, err
+	}
+	conf = new(Config)
+	if err := json.Unmarshal(data, conf); err != nil {
+		return nil, version, configError{Msg: err.Error()}
+	}
+	return conf, version, nil
+}
+
+// rawVersion returns the version of the raw config (0 if it has none).
+func rawVersion(raw map[string]interface{}) (int, error) {
+	v, ok := raw["version"]
+	if !ok {
+		return 0, nil
+	}
+	n, ok := v.(json.Number)
+	version, err := n.Int64()
+	if !ok || err != nil || version < 0 {
+		return 0, configError{Path: "version", Msg: "should be a non-negative integer"}
+	}
+	if version > configVersion {
+		return 0, configError{Path: "version", Msg: fmt.Sprintf(
+			"version %d is newer than the supported version %d (upgrade dmsg-server)", version, configVersion)}
+	}
+	return int(version), nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// checkSchema checks that the decoded JSON value 'v' at the given path fits the type 't', so that unknown fields and
+// values of the wrong type are reported with their paths.
+func checkSchema(path string, v interface{}, t reflect.Type) error {
+	if v == nil {
+		return nil
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return checkLeaf(path, v, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return configError{Path: path, Msg: "should be an object"}
+		}
+		fields := jsonFields(t)
+		for _, k := range sortedKeys(obj) {
+			ft, ok := fields[k]
+			if !ok {
+				return configError{Path: joinPath(path, k), Msg: "unknown field"}
+			}
+			if err := checkSchema(joinPath(path, k), obj[k], ft); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return configError{Path: path, Msg: "should be an array"}
+		}
+		for i, ev := range arr {
+			if err := checkSchema(fmt.Sprintf("%s[%d]", path, i), ev, t.Elem()); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return configError{Path: path, Msg: "should be an object"}
+		}
+		for _, k := range sortedKeys(obj) {
+			if err := checkSchema(joinPath(path, k), obj[k], t.Elem()); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return checkLeaf(path, v, t)
+	}
+}
+
+// checkLeaf checks the value by decoding it into a value of the given type.
+func checkLeaf(path string, v interface{}, t reflect.Type) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return configError{Path: path, Msg: err.Error()}
+	}
+	if err := json.Unmarshal(b, reflect.New(t).Interface()); err != nil {
+		if tErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return configError{Path: path, Msg: fmt.Sprintf("should be of type %s, not %s", t, tErr.Value)}
+		}
+		return configError{Path: path, Msg: err.Error()}
+	}
+	return nil
+}
+
+// jsonFields returns the types of the fields of the struct type, by JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// position returns the line and column of the byte offset within data.
+func position(data []byte, offset int64) (line, col int) {
+	line, col = 1, 1
+	for i := 0; i < len(data) && int64(i) < offset-1; i++ {
+		if data[i] == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
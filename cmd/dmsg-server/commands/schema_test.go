@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeConfig_schema(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		path string // path of the invalid value
+		msg  string // part of the message of the error
+	}{
+		{"syntax", "{\n\t\"log_level\": \"info\",\n\t\"discovery\": }", "", "line 3, column 15"},
+		{"not_an_object", `[]`, "", "cannot unmarshal array"},
+		{"unknown_field", `{"log_levels": "info"}`, "log_levels", "unknown field"},
+		{"wrong_type", `{"pow_difficulty": "8"}`, "pow_difficulty", "should be of type int, not string"},
+		{"negative_unsigned", `{"memory_budget": -1}`, "memory_budget", "should be of type uint64"},
+		{"invalid_text", `{"public_key": "not-a-key"}`, "public_key", ""},
+		{"not_an_array", `{"extra_listeners": {}}`, "extra_listeners", "should be an array"},
+		{"array_element", `{"extra_listeners": [{"type": "tcp"}, []]}`, "extra_listeners[1]", "should be an object"},
+		{"nested_unknown_field", `{"extra_listeners": [{"typ": "tcp"}]}`, "extra_listeners[0].typ", "unknown field"},
+		{"map_value", `{"metrics_labels": {"region": 1}}`, "metrics_labels.region", "should be of type string"},
+		{"negative_version", `{"version": -1}`, "version", "non-negative integer"},
+		{"newer_version", `{"version": 2}`, "version", "newer than the supported version 1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := decodeConfig([]byte(c.data))
+			var cErr configError
+			require.True(t, errors.As(err, &cErr), err)
+			require.Equal(t, c.path, cErr.Path)
+			require.Contains(t, cErr.Msg, c.msg)
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		data := `{
+			"version": 1,
+			"log_level": "info",
+			"extra_listeners": [{"type": "ws", "local_address": ":8081", "public_address": "example.com:8081"}],
+			"metrics_labels": {"region": "eu"},
+			"memory_budget": 1073741824
+		}`
+		conf, version, err := decodeConfig([]byte(data))
+		require.NoError(t, err)
+		require.Equal(t, 1, version)
+		require.Equal(t, "info", conf.LogLevel)
+		require.Equal(t, []ListenerConfig{{Type: "ws", LocalAddress: ":8081", PublicAddress: "example.com:8081"}},
+			conf.ExtraListeners)
+		require.Equal(t, map[string]string{"region": "eu"}, conf.MetricsLabels)
+		require.Equal(t, uint64(1<<30), conf.MemoryBudget)
+	})
+}
+
+func TestDecodeConfig_migration(t *testing.T) {
+	// replaceMigration replaces the migration from version 0 for the duration of the test.
+	replaceMigration := func(migrate func(raw map[string]interface{}) error) func() {
+		prev := configMigrations[0]
+		configMigrations[0] = migrate
+		return func() { configMigrations[0] = prev }
+	}
+
+	t.Run("unversioned", func(t *testing.T) {
+		conf, version, err := decodeConfig([]byte(`{"log_level": "debug"}`))
+		require.NoError(t, err)
+		require.Equal(t, 0, version)
+		require.Equal(t, configVersion, conf.Version)
+		require.Equal(t, "debug", conf.LogLevel)
+	})
+
+	t.Run("migrated_before_schema_check", func(t *testing.T) {
+		// A field which was renamed is only known to the schema once migrated.
+		defer replaceMigration(func(raw map[string]interface{}) error {
+			if v, ok := raw["stats_addr"]; ok {
+				raw["stats_address"] = v
+				delete(raw, "stats_addr")
+			}
+			return nil
+		})()
+
+		conf, version, err := decodeConfig([]byte(`{"stats_addr": ":9090"}`))
+		require.NoError(t, err)
+		require.Equal(t, 0, version)
+		require.Equal(t, configVersion, conf.Version)
+		require.Equal(t, ":9090", conf.StatsAddress)
+
+		// Current configs are not migrated.
+		_, _, err = decodeConfig([]byte(`{"version": 1, "stats_addr": ":9090"}`))
+		require.Equal(t, configError{Path: "stats_addr", Msg: "unknown field"}, err)
+	})
+
+	t.Run("migration_failed", func(t *testing.T) {
+		defer replaceMigration(func(map[string]interface{}) error { return errors.New("boom") })()
+
+		_, version, err := decodeConfig([]byte(`{}`))
+		require.Equal(t, 0, version)
+		require.Equal(t, configError{Msg: "failed to migrate from version 0: boom"}, err)
+	})
+}
@@ -0,0 +1,11 @@
+// +build !windows
+
+package commands
+
+import "context"
+
+// runAsService is a no-op on non-Windows platforms, as service managers (such as systemd) are notified via
+// 'cmdutil.SdNotify' instead.
+func runAsService(_ string, _ func(ctx context.Context, ready func())) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,60 @@
+// +build windows
+
+package commands
+
+import (
+	"context"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// runAsService runs 'run' as a Windows service if the process is started by the service control manager.
+// It returns false if the process is ran interactively.
+func runAsService(name string, run func(ctx context.Context, ready func())) (bool, error) {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		return false, err
+	}
+	if interactive {
+		return false, nil
+	}
+	return true, svc.Run(name, &winService{run: run})
+}
+
+// winService implements svc.Handler.
+type winService struct {
+	run func(ctx context.Context, ready func())
+}
+
+// Execute implements svc.Handler
+func (s *winService) Execute(_ []string, reqs <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.run(ctx, func() { status <- svc.Status{State: svc.Running, Accepts: accepts} })
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return false, 0
+		case req := <-reqs:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				<-done
+				return false, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"html/template"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/httputil"
+)
+
+// publicStats is the read-only status of the dmsg-server which is published on the stats page.
+// Public keys are only included if enabled with 'stats_show_pks'.
+type publicStats struct {
+	Version   string          `json:"version"`
+	Uptime    string          `json:"uptime"`
+	Sessions  int             `json:"sessions"`
+	Streams   int             `json:"streams"`
+	BytesIn   uint64          `json:"bytes_in"`
+	BytesOut  uint64          `json:"bytes_out"`
+	ServerPK  *cipher.PubKey  `json:"server_pk,omitempty"`
+	ClientPKs []cipher.PubKey `json:"client_pks,omitempty"`
+}
+
+var statsPage = template.Must(template.New("stats").Parse(`<!DOCTYPE html>
+<html>
+<head><title>dmsg-server status</title></head>
+<body>
+<h1>dmsg-server status</h1>
+<table>
+<tr><td>Version</td><td>{{.Version}}</td></tr>
+<tr><td>Uptime</td><td>{{.Uptime}}</td></tr>
+<tr><td>Sessions</td><td>{{.Sessions}}</td></tr>
+<tr><td>Streams</td><td>{{.Streams}}</td></tr>
+<tr><td>Bytes in</td><td>{{.BytesIn}}</td></tr>
+<tr><td>Bytes out</td><td>{{.BytesOut}}</td></tr>
+{{if .ServerPK}}<tr><td>Public key</td><td>{{.ServerPK}}</td></tr>{{end}}
+</table>
+{{if .ClientPKs}}<h2>Clients</h2>
+<ul>{{range .ClientPKs}}<li>{{.}}</li>{{end}}</ul>{{end}}
+</body>
+</html>
+`))
+
+// statsHandler serves the stats page as HTML, or as JSON if requested with the 'Accept: application/json' header or
+// the '?format=json' query.
+func statsHandler(srv *dmsg.Server, showPKs bool) http.Handler {
+	version := buildVersion()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := srv.Stats()
+		stats := publicStats{
+			Version:  version,
+			Uptime:   time.Since(st.Started).Truncate(time.Second).String(),
+			Sessions: st.Sessions,
+			Streams:  st.Streams,
+			BytesIn:  st.BytesIn,
+			BytesOut: st.BytesOut,
+		}
+		if showPKs {
+			pk := srv.LocalPK()
+			stats.ServerPK = &pk
+			stats.ClientPKs = st.ClientPKs
+		}
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			httputil.WriteJSON(w, r, http.StatusOK, stats)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statsPage.Execute(w, stats); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// buildVersion returns the module version of the binary.
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "unknown"
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestStatsHandler(t *testing.T) {
+	dc := disc.NewMock()
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := dmsg.NewServer(srvPK, srvSK, dc)
+	lis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(lis, "") }() //nolint:errcheck
+	<-srv.Ready()
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	cliPK, cliSK := cipher.GenerateKeyPair()
+	c := dmsg.NewClient(cliPK, cliSK, dc, nil)
+	go c.Serve()
+	<-c.Ready()
+	defer func() { require.NoError(t, c.Close()) }()
+	require.Eventually(t, func() bool { return srv.SessionCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// get returns the response to a request of the stats page with the given URL and Accept header.
+	get := func(h http.Handler, url, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec
+	}
+
+	t.Run("json", func(t *testing.T) {
+		h := statsHandler(srv, false)
+		for _, rec := range []*httptest.ResponseRecorder{
+			get(h, "/?format=json", ""),
+			get(h, "/", "application/json"),
+		} {
+			require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+			var stats publicStats
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+			require.Equal(t, 1, stats.Sessions)
+			require.NotEmpty(t, stats.Version)
+			require.NotEmpty(t, stats.Uptime)
+
+			// Public keys are not published unless enabled.
+			require.Nil(t, stats.ServerPK)
+			require.Empty(t, stats.ClientPKs)
+			require.NotContains(t, rec.Body.String(), "server_pk")
+			require.NotContains(t, rec.Body.String(), "client_pks")
+		}
+	})
+
+	t.Run("json_with_pks", func(t *testing.T) {
+		rec := get(statsHandler(srv, true), "/?format=json", "")
+
+		var stats publicStats
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		require.NotNil(t, stats.ServerPK)
+		require.Equal(t, srvPK, *stats.ServerPK)
+		require.Equal(t, []cipher.PubKey{cliPK}, stats.ClientPKs)
+	})
+
+	t.Run("html", func(t *testing.T) {
+		rec := get(statsHandler(srv, false), "/", "text/html")
+		require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+		require.Contains(t, rec.Body.String(), "<tr><td>Sessions</td><td>1</td></tr>")
+		require.NotContains(t, rec.Body.String(), cliPK.Hex())
+		require.NotContains(t, rec.Body.String(), srvPK.Hex())
+
+		rec = get(statsHandler(srv, true), "/", "")
+		require.Contains(t, rec.Body.String(), "<tr><td>Public key</td><td>"+srvPK.Hex()+"</td></tr>")
+		require.Contains(t, rec.Body.String(), "<li>"+cliPK.Hex()+"</li>")
+	})
+}
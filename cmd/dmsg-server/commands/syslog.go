@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/cmdutil"
+)
+
+// addSyslogHook sends logs to the syslog server of the given address (see cmdutil.SyslogConfig) as RFC 5424 messages.
+// The public key of the server and the session of entries are sent as structured data.
+// If 'caFile' is set, the TLS certificate of the syslog server is verified against the CAs of the PEM file.
+func addSyslogHook(addr, tag, caFile string, pk cipher.PubKey) error {
+	conf := cmdutil.SyslogConfig{
+		Addr:   addr,
+		Tag:    tag,
+		Params: map[string]string{"pk": pk.String()},
+		Fields: []string{"session", "remote_pk"},
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(filepath.Clean(caFile))
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in syslog CA file")
+		}
+		conf.TLS = &tls.Config{RootCAs: pool} //nolint:gosec
+	}
+	hook, err := cmdutil.NewSyslogHook(conf)
+	if err != nil {
+		return err
+	}
+	logging.AddHook(hook)
+	return nil
+}
@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+// errDiscDown is returned by flakyDisc when discovery is flapped down.
+var errDiscDown = errors.New("discovery is down (chaos)")
+
+// flakyDisc wraps a discovery client, and fails all calls while it is set as down.
+type flakyDisc struct {
+	disc.APIClient
+	down int32 // accessed atomically, 1 if down
+}
+
+func (d *flakyDisc) setDown(down bool) {
+	v := int32(0)
+	if down {
+		v = 1
+	}
+	atomic.StoreInt32(&d.down, v)
+}
+
+func (d *flakyDisc) isDown() bool { return atomic.LoadInt32(&d.down) == 1 }
+
+// Entry implements disc.APIClient
+func (d *flakyDisc) Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	if d.isDown() {
+		return nil, errDiscDown
+	}
+	return d.APIClient.Entry(ctx, pk)
+}
+
+// SetEntry implements disc.APIClient
+func (d *flakyDisc) SetEntry(ctx context.Context, e *disc.Entry) error {
+	if d.isDown() {
+		return errDiscDown
+	}
+	return d.APIClient.SetEntry(ctx, e)
+}
+
+// UpdateEntry implements disc.APIClient
+func (d *flakyDisc) UpdateEntry(ctx context.Context, sk cipher.SecKey, e *disc.Entry) error {
+	if d.isDown() {
+		return errDiscDown
+	}
+	return d.APIClient.UpdateEntry(ctx, sk, e)
+}
+
+// AvailableServers implements disc.APIClient
+func (d *flakyDisc) AvailableServers(ctx context.Context, opts ...disc.ServersOption) ([]*disc.Entry, error) {
+	if d.isDown() {
+		return nil, errDiscDown
+	}
+	return d.APIClient.AvailableServers(ctx, opts...)
+}
+
+// chaos randomly disrupts the dmsg network of an Env, and continuously checks that clients recover.
+type chaos struct {
+	env      *dmsgtest.Env
+	dc       *flakyDisc    // nil if discovery flapping is disabled
+	interval time.Duration // interval between disruptions
+	downtime time.Duration // duration in which killed servers and flapped discovery stay down
+	sla      time.Duration // duration in which clients are expected to reconnect after a disruption
+	st       *stats
+	rand     *rand.Rand
+}
+
+// chaosSeed returns the seed used for picking disruptions.
+// If the simulator seed is set, the disruptions are reproducible.
+func chaosSeed(seed string) int64 {
+	if seed == "" {
+		return time.Now().UnixNano()
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(seed)) //nolint:errcheck
+	return int64(h.Sum64())
+}
+
+// run disrupts the network every interval until the context is done.
+func (c *chaos) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	actions := []func(ctx context.Context){c.killServer, c.partitionClient}
+	if c.dc != nil {
+		actions = append(actions, c.flapDiscovery)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			actions[c.rand.Intn(len(actions))](ctx)
+		}
+	}
+}
+
+// killServer kills a random server (unless it is the last one), and starts a replacement after the downtime.
+func (c *chaos) killServer(ctx context.Context) {
+	servers := c.env.AllServers()
+	if len(servers) <= 1 {
+		return
+	}
+	srv := servers[c.rand.Intn(len(servers))]
+	log.WithField("server", srv.LocalPK()).Warn("Chaos: killing server.")
+	if err := srv.Close(); err != nil {
+		log.WithError(err).Warn("Chaos: server closed with error.")
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.downtime):
+		}
+		srv, err := c.env.NewServer()
+		if err != nil {
+			log.WithError(err).Error("Chaos: failed to restart server.")
+			return
+		}
+		log.WithField("server", srv.LocalPK()).Warn("Chaos: restarted server.")
+	}()
+}
+
+// partitionClient closes all sessions of a random client, cutting it off from the network until it reconnects.
+func (c *chaos) partitionClient(_ context.Context) {
+	clients := c.env.AllClients()
+	if len(clients) == 0 {
+		return
+	}
+	cl := clients[c.rand.Intn(len(clients))]
+	log.WithField("client", cl.LocalPK()).Warn("Chaos: partitioning client.")
+	for _, ses := range cl.AllSessions() {
+		_ = ses.Close() //nolint:errcheck
+	}
+}
+
+// flapDiscovery makes discovery unavailable for the downtime.
+func (c *chaos) flapDiscovery(ctx context.Context) {
+	if c.dc.isDown() {
+		return
+	}
+	log.Warn("Chaos: flapping discovery down.")
+	c.dc.setDown(true)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.downtime):
+		}
+		c.dc.setDown(false)
+		log.Warn("Chaos: flapped discovery up.")
+	}()
+}
+
+// checkInvariants continuously checks that every client reconnects to at least one server within the SLA.
+func (c *chaos) checkInvariants(ctx context.Context) {
+	ticker := time.NewTicker(c.sla / 4)
+	defer ticker.Stop()
+
+	unhealthySince := make(map[cipher.PubKey]time.Time)
+	reported := make(map[cipher.PubKey]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		for _, cl := range c.env.AllClients() {
+			pk := cl.LocalPK()
+			if len(cl.AllSessions()) > 0 {
+				delete(unhealthySince, pk)
+				delete(reported, pk)
+				continue
+			}
+			since, ok := unhealthySince[pk]
+			if !ok {
+				unhealthySince[pk] = now
+				continue
+			}
+			if now.Sub(since) > c.sla && !reported[pk] {
+				reported[pk] = true
+				atomic.AddUint64(&c.st.violations, 1)
+				log.WithField("client", pk).
+					WithField("disconnected_for", now.Sub(since)).
+					Error("Invariant violated: client did not reconnect within SLA.")
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cmdutil"
+	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+var log = logging.MustGetLogger("dmsg-sim")
+
+var (
+	servers     = 3
+	clients     = 6
+	minSessions = dmsg.DefaultMinSessions
+	streams     = 3
+	msgSize     = 1024
+	msgRate     = 100
+	statsEvery  = time.Second * 5
+	seed        = ""
+	realDisc    = false
+
+	chaosMode     = false
+	chaosInterval = time.Second * 10
+	chaosDowntime = time.Second * 5
+	chaosSLA      = time.Second * 30
+)
+
+func init() {
+	rootCmd.Flags().IntVar(&servers, "servers", servers,
+		"number of dmsg servers to run")
+
+	rootCmd.Flags().IntVar(&clients, "clients", clients,
+		"number of dmsg clients to run")
+
+	rootCmd.Flags().IntVar(&minSessions, "min-sessions", minSessions,
+		"minimum number of sessions each dmsg client should maintain")
+
+	rootCmd.Flags().IntVar(&streams, "streams", streams,
+		"number of streams to generate traffic over (each between a pair of dmsg clients)")
+
+	rootCmd.Flags().IntVar(&msgSize, "msg-size", msgSize,
+		"size in bytes of each message written to a stream")
+
+	rootCmd.Flags().IntVar(&msgRate, "msg-rate", msgRate,
+		"messages written per second per stream (0 for no limit)")
+
+	rootCmd.Flags().DurationVar(&statsEvery, "stats", statsEvery,
+		"interval in which stats are printed")
+
+	rootCmd.Flags().StringVar(&seed, "seed", seed,
+		"if set, keypairs are generated deterministically from the seed")
+
+	rootCmd.Flags().BoolVar(&realDisc, "real-disc", realDisc,
+		"if set, an in-memory dmsg discovery HTTP server is used instead of a mock discovery")
+
+	rootCmd.Flags().BoolVar(&chaosMode, "chaos", chaosMode,
+		"if set, servers are randomly killed, clients partitioned and discovery flapped (unless 'real-disc' is set)")
+
+	rootCmd.Flags().DurationVar(&chaosInterval, "chaos-interval", chaosInterval,
+		"interval between chaos disruptions")
+
+	rootCmd.Flags().DurationVar(&chaosDowntime, "chaos-downtime", chaosDowntime,
+		"duration in which killed servers and flapped discovery stay down")
+
+	rootCmd.Flags().DurationVar(&chaosSLA, "chaos-sla", chaosSLA,
+		"duration in which clients are expected to reconnect after a disruption")
+}
+
+var rootCmd = &cobra.Command{
+	Use:   cmdutil.RootCmdName(),
+	Short: "runs a simulated local dmsg network",
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := cmdutil.SignalContext(context.Background(), log)
+		defer cancel()
+
+		if streams > 0 && clients < 2 {
+			log.Fatal("At least 2 clients are required to generate traffic.")
+		}
+		if msgSize < msgSizeMin {
+			log.Fatalf("Value 'msg-size' should be at least %d.", msgSizeMin)
+		}
+
+		var env *dmsgtest.Env
+		if seed != "" {
+			env = dmsgtest.NewEnvWithSeed(nil, dmsgtest.DefaultTimeout, []byte(seed))
+		} else {
+			env = dmsgtest.NewEnv(nil, dmsgtest.DefaultTimeout)
+		}
+
+		conf := dmsg.DefaultConfig()
+		conf.MinSessions = minSessions
+
+		log.WithField("servers", servers).
+			WithField("clients", clients).
+			Info("Starting up dmsg network...")
+
+		var dc *flakyDisc
+		var err error
+		switch {
+		case realDisc:
+			err = env.StartupWithDiscovery(servers, clients, conf)
+		case chaosMode:
+			dc = &flakyDisc{APIClient: disc.NewMock()}
+			err = env.StartupWithDiscClient(dc, servers, clients, conf)
+		default:
+			err = env.Startup(servers, clients, conf)
+		}
+		cmdutil.CatchWithLog(log, "failed to start up dmsg network", err)
+		defer env.Shutdown()
+
+		st := new(stats)
+		wg := new(sync.WaitGroup)
+
+		if chaosMode {
+			c := &chaos{
+				env:      env,
+				dc:       dc,
+				interval: chaosInterval,
+				downtime: chaosDowntime,
+				sla:      chaosSLA,
+				st:       st,
+				rand:     rand.New(rand.NewSource(chaosSeed(seed))), //nolint:gosec
+			}
+			wg.Add(2)
+			go func() {
+				c.run(ctx)
+				wg.Done()
+			}()
+			go func() {
+				c.checkInvariants(ctx)
+				wg.Done()
+			}()
+		}
+
+		allClients := env.AllClients()
+		for i := 0; i < streams; i++ {
+			src, dst := allClients[i%len(allClients)], allClients[(i+1)%len(allClients)]
+			gen := &trafficGen{
+				src:  src,
+				dst:  dst,
+				port: trafficPortMin + uint16(i),
+				size: msgSize,
+				rate: msgRate,
+				st:   st,
+			}
+			wg.Add(1)
+			go func() {
+				gen.run(ctx)
+				wg.Done()
+			}()
+		}
+
+		printStats(ctx, env, st, statsEvery)
+		wg.Wait()
+	},
+}
+
+// printStats prints stats of the dmsg network every interval until the context is done.
+func printStats(ctx context.Context, env *dmsgtest.Env, st *stats, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	_, lastRecv := st.snapshot()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var sesN, strN int
+		allClients := env.AllClients()
+		for _, c := range allClients {
+			for _, ses := range c.AllSessions() {
+				sesN++
+				strN += ses.StreamCount()
+			}
+		}
+
+		sent, recv := st.snapshot()
+		log.WithField("uptime", time.Since(start).Truncate(time.Second)).
+			WithField("servers", len(env.AllServers())).
+			WithField("clients", len(allClients)).
+			WithField("sessions", sesN).
+			WithField("streams", strN).
+			WithField("sent_bytes", sent).
+			WithField("recv_bytes", recv).
+			WithField("recv_bytes_per_sec", float64(recv-lastRecv)/interval.Seconds()).
+			WithField("errors", st.errorCount()).
+			WithField("corruptions", st.corruptionCount()).
+			WithField("violations", st.violationCount()).
+			Info("Stats.")
+		lastRecv = recv
+	}
+}
+
+// Execute executes the root command.
+func Execute() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
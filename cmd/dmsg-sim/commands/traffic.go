@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+)
+
+// trafficPortMin is the dmsg port used by the first traffic generator. Subsequent generators use subsequent ports.
+const trafficPortMin = uint16(1000)
+
+// msgSizeMin is the minimum size of a traffic message, as each message begins with its sequence number.
+const msgSizeMin = 8
+
+// stats records traffic totals across all traffic generators.
+type stats struct {
+	sent        uint64
+	recv        uint64
+	errors      uint64
+	corruptions uint64 // number of messages that were received with unexpected contents
+	violations  uint64 // number of chaos invariant violations (other than corruptions)
+}
+
+func (s *stats) snapshot() (sent, recv uint64) {
+	return atomic.LoadUint64(&s.sent), atomic.LoadUint64(&s.recv)
+}
+
+func (s *stats) errorCount() uint64 {
+	return atomic.LoadUint64(&s.errors)
+}
+
+func (s *stats) corruptionCount() uint64 {
+	return atomic.LoadUint64(&s.corruptions)
+}
+
+func (s *stats) violationCount() uint64 {
+	return atomic.LoadUint64(&s.violations)
+}
+
+// trafficGen writes messages over a dmsg stream from 'src' to 'dst', and reads them on the other end.
+// The stream is re-dialed on failure.
+// Each message contains a sequence number and contents derived from it, so that the reading end can verify that no
+// data is corrupted, reordered or lost within a stream.
+type trafficGen struct {
+	src  *dmsg.Client
+	dst  *dmsg.Client
+	port uint16
+	size int
+	rate int // messages per second, 0 for no limit
+	st   *stats
+}
+
+func (g *trafficGen) run(ctx context.Context) {
+	lis, err := g.dst.Listen(g.port)
+	if err != nil {
+		log.WithError(err).WithField("port", g.port).Error("Failed to listen.")
+		atomic.AddUint64(&g.st.errors, 1)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		_ = lis.Close() //nolint:errcheck
+	}()
+	go g.acceptLoop(lis)
+
+	for ctx.Err() == nil {
+		if err := g.writeLoop(ctx, lis.DmsgAddr()); err != nil && ctx.Err() == nil {
+			log.WithError(err).WithField("addr", lis.DmsgAddr()).Warn("Traffic interrupted, re-dialing...")
+			atomic.AddUint64(&g.st.errors, 1)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (g *trafficGen) acceptLoop(lis *dmsg.Listener) {
+	for {
+		stream, err := lis.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			g.readLoop(stream)
+			_ = stream.Close() //nolint:errcheck
+		}()
+	}
+}
+
+// readLoop reads and verifies messages from the stream until reading fails or a corrupted message is found.
+func (g *trafficGen) readLoop(stream *dmsg.Stream) {
+	msg := make([]byte, g.size)
+	exp := make([]byte, g.size)
+	for seq := uint64(0); ; seq++ {
+		if _, err := io.ReadFull(stream, msg); err != nil {
+			return
+		}
+		atomic.AddUint64(&g.st.recv, uint64(len(msg)))
+
+		fillMsg(exp, seq)
+		if !bytes.Equal(msg, exp) {
+			atomic.AddUint64(&g.st.corruptions, 1)
+			log.WithField("stream", stream.RawRemoteAddr()).
+				WithField("expected_seq", seq).
+				WithField("got_seq", binary.BigEndian.Uint64(msg)).
+				Error("Invariant violated: stream data corrupted.")
+			return
+		}
+	}
+}
+
+func (g *trafficGen) writeLoop(ctx context.Context, addr dmsg.Addr) error {
+	stream, err := g.src.DialStream(ctx, addr, dmsg.BypassUnreachableCache())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = stream.Close() }() //nolint:errcheck
+
+	var tick <-chan time.Time
+	if g.rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(g.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	msg := make([]byte, g.size)
+	for seq := uint64(0); ; seq++ {
+		if tick != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-tick:
+			}
+		} else if ctx.Err() != nil {
+			return nil
+		}
+		fillMsg(msg, seq)
+		n, err := stream.Write(msg)
+		atomic.AddUint64(&g.st.sent, uint64(n))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fillMsg fills 'msg' with the contents expected of the message of the given sequence number.
+func fillMsg(msg []byte, seq uint64) {
+	binary.BigEndian.PutUint64(msg, seq)
+	for i := msgSizeMin; i < len(msg); i++ {
+		msg[i] = byte(seq) ^ byte(i)
+	}
+}
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/SkycoinProject/dmsg/cmd/dmsg-sim/commands"
+
+func main() {
+	commands.Execute()
+}
@@ -3,6 +3,8 @@ package commands
 import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/SkycoinProject/dmsg/cmdutil"
 )
 
 var unsafe = false
@@ -11,7 +13,7 @@ func init() {
 	confgenCmd.Flags().BoolVar(&unsafe, "unsafe", unsafe,
 		"will unsafely write config if set")
 
-	rootCmd.AddCommand(confgenCmd)
+	rootCmd.AddCommand(confgenCmd, cmdutil.KeygenCmd())
 }
 
 var confgenCmd = &cobra.Command{
@@ -190,7 +190,7 @@ var rootCmd = &cobra.Command{
 		dmsgC := dmsg.NewClient(pk, sk, disc.NewHTTP(dmsgDisc), &dmsg.Config{
 			MinSessions: dmsgSessions,
 		})
-		go dmsgC.Serve()
+		go func() { _ = dmsgC.ServeContext(ctx) }() //nolint:errcheck
 		select {
 		case <-ctx.Done():
 			cmdutil.CatchWithLog(log, "failed to wait unti dmsg client to be ready", ctx.Err())
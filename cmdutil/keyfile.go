@@ -0,0 +1,81 @@
+package cmdutil
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// PassphraseEnv is the env which the passphrases of encrypted secret keys are read from (if set).
+const PassphraseEnv = "DMSG_PASSPHRASE"
+
+// KeyFile is the format of key files (see KeygenCmd). Either SecKey or EncryptedSecKey is set.
+type KeyFile struct {
+	PubKey          cipher.PubKey    `json:"public_key"`
+	SecKey          *cipher.SecKey   `json:"secret_key,omitempty"`
+	EncryptedSecKey *EncryptedSecKey `json:"encrypted_secret_key,omitempty"`
+}
+
+// WriteKeyFile writes the key file of the secret key to the given path, which must not exist yet. The secret key is
+// encrypted if the passphrase is non-empty. The file is only accessible by the owner.
+func WriteKeyFile(path string, sk cipher.SecKey, passphrase []byte) (cipher.PubKey, error) {
+	pk, err := sk.PubKey()
+	if err != nil {
+		return pk, err
+	}
+	kf := KeyFile{PubKey: pk}
+	if len(passphrase) > 0 {
+		if kf.EncryptedSecKey, err = EncryptSecKey(sk, passphrase); err != nil {
+			return pk, err
+		}
+	} else {
+		kf.SecKey = &sk
+	}
+	b, err := json.MarshalIndent(kf, "", "\t")
+	if err != nil {
+		return pk, err
+	}
+
+	f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return pk, err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close() //nolint:errcheck
+		return pk, err
+	}
+	return pk, f.Close()
+}
+
+// ReadKeyFile reads the key file of the given path. The passphrase is only obtained if the secret key is encrypted.
+func ReadKeyFile(path string, passphrase func() ([]byte, error)) (cipher.PubKey, cipher.SecKey, error) {
+	var sk cipher.SecKey
+	b, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return cipher.PubKey{}, sk, err
+	}
+	var kf KeyFile
+	if err := json.Unmarshal(b, &kf); err != nil {
+		return cipher.PubKey{}, sk, err
+	}
+
+	switch {
+	case kf.SecKey != nil:
+		sk = *kf.SecKey
+	case kf.EncryptedSecKey != nil:
+		p, err := passphrase()
+		if err != nil {
+			return kf.PubKey, sk, err
+		}
+		if sk, err = kf.EncryptedSecKey.Decrypt(p); err != nil {
+			return kf.PubKey, sk, err
+		}
+	default:
+		return kf.PubKey, sk, errors.New("key file has no secret key")
+	}
+	return kf.PubKey, sk, cipher.VerifyKeyPair(kf.PubKey, sk)
+}
@@ -0,0 +1,56 @@
+package cmdutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyfile")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	noPassphrase := func() ([]byte, error) { return nil, nil }
+	passphrase := func() ([]byte, error) { return []byte("secret"), nil }
+
+	t.Run("plain", func(t *testing.T) {
+		path := filepath.Join(dir, "plain.json")
+		pk, sk := cipher.GenerateKeyPair()
+		wPK, err := WriteKeyFile(path, sk, nil)
+		require.NoError(t, err)
+		require.Equal(t, pk, wPK)
+
+		rPK, rSK, err := ReadKeyFile(path, noPassphrase)
+		require.NoError(t, err)
+		require.Equal(t, pk, rPK)
+		require.Equal(t, sk, rSK)
+
+		// Existing key files are not overwritten.
+		_, err = WriteKeyFile(path, sk, nil)
+		require.True(t, os.IsExist(err))
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		path := filepath.Join(dir, "encrypted.json")
+		_, sk := cipher.GenerateKeyPair()
+		_, err := WriteKeyFile(path, sk, []byte("secret"))
+		require.NoError(t, err)
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.NotContains(t, string(b), sk.Hex())
+
+		_, rSK, err := ReadKeyFile(path, passphrase)
+		require.NoError(t, err)
+		require.Equal(t, sk, rSK)
+
+		_, _, err = ReadKeyFile(path, noPassphrase)
+		require.Equal(t, ErrWrongPassphrase, err)
+	})
+}
@@ -0,0 +1,55 @@
+package cmdutil
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// DefaultKeyFile is the default path of key files written by the 'keygen' subcommand.
+const DefaultKeyFile = "dmsg-keys.json"
+
+// KeygenCmd returns the 'keygen' subcommand, which generates a keypair, writes its key file (see WriteKeyFile) and
+// prints the public key. It is shared by the CLIs of dmsg entities.
+func KeygenCmd() *cobra.Command {
+	var (
+		out             = DefaultKeyFile
+		encrypt         bool
+		passphraseStdin bool
+	)
+	cmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generates a keypair and writes it to a key file",
+		Long: `Generates a keypair, writes it to a key file (which must not exist yet) and prints the public key.
+
+With --encrypt, the secret key is encrypted with a passphrase, which is read from ` + PassphraseEnv + ` if set, from
+STDIN with --passphrase-stdin, or else prompted for.`,
+		Args: cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			var passphrase []byte
+			if encrypt {
+				p, err := ReadPassphrase(PassphraseEnv, passphraseStdin, true)
+				if err != nil {
+					return err
+				}
+				if len(p) == 0 {
+					return fmt.Errorf("passphrase is empty")
+				}
+				passphrase = p
+			}
+			_, sk := cipher.GenerateKeyPair()
+			pk, err := WriteKeyFile(out, sk, passphrase)
+			if err != nil {
+				return err
+			}
+			fmt.Println(pk)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&out, "out", "o", out, "path of the key file")
+	cmd.Flags().BoolVarP(&encrypt, "encrypt", "e", false, "encrypt the secret key with a passphrase")
+	cmd.Flags().BoolVar(&passphraseStdin, "passphrase-stdin", false, "read passphrase from STDIN")
+	return cmd
+}
@@ -0,0 +1,245 @@
+package cmdutil
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLogFileMaxSize is the default size (in bytes) after which a log file is rotated.
+const DefaultLogFileMaxSize = 100 << 20
+
+// backupTimeFormat is the format of the time in the names of rotated log files.
+const backupTimeFormat = "20060102T150405.000"
+
+// ErrLogFileClosed is returned when writing to a closed log file.
+var ErrLogFileClosed = errors.New("log file closed")
+
+// LogFileConfig configures the rotation of a log file (see OpenLogFile).
+type LogFileConfig struct {
+	// MaxSize is the size (in bytes) after which the file is rotated. If 0, DefaultLogFileMaxSize is used.
+	MaxSize int64
+
+	// MaxAge is the age after which the file is rotated, counted from when it is opened or rotated.
+	// A value of 0 disables age-based rotation.
+	MaxAge time.Duration
+
+	// MaxBackups is the number of rotated files which are kept. Older rotated files are deleted.
+	// A value of 0 keeps all rotated files.
+	MaxBackups int
+
+	// Compress compresses rotated files with gzip.
+	Compress bool
+}
+
+// LogFile is an io.WriteCloser which appends to a file that is rotated by size and age. Rotated files are renamed
+// with the time of rotation inserted before the extension (such as 'dmsg-server-20200102T150405.000.log'), and are
+// optionally compressed (with the '.gz' suffix).
+type LogFile struct {
+	path string
+	conf LogFileConfig
+
+	f       *os.File
+	size    int64
+	started time.Time
+
+	mx sync.Mutex
+	wg sync.WaitGroup // compression and deletion of rotated files
+}
+
+// OpenLogFile opens (or creates) the log file of the given path for appending.
+func OpenLogFile(path string, conf LogFileConfig) (*LogFile, error) {
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = DefaultLogFileMaxSize
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	l := &LogFile{path: path, conf: conf}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Write implements io.Writer
+// The file is rotated before the write if the write would exceed the maximum size, or if the maximum age is reached.
+func (l *LogFile) Write(p []byte) (int, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.f == nil {
+		return 0, ErrLogFileClosed
+	}
+	if (l.size > 0 && l.size+int64(len(p)) > l.conf.MaxSize) ||
+		(l.conf.MaxAge > 0 && time.Since(l.started) >= l.conf.MaxAge) {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := l.f.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the file immediately (such as on SIGHUP).
+func (l *LogFile) Rotate() error {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.f == nil {
+		return ErrLogFileClosed
+	}
+	return l.rotate()
+}
+
+// Close implements io.Closer
+// It waits for rotated files to be compressed.
+func (l *LogFile) Close() error {
+	l.mx.Lock()
+	var err error
+	if l.f != nil {
+		err = l.f.Close()
+		l.f = nil
+	}
+	l.mx.Unlock()
+
+	l.wg.Wait()
+	return err
+}
+
+func (l *LogFile) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close() //nolint:errcheck
+		return err
+	}
+	l.f, l.size, l.started = f, info.Size(), time.Now()
+	return nil
+}
+
+// rotate renames the current file with the time of rotation and opens a new file. Rotated files are compressed and
+// deleted (as configured) in the background.
+func (l *LogFile) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	backup := l.backupName(time.Now())
+	if err := os.Rename(l.path, backup); err != nil {
+		return err
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		if l.conf.Compress {
+			if err := compressFile(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to compress rotated log file %s: %v\n", backup, err)
+			}
+		}
+		if err := l.deleteBackups(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to delete rotated log files of %s: %v\n", l.path, err)
+		}
+	}()
+	return nil
+}
+
+func (l *LogFile) backupName(t time.Time) string {
+	ext := filepath.Ext(l.path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(l.path, ext), t.Format(backupTimeFormat), ext)
+}
+
+// backups returns the paths of rotated files (compressed or not), from oldest to newest.
+func (l *LogFile) backups() ([]string, error) {
+	ext := filepath.Ext(l.path)
+	prefix := strings.TrimSuffix(filepath.Base(l.path), ext) + "-"
+
+	f, err := os.Open(filepath.Dir(l.path))
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	_ = f.Close() //nolint:errcheck
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ext)
+		if _, err := time.Parse(backupTimeFormat, ts); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(l.path), name))
+	}
+	// The time format sorts lexically.
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// deleteBackups deletes the oldest rotated files which exceed MaxBackups.
+func (l *LogFile) deleteBackups() error {
+	if l.conf.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := l.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > l.conf.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// compressFile compresses the file of the given path to '<path>.gz', and removes the original.
+func compressFile(path string) (err error) {
+	src, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }() //nolint:errcheck
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = dst.Close()             //nolint:errcheck
+			_ = os.Remove(path + ".gz") //nolint:errcheck
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
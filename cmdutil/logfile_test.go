@@ -0,0 +1,73 @@
+package cmdutil
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	t.Run("size", func(t *testing.T) {
+		path := filepath.Join(dir, "size", "server.log")
+		l, err := OpenLogFile(path, LogFileConfig{MaxSize: 10, MaxBackups: 2})
+		require.NoError(t, err)
+
+		for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+			_, err := l.Write([]byte(line))
+			require.NoError(t, err)
+			time.Sleep(time.Millisecond * 2) // rotated files are named by the millisecond
+		}
+		require.NoError(t, l.Close())
+
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "line 4\n", string(b))
+
+		backups, err := l.backups()
+		require.NoError(t, err)
+		require.Len(t, backups, 2)
+		b, err = ioutil.ReadFile(backups[0])
+		require.NoError(t, err)
+		require.Equal(t, "line 2\n", string(b))
+
+		_, err = l.Write([]byte("closed\n"))
+		require.Equal(t, ErrLogFileClosed, err)
+	})
+
+	t.Run("age_and_compress", func(t *testing.T) {
+		path := filepath.Join(dir, "age", "server.log")
+		l, err := OpenLogFile(path, LogFileConfig{MaxAge: time.Millisecond * 50, Compress: true})
+		require.NoError(t, err)
+
+		_, err = l.Write([]byte("old\n"))
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond * 60)
+		_, err = l.Write([]byte("new\n"))
+		require.NoError(t, err)
+		require.NoError(t, l.Close())
+
+		backups, err := l.backups()
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+		require.True(t, strings.HasSuffix(backups[0], ".log.gz"), backups[0])
+
+		f, err := os.Open(backups[0])
+		require.NoError(t, err)
+		defer func() { require.NoError(t, f.Close()) }()
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(gz)
+		require.NoError(t, err)
+		require.Equal(t, "old\n", string(b))
+	})
+}
@@ -0,0 +1,79 @@
+package cmdutil
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// States which can be sent to the service manager via SdNotify.
+const (
+	SdNotifyReady    = "READY=1"
+	SdNotifyStopping = "STOPPING=1"
+	SdNotifyWatchdog = "WATCHDOG=1"
+)
+
+// SdNotify sends the given state to the service manager (such as systemd with 'Type=notify').
+// It returns false if the process is not ran by a service manager that expects notifications (NOTIFY_SOCKET is unset).
+func SdNotify(state string) (bool, error) {
+	addr := &net.UnixAddr{Name: os.Getenv("NOTIFY_SOCKET"), Net: "unixgram"}
+	if addr.Name == "" {
+		return false, nil
+	}
+	conn, err := net.DialUnix(addr.Net, nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = conn.Close() }() //nolint:errcheck
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SdWatchdogInterval returns the interval in which the service manager expects watchdog pings.
+// It returns false if the watchdog is not enabled for this process (WATCHDOG_USEC is unset or WATCHDOG_PID mismatches).
+func SdWatchdogInterval() (time.Duration, bool) {
+	if pidStr := os.Getenv("WATCHDOG_PID"); pidStr != "" {
+		if pid, err := strconv.Atoi(pidStr); err != nil || pid != os.Getpid() {
+			return 0, false
+		}
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// SdWatchdog sends watchdog pings to the service manager at half the expected interval until the context is done.
+// It returns immediately if the watchdog is not enabled.
+func SdWatchdog(ctx context.Context, log logrus.FieldLogger) {
+	if log == nil {
+		log = logrus.New()
+	}
+
+	interval, ok := SdWatchdogInterval()
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := SdNotify(SdNotifyWatchdog); err != nil {
+				log.WithError(err).Warn("Failed to send watchdog ping to service manager.")
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// +build !windows
+
+package cmdutil
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSdNotify(t *testing.T) {
+	t.Run("no_notify_socket", func(t *testing.T) {
+		require.NoError(t, os.Unsetenv("NOTIFY_SOCKET"))
+		ok, err := SdNotify(SdNotifyReady)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("notify_socket", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "sd_notify")
+		require.NoError(t, err)
+		defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+		addr := &net.UnixAddr{Name: filepath.Join(dir, "notify.sock"), Net: "unixgram"}
+		conn, err := net.ListenUnixgram(addr.Net, addr)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, conn.Close()) }()
+
+		require.NoError(t, os.Setenv("NOTIFY_SOCKET", addr.Name))
+		defer func() { require.NoError(t, os.Unsetenv("NOTIFY_SOCKET")) }()
+
+		ok, err := SdNotify(SdNotifyReady)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		buf := make([]byte, 64)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, SdNotifyReady, string(buf[:n]))
+	})
+}
+
+func TestSdWatchdogInterval(t *testing.T) {
+	defer func() {
+		require.NoError(t, os.Unsetenv("WATCHDOG_USEC"))
+		require.NoError(t, os.Unsetenv("WATCHDOG_PID"))
+	}()
+
+	require.NoError(t, os.Unsetenv("WATCHDOG_USEC"))
+	_, ok := SdWatchdogInterval()
+	require.False(t, ok)
+
+	require.NoError(t, os.Setenv("WATCHDOG_USEC", "2000000"))
+	interval, ok := SdWatchdogInterval()
+	require.True(t, ok)
+	require.Equal(t, time.Second*2, interval)
+
+	require.NoError(t, os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1)))
+	_, ok = SdWatchdogInterval()
+	require.False(t, ok)
+}
@@ -0,0 +1,157 @@
+package cmdutil
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/ssh/terminal"
+
+	dmsgcipher "github.com/SkycoinProject/dmsg/cipher"
+)
+
+// KDFArgon2id is the key derivation function of encrypted secret keys.
+const KDFArgon2id = "argon2id"
+
+// Default argon2id parameters of encrypted secret keys (as recommended by golang.org/x/crypto/argon2).
+const (
+	DefaultKDFTime    = 1
+	DefaultKDFMemory  = 64 * 1024 // KiB
+	DefaultKDFThreads = 4
+)
+
+// ErrWrongPassphrase is returned when an encrypted secret key fails to be decrypted with the given passphrase.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted secret key")
+
+// EncryptedSecKey is a secret key which is encrypted at rest with AES-256-GCM, under a key which is derived from a
+// passphrase with argon2id. Binary values are hex-encoded.
+type EncryptedSecKey struct {
+	KDF        string `json:"kdf"`
+	Time       uint32 `json:"time"`
+	Memory     uint32 `json:"memory"` // KiB
+	Threads    uint8  `json:"threads"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// EncryptSecKey encrypts the secret key with the passphrase, using the default argon2id parameters.
+func EncryptSecKey(sk dmsgcipher.SecKey, passphrase []byte) (*EncryptedSecKey, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	e := &EncryptedSecKey{
+		KDF:     KDFArgon2id,
+		Time:    DefaultKDFTime,
+		Memory:  DefaultKDFMemory,
+		Threads: DefaultKDFThreads,
+		Salt:    hex.EncodeToString(salt),
+	}
+	aead, err := e.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	plain, err := sk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	e.Nonce = hex.EncodeToString(nonce)
+	e.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, plain, nil))
+	return e, nil
+}
+
+// Decrypt decrypts the secret key with the passphrase. ErrWrongPassphrase is returned if authentication fails.
+func (e *EncryptedSecKey) Decrypt(passphrase []byte) (dmsgcipher.SecKey, error) {
+	var sk dmsgcipher.SecKey
+	aead, err := e.aead(passphrase)
+	if err != nil {
+		return sk, err
+	}
+	nonce, err := hex.DecodeString(e.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return sk, errors.New("encrypted secret key has invalid nonce")
+	}
+	ciphertext, err := hex.DecodeString(e.Ciphertext)
+	if err != nil {
+		return sk, errors.New("encrypted secret key has invalid ciphertext")
+	}
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return sk, ErrWrongPassphrase
+	}
+	err = sk.UnmarshalBinary(plain)
+	return sk, err
+}
+
+// aead derives the encryption key from the passphrase.
+func (e *EncryptedSecKey) aead(passphrase []byte) (cipher.AEAD, error) {
+	if e.KDF != KDFArgon2id {
+		return nil, fmt.Errorf("encrypted secret key has unsupported kdf '%s'", e.KDF)
+	}
+	if e.Time == 0 || e.Memory == 0 || e.Threads == 0 {
+		return nil, errors.New("encrypted secret key has invalid kdf parameters")
+	}
+	salt, err := hex.DecodeString(e.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, errors.New("encrypted secret key has invalid salt")
+	}
+	block, err := aes.NewCipher(argon2.IDKey(passphrase, salt, e.Time, e.Memory, e.Threads, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ReadPassphrase obtains a passphrase from the environment variable of the given key (if set), from the first line of
+// stdin (if 'fromStdin' is set), or else by prompting on the terminal. If 'confirm' is set, prompted passphrases are
+// entered twice.
+func ReadPassphrase(envKey string, fromStdin, confirm bool) ([]byte, error) {
+	if v, ok := os.LookupEnv(envKey); ok {
+		return []byte(v), nil
+	}
+	if fromStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, fmt.Errorf("failed to read passphrase from stdin: %v", err)
+		}
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("no passphrase: set %s, or provide it via stdin", envKey)
+	}
+	prompt := func(msg string) ([]byte, error) {
+		fmt.Fprint(os.Stderr, msg)    //nolint:errcheck
+		defer fmt.Fprintln(os.Stderr) //nolint:errcheck
+		return terminal.ReadPassword(fd)
+	}
+	passphrase, err := prompt("Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := prompt("Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare(again, passphrase) != 1 {
+			return nil, errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,24 @@
+package cmdutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestEncryptSecKey(t *testing.T) {
+	_, sk := cipher.GenerateKeyPair()
+
+	e, err := EncryptSecKey(sk, []byte("correct horse"))
+	require.NoError(t, err)
+	require.NotContains(t, e.Ciphertext, sk.Hex())
+
+	got, err := e.Decrypt([]byte("correct horse"))
+	require.NoError(t, err)
+	require.Equal(t, sk, got)
+
+	_, err = e.Decrypt([]byte("wrong horse"))
+	require.Equal(t, ErrWrongPassphrase, err)
+}
@@ -0,0 +1,243 @@
+package cmdutil
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogSDID is the SD-ID of the structured data of syslog messages. 32473 is the private enterprise number reserved
+// for documentation (RFC 5612), as dmsg has none of its own.
+const syslogSDID = "dmsg@32473"
+
+// syslogFacility is the facility of syslog messages (daemon).
+const syslogFacility = 3
+
+// SyslogConfig configures a SyslogHook.
+type SyslogConfig struct {
+	// Addr is the address of the syslog server, as '<network>://<host>:<port>' where the network is 'udp', 'tcp' or
+	// 'tls'. If the network is omitted, 'udp' is used.
+	Addr string
+
+	// Tag is the APP-NAME of messages.
+	Tag string
+
+	// TLS is the TLS config of the 'tls' network. If nil, the system's root CAs are used.
+	TLS *tls.Config
+
+	// Params are structured data parameters which are added to every message (such as the public key of the server).
+	Params map[string]string
+
+	// Fields are the names of log fields which are added to messages as structured data parameters (if they are set),
+	// rather than to the message text.
+	Fields []string
+}
+
+// SyslogHook is a logrus hook which sends log entries to a syslog server as RFC 5424 messages, over UDP, TCP or TLS.
+// Messages sent over TCP and TLS are framed by octet counting (RFC 5425). Connections which fail are re-established
+// once per message.
+type SyslogHook struct {
+	network string
+	addr    string
+	tlsConf *tls.Config
+	header  string // HOSTNAME, APP-NAME and PROCID
+	params  string // encoded static structured data parameters
+	fields  map[string]bool
+
+	conn net.Conn
+	mx   sync.Mutex
+}
+
+// NewSyslogHook connects to the syslog server of the config.
+func NewSyslogHook(conf SyslogConfig) (*SyslogHook, error) {
+	network, addr := "udp", conf.Addr
+	if u, err := url.Parse(conf.Addr); err == nil && u.Host != "" {
+		network, addr = u.Scheme, u.Host
+	}
+	switch network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network '%s'", network)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	h := &SyslogHook{
+		network: network,
+		addr:    addr,
+		tlsConf: conf.TLS,
+		header:  fmt.Sprintf("%s %s %d", hostname, syslogName(conf.Tag), os.Getpid()),
+		fields:  make(map[string]bool, len(conf.Fields)),
+	}
+	if h.network == "tls" && h.tlsConf == nil {
+		h.tlsConf = new(tls.Config)
+	}
+	keys := make([]string, 0, len(conf.Params))
+	for k := range conf.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params bytes.Buffer
+	for _, k := range keys {
+		writeSyslogParam(&params, k, conf.Params[k])
+	}
+	h.params = params.String()
+	for _, f := range conf.Fields {
+		h.fields[f] = true
+	}
+
+	if err := h.connect(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Levels implements logrus.Hook
+func (h *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *SyslogHook) Fire(entry *logrus.Entry) error {
+	msg := h.format(entry)
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.conn != nil {
+		if err := h.write(msg); err == nil {
+			return nil
+		}
+		_ = h.conn.Close() //nolint:errcheck
+		h.conn = nil
+	}
+	if err := h.connect(); err != nil {
+		return err
+	}
+	return h.write(msg)
+}
+
+// Close closes the connection to the syslog server.
+func (h *SyslogHook) Close() error {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
+
+func (h *SyslogHook) connect() error {
+	var (
+		conn net.Conn
+		err  error
+	)
+	dialer := &net.Dialer{Timeout: time.Second * 10}
+	if h.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", h.addr, h.tlsConf)
+	} else {
+		conn, err = dialer.Dial(h.network, h.addr)
+	}
+	if err != nil {
+		return err
+	}
+	h.conn = conn
+	return nil
+}
+
+func (h *SyslogHook) write(msg []byte) error {
+	if err := h.conn.SetWriteDeadline(time.Now().Add(time.Second * 10)); err != nil {
+		return err
+	}
+	if h.network != "udp" {
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	_, err := h.conn.Write(msg)
+	return err
+}
+
+// format formats the entry as an RFC 5424 message:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (h *SyslogHook) format(entry *logrus.Entry) []byte {
+	var sd, text bytes.Buffer
+	sd.WriteString(h.params)
+	text.WriteString(entry.Message)
+
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := fmt.Sprint(entry.Data[k])
+		if h.fields[k] {
+			writeSyslogParam(&sd, k, v)
+		} else {
+			fmt.Fprintf(&text, " %s=%q", k, v)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s - ",
+		syslogFacility*8+syslogSeverity(entry.Level), entry.Time.Format(time.RFC3339Nano), h.header)
+	if sd.Len() == 0 {
+		b.WriteString("-")
+	} else {
+		fmt.Fprintf(&b, "[%s%s]", syslogSDID, sd.String())
+	}
+	b.WriteString(" ")
+	b.Write(text.Bytes())
+	return b.Bytes()
+}
+
+// syslogSeverity returns the syslog severity of the logrus level.
+func syslogSeverity(lvl logrus.Level) int {
+	switch lvl {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return 2 // critical
+	case logrus.ErrorLevel:
+		return 3 // error
+	case logrus.WarnLevel:
+		return 4 // warning
+	case logrus.InfoLevel:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// syslogName returns the name with characters which are not allowed in header fields (and SD names) replaced.
+func syslogName(name string) string {
+	if name == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// writeSyslogParam writes a structured data parameter, with the value escaped as per RFC 5424.
+func writeSyslogParam(b *bytes.Buffer, name, value string) {
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+	fmt.Fprintf(b, ` %s="%s"`, syslogName(name), value)
+}
@@ -0,0 +1,85 @@
+package cmdutil
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogHook(t *testing.T) {
+	conf := SyslogConfig{
+		Tag:    "dmsg-server",
+		Params: map[string]string{"pk": "02abc"},
+		Fields: []string{"session"},
+	}
+	entry := &logrus.Entry{
+		Time:    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Level:   logrus.WarnLevel,
+		Message: "Rejecting stream.",
+		Data:    logrus.Fields{"session": `03d"e]f`, "error": "busy"},
+	}
+
+	t.Run("tcp", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() { require.NoError(t, lis.Close()) }()
+
+		conf := conf
+		conf.Addr = "tcp://" + lis.Addr().String()
+		h, err := NewSyslogHook(conf)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, h.Close()) }()
+
+		conn, err := lis.Accept()
+		require.NoError(t, err)
+		defer func() { require.NoError(t, conn.Close()) }()
+
+		require.NoError(t, h.Fire(entry))
+
+		// Messages are framed by octet counting.
+		r := bufio.NewReader(conn)
+		lenStr, err := r.ReadString(' ')
+		require.NoError(t, err)
+		n, err := strconv.Atoi(strings.TrimSpace(lenStr))
+		require.NoError(t, err)
+		msg := make([]byte, n)
+		_, err = r.Read(msg)
+		require.NoError(t, err)
+
+		require.True(t, strings.HasPrefix(string(msg), "<28>1 2020-01-02T03:04:05Z "), string(msg))
+		require.Contains(t, string(msg), ` dmsg-server `)
+		require.True(t, strings.HasSuffix(string(msg),
+			` - [dmsg@32473 pk="02abc" session="03d\"e\]f"] Rejecting stream. error="busy"`), string(msg))
+	})
+
+	t.Run("udp", func(t *testing.T) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() { require.NoError(t, pc.Close()) }()
+
+		conf := conf
+		conf.Addr = pc.LocalAddr().String()
+		h, err := NewSyslogHook(conf)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, h.Close()) }()
+
+		require.NoError(t, h.Fire(entry))
+		buf := make([]byte, 1024)
+		n, _, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(string(buf[:n]), "<28>1 "), string(buf[:n]))
+	})
+
+	t.Run("unsupported_network", func(t *testing.T) {
+		conf := conf
+		conf.Addr = "unix:///dev/log"
+		_, err := NewSyslogHook(conf)
+		require.Error(t, err)
+	})
+}
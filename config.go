@@ -0,0 +1,138 @@
+package dmsg
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// Validate returns a ConfigError for the first field with a value which would fail at runtime.
+// Zero-value timeouts are invalid, but NewClient fills them with their defaults before validating.
+func (c *Config) Validate() error {
+	err := firstErr(
+		nonNegative("MinSessions", c.MinSessions),
+		positiveDuration("SessionHandshakeTimeout", c.SessionHandshakeTimeout),
+		positiveDuration("StreamHandshakeTimeout", c.StreamHandshakeTimeout),
+		nonNegativeDuration("EntryUpdateInterval", c.EntryUpdateInterval),
+		nonNegative("PoWDifficulty", c.PoWDifficulty),
+		nonNegative("ServerBusyRetries", c.ServerBusyRetries),
+		nonNegative("MaxConcurrentDials", c.MaxConcurrentDials),
+		nonNegative("FDReserve", c.FDReserve),
+		nonNegativeDuration("StreamKeepAlive", c.StreamKeepAlive),
+		nonNegativeDuration("StreamCoalesceDelay", c.StreamCoalesceDelay),
+		nonNegativeDuration("SessionKeepAlive", c.SessionKeepAlive),
+		nonNegative("MaxSessionStreams", c.MaxSessionStreams),
+		nonNegativeDuration("SessionRekey", c.SessionRekey.Interval),
+	)
+	if err != nil {
+		return err
+	}
+	if uint64(c.MaxSessionStreams) > math.MaxUint32 {
+		return ConfigError{Field: "MaxSessionStreams", Reason: fmt.Sprintf("exceeds %d", uint32(math.MaxUint32))}
+	}
+	if c.StreamWindowSize > 0 && c.StreamWindowSize < MinStreamWindowSize {
+		return ConfigError{Field: "StreamWindowSize", Reason: fmt.Sprintf("is below %d", MinStreamWindowSize)}
+	}
+	if !c.TrustedOperator.Null() && c.ServerList != nil && c.MinSessions > len(c.ServerList.Servers) {
+		return ConfigError{Field: "MinSessions", Reason: fmt.Sprintf(
+			"has value %d which exceeds the %d servers of 'ServerList'", c.MinSessions, len(c.ServerList.Servers))}
+	}
+	return nil
+}
+
+// Validate returns a ConfigError for the first field with a value which would fail at runtime.
+func (c *ServerConfig) Validate() error {
+	err := firstErr(
+		nonNegativeDuration("EntryUpdateInterval", c.EntryUpdateInterval),
+		nonNegativeDuration("PublicIPCheckInterval", c.PublicIPCheckInterval),
+		nonNegative("PoWDifficulty", c.PoWDifficulty),
+		nonNegative("StreamRateLimit", c.StreamRateLimit),
+		nonNegative("MaxSessionStreams", c.MaxSessionStreams),
+		nonNegative("HandshakeFloodThreshold", c.HandshakeFloodThreshold),
+		nonNegative("MaxRelayHops", c.MaxRelayHops),
+		nonNegative("MaxStreams", c.MaxStreams),
+		nonNegative("AcceptRateLimit", c.AcceptRateLimit),
+		nonNegative("MaxPendingHandshakes", c.MaxPendingHandshakes),
+		nonNegativeDuration("SessionHandshakeTimeout", c.SessionHandshakeTimeout),
+		nonNegative("FDReserve", c.FDReserve),
+		nonNegativeDuration("StreamStallThreshold", c.StreamStallThreshold),
+		nonNegativeDuration("SessionIdleTimeout", c.SessionIdleTimeout),
+		nonNegativeDuration("StreamIdleTimeout", c.StreamIdleTimeout),
+		nonNegativeDuration("SessionRekey", c.SessionRekey.Interval),
+		nonNegative("LogSampleRate", c.LogSampleRate),
+		nonNegativeDuration("BandwidthReportInterval", c.BandwidthReportInterval),
+	)
+	if err != nil {
+		return err
+	}
+	if uint64(c.MaxSessionStreams) > math.MaxUint32 {
+		return ConfigError{Field: "MaxSessionStreams", Reason: fmt.Sprintf("exceeds %d", uint32(math.MaxUint32))}
+	}
+	if c.MaxStreams > 0 && c.MaxSessionStreams > c.MaxStreams {
+		return ConfigError{Field: "MaxSessionStreams", Reason: fmt.Sprintf(
+			"has value %d which exceeds 'MaxStreams' (%d)", c.MaxSessionStreams, c.MaxStreams)}
+	}
+	if c.Cluster != nil && (c.Cluster.Router == nil || c.Cluster.Address == "") {
+		return ConfigError{Field: "Cluster", Reason: "should have both 'Router' and 'Address' set"}
+	}
+	if c.Standby != nil && c.Standby.ActiveAddr == "" {
+		return ConfigError{Field: "Standby", Reason: "should have 'ActiveAddr' set"}
+	}
+	return nil
+}
+
+// ConfigError is returned by the Validate methods of Config and ServerConfig for fields with invalid values.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+// Error implements error
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("invalid dmsg config: field '%s' %s", e.Field, e.Reason)
+}
+
+// ErrNilDiscovery is returned by the Serve methods of entities which are created without a dmsg discovery client.
+var ErrNilDiscovery = errors.New("dmsg discovery client is nil")
+
+// validateEntity returns the error of validating the config of an entity, or ErrNilDiscovery if 'dc' is nil.
+func validateEntity(dc disc.APIClient, confErr error) error {
+	if dc == nil {
+		return ErrNilDiscovery
+	}
+	return confErr
+}
+
+// firstErr returns the first non-nil error.
+func firstErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nonNegative(field string, v int) error {
+	if v < 0 {
+		return ConfigError{Field: field, Reason: fmt.Sprintf("has negative value %d", v)}
+	}
+	return nil
+}
+
+func nonNegativeDuration(field string, d time.Duration) error {
+	if d < 0 {
+		return ConfigError{Field: field, Reason: fmt.Sprintf("has negative duration %s", d)}
+	}
+	return nil
+}
+
+func positiveDuration(field string, d time.Duration) error {
+	if d <= 0 {
+		return ConfigError{Field: field, Reason: fmt.Sprintf("has non-positive duration %s", d)}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package dmsg
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	require.NoError(t, DefaultConfig().Validate())
+
+	opPK, _ := cipher.GenerateKeyPair()
+	cases := map[string]struct {
+		modify func(c *Config)
+		field  string
+	}{
+		"negative_min_sessions": {func(c *Config) { c.MinSessions = -1 }, "MinSessions"},
+		"zero_timeout":          {func(c *Config) { c.SessionHandshakeTimeout = 0 }, "SessionHandshakeTimeout"},
+		"negative_keepalive":    {func(c *Config) { c.StreamKeepAlive = -time.Second }, "StreamKeepAlive"},
+		"min_sessions_above_servers": {func(c *Config) {
+			c.MinSessions = 2
+			c.TrustedOperator = opPK
+			c.ServerList = &disc.ServerList{Servers: make([]*disc.Entry, 1)}
+		}, "MinSessions"},
+	}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			conf := DefaultConfig()
+			c.modify(conf)
+			err := conf.Validate()
+			require.Error(t, err)
+			require.Equal(t, c.field, err.(ConfigError).Field)
+		})
+	}
+}
+
+func TestNewClient_config(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	// Defaults are filled in on a copy of the config, so that the config of the caller is not modified.
+	conf := &Config{MinSessions: 1}
+	c := NewClient(pk, sk, disc.NewMock(), conf)
+	require.Equal(t, &Config{MinSessions: 1}, conf)
+	require.Equal(t, DefaultSessionHandshakeTimeout, c.conf.SessionHandshakeTimeout)
+}
+
+func TestServerConfig_Validate(t *testing.T) {
+	require.NoError(t, DefaultServerConfig().Validate())
+
+	err := (&ServerConfig{MaxStreams: 10, MaxSessionStreams: 20}).Validate()
+	require.Equal(t, "MaxSessionStreams", err.(ConfigError).Field)
+
+	err = (&ServerConfig{Standby: &StandbyConfig{}}).Validate()
+	require.Equal(t, "Standby", err.(ConfigError).Field)
+
+	// An invalid config is reported when serving.
+	pk, sk := cipher.GenerateKeyPair()
+	srv := NewServerWithConfig(pk, sk, disc.NewMock(), &ServerConfig{MaxRelayHops: -1})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+	require.Equal(t, "MaxRelayHops", srv.Serve(lis, "").(ConfigError).Field)
+
+	require.Equal(t, ErrNilDiscovery, NewServer(pk, sk, nil).Serve(lis, ""))
+}
+
+func TestProfiles(t *testing.T) {
+	for name, conf := range map[string]*Config{
+		"low_latency":   LowLatencyProfile(),
+		"low_bandwidth": LowBandwidthProfile(),
+	} {
+		require.NoError(t, conf.Validate(), name)
+	}
+
+	conf := DefaultConfig()
+	conf.StreamWindowSize = MinStreamWindowSize - 1
+	require.Equal(t, "StreamWindowSize", conf.Validate().(ConfigError).Field)
+}
@@ -1,9 +1,25 @@
 package dmsg
 
+import "time"
+
 // Constants.
 const (
 	// TODO(evanlinjin): Reference the production address on release
 	DefaultDiscAddr = "http://dmsg.discovery.skywire.cc"
 
 	DefaultMinSessions = 1
+
+	DefaultSessionHandshakeTimeout = time.Second * 30
+
+	DefaultPublicIPCheckInterval = time.Minute * 10
+
+	DefaultStreamLinger = 0
+
+	DefaultStreamCoalesceDelay = time.Millisecond * 5
+
+	DefaultStandbyCheckInterval = time.Second
+
+	DefaultStandbyFailureThreshold = 3
+
+	DefaultLogSampleRate = 10
 )
@@ -0,0 +1,98 @@
+package dmsg
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const modulePath = "github.com/SkycoinProject/dmsg"
+
+// dependencyBoundaries are the packages which are consumed on their own by embedders (by directory), and the external
+// packages which they may import (by path prefix). Packages of this module which they import are held to the same
+// boundary, so that importing cipher or disc never pulls in dmsg's heavier dependencies (cobra, prometheus, syslog
+// hooks, etc.).
+var dependencyBoundaries = map[string][]string{
+	"cipher": {
+		"github.com/SkycoinProject/skycoin/src/cipher",
+	},
+	"disc": {
+		"github.com/SkycoinProject/skycoin/src/cipher",
+		"github.com/SkycoinProject/skycoin/src/util/logging",
+	},
+	"dmsglan": {
+		"github.com/SkycoinProject/skycoin/src/cipher",
+		"github.com/SkycoinProject/skycoin/src/util/logging",
+		"golang.org/x/net/dns/dnsmessage",
+		"golang.org/x/net/ipv4",
+	},
+}
+
+func TestDependencyBoundaries(t *testing.T) {
+	for dir, allowed := range dependencyBoundaries {
+		imports, err := externalImports(dir)
+		require.NoError(t, err)
+		for path, importer := range imports {
+			if !hasAnyPrefix(path, allowed) {
+				t.Errorf("%s imports %s, which is outside of the dependency boundary of %s", importer, path, dir)
+			}
+		}
+	}
+}
+
+// externalImports returns the imports (outside of this module and the standard library) of the non-test files of the
+// package in the given directory and of the packages of this module which it imports, mapped to an importing package.
+func externalImports(dir string) (map[string]string, error) {
+	imports := make(map[string]string)
+	seen := make(map[string]bool)
+	notTest := func(info os.FileInfo) bool { return !strings.HasSuffix(info.Name(), "_test.go") }
+
+	for queue := []string{dir}; len(queue) > 0; queue = queue[1:] {
+		dir := queue[0]
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		pkgs, err := parser.ParseDir(token.NewFileSet(), dir, notTest, parser.ImportsOnly)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range pkgs {
+			for _, f := range pkg.Files {
+				for _, imp := range f.Imports {
+					path, err := strconv.Unquote(imp.Path.Value)
+					if err != nil {
+						return nil, err
+					}
+					switch {
+					case path == modulePath:
+						queue = append(queue, ".")
+					case strings.HasPrefix(path, modulePath+"/"):
+						queue = append(queue, filepath.FromSlash(strings.TrimPrefix(path, modulePath+"/")))
+					case !strings.Contains(strings.Split(path, "/")[0], "."):
+						// standard library
+					default:
+						imports[path] = filepath.ToSlash(filepath.Join(modulePath, dir))
+					}
+				}
+			}
+		}
+	}
+	return imports, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if s == p || strings.HasPrefix(s, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package dmsg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/dmsgerr"
+)
+
+// DialPhase is the phase in which a dial failed.
+type DialPhase string
+
+// Phases of a dial.
+const (
+	DialPhaseQueued           DialPhase = "queued"            // waiting for a dial slot (see Config.MaxConcurrentDials)
+	DialPhaseDiscovery        DialPhase = "discovery_lookup"  // obtaining the entry of the remote client
+	DialPhaseEntry            DialPhase = "entry_invalid"     // the entry of the remote client is invalid
+	DialPhaseServerConnect    DialPhase = "server_connect"    // connecting to a delegated server
+	DialPhaseSessionHandshake DialPhase = "session_handshake" // session handshake with a delegated server
+	DialPhaseServerRejected   DialPhase = "server_rejected"   // the server rejected the stream (such as ErrServerBusy)
+	DialPhaseRemoteRefused    DialPhase = "remote_refused"    // the remote client refused the stream
+	DialPhaseRemoteTimeout    DialPhase = "remote_timeout"    // the remote client did not respond in time
+)
+
+// DialError reports the phase in which a dial failed, and the delegated server involved (if any).
+// It is returned by (*Client).Dial, (*Client).DialStream and (*Client).EnsureAndObtainSession.
+type DialError struct {
+	Phase  DialPhase
+	Remote cipher.PubKey // remote client (null for session dials)
+	Server cipher.PubKey // delegated server (null if the dial failed before a server was involved)
+	Err    error         // underlying error
+}
+
+// Error implements error.
+func (e *DialError) Error() string {
+	msg := fmt.Sprintf("dmsg dial failed at %s", e.Phase)
+	if !e.Remote.Null() {
+		msg += fmt.Sprintf(" to %s", e.Remote)
+	}
+	if !e.Server.Null() {
+		msg += fmt.Sprintf(" via server %s", e.Server)
+	}
+	return fmt.Sprintf("%s: %v", msg, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DialError) Unwrap() error { return e.Err }
+
+// Code returns the code of the underlying dmsg error (or 0 if it is not a dmsg error).
+func (e *DialError) Code() uint16 {
+	code, _ := dmsgerr.CodeOf(e.Err)
+	return uint16(code)
+}
+
+// Timeout implements net.Error
+func (e *DialError) Timeout() bool {
+	netErr, ok := e.Err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// Temporary implements net.Error
+func (e *DialError) Temporary() bool {
+	netErr, ok := e.Err.(net.Error)
+	return ok && netErr.Temporary()
+}
+
+// Fields returns the log fields of the error.
+func (e *DialError) Fields() logrus.Fields {
+	fields := logrus.Fields{"dial_phase": e.Phase, "error": e.Err}
+	if !e.Remote.Null() {
+		fields["remote_pk"] = e.Remote
+	}
+	if !e.Server.Null() {
+		fields["srv_pk"] = e.Server
+	}
+	if code := e.Code(); code != 0 {
+		fields["error_code"] = code
+	}
+	return fields
+}
+
+// dialErrCause returns the underlying error if 'err' is a *DialError.
+func dialErrCause(err error) error {
+	if dErr, ok := err.(*DialError); ok {
+		return dErr.Err
+	}
+	return err
+}
+
+// isAnyErr returns true if 'err' matches any of the targets (see errors.Is).
+func isAnyErr(err error, targets ...error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamDialPhase returns the phase in which the stream handshake with the remote client failed.
+func streamDialPhase(err error) DialPhase {
+	if code, ok := dmsgerr.CodeOf(err); ok && isServerRejectionCode(code) {
+		return DialPhaseServerRejected
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return DialPhaseRemoteTimeout
+	}
+	return DialPhaseRemoteRefused
+}
@@ -0,0 +1,149 @@
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestDialError(t *testing.T) {
+	rPK, _ := cipher.GenerateKeyPair()
+	srvPK, _ := cipher.GenerateKeyPair()
+
+	err := streamDialError(rPK, srvPK, ErrServerBusy)
+	dErr, ok := err.(*DialError)
+	require.True(t, ok)
+	require.Equal(t, DialPhaseServerRejected, dErr.Phase)
+	require.Equal(t, uint16(353), dErr.Code())
+	require.True(t, dErr.Temporary())
+	require.Equal(t, ErrServerBusy, dialErrCause(err))
+	require.Contains(t, err.Error(), "via server "+srvPK.String())
+
+	require.Equal(t, DialPhaseRemoteRefused, streamDialPhase(ErrPortNotListening))
+	require.Equal(t, DialPhaseRemoteTimeout, streamDialPhase(ErrPortNotListening.Wrap(context.DeadlineExceeded)))
+	require.Nil(t, streamDialError(rPK, srvPK, nil))
+}
+
+func TestClient_DialStream_DialError(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	rPK, _ := cipher.GenerateKeyPair()
+
+	c := NewClient(pk, sk, disc.NewMock(), nil)
+	_, err := c.DialStream(context.TODO(), Addr{PK: rPK, Port: 1})
+
+	dErr, ok := err.(*DialError)
+	require.True(t, ok)
+	require.Equal(t, DialPhaseDiscovery, dErr.Phase)
+	require.Equal(t, rPK, dErr.Remote)
+	require.True(t, errors.Is(err, ErrDiscEntryNotFound))
+}
+
+func TestClient_DialStream_MaxConcurrentDials(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	rPK, _ := cipher.GenerateKeyPair()
+
+	conf := DefaultConfig()
+	conf.MaxConcurrentDials = 1
+	c := NewClient(pk, sk, disc.NewMock(), conf)
+
+	// Occupy the only dial slot, so that dials queue until their context is done.
+	require.NoError(t, c.acquireDialSlot(context.TODO(), Addr{PK: rPK}))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, err := c.DialStream(ctx, Addr{PK: rPK, Port: 1})
+	dErr, ok := err.(*DialError)
+	require.True(t, ok)
+	require.Equal(t, DialPhaseQueued, dErr.Phase)
+	require.True(t, errors.Is(err, context.Canceled))
+
+	// Once the slot is released, dials proceed.
+	c.releaseDialSlot()
+	_, err = c.DialStream(context.TODO(), Addr{PK: rPK, Port: 1})
+	require.True(t, errors.Is(err, ErrDiscEntryNotFound))
+}
+
+func TestClient_DialStream_ServerBusy(t *testing.T) {
+	dc := disc.NewMock()
+
+	// serve serves a server which is limited to a single stream.
+	serve := func() *Server {
+		pk, sk := cipher.GenerateKeyPair()
+		srv := NewServerWithConfig(pk, sk, dc, &ServerConfig{MaxStreams: 1})
+		lis, err := nettest.NewLocalListener("tcp")
+		require.NoError(t, err)
+		go func() { _ = srv.Serve(lis, "") }() //nolint:errcheck
+		<-srv.Ready()
+		return srv
+	}
+	busySrv, freeSrv := serve(), serve()
+	defer func() {
+		require.NoError(t, busySrv.Close())
+		require.NoError(t, freeSrv.Close())
+	}()
+
+	// The busy server is at capacity.
+	require.True(t, busySrv.acquireStream())
+	defer busySrv.releaseStream()
+
+	// The listening client has sessions with both servers.
+	pkA, skA := cipher.GenerateKeyPair()
+	confA := DefaultConfig()
+	confA.MinSessions = 2
+	clientA := NewClient(pkA, skA, dc, confA)
+	go clientA.Serve()
+	defer func() { require.NoError(t, clientA.Close()) }()
+	require.Eventually(t, func() bool {
+		entry, err := dc.Entry(context.TODO(), pkA)
+		return err == nil && len(entry.Client.DelegatedServers) == 2
+	}, 10*time.Second, 10*time.Millisecond)
+	lis, err := clientA.Listen(1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	// newDialer returns a client which only has a session with the busy server, so that it dials via it first.
+	newDialer := func(retries int) *Client {
+		pk, sk := cipher.GenerateKeyPair()
+		conf := DefaultConfig()
+		conf.ServerBusyRetries = retries
+		c := NewClient(pk, sk, dc, conf)
+		require.NoError(t, c.EnsureSession(context.TODO(), busySrv.LocalPK()))
+		return c
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		c := newDialer(0)
+		defer func() { require.NoError(t, c.Close()) }()
+
+		_, err := c.DialStream(context.TODO(), Addr{PK: pkA, Port: 1})
+		dErr, ok := err.(*DialError)
+		require.True(t, ok, err)
+		require.Equal(t, DialPhaseServerRejected, dErr.Phase)
+		require.Equal(t, busySrv.LocalPK(), dErr.Server)
+		require.True(t, errors.Is(err, ErrServerBusy), err)
+
+		// A busy server says nothing about the remote client, so it is not recorded as unreachable.
+		require.False(t, c.unreachable.contains(pkA))
+	})
+
+	t.Run("retried_via_other_server", func(t *testing.T) {
+		c := newDialer(1)
+		defer func() { require.NoError(t, c.Close()) }()
+
+		dStr, err := c.DialStream(context.TODO(), Addr{PK: pkA, Port: 1})
+		require.NoError(t, err)
+		require.Equal(t, freeSrv.LocalPK(), dStr.HandshakeInfo().ServerPK)
+		rStr, err := lis.AcceptStream()
+		require.NoError(t, err)
+		require.NoError(t, dStr.Close())
+		require.NoError(t, rStr.Close())
+		require.False(t, c.unreachable.contains(pkA))
+	})
+}
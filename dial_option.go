@@ -0,0 +1,86 @@
+package dmsg
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// DialOption configures how a client dials a remote client.
+type DialOption func(*dialOptions)
+
+type dialOptions struct {
+	bypassUnreachable bool
+}
+
+func makeDialOptions(opts []DialOption) dialOptions {
+	var dOpts dialOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&dOpts)
+		}
+	}
+	return dOpts
+}
+
+// BypassUnreachableCache results in the dial being attempted even if the remote client was recently unreachable.
+func BypassUnreachableCache() DialOption {
+	return func(opts *dialOptions) {
+		opts.bypassUnreachable = true
+	}
+}
+
+// unreachableCache records remote clients that recently failed to be dialed.
+type unreachableCache struct {
+	ttl   time.Duration
+	clock Clock
+	m     map[cipher.PubKey]time.Time // remote pk -> expiry
+	mx    sync.Mutex
+}
+
+func newUnreachableCache(ttl time.Duration, clock Clock) *unreachableCache {
+	return &unreachableCache{
+		ttl:   ttl,
+		clock: clock,
+		m:     make(map[cipher.PubKey]time.Time),
+	}
+}
+
+// contains returns true if the given remote client was recently recorded as unreachable.
+func (uc *unreachableCache) contains(pk cipher.PubKey) bool {
+	uc.mx.Lock()
+	defer uc.mx.Unlock()
+
+	expiry, ok := uc.m[pk]
+	if !ok {
+		return false
+	}
+	if uc.clock.Now().After(expiry) {
+		delete(uc.m, pk)
+		return false
+	}
+	return true
+}
+
+// update records the result of a dial to the given remote client.
+// Dials which are cancelled by the caller, rejected by a busy server, or which reach the remote client are not
+// recorded. Dials which time out are recorded, as the remote client did not respond in time.
+func (uc *unreachableCache) update(pk cipher.PubKey, err error) {
+	if isAnyErr(err, context.Canceled, ErrServerBusy, ErrPortNotListening, ErrReqRejected) {
+		return
+	}
+	if uc.ttl <= 0 {
+		return
+	}
+
+	uc.mx.Lock()
+	defer uc.mx.Unlock()
+
+	if err == nil {
+		delete(uc.m, pk)
+		return
+	}
+	uc.m[pk] = uc.clock.Now().Add(uc.ttl)
+}
@@ -0,0 +1,104 @@
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// stepClock is a Clock of which the time only changes when advanced. Its timers use the system clock.
+type stepClock struct {
+	systemClock
+	now time.Time
+	mx  sync.Mutex
+}
+
+func newStepClock() *stepClock {
+	return &stepClock{now: time.Unix(0, 0)}
+}
+
+func (c *stepClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+func (c *stepClock) advance(d time.Duration) {
+	c.mx.Lock()
+	c.now = c.now.Add(d)
+	c.mx.Unlock()
+}
+
+func TestUnreachableCache(t *testing.T) {
+	const ttl = time.Minute
+
+	cases := []struct {
+		name   string
+		err    error
+		cached bool
+	}{
+		{"unreachable", ErrDiscEntryNotFound, true},
+		{"timed_out", &DialError{Phase: DialPhaseRemoteTimeout, Err: context.DeadlineExceeded}, true},
+		{"canceled", &DialError{Phase: DialPhaseServerConnect, Err: context.Canceled}, false},
+		{"server_busy", ErrServerBusy, false},
+		{"port_not_listening", ErrPortNotListening, false},
+		{"reached", nil, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pk, _ := cipher.GenerateKeyPair()
+			clock := newStepClock()
+			uc := newUnreachableCache(ttl, clock)
+
+			uc.update(pk, c.err)
+			require.Equal(t, c.cached, uc.contains(pk))
+		})
+	}
+
+	t.Run("expiry", func(t *testing.T) {
+		pk, _ := cipher.GenerateKeyPair()
+		clock := newStepClock()
+		uc := newUnreachableCache(ttl, clock)
+
+		uc.update(pk, ErrDiscEntryNotFound)
+		clock.advance(ttl)
+		require.True(t, uc.contains(pk))
+		clock.advance(time.Nanosecond)
+		require.False(t, uc.contains(pk))
+
+		// Reaching the remote client clears the record.
+		uc.update(pk, ErrDiscEntryNotFound)
+		uc.update(pk, nil)
+		require.False(t, uc.contains(pk))
+	})
+}
+
+func TestClient_DialStream_UnreachableCache(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	rPK, _ := cipher.GenerateKeyPair()
+
+	clock := newStepClock()
+	conf := DefaultConfig()
+	conf.Clock = clock
+	c := NewClient(pk, sk, disc.NewMock(), conf)
+
+	_, err := c.DialStream(context.TODO(), Addr{PK: rPK, Port: 1})
+	require.True(t, errors.Is(err, ErrDiscEntryNotFound), err)
+
+	// The remote client is not dialed again until the record expires, unless the cache is bypassed.
+	_, err = c.DialStream(context.TODO(), Addr{PK: rPK, Port: 1})
+	require.Equal(t, ErrPeerRecentlyUnreachable, err)
+	_, err = c.DialStream(context.TODO(), Addr{PK: rPK, Port: 1}, BypassUnreachableCache())
+	require.True(t, errors.Is(err, ErrDiscEntryNotFound), err)
+
+	clock.advance(UnreachableCacheTTL + time.Nanosecond)
+	_, err = c.DialStream(context.TODO(), Addr{PK: rPK, Port: 1})
+	require.True(t, errors.Is(err, ErrDiscEntryNotFound), err)
+}
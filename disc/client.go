@@ -23,7 +23,15 @@ type APIClient interface {
 	Entry(context.Context, cipher.PubKey) (*Entry, error)
 	SetEntry(context.Context, *Entry) error
 	UpdateEntry(context.Context, cipher.SecKey, *Entry) error
-	AvailableServers(context.Context) ([]*Entry, error)
+	AvailableServers(context.Context, ...ServersOption) ([]*Entry, error)
+}
+
+// EntryWatcher is implemented by APIClients which are notified of entry changes by dmsg discovery (instead of having
+// to poll).
+type EntryWatcher interface {
+	// WatchEntry returns a chan which emits the entry of the given public key when it is first obtained and whenever
+	// it changes. The chan is closed when the context is done or when the watch is interrupted.
+	WatchEntry(ctx context.Context, pk cipher.PubKey) (<-chan *Entry, error)
 }
 
 // HTTPClient represents a client that communicates with a dmsg-discovery service through http, it
@@ -135,6 +143,13 @@ func (c *httpClient) UpdateEntry(ctx context.Context, sk cipher.SecKey, e *Entry
 	c.updateMux.Lock()
 	defer c.updateMux.Unlock()
 
+	return UpdateEntry(ctx, c, sk, e)
+}
+
+// UpdateEntry increments the sequence of the entry, signs it and sets it in dmsg discovery via 'dc'.
+// If the sequence is outdated, the sequence of the remote entry is used instead.
+// It implements the UpdateEntry method of APIClients, which should serialize calls.
+func UpdateEntry(ctx context.Context, dc APIClient, sk cipher.SecKey, e *Entry) error {
 	e.Sequence++
 	e.Timestamp = time.Now().UnixNano()
 
@@ -143,7 +158,7 @@ func (c *httpClient) UpdateEntry(ctx context.Context, sk cipher.SecKey, e *Entry
 		if err != nil {
 			return err
 		}
-		err = c.SetEntry(ctx, e)
+		err = dc.SetEntry(ctx, e)
 		if err == nil {
 			return nil
 		}
@@ -151,7 +166,7 @@ func (c *httpClient) UpdateEntry(ctx context.Context, sk cipher.SecKey, e *Entry
 			e.Sequence--
 			return err
 		}
-		rE, entryErr := c.Entry(ctx, e.Static)
+		rE, entryErr := dc.Entry(ctx, e.Static)
 		if entryErr != nil {
 			return err
 		}
@@ -164,9 +179,13 @@ func (c *httpClient) UpdateEntry(ctx context.Context, sk cipher.SecKey, e *Entry
 }
 
 // AvailableServers returns list of available servers.
-func (c *httpClient) AvailableServers(ctx context.Context) ([]*Entry, error) {
+// Without options, the discovery returns a random subset of available servers.
+func (c *httpClient) AvailableServers(ctx context.Context, opts ...ServersOption) ([]*Entry, error) {
 	var entries []*Entry
 	endpoint := c.address + "/dmsg-discovery/available_servers"
+	if q := MakeServersQuery(opts...); !q.IsEmpty() {
+		endpoint += "?" + q.Values().Encode()
+	}
 
 	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
 	if err != nil {
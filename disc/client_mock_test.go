@@ -367,3 +367,58 @@ func newTestEntry(pk cipher.PubKey) disc.Entry {
 	}
 	return baseEntry
 }
+
+func TestNewMockAvailableServersUpdates(t *testing.T) {
+	dc := disc.NewMock()
+	ctx := context.TODO()
+
+	pk, sk := cipher.GenerateKeyPair()
+	entry := disc.NewServerEntry(pk, 0, "localhost:8080", 10)
+	require.NoError(t, entry.Sign(sk))
+	require.NoError(t, dc.SetEntry(ctx, entry))
+
+	otherPK, otherSK := cipher.GenerateKeyPair()
+	other := disc.NewServerEntry(otherPK, 0, "localhost:8081", 10)
+	require.NoError(t, other.Sign(otherSK))
+	require.NoError(t, dc.SetEntry(ctx, other))
+
+	// listed returns the listed entry of the server of 'pk' (nil if not listed), and fails if listed more than once.
+	listed := func() *disc.Entry {
+		entries, err := dc.AvailableServers(ctx)
+		require.NoError(t, err)
+		var res *disc.Entry
+		for _, e := range entries {
+			if e.Static == pk {
+				require.Nil(t, res, "server is listed more than once")
+				res = e
+			}
+		}
+		return res
+	}
+
+	// update updates the entry of the server of 'pk' in discovery, from a copy of the current one.
+	update := func(modify func(e *disc.Entry)) {
+		e, err := dc.Entry(ctx, pk)
+		require.NoError(t, err)
+		modify(e)
+		require.NoError(t, dc.UpdateEntry(ctx, sk, e))
+	}
+
+	// Updated entries replace listed ones.
+	update(func(e *disc.Entry) { e.Server.Address = "localhost:9090" })
+	update(func(e *disc.Entry) {})
+	require.NotNil(t, listed())
+	assert.Equal(t, "localhost:9090", listed().Server.Address)
+
+	// Servers without available connections are not listed, and are listed again once they are available.
+	update(func(e *disc.Entry) { e.Server.AvailableConnections = 0 })
+	assert.Nil(t, listed())
+
+	update(func(e *disc.Entry) { e.Server.AvailableConnections = 10 })
+	assert.NotNil(t, listed())
+
+	// Other servers are not affected.
+	entries, err := dc.AvailableServers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
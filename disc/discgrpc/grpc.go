@@ -0,0 +1,276 @@
+// Package discgrpc implements the gRPC transport of dmsg discovery. It is separate from package disc, so that only
+// importers of the gRPC transport depend on gRPC.
+package discgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+var log = logging.MustGetLogger("discgrpc")
+
+const (
+	// grpcServiceName is the full name of the dmsg discovery gRPC service.
+	grpcServiceName = "dmsg.disc.Discovery"
+
+	// grpcCodecName is the gRPC content-subtype of the dmsg discovery gRPC service.
+	// Messages are encoded as JSON (as with the HTTP API), so that no generated protobuf code is required.
+	grpcCodecName = "dmsgjson"
+)
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return grpcCodecName }
+
+// gRPC messages.
+type (
+	grpcEntryReq struct {
+		PK cipher.PubKey `json:"pk"`
+	}
+	grpcServersResp struct {
+		Entries []*disc.Entry `json:"entries"`
+	}
+	grpcEmpty struct{}
+)
+
+// Server is implemented by dmsg discovery services which are served over gRPC.
+type Server interface {
+	Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error)
+	SetEntry(ctx context.Context, entry *disc.Entry) error
+	AvailableServers(ctx context.Context, q disc.ServersQuery) ([]*disc.Entry, error)
+
+	// WatchEntry calls 'send' with the entry of the given public key when it is first obtained and whenever it
+	// changes. It returns when the context is done or when 'send' fails.
+	WatchEntry(ctx context.Context, pk cipher.PubKey, send func(*disc.Entry) error) error
+}
+
+// RegisterServer registers the dmsg discovery service on a gRPC server.
+func RegisterServer(s *grpc.Server, srv Server) {
+	s.RegisterService(&grpcServiceDesc, srv)
+}
+
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Entry", Handler: grpcUnaryHandler("Entry", grpcEntry)},
+		{MethodName: "SetEntry", Handler: grpcUnaryHandler("SetEntry", grpcSetEntry)},
+		{MethodName: "AvailableServers", Handler: grpcUnaryHandler("AvailableServers", grpcAvailableServers)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "WatchEntry", Handler: grpcWatchEntryHandler, ServerStreams: true},
+	},
+}
+
+func grpcMethod(name string) string {
+	return "/" + grpcServiceName + "/" + name
+}
+
+// grpcUnaryFunc decodes the request via 'dec' and calls the corresponding method of 'srv'.
+type grpcUnaryFunc func(ctx context.Context, srv Server, dec func(interface{}) error) (interface{}, error)
+
+func grpcEntry(ctx context.Context, srv Server, dec func(interface{}) error) (interface{}, error) {
+	var req grpcEntryReq
+	if err := dec(&req); err != nil {
+		return nil, err
+	}
+	return srv.Entry(ctx, req.PK)
+}
+
+func grpcSetEntry(ctx context.Context, srv Server, dec func(interface{}) error) (interface{}, error) {
+	var entry disc.Entry
+	if err := dec(&entry); err != nil {
+		return nil, err
+	}
+	return &grpcEmpty{}, srv.SetEntry(ctx, &entry)
+}
+
+func grpcAvailableServers(ctx context.Context, srv Server, dec func(interface{}) error) (interface{}, error) {
+	var q disc.ServersQuery
+	if err := dec(&q); err != nil {
+		return nil, err
+	}
+	entries, err := srv.AvailableServers(ctx, q)
+	return &grpcServersResp{Entries: entries}, err
+}
+
+// grpcUnaryHandler returns a gRPC method handler which calls 'fn', and converts returned errors to gRPC errors.
+// Interceptors are not supported.
+func grpcUnaryHandler(name string, fn grpcUnaryFunc) grpcMethodHandler {
+	return func(
+		srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor,
+	) (interface{}, error) {
+		resp, err := fn(ctx, srv.(Server), dec)
+		if err != nil {
+			log.WithError(err).WithField("method", grpcMethod(name)).Debug("gRPC request failed.")
+			return nil, grpcError(err)
+		}
+		return resp, nil
+	}
+}
+
+// grpcMethodHandler is the signature of handlers of grpc.MethodDesc.
+type grpcMethodHandler = func(
+	srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor,
+) (interface{}, error)
+
+func grpcWatchEntryHandler(srv interface{}, stream grpc.ServerStream) error {
+	var req grpcEntryReq
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	send := func(entry *disc.Entry) error { return stream.SendMsg(entry) }
+	return grpcError(srv.(Server).WatchEntry(stream.Context(), req.PK, send))
+}
+
+// grpcError converts an error of the dmsg discovery service to a gRPC status error.
+// As with the HTTP API, unknown errors are reported as disc.ErrUnexpected.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if _, ok := err.(disc.EntryValidationError); ok {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	switch err {
+	case disc.ErrKeyNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case disc.ErrUnauthorized:
+		return status.Error(codes.Unauthenticated, err.Error())
+	case disc.ErrBadInput:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case context.Canceled:
+		return status.Error(codes.Canceled, err.Error())
+	case context.DeadlineExceeded:
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, disc.ErrUnexpected.Error())
+	}
+}
+
+// errFromGRPC converts a gRPC status error returned by the dmsg discovery service back to the original error.
+// Errors which are not of the dmsg discovery service (such as transport errors) are returned as is.
+func errFromGRPC(err error) error {
+	s, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	if e := disc.ErrFromMessage(s.Message()); e != nil {
+		return e
+	}
+	return err
+}
+
+// Client is a disc.APIClient which communicates with a dmsg-discovery service through gRPC.
+// It also implements disc.EntryWatcher, so that entry changes are pushed by dmsg discovery instead of being polled.
+type Client struct {
+	conn      *grpc.ClientConn
+	updateMux sync.Mutex // for thread-safe sequence incrementing
+}
+
+// NewClient constructs a new disc.APIClient that communicates with discovery via gRPC.
+// If no dial options are provided, the connection is not encrypted.
+func NewClient(address string, opts ...grpc.DialOption) (*Client, error) {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	opts = append(opts, grpc.WithDefaultCallOptions(grpc.CallContentSubtype(grpcCodecName)))
+
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Entry retrieves an entry associated with the given public key.
+func (c *Client) Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	var entry disc.Entry
+	if err := c.conn.Invoke(ctx, grpcMethod("Entry"), &grpcEntryReq{PK: pk}, &entry); err != nil {
+		return nil, errFromGRPC(err)
+	}
+	return &entry, nil
+}
+
+// SetEntry creates a new Entry.
+func (c *Client) SetEntry(ctx context.Context, e *disc.Entry) error {
+	return errFromGRPC(c.conn.Invoke(ctx, grpcMethod("SetEntry"), e, &grpcEmpty{}))
+}
+
+// UpdateEntry updates Entry in dmsg discovery.
+func (c *Client) UpdateEntry(ctx context.Context, sk cipher.SecKey, e *disc.Entry) error {
+	c.updateMux.Lock()
+	defer c.updateMux.Unlock()
+
+	return disc.UpdateEntry(ctx, c, sk, e)
+}
+
+// AvailableServers returns list of available servers.
+// Without options, the discovery returns a random subset of available servers.
+func (c *Client) AvailableServers(ctx context.Context, opts ...disc.ServersOption) ([]*disc.Entry, error) {
+	q := disc.MakeServersQuery(opts...)
+	var resp grpcServersResp
+	if err := c.conn.Invoke(ctx, grpcMethod("AvailableServers"), &q, &resp); err != nil {
+		return nil, errFromGRPC(err)
+	}
+	return resp.Entries, nil
+}
+
+// WatchEntry implements disc.EntryWatcher.
+func (c *Client) WatchEntry(ctx context.Context, pk cipher.PubKey) (<-chan *disc.Entry, error) {
+	stream, err := c.conn.NewStream(ctx, &grpcServiceDesc.Streams[0], grpcMethod("WatchEntry"))
+	if err != nil {
+		return nil, errFromGRPC(err)
+	}
+	if err := stream.SendMsg(&grpcEntryReq{PK: pk}); err != nil {
+		return nil, errFromGRPC(err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, errFromGRPC(err)
+	}
+
+	ch := make(chan *disc.Entry, 1)
+	go func() {
+		defer close(ch)
+		for {
+			entry := new(disc.Entry)
+			if err := stream.RecvMsg(entry); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					log.WithError(errFromGRPC(err)).WithField("pk", pk).Warn("Entry watch stream closed.")
+				}
+				return
+			}
+			select {
+			case ch <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Close closes the underlying gRPC connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
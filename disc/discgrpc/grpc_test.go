@@ -0,0 +1,147 @@
+package discgrpc_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/disc/discgrpc"
+)
+
+// testGRPCServer implements discgrpc.Server on top of a mock APIClient.
+type testGRPCServer struct {
+	dc      disc.APIClient
+	changed chan struct{} // closed and replaced on every SetEntry
+	mx      sync.Mutex
+}
+
+func newTestGRPCServer() *testGRPCServer {
+	return &testGRPCServer{dc: disc.NewMock(), changed: make(chan struct{})}
+}
+
+func (s *testGRPCServer) Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	entry, err := s.dc.Entry(ctx, pk)
+	if err != nil {
+		return nil, disc.ErrKeyNotFound
+	}
+	return entry, nil
+}
+
+func (s *testGRPCServer) SetEntry(ctx context.Context, entry *disc.Entry) error {
+	if err := s.dc.SetEntry(ctx, entry); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	close(s.changed)
+	s.changed = make(chan struct{})
+	s.mx.Unlock()
+	return nil
+}
+
+func (s *testGRPCServer) AvailableServers(ctx context.Context, q disc.ServersQuery) ([]*disc.Entry, error) {
+	return s.dc.AvailableServers(ctx, disc.WithPage(q.Offset, q.Limit), disc.WithRegion(q.Region))
+}
+
+func (s *testGRPCServer) WatchEntry(ctx context.Context, pk cipher.PubKey, send func(*disc.Entry) error) error {
+	for {
+		s.mx.Lock()
+		changed := s.changed
+		s.mx.Unlock()
+
+		if entry, err := s.dc.Entry(ctx, pk); err == nil {
+			if err := send(entry); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer()
+	discgrpc.RegisterServer(srv, newTestGRPCServer())
+	go func() { _ = srv.Serve(lis) }() //nolint:errcheck
+	defer srv.Stop()
+
+	dc, err := discgrpc.NewClient(lis.Addr().String())
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, dc.Close()) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	pk, sk := cipher.GenerateKeyPair()
+
+	t.Run("entry_not_found", func(t *testing.T) {
+		_, err := dc.Entry(ctx, pk)
+		require.Equal(t, disc.ErrKeyNotFound, err)
+	})
+
+	t.Run("set_update_and_watch_entry", func(t *testing.T) {
+		entry := disc.NewClientEntry(pk, 0, []cipher.PubKey{})
+		require.NoError(t, entry.Sign(sk))
+		require.NoError(t, dc.SetEntry(ctx, entry))
+
+		got, err := dc.Entry(ctx, pk)
+		require.NoError(t, err)
+		require.Equal(t, entry, got)
+
+		// A set entry of the same sequence is rejected.
+		require.Equal(t, disc.ErrValidationWrongSequence, dc.SetEntry(ctx, entry))
+
+		watchCtx, watchCancel := context.WithCancel(ctx)
+		defer watchCancel()
+		entries, err := dc.WatchEntry(watchCtx, pk)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), (<-entries).Sequence)
+
+		srvPK, _ := cipher.GenerateKeyPair()
+		entry.Client.DelegatedServers = []cipher.PubKey{srvPK}
+		require.NoError(t, dc.UpdateEntry(ctx, sk, entry))
+
+		updated := <-entries
+		require.Equal(t, uint64(1), updated.Sequence)
+		require.Equal(t, []cipher.PubKey{srvPK}, updated.Client.DelegatedServers)
+
+		watchCancel()
+		for range entries {
+		}
+	})
+
+	t.Run("available_servers", func(t *testing.T) {
+		for _, region := range []string{"eu", "us", "eu"} {
+			srvPK, srvSK := cipher.GenerateKeyPair()
+			entry := disc.NewServerEntry(srvPK, 0, "1.1.1.1:8080", 10)
+			entry.Server.Region = region
+			require.NoError(t, entry.Sign(srvSK))
+			require.NoError(t, dc.SetEntry(ctx, entry))
+		}
+
+		entries, err := dc.AvailableServers(ctx)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+
+		entries, err = dc.AvailableServers(ctx, disc.WithRegion("eu"))
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+
+		entries, err = dc.AvailableServers(ctx, disc.WithPage(1, 1))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+}
@@ -41,6 +41,8 @@ var (
 	ErrValidationWrongTime = NewEntryValidationError("previous entry timestamp is not set before current entry timestamp")
 	// ErrValidationServerAddress occurs in case when client want to advertise wrong Server address
 	ErrValidationServerAddress = NewEntryValidationError("advertising localhost listening address is not allowed in production mode")
+	// ErrValidationInsufficientPoW occurs in case when the entry's proof-of-work does not satisfy the required difficulty
+	ErrValidationInsufficientPoW = NewEntryValidationError("entry proof-of-work is of insufficient difficulty")
 
 	errReverseMap = map[string]error{
 		ErrKeyNotFound.Error():                ErrKeyNotFound,
@@ -56,9 +58,20 @@ var (
 		ErrValidationNoClientOrServer.Error(): ErrValidationNoClientOrServer,
 		ErrValidationWrongSequence.Error():    ErrValidationWrongSequence,
 		ErrValidationWrongTime.Error():        ErrValidationWrongTime,
+		ErrValidationInsufficientPoW.Error():  ErrValidationInsufficientPoW,
+		ErrServiceNotFound.Error():            ErrServiceNotFound,
+		ErrValidationServiceName.Error():      ErrValidationServiceName,
+		ErrValidationServicePort.Error():      ErrValidationServicePort,
+		ErrValidationServiceExpired.Error():   ErrValidationServiceExpired,
 	}
 )
 
+// ErrFromMessage returns the dmsg discovery error of the given message (nil if there is none), so that errors which
+// are passed as messages by transports can be restored.
+func ErrFromMessage(msg string) error {
+	return errReverseMap[msg]
+}
+
 func errFromString(s string) error {
 	err, ok := errReverseMap[s]
 	if !ok {
@@ -102,6 +115,13 @@ type Entry struct {
 	// Contains the instance's server meta if it's to be advertised as a DMSG Server.
 	Server *Server `json:"server,omitempty"`
 
+	// Network ID of the dmsg network that the instance is part of (empty for the default network).
+	NetworkID string `json:"network_id,omitempty"`
+
+	// Proof-of-work nonce of the static public key (see PoWDifficulty).
+	// This is only required if dmsg discovery enforces a proof-of-work difficulty.
+	PoW uint64 `json:"pow,omitempty"`
+
 	// Signature for proving authenticity of an Entry.
 	Signature string `json:"signature,omitempty"`
 }
@@ -112,6 +132,9 @@ func (e *Entry) String() string {
 	res += fmt.Sprintf("\tsequence: %d\n", e.Sequence)
 	res += fmt.Sprintf("\tregistered at: %d\n", e.Timestamp)
 	res += fmt.Sprintf("\tstatic public key: %s\n", e.Static)
+	if e.NetworkID != "" {
+		res += fmt.Sprintf("\tnetwork ID: %s\n", e.NetworkID)
+	}
 	res += fmt.Sprintf("\tsignature: %s\n", e.Signature)
 
 	if e.Client != nil {
@@ -154,11 +177,70 @@ type Server struct {
 
 	// Number of connections still available.
 	AvailableConnections int `json:"available_connections"`
+
+	// Additional public addresses of the DMSG Server (such as an IPv6 address in addition to an IPv4 Address).
+	Addresses []string `json:"addresses,omitempty"`
+
+	// Typed addresses of additional underlays that the DMSG Server is listening on (such as websocket).
+	Records []AddrRecord `json:"records,omitempty"`
+
+	// Region in which the DMSG Server is located (optional).
+	Region string `json:"region,omitempty"`
+}
+
+// Underlay types of address records.
+const (
+	UnderlayTCP = "tcp"
+	UnderlayWS  = "ws"
+)
+
+// AddrRecord is a typed address of a DMSG Server.
+type AddrRecord struct {
+	// Type of the underlay (such as "tcp" or "ws").
+	Type string `json:"type"`
+
+	// Public address of the underlay.
+	Address string `json:"address"`
+}
+
+// AddrsOfType returns all addresses of the given underlay type.
+// For "tcp", this includes Address and the additional Addresses.
+func (s *Server) AddrsOfType(typ string) []string {
+	var addrs []string
+	if typ == UnderlayTCP {
+		addrs = s.AllAddresses()
+	}
+	for _, r := range s.Records {
+		if r.Type == typ && r.Address != "" {
+			addrs = append(addrs, r.Address)
+		}
+	}
+	return addrs
+}
+
+// AllAddresses returns Address followed by the additional Addresses, omitting empty and duplicate values.
+func (s *Server) AllAddresses() []string {
+	addrs := make([]string, 0, 1+len(s.Addresses))
+	seen := make(map[string]struct{}, 1+len(s.Addresses))
+	for _, addr := range append([]string{s.Address}, s.Addresses...) {
+		if _, ok := seen[addr]; ok || addr == "" {
+			continue
+		}
+		seen[addr] = struct{}{}
+		addrs = append(addrs, addr)
+	}
+	return addrs
 }
 
 // String implements stringer
 func (s *Server) String() string {
 	res := fmt.Sprintf("\taddress: %s\n", s.Address)
+	if len(s.Addresses) > 0 {
+		res += fmt.Sprintf("\taddresses: %s\n", strings.Join(s.Addresses, ", "))
+	}
+	for _, r := range s.Records {
+		res += fmt.Sprintf("\trecord: %s %s\n", r.Type, r.Address)
+	}
 	res += fmt.Sprintf("\tport: %s\n", s.Port)
 	res += fmt.Sprintf("\tavailable connections: %d\n", s.AvailableConnections)
 
@@ -190,13 +272,22 @@ func NewServerEntry(pubkey cipher.PubKey, sequence uint64, address string, conns
 
 // VerifySignature check if signature matches to Entry's PubKey.
 func (e *Entry) VerifySignature() error {
+	signature, entryJSON, err := e.signedPayload()
+	if err != nil {
+		return err
+	}
+	return cipher.VerifyPubKeySignedPayload(e.Static, signature, entryJSON)
+}
+
+// signedPayload returns the signature of the entry, and the payload which it signs.
+func (e *Entry) signedPayload() (cipher.Sig, []byte, error) {
 	entry := *e
 
 	// Get and parse signature
 	signature := cipher.Sig{}
 	err := signature.UnmarshalText([]byte(e.Signature))
 	if err != nil {
-		return err
+		return signature, nil, err
 	}
 
 	// Set signature field to zero-value
@@ -204,11 +295,23 @@ func (e *Entry) VerifySignature() error {
 
 	// Get hash of the entry
 	entryJSON, err := json.Marshal(entry)
-	if err != nil {
-		return err
-	}
+	return signature, entryJSON, err
+}
 
-	return cipher.VerifyPubKeySignedPayload(e.Static, signature, entryJSON)
+// VerifySignatures verifies the signatures of the entries as a batch (see cipher.VerifyBatch), which is faster than
+// verifying them one by one. If any signature is invalid, a *cipher.BatchError of the index of the entry is returned.
+func VerifySignatures(entries []*Entry) error {
+	pks := make([]cipher.PubKey, len(entries))
+	sigs := make([]cipher.Sig, len(entries))
+	payloads := make([][]byte, len(entries))
+	for i, e := range entries {
+		sig, payload, err := e.signedPayload()
+		if err != nil {
+			return &cipher.BatchError{Index: i, Err: err}
+		}
+		pks[i], sigs[i], payloads[i] = e.Static, sig, payload
+	}
+	return cipher.VerifyBatch(pks, sigs, payloads)
 }
 
 // Sign signs Entry with provided SecKey.
@@ -285,6 +388,12 @@ func Copy(dst, src *Entry) {
 		dst.Server = nil
 	} else {
 		*dst.Server = *src.Server
+		if src.Server.Addresses != nil {
+			dst.Server.Addresses = append([]string(nil), src.Server.Addresses...)
+		}
+		if src.Server.Records != nil {
+			dst.Server.Records = append([]AddrRecord(nil), src.Server.Records...)
+		}
 	}
 	if src.Client == nil {
 		dst.Client = nil
@@ -297,4 +406,6 @@ func Copy(dst, src *Entry) {
 	dst.Version = src.Version
 	dst.Sequence = src.Sequence
 	dst.Timestamp = src.Timestamp
+	dst.PoW = src.PoW
+	dst.NetworkID = src.NetworkID
 }
@@ -92,6 +92,22 @@ func TestVerifySignature(t *testing.T) {
 	assert.NotNilf(t, err, "this signature must not be valid")
 }
 
+func TestVerifySignatures(t *testing.T) {
+	entries := make([]*Entry, 10)
+	for i := range entries {
+		pk, sk := cipher.GenerateKeyPair()
+		entries[i] = newTestEntry(pk)
+		require.NoError(t, entries[i].Sign(sk))
+	}
+	require.NoError(t, VerifySignatures(entries))
+
+	wrongPk, _ := cipher.GenerateKeyPair()
+	entries[7].Static = wrongPk
+	err := VerifySignatures(entries)
+	require.Error(t, err)
+	require.Equal(t, 7, err.(*cipher.BatchError).Index)
+}
+
 func TestValidateRightEntry(t *testing.T) {
 	// Arrange
 	// Create keys and signed entry
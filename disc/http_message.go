@@ -9,6 +9,7 @@ import (
 var (
 	MsgEntrySet     = HTTPMessage{Code: http.StatusOK, Message: "wrote a new entry"}
 	MsgEntryUpdated = HTTPMessage{Code: http.StatusOK, Message: "wrote new entry iteration"}
+	MsgServiceSet   = HTTPMessage{Code: http.StatusOK, Message: "wrote service record"}
 )
 
 // HTTPMessage represents a message to be returned as an http response
@@ -0,0 +1,57 @@
+package disc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// powCheckInterval is the number of attempts between context checks when solving a proof-of-work.
+const powCheckInterval = 1 << 16
+
+// PoWDifficulty returns the difficulty satisfied by the proof-of-work 'nonce' of the public key 'pk'.
+// The difficulty is the number of leading zero bits of SHA256(pk || nonce), where the nonce is encoded big-endian.
+func PoWDifficulty(pk cipher.PubKey, nonce uint64) int {
+	var b [len(pk) + 8]byte
+	copy(b[:], pk[:])
+	binary.BigEndian.PutUint64(b[len(pk):], nonce)
+	sum := sha256.Sum256(b[:])
+
+	n := 0
+	for i := 0; i < len(sum); i += 8 {
+		z := bits.LeadingZeros64(binary.BigEndian.Uint64(sum[i:]))
+		n += z
+		if z < 64 {
+			break
+		}
+	}
+	return n
+}
+
+// SolvePoW finds a proof-of-work nonce of the public key 'pk' which satisfies 'difficulty'.
+// Each additional bit of difficulty doubles the expected work.
+// As the proof-of-work is tied to the public key (and not the entry contents), a solution is valid for all
+// iterations of an entry.
+func SolvePoW(ctx context.Context, pk cipher.PubKey, difficulty int) (uint64, error) {
+	for nonce := uint64(0); ; nonce++ {
+		if PoWDifficulty(pk, nonce) >= difficulty {
+			return nonce, nil
+		}
+		if nonce%powCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// VerifyPoW checks that the entry's proof-of-work satisfies the given difficulty.
+func (e *Entry) VerifyPoW(difficulty int) error {
+	if PoWDifficulty(e.Static, e.PoW) < difficulty {
+		return ErrValidationInsufficientPoW
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package disc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestSolvePoW(t *testing.T) {
+	const difficulty = 12
+	pk, sk := cipher.GenerateKeyPair()
+
+	nonce, err := disc.SolvePoW(context.Background(), pk, difficulty)
+	require.NoError(t, err)
+	require.True(t, disc.PoWDifficulty(pk, nonce) >= difficulty)
+
+	entry := disc.NewClientEntry(pk, 0, nil)
+	entry.PoW = nonce
+	require.NoError(t, entry.VerifyPoW(difficulty))
+	require.NoError(t, entry.Sign(sk))
+	require.NoError(t, entry.VerifySignature())
+
+	// The proof-of-work is covered by the signature.
+	entry.PoW++
+	require.Error(t, entry.VerifySignature())
+
+	// The proof-of-work is tied to the public key.
+	pk2, _ := cipher.GenerateKeyPair()
+	entry2 := disc.NewClientEntry(pk2, 0, nil)
+	entry2.PoW = nonce
+	if disc.PoWDifficulty(pk2, nonce) < difficulty {
+		require.Equal(t, disc.ErrValidationInsufficientPoW, entry2.VerifyPoW(difficulty))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = disc.SolvePoW(ctx, pk, 256)
+	require.Equal(t, context.Canceled, err)
+}
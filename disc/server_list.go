@@ -0,0 +1,126 @@
+package disc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+var (
+	// ErrServerListWrongOperator occurs when a server list is not of the expected operator.
+	ErrServerListWrongOperator = errors.New("server list is not of the trusted operator")
+	// ErrServerListNoSignature occurs when a server list has no signature.
+	ErrServerListNoSignature = errors.New("server list has no signature")
+)
+
+// ServerList is a signed snapshot of the dmsg servers approved by the operator of a (private) dmsg network.
+// Clients which trust the operator only establish sessions with servers of the list. Server entries are still obtained
+// from dmsg discovery, and the snapshotted entries are only used to bootstrap if dmsg discovery has none of them.
+type ServerList struct {
+	// Operator is the public key of the operator who signed the list.
+	Operator cipher.PubKey `json:"operator"`
+
+	// Timestamp of the snapshot.
+	Timestamp int64 `json:"timestamp"`
+
+	// Servers contains the entries of the approved servers.
+	Servers []*Entry `json:"servers"`
+
+	// Signature of the operator.
+	Signature string `json:"signature,omitempty"`
+}
+
+// NewServerList creates a server list of the given operator and server entries. It should be signed before publishing.
+func NewServerList(operator cipher.PubKey, servers []*Entry) *ServerList {
+	return &ServerList{
+		Operator:  operator,
+		Timestamp: time.Now().UnixNano(),
+		Servers:   servers,
+	}
+}
+
+// Sign signs the server list with the operator's secret key.
+func (l *ServerList) Sign(sk cipher.SecKey) error {
+	l.Signature = ""
+
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	sig, err := cipher.SignPayload(b, sk)
+	if err != nil {
+		return err
+	}
+	l.Signature = sig.Hex()
+	return nil
+}
+
+// Verify checks that the server list is of the given operator and that it is correctly signed.
+func (l *ServerList) Verify(operator cipher.PubKey) error {
+	if l.Operator != operator {
+		return ErrServerListWrongOperator
+	}
+	if l.Signature == "" {
+		return ErrServerListNoSignature
+	}
+
+	var sig cipher.Sig
+	if err := sig.UnmarshalText([]byte(l.Signature)); err != nil {
+		return err
+	}
+
+	cp := *l
+	cp.Signature = ""
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	if err := cipher.VerifyPubKeySignedPayload(operator, sig, b); err != nil {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Contains returns true if the server of the given public key is in the list.
+func (l *ServerList) Contains(pk cipher.PubKey) bool {
+	for _, e := range l.Servers {
+		if e.Static == pk {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchServerList obtains a published server list from the given URL, and verifies it against the trusted operator.
+func FetchServerList(ctx context.Context, url string, operator cipher.PubKey) (*ServerList, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.WithError(err).Warn("Failed to close response body")
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch server list: status code %d", resp.StatusCode)
+	}
+	var l ServerList
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, err
+	}
+	if err := l.Verify(operator); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
@@ -0,0 +1,56 @@
+package disc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestServerList(t *testing.T) {
+	opPK, opSK := cipher.GenerateKeyPair()
+	srvPK, _ := cipher.GenerateKeyPair()
+	otherPK, otherSK := cipher.GenerateKeyPair()
+
+	list := disc.NewServerList(opPK, []*disc.Entry{disc.NewServerEntry(srvPK, 0, "1.1.1.1:8080", 10)})
+	require.Equal(t, disc.ErrServerListNoSignature, list.Verify(opPK))
+	require.NoError(t, list.Sign(opSK))
+	require.NoError(t, list.Verify(opPK))
+	require.True(t, list.Contains(srvPK))
+	require.False(t, list.Contains(otherPK))
+
+	t.Run("wrong_operator", func(t *testing.T) {
+		require.Equal(t, disc.ErrServerListWrongOperator, list.Verify(otherPK))
+
+		forged := *list
+		forged.Operator = otherPK
+		require.NoError(t, forged.Sign(otherSK))
+		require.Equal(t, disc.ErrServerListWrongOperator, forged.Verify(opPK))
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := *list
+		tampered.Servers = append(tampered.Servers, disc.NewServerEntry(otherPK, 0, "2.2.2.2:8080", 10))
+		require.Equal(t, disc.ErrUnauthorized, tampered.Verify(opPK))
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.NoError(t, json.NewEncoder(w).Encode(list))
+		}))
+		defer srv.Close()
+
+		fetched, err := disc.FetchServerList(context.Background(), srv.URL, opPK)
+		require.NoError(t, err)
+		require.True(t, fetched.Contains(srvPK))
+
+		_, err = disc.FetchServerList(context.Background(), srv.URL, otherPK)
+		require.Equal(t, disc.ErrServerListWrongOperator, err)
+	})
+}
@@ -0,0 +1,162 @@
+package disc
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ServersQuery filters and paginates the listing of available servers.
+type ServersQuery struct {
+	Offset     int    // number of servers to skip
+	Limit      int    // maximum number of servers to return (0 for no limit)
+	Region     string // if set, only servers of this region are returned
+	MinVersion string // if set, only servers with an entry version of at least this are returned
+	NetworkID  string // if set, only servers of this dmsg network are returned
+}
+
+// ServersOption configures a ServersQuery.
+type ServersOption func(*ServersQuery)
+
+// WithPage returns servers starting from 'offset', and at most 'limit' servers (0 for no limit).
+// Servers are ordered by public key.
+func WithPage(offset, limit int) ServersOption {
+	return func(q *ServersQuery) {
+		q.Offset = offset
+		q.Limit = limit
+	}
+}
+
+// WithRegion only returns servers of the given region.
+func WithRegion(region string) ServersOption {
+	return func(q *ServersQuery) {
+		q.Region = region
+	}
+}
+
+// WithMinVersion only returns servers with an entry version of at least the given version.
+func WithMinVersion(version string) ServersOption {
+	return func(q *ServersQuery) {
+		q.MinVersion = version
+	}
+}
+
+// WithNetworkID only returns servers of the given dmsg network.
+func WithNetworkID(id string) ServersOption {
+	return func(q *ServersQuery) {
+		q.NetworkID = id
+	}
+}
+
+// MakeServersQuery makes a ServersQuery from the given options.
+func MakeServersQuery(opts ...ServersOption) ServersQuery {
+	var q ServersQuery
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return q
+}
+
+// IsEmpty returns true if the query neither filters nor paginates.
+func (q ServersQuery) IsEmpty() bool {
+	return q == ServersQuery{}
+}
+
+// Values encodes the query as URL query values.
+func (q ServersQuery) Values() url.Values {
+	v := make(url.Values)
+	if q.Offset > 0 {
+		v.Set("offset", strconv.Itoa(q.Offset))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Region != "" {
+		v.Set("region", q.Region)
+	}
+	if q.MinVersion != "" {
+		v.Set("min_version", q.MinVersion)
+	}
+	if q.NetworkID != "" {
+		v.Set("network_id", q.NetworkID)
+	}
+	return v
+}
+
+// ParseServersQuery decodes a query from URL query values.
+func ParseServersQuery(v url.Values) (ServersQuery, error) {
+	var q ServersQuery
+	var err error
+	if s := v.Get("offset"); s != "" {
+		if q.Offset, err = strconv.Atoi(s); err != nil || q.Offset < 0 {
+			return q, ErrBadInput
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit < 0 {
+			return q, ErrBadInput
+		}
+	}
+	q.Region = v.Get("region")
+	q.MinVersion = v.Get("min_version")
+	q.NetworkID = v.Get("network_id")
+	return q, nil
+}
+
+// Apply filters, orders (by public key) and paginates the given server entries.
+func (q ServersQuery) Apply(entries []*Entry) []*Entry {
+	out := make([]*Entry, 0, len(entries))
+	for _, e := range entries {
+		if e.Server == nil {
+			continue
+		}
+		if q.Region != "" && e.Server.Region != q.Region {
+			continue
+		}
+		if q.MinVersion != "" && CompareVersions(e.Version, q.MinVersion) < 0 {
+			continue
+		}
+		if q.NetworkID != "" && e.NetworkID != q.NetworkID {
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Static.Hex() < out[j].Static.Hex() })
+
+	if q.Offset >= len(out) {
+		return []*Entry{}
+	}
+	out = out[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(out) {
+		out = out[:q.Limit]
+	}
+	return out
+}
+
+// CompareVersions compares two dot-separated numeric versions (such as "0.0.1").
+// It returns -1 if a < b, 0 if a == b and 1 if a > b. Missing or non-numeric components are treated as 0.
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		an, bn := versionComponent(as, i), versionComponent(bs, i)
+		if an < bn {
+			return -1
+		}
+		if an > bn {
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionComponent(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(parts[i], "v"))
+	if err != nil {
+		return 0
+	}
+	return n
+}
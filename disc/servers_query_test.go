@@ -0,0 +1,62 @@
+package disc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestServersQuery_Apply(t *testing.T) {
+	var entries []*disc.Entry
+	for i, region := range []string{"eu", "us", "eu", "eu", "us"} {
+		pk, _ := cipher.GenerateKeyPair()
+		entry := disc.NewServerEntry(pk, 0, "1.1.1.1:8080", 10)
+		entry.Server.Region = region
+		if i == 0 {
+			entry.Version = "0.0.0"
+		}
+		entries = append(entries, entry)
+	}
+
+	q := disc.MakeServersQuery(disc.WithRegion("eu"))
+	require.Len(t, q.Apply(entries), 3)
+
+	q = disc.MakeServersQuery(disc.WithRegion("eu"), disc.WithMinVersion("0.0.1"))
+	require.Len(t, q.Apply(entries), 2)
+
+	entries[1].NetworkID = "staging"
+	require.Len(t, disc.MakeServersQuery(disc.WithNetworkID("staging")).Apply(entries), 1)
+	entries[1].NetworkID = ""
+
+	// Pages should not overlap and should cover all entries.
+	seen := make(map[cipher.PubKey]bool)
+	for offset := 0; offset < len(entries); offset += 2 {
+		page := disc.MakeServersQuery(disc.WithPage(offset, 2)).Apply(entries)
+		require.True(t, len(page) <= 2)
+		for _, e := range page {
+			require.False(t, seen[e.Static])
+			seen[e.Static] = true
+		}
+	}
+	require.Len(t, seen, len(entries))
+	require.Empty(t, disc.MakeServersQuery(disc.WithPage(len(entries), 2)).Apply(entries))
+}
+
+func TestServersQuery_Values(t *testing.T) {
+	q := disc.MakeServersQuery(disc.WithPage(10, 5), disc.WithRegion("eu"), disc.WithMinVersion("1.2.3"),
+		disc.WithNetworkID("staging"))
+	parsed, err := disc.ParseServersQuery(q.Values())
+	require.NoError(t, err)
+	require.Equal(t, q, parsed)
+	require.True(t, disc.ServersQuery{}.IsEmpty())
+}
+
+func TestCompareVersions(t *testing.T) {
+	require.Equal(t, 0, disc.CompareVersions("0.0.1", "0.0.1"))
+	require.Equal(t, -1, disc.CompareVersions("0.0.1", "0.1"))
+	require.Equal(t, 1, disc.CompareVersions("1.0", "0.9.9"))
+	require.Equal(t, 0, disc.CompareVersions("1", "1.0.0"))
+}
@@ -0,0 +1,205 @@
+package disc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// ServiceTTL is the duration after its timestamp for which a service record is valid.
+// Providers of a service should register it again within this duration.
+const ServiceTTL = 10 * time.Minute
+
+// MaxServiceNameLen is the maximum length of service names.
+const MaxServiceNameLen = 64
+
+var (
+	// ErrServiceNotFound occurs in case when no valid record of a service name is found
+	ErrServiceNotFound = errors.New("service of name is not found")
+	// ErrValidationServiceName occurs in case when a service record has an invalid name
+	ErrValidationServiceName = NewEntryValidationError(
+		"service name should be of 1 to 64 lower case letters, digits, '-', '_' and '.'")
+	// ErrValidationServicePort occurs in case when a service record has no port
+	ErrValidationServicePort = NewEntryValidationError("service record has no port")
+	// ErrValidationServiceExpired occurs in case when the timestamp of a service record is older than ServiceTTL
+	ErrValidationServiceExpired = NewEntryValidationError("service record is expired")
+)
+
+// ServiceRecord advertises that the service of a name is provided on a dmsg port of a public key.
+// It is signed by the public key, and is valid for ServiceTTL after its timestamp.
+// Multiple public keys may provide a service of the same name.
+type ServiceRecord struct {
+	Name      string        `json:"name"`
+	PK        cipher.PubKey `json:"public_key"`
+	Port      uint16        `json:"port"`
+	Timestamp int64         `json:"timestamp"` // in nanoseconds since epoch
+	Signature string        `json:"signature,omitempty"`
+}
+
+// NewServiceRecord returns a service record of the current time. It is yet to be signed.
+func NewServiceRecord(name string, pk cipher.PubKey, port uint16) *ServiceRecord {
+	return &ServiceRecord{Name: name, PK: pk, Port: port, Timestamp: time.Now().UnixNano()}
+}
+
+// String implements fmt.Stringer
+func (r *ServiceRecord) String() string {
+	return fmt.Sprintf("%s -> %s:%d", r.Name, r.PK, r.Port)
+}
+
+// Sign signs the record with the secret key of its public key.
+func (r *ServiceRecord) Sign(sk cipher.SecKey) error {
+	r.Signature = ""
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	sig, err := cipher.SignPayload(payload, sk)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig.Hex()
+	return nil
+}
+
+// VerifySignature checks that the record is signed by its public key.
+func (r *ServiceRecord) VerifySignature() error {
+	var sig cipher.Sig
+	if err := sig.UnmarshalText([]byte(r.Signature)); err != nil {
+		return err
+	}
+	rec := *r
+	rec.Signature = ""
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return cipher.VerifyPubKeySignedPayload(r.PK, sig, payload)
+}
+
+// Validate checks the fields of the record, and that it is not expired at the given time.
+func (r *ServiceRecord) Validate(now time.Time) error {
+	if !ValidServiceName(r.Name) {
+		return ErrValidationServiceName
+	}
+	if r.Port == 0 {
+		return ErrValidationServicePort
+	}
+	if r.Signature == "" {
+		return ErrValidationNoSignature
+	}
+	if r.Expired(now) {
+		return ErrValidationServiceExpired
+	}
+	return nil
+}
+
+// Expired returns whether the record is expired at the given time.
+func (r *ServiceRecord) Expired(now time.Time) bool {
+	return now.Sub(time.Unix(0, r.Timestamp)) > ServiceTTL
+}
+
+// ValidServiceName returns whether the name is a valid service name.
+func ValidServiceName(name string) bool {
+	if name == "" || len(name) > MaxServiceNameLen {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ServiceAPIClient implements the service registry API of dmsg discovery.
+type ServiceAPIClient interface {
+	// Services obtains the valid records of the service name, of which the newest come first.
+	Services(ctx context.Context, name string) ([]*ServiceRecord, error)
+
+	// SetService registers a signed service record.
+	SetService(ctx context.Context, r *ServiceRecord) error
+}
+
+// NewServiceHTTP constructs a new ServiceAPIClient that communicates with discovery via http.
+func NewServiceHTTP(address string) ServiceAPIClient {
+	return &httpClient{
+		client:  http.Client{},
+		address: address,
+	}
+}
+
+// Services implements ServiceAPIClient
+func (c *httpClient) Services(ctx context.Context, name string) ([]*ServiceRecord, error) {
+	var records []*ServiceRecord
+	err := c.do(ctx, http.MethodGet, "/dmsg-discovery/service/"+url.PathEscape(name), nil, &records)
+	return records, err
+}
+
+// SetService implements ServiceAPIClient
+func (c *httpClient) SetService(ctx context.Context, r *ServiceRecord) error {
+	return c.do(ctx, http.MethodPost, "/dmsg-discovery/service/", r, nil)
+}
+
+// do sends a request with the JSON-encoded body (if not nil), and decodes the response into 'out' (if not nil).
+func (c *httpClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, c.address+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.WithError(err).Warn("Failed to close response body")
+		}
+	}()
+
+	// if the response is an error it will be codified as an HTTPMessage
+	if resp.StatusCode != http.StatusOK {
+		var message HTTPMessage
+		if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
+			return err
+		}
+		return errFromString(message.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ValidServices returns the records of the service name which are valid at the given time and correctly signed, of
+// which the newest come first.
+func ValidServices(name string, records []*ServiceRecord, now time.Time) []*ServiceRecord {
+	valid := make([]*ServiceRecord, 0, len(records))
+	for _, r := range records {
+		if r.Name == name && r.Validate(now) == nil && r.VerifySignature() == nil {
+			valid = append(valid, r)
+		}
+	}
+	sort.Slice(valid, func(i, j int) bool { return valid[i].Timestamp > valid[j].Timestamp })
+	return valid
+}
@@ -0,0 +1,36 @@
+package disc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestServiceRecord(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	now := time.Now()
+
+	r := NewServiceRecord("skychat", pk, 80)
+	require.Equal(t, ErrValidationNoSignature, r.Validate(now))
+	require.NoError(t, r.Sign(sk))
+	require.NoError(t, r.Validate(now))
+	require.NoError(t, r.VerifySignature())
+	require.Equal(t, ErrValidationServiceExpired, r.Validate(now.Add(ServiceTTL+time.Second)))
+
+	r.Port = 81
+	require.Error(t, r.VerifySignature())
+
+	for _, name := range []string{"", "Chat", "sky chat", string(make([]byte, MaxServiceNameLen+1))} {
+		require.False(t, ValidServiceName(name), name)
+	}
+
+	older := NewServiceRecord("skychat", pk, 80)
+	older.Timestamp = r.Timestamp - 1
+	require.NoError(t, older.Sign(sk))
+	require.NoError(t, r.Sign(sk))
+	require.Equal(t, []*ServiceRecord{r, older}, ValidServices("skychat", []*ServiceRecord{older, r}, now))
+	require.Empty(t, ValidServices("other", []*ServiceRecord{older, r}, now))
+}
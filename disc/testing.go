@@ -46,7 +46,17 @@ func (m *mockClient) setServer(entry *Entry) {
 	m.listLock.Lock()
 	defer m.listLock.Unlock()
 
-	m.list = append(m.list, entry)
+	list := make([]*Entry, 0, len(m.list)+1)
+	for _, e := range m.list {
+		if e.Static != entry.Static {
+			list = append(list, e)
+		}
+	}
+	// Servers with no available connections (such as servers which have shut down) are not advertised.
+	if entry.Server.AvailableConnections > 0 {
+		list = append(list, entry)
+	}
+	m.list = list
 }
 
 // Entry returns the mock client static public key associated entry
@@ -113,8 +123,59 @@ func (m *mockClient) UpdateEntry(ctx context.Context, sk cipher.SecKey, e *Entry
 }
 
 // AvailableServers returns all the servers that the APIClient mock has
-func (m *mockClient) AvailableServers(ctx context.Context) ([]*Entry, error) {
+func (m *mockClient) AvailableServers(ctx context.Context, opts ...ServersOption) ([]*Entry, error) {
 	m.listLock.RLock()
 	defer m.listLock.RUnlock()
+	if q := MakeServersQuery(opts...); !q.IsEmpty() {
+		return q.Apply(m.list), nil
+	}
 	return m.list, nil
 }
+
+// mockServices is a ServiceAPIClient mock.
+type mockServices struct {
+	mu      sync.RWMutex
+	records map[string]map[cipher.PubKey]ServiceRecord
+}
+
+// NewServiceMock constructs a new mock ServiceAPIClient.
+func NewServiceMock() ServiceAPIClient {
+	return &mockServices{records: make(map[string]map[cipher.PubKey]ServiceRecord)}
+}
+
+// Services implements ServiceAPIClient
+func (m *mockServices) Services(_ context.Context, name string) ([]*ServiceRecord, error) {
+	m.mu.RLock()
+	records := make([]*ServiceRecord, 0, len(m.records[name]))
+	for _, r := range m.records[name] {
+		r := r
+		records = append(records, &r)
+	}
+	m.mu.RUnlock()
+
+	if records = ValidServices(name, records, time.Now()); len(records) == 0 {
+		return nil, ErrServiceNotFound
+	}
+	return records, nil
+}
+
+// SetService implements ServiceAPIClient
+func (m *mockServices) SetService(_ context.Context, r *ServiceRecord) error {
+	if err := r.Validate(time.Now()); err != nil {
+		return err
+	}
+	if err := r.VerifySignature(); err != nil {
+		return ErrUnauthorized
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.records[r.Name] == nil {
+		m.records[r.Name] = make(map[cipher.PubKey]ServiceRecord)
+	}
+	if prev, ok := m.records[r.Name][r.PK]; ok && prev.Timestamp >= r.Timestamp {
+		return ErrValidationWrongTime
+	}
+	m.records[r.Name][r.PK] = *r
+	return nil
+}
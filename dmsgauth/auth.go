@@ -0,0 +1,202 @@
+// Package dmsgauth implements challenge-response login and session tokens for services which are served over dmsg.
+// A client proves ownership of its public key by signing a challenge nonce of the service, and obtains a session
+// token which authenticates its subsequent requests.
+package dmsgauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+const (
+	// DefaultChallengeTTL is the default duration for which a challenge can be solved.
+	DefaultChallengeTTL = time.Second * 30
+
+	// DefaultTokenTTL is the default duration for which a session token is valid.
+	DefaultTokenTTL = time.Hour
+
+	// DefaultMaxChallenges is the default maximum number of pending challenges.
+	DefaultMaxChallenges = 1024
+
+	nonceSize = 32
+)
+
+var (
+	// ErrChallengeNotFound occurs when a login does not correspond to a pending challenge (or the challenge expired).
+	ErrChallengeNotFound = errors.New("challenge not found or expired")
+
+	// ErrTooManyChallenges occurs when the maximum number of pending challenges is reached.
+	ErrTooManyChallenges = errors.New("too many pending challenges")
+
+	// ErrInvalidSignature occurs when the signature of a challenge is invalid.
+	ErrInvalidSignature = errors.New("invalid challenge signature")
+
+	// ErrInvalidToken occurs when a session token is malformed or not issued by the service.
+	ErrInvalidToken = errors.New("invalid session token")
+
+	// ErrTokenExpired occurs when a session token is expired.
+	ErrTokenExpired = errors.New("session token expired")
+)
+
+// Config configures an Authenticator.
+type Config struct {
+	ChallengeTTL  time.Duration // duration for which a challenge can be solved
+	TokenTTL      time.Duration // duration for which a session token is valid
+	MaxChallenges int           // maximum number of pending challenges
+}
+
+// DefaultConfig returns the default configuration of an Authenticator.
+func DefaultConfig() *Config {
+	return &Config{
+		ChallengeTTL:  DefaultChallengeTTL,
+		TokenTTL:      DefaultTokenTTL,
+		MaxChallenges: DefaultMaxChallenges,
+	}
+}
+
+// Challenge is issued by a service to a client which logs in.
+// The client signs the challenge with SignChallenge to prove ownership of its public key.
+type Challenge struct {
+	ServerPK cipher.PubKey `json:"server_pk"`
+	ClientPK cipher.PubKey `json:"client_pk"`
+	Nonce    string        `json:"nonce"`
+}
+
+// payload is signed by the client. It contains the public key of the service, so that the signature cannot be
+// replayed to another service.
+func (ch Challenge) payload() []byte {
+	return []byte("dmsgauth-challenge:" + ch.ServerPK.Hex() + ":" + ch.ClientPK.Hex() + ":" + ch.Nonce)
+}
+
+// SignChallenge signs a challenge with the secret key of the client.
+func SignChallenge(ch Challenge, sk cipher.SecKey) (cipher.Sig, error) {
+	return cipher.SignPayload(ch.payload(), sk)
+}
+
+// Authenticator issues challenges and session tokens for a service.
+type Authenticator struct {
+	pk   cipher.PubKey
+	sk   cipher.SecKey
+	conf Config
+
+	challenges map[cipher.PubKey]pendingChallenge // pending challenges by client public key
+	mx         sync.Mutex
+}
+
+type pendingChallenge struct {
+	nonce  string
+	expiry time.Time
+}
+
+// NewAuthenticator creates an Authenticator for the service of the given keypair.
+// Session tokens are signed with the secret key of the service. If conf is nil, DefaultConfig is used.
+func NewAuthenticator(pk cipher.PubKey, sk cipher.SecKey, conf *Config) *Authenticator {
+	if conf == nil {
+		conf = DefaultConfig()
+	}
+	return &Authenticator{
+		pk:         pk,
+		sk:         sk,
+		conf:       *conf,
+		challenges: make(map[cipher.PubKey]pendingChallenge),
+	}
+}
+
+// Challenge issues a challenge for the client of the given public key.
+// A previous pending challenge of the client is replaced.
+func (a *Authenticator) Challenge(clientPK cipher.PubKey) (Challenge, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, err
+	}
+	ch := Challenge{ServerPK: a.pk, ClientPK: clientPK, Nonce: hex.EncodeToString(nonce)}
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	now := time.Now()
+	if _, ok := a.challenges[clientPK]; !ok && len(a.challenges) >= a.conf.MaxChallenges {
+		for pk, pending := range a.challenges {
+			if now.After(pending.expiry) {
+				delete(a.challenges, pk)
+			}
+		}
+		if len(a.challenges) >= a.conf.MaxChallenges {
+			return Challenge{}, ErrTooManyChallenges
+		}
+	}
+	a.challenges[clientPK] = pendingChallenge{nonce: ch.Nonce, expiry: now.Add(a.conf.ChallengeTTL)}
+	return ch, nil
+}
+
+// Login verifies the signature of a pending challenge of the client, and issues a session token.
+// The challenge can only be used once.
+func (a *Authenticator) Login(clientPK cipher.PubKey, nonce string, sig cipher.Sig) (string, error) {
+	a.mx.Lock()
+	pending, ok := a.challenges[clientPK]
+	valid := ok && subtle.ConstantTimeCompare([]byte(pending.nonce), []byte(nonce)) == 1
+	if valid {
+		delete(a.challenges, clientPK)
+	}
+	a.mx.Unlock()
+
+	if !valid || time.Now().After(pending.expiry) {
+		return "", ErrChallengeNotFound
+	}
+	ch := Challenge{ServerPK: a.pk, ClientPK: clientPK, Nonce: nonce}
+	if err := cipher.VerifyPubKeySignedPayload(clientPK, sig, ch.payload()); err != nil {
+		return "", ErrInvalidSignature
+	}
+	return a.issueToken(clientPK, time.Now().Add(a.conf.TokenTTL))
+}
+
+// Token format: <client public key>.<expiry (unix seconds)>.<signature of the service>
+func tokenPayload(clientPK cipher.PubKey, expiry int64) string {
+	return clientPK.Hex() + "." + strconv.FormatInt(expiry, 10)
+}
+
+func (a *Authenticator) issueToken(clientPK cipher.PubKey, expiry time.Time) (string, error) {
+	payload := tokenPayload(clientPK, expiry.Unix())
+	sig, err := cipher.SignPayload([]byte("dmsgauth-token:"+payload), a.sk)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign session token: %v", err)
+	}
+	return payload + "." + sig.Hex(), nil
+}
+
+// Verify verifies a session token which is issued by the Authenticator, and returns the public key of the client.
+func (a *Authenticator) Verify(token string) (cipher.PubKey, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return cipher.PubKey{}, ErrInvalidToken
+	}
+	var clientPK cipher.PubKey
+	if err := clientPK.Set(parts[0]); err != nil {
+		return cipher.PubKey{}, ErrInvalidToken
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return cipher.PubKey{}, ErrInvalidToken
+	}
+	var sig cipher.Sig
+	if err := sig.UnmarshalText([]byte(parts[2])); err != nil {
+		return cipher.PubKey{}, ErrInvalidToken
+	}
+	payload := tokenPayload(clientPK, expiry)
+	if err := cipher.VerifyPubKeySignedPayload(a.pk, sig, []byte("dmsgauth-token:"+payload)); err != nil {
+		return cipher.PubKey{}, ErrInvalidToken
+	}
+	if time.Now().Unix() >= expiry {
+		return cipher.PubKey{}, ErrTokenExpired
+	}
+	return clientPK, nil
+}
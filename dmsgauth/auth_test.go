@@ -0,0 +1,82 @@
+package dmsgauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestAuthenticator(t *testing.T) {
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	clientPK, clientSK := cipher.GenerateKeyPair()
+	a := NewAuthenticator(srvPK, srvSK, nil)
+
+	ch, err := a.Challenge(clientPK)
+	require.NoError(t, err)
+
+	// A challenge which is signed by another key is rejected.
+	_, otherSK := cipher.GenerateKeyPair()
+	sig, err := SignChallenge(ch, otherSK)
+	require.NoError(t, err)
+	_, err = a.Login(clientPK, ch.Nonce, sig)
+	require.Equal(t, ErrInvalidSignature, err)
+
+	// The challenge is consumed by a login attempt.
+	sig, err = SignChallenge(ch, clientSK)
+	require.NoError(t, err)
+	_, err = a.Login(clientPK, ch.Nonce, sig)
+	require.Equal(t, ErrChallengeNotFound, err)
+
+	ch, err = a.Challenge(clientPK)
+	require.NoError(t, err)
+	sig, err = SignChallenge(ch, clientSK)
+	require.NoError(t, err)
+	token, err := a.Login(clientPK, ch.Nonce, sig)
+	require.NoError(t, err)
+
+	pk, err := a.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, clientPK, pk)
+
+	// Tokens of other services are rejected.
+	otherPK, otherSK := cipher.GenerateKeyPair()
+	_, err = NewAuthenticator(otherPK, otherSK, nil).Verify(token)
+	require.Equal(t, ErrInvalidToken, err)
+
+	expired, err := a.issueToken(clientPK, time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	_, err = a.Verify(expired)
+	require.Equal(t, ErrTokenExpired, err)
+}
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	clientPK, _ := cipher.GenerateKeyPair()
+	a := NewAuthenticator(srvPK, srvSK, nil)
+
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pk, ok := ClientPK(r.Context())
+		require.True(t, ok)
+		require.Equal(t, clientPK, pk)
+	}))
+
+	token, err := a.issueToken(clientPK, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	for auth, code := range map[string]int{
+		"":                http.StatusUnauthorized,
+		"Bearer invalid":  http.StatusUnauthorized,
+		"Bearer " + token: http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		require.Equal(t, code, rec.Code, auth)
+	}
+}
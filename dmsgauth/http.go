@@ -0,0 +1,38 @@
+package dmsgauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/httputil"
+)
+
+type ctxKey struct{}
+
+// Middleware authenticates requests with the session token of the "Authorization: Bearer <token>" header.
+// The public key of the client is added to the request context (see ClientPK).
+// Requests without a valid session token are responded to with 401 Unauthorized.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "Bearer "
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, prefix) {
+			httputil.WriteJSON(w, r, http.StatusUnauthorized, ErrInvalidToken)
+			return
+		}
+		clientPK, err := a.Verify(strings.TrimPrefix(auth, prefix))
+		if err != nil {
+			httputil.WriteJSON(w, r, http.StatusUnauthorized, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey{}, clientPK)))
+	})
+}
+
+// ClientPK obtains the public key of the client, as authenticated by Middleware.
+func ClientPK(ctx context.Context) (cipher.PubKey, bool) {
+	pk, ok := ctx.Value(ctxKey{}).(cipher.PubKey)
+	return pk, ok
+}
@@ -0,0 +1,132 @@
+// Package dmsgerr contains the error type of dmsg, whose errors are identified by codes which are shared by both ends
+// of the wire (such as in stream responses). It only depends on the standard library, so that packages which are
+// consumed on their own (such as disc) may use it.
+//
+// Codes are grouped by range:
+//
+//	1xx: dmsg discovery
+//	2xx: dmsg entities (clients, servers and their sessions)
+//	3xx: stream requests and responses
+//	4xx: listeners
+//	5xx: audit logs
+//
+// Errors support errors.Is (matching by code, regardless of wrapped errors) and errors.As (to obtain the Error or
+// Code of any error which wraps one).
+package dmsgerr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Code identifies a dmsg error.
+type Code uint16
+
+var (
+	registry = make(map[Code]Error)
+	mx       sync.RWMutex
+)
+
+// Register registers a new error of the given code and message. It panics if the code is already registered.
+func Register(code Code, msg string) Error {
+	return register(Error{code: code, msg: msg})
+}
+
+// RegisterTemporary is Register, but the error is temporary (the operation which failed may be retried).
+func RegisterTemporary(code Code, msg string) Error {
+	return register(Error{code: code, msg: msg, temp: true})
+}
+
+func register(e Error) Error {
+	mx.Lock()
+	defer mx.Unlock()
+
+	if _, ok := registry[e.code]; ok {
+		panic(fmt.Errorf("error of code %d already exists", e.code))
+	}
+	registry[e.code] = e
+	return e
+}
+
+// FromCode returns the registered error of the given code (if exists).
+func FromCode(code Code) (Error, bool) {
+	mx.RLock()
+	e, ok := registry[code]
+	mx.RUnlock()
+	return e, ok
+}
+
+// CodeOf returns the code of the first dmsg error in the chain of 'err', and whether one is found.
+func CodeOf(err error) (Code, bool) {
+	var e Error
+	if !errors.As(err, &e) {
+		return 0, false
+	}
+	return e.code, true
+}
+
+// Error represents a dmsg-related error.
+type Error struct {
+	code Code
+	msg  string
+	temp bool
+	nxt  error
+}
+
+// Error implements error
+func (e Error) Error() string {
+	return fmt.Sprintf("dmsg error %d - %s", e.code, e.errorString())
+}
+
+func (e Error) errorString() string {
+	msg := e.msg
+	if e.nxt != nil {
+		if nxt, ok := e.nxt.(Error); ok {
+			msg += ": " + nxt.errorString()
+		} else {
+			msg += ": " + e.nxt.Error()
+		}
+	}
+	return msg
+}
+
+// Code returns the code of the error.
+func (e Error) Code() Code {
+	return e.code
+}
+
+// Message returns the message of the error (without the message of the wrapped error).
+func (e Error) Message() string {
+	return e.msg
+}
+
+// Timeout implements net.Error
+// The error is a timeout if the error it wraps is a timeout.
+func (e Error) Timeout() bool {
+	netErr, ok := e.nxt.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+// Temporary implements net.Error
+func (e Error) Temporary() bool {
+	return e.temp
+}
+
+// Wrap wraps an error and returns the new error.
+func (e Error) Wrap(err error) Error {
+	e.nxt = err
+	return e
+}
+
+// Unwrap returns the wrapped error (if any).
+func (e Error) Unwrap() error {
+	return e.nxt
+}
+
+// Is reports whether the target is a dmsg error of the same code.
+func (e Error) Is(target error) bool {
+	t, ok := target.(Error)
+	return ok && t.code == e.code
+}
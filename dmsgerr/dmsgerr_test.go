@@ -0,0 +1,64 @@
+package dmsgerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var (
+	errTest     = Register(900, "test error")
+	errTestTemp = RegisterTemporary(901, "temporary test error")
+)
+
+func TestError(t *testing.T) {
+	err := fmt.Errorf("failed: %w", errTest.Wrap(io.EOF))
+
+	if !errors.Is(err, errTest) {
+		t.Error("expected wrapped error to match by code")
+	}
+	if !errors.Is(err, io.EOF) {
+		t.Error("expected errors.Is to reach the error wrapped by the dmsg error")
+	}
+	if errors.Is(err, errTestTemp) {
+		t.Error("expected errors of different codes not to match")
+	}
+	if code, ok := CodeOf(err); !ok || code != 900 {
+		t.Errorf("CodeOf() = (%d, %v), expected (900, true)", code, ok)
+	}
+	if _, ok := CodeOf(io.EOF); ok {
+		t.Error("expected CodeOf to not find a code of a non-dmsg error")
+	}
+	if got, want := errTest.Wrap(io.EOF).Error(), "dmsg error 900 - test error: EOF"; got != want {
+		t.Errorf("Error() = %q, expected %q", got, want)
+	}
+}
+
+func TestError_NetError(t *testing.T) {
+	if errTest.Temporary() || !errTestTemp.Temporary() {
+		t.Error("unexpected Temporary()")
+	}
+	if errTest.Timeout() || !errTest.Wrap(context.DeadlineExceeded).Timeout() {
+		t.Error("unexpected Timeout()")
+	}
+}
+
+func TestFromCode(t *testing.T) {
+	if e, ok := FromCode(901); !ok || e != errTestTemp {
+		t.Errorf("FromCode(901) = (%v, %v), expected (%v, true)", e, ok, errTestTemp)
+	}
+	if _, ok := FromCode(999); ok {
+		t.Error("expected unregistered code to not be found")
+	}
+}
+
+func TestRegister_Duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering a duplicate code to panic")
+		}
+	}()
+	Register(900, "duplicate")
+}
@@ -0,0 +1,561 @@
+// Package dmsglan implements discovery of dmsg entities on the local network via multicast DNS (mDNS).
+//
+// Entities announce their signed discovery entries on the LAN, and browse for the entries of others, so that dmsg
+// clients and servers of the same LAN find one another without dmsg discovery (such as at events and labs with no
+// internet access). As dmsg clients connect to one another via dmsg servers, the LAN needs at least one dmsg server
+// which advertises an address that is reachable from the LAN.
+//
+// Discovery implements disc.APIClient, so that it can be used in place of (or in front of) dmsg discovery, and
+// dmsg.Resolver, so that clients of dmsg discovery may resolve the entries of LAN peers locally.
+package dmsglan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+var log = logging.MustGetLogger("dmsglan")
+
+const (
+	// DefaultAddr is the mDNS multicast group address.
+	DefaultAddr = "224.0.0.251:5353"
+
+	// DefaultService is the DNS-SD service type of dmsg entries.
+	DefaultService = "_dmsg._udp.local."
+
+	// DefaultAnnounceInterval is the default interval of announcing and browsing.
+	DefaultAnnounceInterval = time.Second * 30
+
+	// DefaultEntryTTL is the default TTL of announced entries.
+	DefaultEntryTTL = time.Minute * 2
+
+	// DefaultQueryTimeout is the default time to wait for responses to queries.
+	DefaultQueryTimeout = time.Second
+)
+
+// ErrClosed is returned by methods of a closed Discovery.
+var ErrClosed = errors.New("lan discovery is closed")
+
+// Config configures Discovery.
+type Config struct {
+	// Addr is the multicast group address of mDNS messages.
+	Addr string
+
+	// Interface is the network interface to join the multicast group on. If nil, the system default is used.
+	Interface *net.Interface
+
+	// Service is the DNS-SD service type which entries are announced as.
+	// Entities of different dmsg networks on the same LAN may use different services.
+	Service string
+
+	// AnnounceInterval is the interval of re-announcing own entries and browsing for the entries of others.
+	AnnounceInterval time.Duration
+
+	// EntryTTL is the TTL of own entries. Entries of others expire once their TTL passes without being re-announced.
+	EntryTTL time.Duration
+
+	// QueryTimeout is the time to wait for responses to queries of entries which are not yet known.
+	QueryTimeout time.Duration
+}
+
+// DefaultConfig returns the default config.
+func DefaultConfig() *Config {
+	return &Config{
+		Addr:             DefaultAddr,
+		Service:          DefaultService,
+		AnnounceInterval: DefaultAnnounceInterval,
+		EntryTTL:         DefaultEntryTTL,
+		QueryTimeout:     DefaultQueryTimeout,
+	}
+}
+
+func (c *Config) fillDefaults() {
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+	if c.Service == "" {
+		c.Service = DefaultService
+	}
+	if c.AnnounceInterval <= 0 {
+		c.AnnounceInterval = DefaultAnnounceInterval
+	}
+	if c.EntryTTL <= 0 {
+		c.EntryTTL = DefaultEntryTTL
+	}
+	if c.QueryTimeout <= 0 {
+		c.QueryTimeout = DefaultQueryTimeout
+	}
+}
+
+// lanEntry is an entry announced by another entity of the LAN.
+type lanEntry struct {
+	entry  *disc.Entry
+	expiry time.Time
+}
+
+// Discovery announces entries on the LAN (those which are set with SetEntry and UpdateEntry), and browses for the
+// entries of others.
+//
+// If Discovery has an upstream (dmsg discovery), entries are set in the upstream before they are announced, and
+// lookups fall back to the LAN only if the upstream fails. Otherwise, Discovery operates on the LAN only.
+type Discovery struct {
+	conf     Config
+	upstream disc.APIClient
+	conn     *net.UDPConn // joined to the multicast group
+	sendConn *net.UDPConn // sends to the multicast group (the source address of 'conn' is the group address)
+	group    *net.UDPAddr
+	service  dnsmessage.Name
+
+	own     map[cipher.PubKey]*disc.Entry // entries announced by this instance
+	entries map[cipher.PubKey]*lanEntry   // entries announced by others
+	update  chan struct{}                 // closed (and replaced) whenever an entry of others is added
+	mx      sync.Mutex
+
+	done chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// New joins the mDNS multicast group and starts browsing for entries. 'upstream' is optional.
+// If the config is nil, the default config is used.
+func New(upstream disc.APIClient, conf *Config) (*Discovery, error) {
+	if conf == nil {
+		conf = DefaultConfig()
+	}
+	d := &Discovery{
+		conf:     *conf,
+		upstream: upstream,
+		own:      make(map[cipher.PubKey]*disc.Entry),
+		entries:  make(map[cipher.PubKey]*lanEntry),
+		update:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	d.conf.fillDefaults()
+
+	var err error
+	if d.service, err = dnsmessage.NewName(d.conf.Service); err != nil {
+		return nil, err
+	}
+	if d.group, err = net.ResolveUDPAddr("udp4", d.conf.Addr); err != nil {
+		return nil, err
+	}
+	if d.conn, err = net.ListenMulticastUDP("udp4", d.conf.Interface, d.group); err != nil {
+		return nil, err
+	}
+	if d.sendConn, err = net.ListenUDP("udp4", nil); err != nil {
+		_ = d.conn.Close() //nolint:errcheck
+		return nil, err
+	}
+	if d.conf.Interface != nil {
+		if err := ipv4.NewPacketConn(d.sendConn).SetMulticastInterface(d.conf.Interface); err != nil {
+			_ = d.conn.Close()     //nolint:errcheck
+			_ = d.sendConn.Close() //nolint:errcheck
+			return nil, err
+		}
+	}
+
+	d.wg.Add(2)
+	go d.readLoop()
+	go d.announceLoop()
+	return d, nil
+}
+
+// Entry returns the entry of the public key, from those known of the LAN, the upstream, or by querying the LAN.
+func (d *Discovery) Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	if entry, ok := d.entry(pk); ok {
+		return entry, nil
+	}
+	if d.upstream == nil {
+		return d.query(ctx, pk)
+	}
+	entry, err := d.upstream.Entry(ctx, pk)
+	if err == nil {
+		return entry, nil
+	}
+	if entry, qErr := d.query(ctx, pk); qErr == nil {
+		return entry, nil
+	}
+	return nil, err
+}
+
+// Resolve implements dmsg.Resolver
+// It only resolves entries of the LAN (without the upstream).
+func (d *Discovery) Resolve(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	if entry, ok := d.entry(pk); ok {
+		return entry, nil
+	}
+	return d.query(ctx, pk)
+}
+
+// SetEntry sets the entry in the upstream (if any) and announces it on the LAN.
+func (d *Discovery) SetEntry(ctx context.Context, e *disc.Entry) error {
+	if isClosed(d.done) {
+		return ErrClosed
+	}
+	if d.upstream != nil {
+		if err := d.upstream.SetEntry(ctx, e); err != nil {
+			return err
+		}
+	} else if err := d.validateOwn(e); err != nil {
+		return err
+	}
+	d.setOwn(e)
+	return nil
+}
+
+// UpdateEntry updates the entry in the upstream (if any), and announces it on the LAN.
+func (d *Discovery) UpdateEntry(ctx context.Context, sk cipher.SecKey, e *disc.Entry) error {
+	if d.upstream != nil {
+		if err := d.upstream.UpdateEntry(ctx, sk, e); err != nil {
+			return err
+		}
+		d.setOwn(e)
+		return nil
+	}
+
+	e.Sequence++
+	e.Timestamp = time.Now().UnixNano()
+	if err := e.Sign(sk); err != nil {
+		e.Sequence--
+		return err
+	}
+	if err := d.SetEntry(ctx, e); err != nil {
+		e.Sequence--
+		return err
+	}
+	return nil
+}
+
+// AvailableServers returns the available servers of the LAN, followed by those of the upstream (if any).
+// If no servers of the LAN are known and there is no upstream, the LAN is browsed for servers first.
+func (d *Discovery) AvailableServers(ctx context.Context, opts ...disc.ServersOption) ([]*disc.Entry, error) {
+	servers := d.servers()
+	if len(servers) == 0 && d.upstream == nil {
+		d.browse()
+		select {
+		case <-time.After(d.conf.QueryTimeout):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-d.done:
+			return nil, ErrClosed
+		}
+		servers = d.servers()
+	}
+
+	if d.upstream != nil {
+		upServers, err := d.upstream.AvailableServers(ctx, opts...)
+		if err != nil && len(servers) == 0 {
+			return nil, err
+		}
+		known := make(map[cipher.PubKey]bool, len(servers))
+		for _, entry := range servers {
+			known[entry.Static] = true
+		}
+		for _, entry := range upServers {
+			if !known[entry.Static] {
+				servers = append(servers, entry)
+			}
+		}
+	}
+
+	if q := disc.MakeServersQuery(opts...); !q.IsEmpty() {
+		return q.Apply(servers), nil
+	}
+	return servers, nil
+}
+
+// Close withdraws the announced entries from the LAN and leaves the multicast group.
+func (d *Discovery) Close() error {
+	err := ErrClosed
+	d.once.Do(func() {
+		close(d.done)
+		d.announce(d.ownEntries(), 0)
+
+		err = d.conn.Close()
+		if sErr := d.sendConn.Close(); err == nil {
+			err = sErr
+		}
+		d.wg.Wait()
+	})
+	return err
+}
+
+// setOwn stores a copy of the entry as an own entry, and announces it.
+func (d *Discovery) setOwn(e *disc.Entry) {
+	entry := new(disc.Entry)
+	disc.Copy(entry, e)
+	d.mx.Lock()
+	d.own[entry.Static] = entry
+	d.mx.Unlock()
+
+	d.announce([]*disc.Entry{entry}, d.ttl())
+}
+
+func (d *Discovery) ownEntries() []*disc.Entry {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	own := make([]*disc.Entry, 0, len(d.own))
+	for _, entry := range d.own {
+		own = append(own, entry)
+	}
+	return own
+}
+
+// expire removes the entries of others of which the TTL has passed.
+func (d *Discovery) expire() {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	now := time.Now()
+	for pk, lanEntry := range d.entries {
+		if now.After(lanEntry.expiry) {
+			delete(d.entries, pk)
+		}
+	}
+}
+
+// entry returns a copy of the known entry of the public key.
+func (d *Discovery) entry(pk cipher.PubKey) (*disc.Entry, bool) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return d.entryLocked(pk)
+}
+
+func (d *Discovery) entryLocked(pk cipher.PubKey) (*disc.Entry, bool) {
+	src, ok := d.own[pk]
+	if !ok {
+		lanEntry, ok := d.entries[pk]
+		if !ok || time.Now().After(lanEntry.expiry) {
+			return nil, false
+		}
+		src = lanEntry.entry
+	}
+	entry := new(disc.Entry)
+	disc.Copy(entry, src)
+	return entry, true
+}
+
+// servers returns copies of the known entries of available servers.
+func (d *Discovery) servers() []*disc.Entry {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	now := time.Now()
+	servers := make([]*disc.Entry, 0)
+	add := func(src *disc.Entry) {
+		if src.Server == nil || src.Server.AvailableConnections <= 0 {
+			return
+		}
+		entry := new(disc.Entry)
+		disc.Copy(entry, src)
+		servers = append(servers, entry)
+	}
+	for _, entry := range d.own {
+		add(entry)
+	}
+	for _, lanEntry := range d.entries {
+		if now.Before(lanEntry.expiry) {
+			add(lanEntry.entry)
+		}
+	}
+	return servers
+}
+
+// query queries the LAN for the entry of the public key, and waits for it to be announced.
+func (d *Discovery) query(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	if isClosed(d.done) {
+		return nil, ErrClosed
+	}
+	instance, err := instanceName(d.service, pk)
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(d.conf.QueryTimeout)
+	defer timer.Stop()
+
+	for sent := false; ; sent = true {
+		d.mx.Lock()
+		entry, ok := d.entryLocked(pk)
+		update := d.update
+		d.mx.Unlock()
+		if ok {
+			return entry, nil
+		}
+		if !sent {
+			d.send(packQuery(instance, dnsmessage.TypeTXT))
+		}
+
+		select {
+		case <-update:
+		case <-timer.C:
+			return nil, disc.ErrKeyNotFound
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-d.done:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// validateOwn validates an entry which is set without an upstream, as dmsg discovery would.
+func (d *Discovery) validateOwn(e *disc.Entry) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if err := e.VerifySignature(); err != nil {
+		return disc.ErrUnauthorized
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	if prev, ok := d.own[e.Static]; ok {
+		return prev.ValidateIteration(e)
+	}
+	return nil
+}
+
+// observe adds an entry announced by another entity, if it is valid and not older than the known entry.
+// A TTL of 0 withdraws the entry.
+func (d *Discovery) observe(entry *disc.Entry, ttl uint32) {
+	if err := entry.Validate(); err != nil {
+		return
+	}
+	if err := entry.VerifySignature(); err != nil {
+		log.WithError(err).WithField("pk", entry.Static).Debug("Ignoring entry with invalid signature.")
+		return
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if _, ok := d.own[entry.Static]; ok {
+		return
+	}
+	if prev, ok := d.entries[entry.Static]; ok && prev.entry.Sequence > entry.Sequence {
+		return
+	}
+	if ttl == 0 {
+		delete(d.entries, entry.Static)
+		return
+	}
+	d.entries[entry.Static] = &lanEntry{entry: entry, expiry: time.Now().Add(time.Duration(ttl) * time.Second)}
+	close(d.update)
+	d.update = make(chan struct{})
+}
+
+// answer announces the own entries which are asked for by the questions of a query.
+func (d *Discovery) answer(qs []dnsmessage.Question) {
+	d.mx.Lock()
+	var entries []*disc.Entry
+	for pk, entry := range d.own {
+		instance, err := instanceName(d.service, pk)
+		if err != nil {
+			continue
+		}
+		for _, q := range qs {
+			asked := (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL) && equalNames(q.Name, d.service) ||
+				(q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL) && equalNames(q.Name, instance)
+			if asked {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	d.mx.Unlock()
+
+	d.announce(entries, d.ttl())
+}
+
+// announce multicasts an announcement of each of the entries.
+func (d *Discovery) announce(entries []*disc.Entry, ttl uint32) {
+	for _, entry := range entries {
+		d.send(packAnnouncement(d.service, entry, ttl))
+	}
+}
+
+// browse multicasts a query for the entries of the service.
+func (d *Discovery) browse() {
+	d.send(packQuery(d.service, dnsmessage.TypePTR))
+}
+
+// send multicasts a packed message, logging failures (as messages may be lost anyway).
+func (d *Discovery) send(msg []byte, err error) {
+	if err == nil {
+		_, err = d.sendConn.WriteToUDP(msg, d.group)
+	}
+	if err != nil && !isClosed(d.done) {
+		log.WithError(err).Warn("Failed to send mDNS message.")
+	}
+}
+
+func (d *Discovery) ttl() uint32 {
+	return uint32(d.conf.EntryTTL / time.Second)
+}
+
+func (d *Discovery) readLoop() {
+	defer d.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			if nErr, ok := err.(net.Error); ok && nErr.Temporary() {
+				continue
+			}
+			if !isClosed(d.done) {
+				log.WithError(err).Error("Failed to read mDNS message.")
+			}
+			return
+		}
+		qs, anns, err := parseMessage(d.service, buf[:n])
+		if err != nil {
+			continue // not every message of the group is necessarily valid
+		}
+		if len(qs) > 0 {
+			d.answer(qs)
+		}
+		for _, ann := range anns {
+			d.observe(ann.entry, ann.ttl)
+		}
+	}
+}
+
+func (d *Discovery) announceLoop() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.conf.AnnounceInterval)
+	defer ticker.Stop()
+
+	d.browse()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.expire()
+			d.announce(d.ownEntries(), d.ttl())
+			d.browse()
+		}
+	}
+}
+
+func isClosed(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
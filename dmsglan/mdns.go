@@ -0,0 +1,161 @@
+package dmsglan
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// maxPacketSize is the maximum size of mDNS messages (RFC 6762, section 17).
+const maxPacketSize = 9000
+
+// maxTXTStringLen is the maximum length of a character string of TXT records.
+const maxTXTStringLen = 255
+
+// ErrInvalidTXT is returned when the TXT record of an announcement does not hold an entry.
+var ErrInvalidTXT = errors.New("TXT record does not hold a dmsg entry")
+
+// instanceEncoding encodes public keys as DNS labels (a hex-encoded public key exceeds the 63 byte limit of labels).
+var instanceEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// instanceName returns the service instance name of the public key, as '<base32-pk>.<service>'.
+func instanceName(service dnsmessage.Name, pk cipher.PubKey) (dnsmessage.Name, error) {
+	label := strings.ToLower(instanceEncoding.EncodeToString(pk[:]))
+	return dnsmessage.NewName(label + "." + service.String())
+}
+
+// equalNames returns true if the names are equal (DNS names are case insensitive).
+func equalNames(a, b dnsmessage.Name) bool {
+	return strings.EqualFold(a.String(), b.String())
+}
+
+// encodeEntry encodes the entry as JSON, split into the character strings of a TXT record.
+func encodeEntry(entry *disc.Entry) ([]string, error) {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	txt := make([]string, 0, len(raw)/maxTXTStringLen+1)
+	for len(raw) > maxTXTStringLen {
+		txt = append(txt, string(raw[:maxTXTStringLen]))
+		raw = raw[maxTXTStringLen:]
+	}
+	return append(txt, string(raw)), nil
+}
+
+// decodeEntry decodes an entry encoded with encodeEntry.
+func decodeEntry(txt []string) (*disc.Entry, error) {
+	entry := new(disc.Entry)
+	if err := json.Unmarshal([]byte(strings.Join(txt, "")), entry); err != nil {
+		return nil, ErrInvalidTXT
+	}
+	return entry, nil
+}
+
+// packQuery packs an mDNS query for the records of the type of the name.
+func packQuery(name dnsmessage.Name, typ dnsmessage.Type) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: typ, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// packAnnouncement packs an mDNS response which announces the entry, as the PTR record of the service pointing to the
+// instance of the entry's public key, and the TXT record of the instance holding the entry.
+// A TTL of 0 announces that the entry is withdrawn (a "goodbye" packet).
+func packAnnouncement(service dnsmessage.Name, entry *disc.Entry, ttl uint32) ([]byte, error) {
+	instance, err := instanceName(service, entry.Static)
+	if err != nil {
+		return nil, err
+	}
+	txt, err := encodeEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	b := dnsmessage.NewBuilder(make([]byte, 0, 1024), dnsmessage.Header{Response: true, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+	ptrHdr := dnsmessage.ResourceHeader{Name: service, Class: dnsmessage.ClassINET, TTL: ttl}
+	if err := b.PTRResource(ptrHdr, dnsmessage.PTRResource{PTR: instance}); err != nil {
+		return nil, err
+	}
+	txtHdr := dnsmessage.ResourceHeader{Name: instance, Class: dnsmessage.ClassINET, TTL: ttl}
+	if err := b.TXTResource(txtHdr, dnsmessage.TXTResource{TXT: txt}); err != nil {
+		return nil, err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) > maxPacketSize {
+		return nil, errors.New("entry is too large to be announced")
+	}
+	return msg, nil
+}
+
+// announcement is an entry announced in an mDNS response.
+type announcement struct {
+	entry *disc.Entry
+	ttl   uint32
+}
+
+// parseMessage parses an mDNS message. Queries return their questions, and responses return the entries of their TXT
+// records which are of instances of the service. Entries are not verified.
+func parseMessage(service dnsmessage.Name, msg []byte) ([]dnsmessage.Question, []announcement, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !h.Response {
+		qs, err := p.AllQuestions()
+		return qs, nil, err
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, nil, err
+	}
+
+	var anns []announcement
+	for {
+		rh, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			return nil, anns, nil
+		}
+		if err != nil {
+			return nil, anns, err
+		}
+		if rh.Type != dnsmessage.TypeTXT {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, anns, err
+			}
+			continue
+		}
+		txt, err := p.TXTResource()
+		if err != nil {
+			return nil, anns, err
+		}
+		entry, err := decodeEntry(txt.TXT)
+		if err != nil {
+			continue // TXT records of other services may share the name
+		}
+		instance, err := instanceName(service, entry.Static)
+		if err != nil || !equalNames(instance, rh.Name) {
+			continue
+		}
+		anns = append(anns, announcement{entry: entry, ttl: rh.TTL})
+	}
+}
@@ -0,0 +1,61 @@
+package dmsglan
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestAnnouncement(t *testing.T) {
+	service := dnsmessage.MustNewName(DefaultService)
+
+	pk, _ := cipher.GenerateKeyPair()
+	srvPKs := make([]cipher.PubKey, 8)
+	for i := range srvPKs {
+		srvPKs[i], _ = cipher.GenerateKeyPair()
+	}
+	entry := disc.NewClientEntry(pk, 3, srvPKs) // large enough to be split into multiple TXT strings
+	entry.Signature = strings.Repeat("a", 130)
+
+	t.Run("response", func(t *testing.T) {
+		msg, err := packAnnouncement(service, entry, 120)
+		require.NoError(t, err)
+
+		qs, anns, err := parseMessage(service, msg)
+		require.NoError(t, err)
+		require.Empty(t, qs)
+		require.Len(t, anns, 1)
+		require.Equal(t, uint32(120), anns[0].ttl)
+		require.Equal(t, entry, anns[0].entry)
+	})
+
+	t.Run("other_service", func(t *testing.T) {
+		msg, err := packAnnouncement(dnsmessage.MustNewName("_other._udp.local."), entry, 120)
+		require.NoError(t, err)
+
+		_, anns, err := parseMessage(service, msg)
+		require.NoError(t, err)
+		require.Empty(t, anns)
+	})
+
+	t.Run("query", func(t *testing.T) {
+		instance, err := instanceName(service, pk)
+		require.NoError(t, err)
+		require.True(t, len(strings.Split(instance.String(), ".")[0]) <= 63)
+
+		msg, err := packQuery(instance, dnsmessage.TypeTXT)
+		require.NoError(t, err)
+
+		qs, anns, err := parseMessage(service, msg)
+		require.NoError(t, err)
+		require.Empty(t, anns)
+		require.Len(t, qs, 1)
+		require.True(t, equalNames(instance, qs[0].Name))
+		require.Equal(t, dnsmessage.TypeTXT, qs[0].Type)
+	})
+}
@@ -1,5 +1,7 @@
 package dmsgpty
 
+import "github.com/SkycoinProject/dmsg/ports"
+
 // Constants related to pty.
 const (
 	PtyRPCName  = "pty"
@@ -21,6 +23,6 @@ const (
 
 // Constants related to dmsg.
 const (
-	DefaultPort = uint16(22)
+	DefaultPort = ports.PTY
 	DefaultCmd  = "/bin/bash"
 )
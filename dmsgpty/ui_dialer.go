@@ -14,8 +14,8 @@ type UIDialer interface {
 }
 
 // DmsgUIDialer returns a UIDialer that dials with dmsg.
-func DmsgUIDialer(dmsgC *dmsg.Client, rAddr dmsg.Addr) UIDialer {
-	return &dmsgUIDialer{dmsgC: dmsgC, rAddr: rAddr}
+func DmsgUIDialer(d dmsg.Dialer, rAddr dmsg.Addr) UIDialer {
+	return &dmsgUIDialer{d: d, rAddr: rAddr}
 }
 
 // NetUIDialer returns a UIDialer that dials with stdlib net.
@@ -24,12 +24,12 @@ func NetUIDialer(network, address string) UIDialer {
 }
 
 type dmsgUIDialer struct {
-	dmsgC *dmsg.Client
+	d     dmsg.Dialer
 	rAddr dmsg.Addr
 }
 
 func (d *dmsgUIDialer) Dial() (net.Conn, error) {
-	return d.dmsgC.Dial(context.Background(), d.rAddr)
+	return d.d.Dial(context.Background(), d.rAddr)
 }
 
 func (d *dmsgUIDialer) AddrString() string {
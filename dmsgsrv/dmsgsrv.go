@@ -0,0 +1,127 @@
+// Package dmsgsrv implements discovery of dmsg services by name.
+//
+// Providers of a service register signed records of its name and dmsg address in the service registry of dmsg
+// discovery (see Register and Advertise). Applications then dial services by name with a Resolver, using addresses of
+// the form 'service:<name>' instead of raw public keys.
+package dmsgsrv
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// AddrPrefix is the prefix of addresses which refer to services by name.
+const AddrPrefix = "service:"
+
+// ErrNoProviders is returned when dialing a service of which no provider can be dialed.
+var ErrNoProviders = errors.New("no provider of service can be dialed")
+
+// ParseAddr returns the service name of the address if it is of the form 'service:<name>'.
+func ParseAddr(addr string) (name string, ok bool) {
+	if !strings.HasPrefix(addr, AddrPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, AddrPrefix), true
+}
+
+// Register registers the service of the name as provided on the dmsg address, of which 'sk' is the secret key.
+func Register(ctx context.Context, sc disc.ServiceAPIClient, name string, addr dmsg.Addr, sk cipher.SecKey) error {
+	r := disc.NewServiceRecord(name, addr.PK, addr.Port)
+	if err := r.Sign(sk); err != nil {
+		return err
+	}
+	return sc.SetService(ctx, r)
+}
+
+// Advertise registers the service, and registers it again well within disc.ServiceTTL until the context is canceled.
+// Only the error of the first registration is returned; later errors are logged, as the following attempt may succeed.
+func Advertise(ctx context.Context, sc disc.ServiceAPIClient, name string, addr dmsg.Addr, sk cipher.SecKey,
+	log logrus.FieldLogger) error {
+
+	if err := Register(ctx, sc, name, addr, sk); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(disc.ServiceTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := Register(ctx, sc, name, addr, sk); err != nil && ctx.Err() == nil {
+				log.WithError(err).WithField("service", name).Warn("Failed to register service.")
+			}
+		}
+	}
+}
+
+// Resolver resolves service names into the dmsg addresses of their providers.
+type Resolver struct {
+	sc disc.ServiceAPIClient
+}
+
+// NewResolver returns a Resolver which looks up services in the service registry of 'sc'.
+func NewResolver(sc disc.ServiceAPIClient) *Resolver {
+	return &Resolver{sc: sc}
+}
+
+// Resolve returns the addresses of the providers of the service name, of which the most recently registered come
+// first. Records are verified locally, so that a registry cannot point services to other addresses.
+func (r *Resolver) Resolve(ctx context.Context, name string) ([]dmsg.Addr, error) {
+	records, err := r.sc.Services(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	records = disc.ValidServices(name, records, time.Now())
+	if len(records) == 0 {
+		return nil, disc.ErrServiceNotFound
+	}
+	addrs := make([]dmsg.Addr, len(records))
+	for i, rec := range records {
+		addrs[i] = dmsg.Addr{PK: rec.PK, Port: rec.Port}
+	}
+	return addrs, nil
+}
+
+// ResolveAddr resolves an address of the form 'service:<name>', or parses an address of the form '<pk>:<port>'.
+func (r *Resolver) ResolveAddr(ctx context.Context, addr string) ([]dmsg.Addr, error) {
+	if name, ok := ParseAddr(addr); ok {
+		return r.Resolve(ctx, name)
+	}
+	var a dmsg.Addr
+	if err := a.Set(addr); err != nil {
+		return nil, err
+	}
+	return []dmsg.Addr{a}, nil
+}
+
+// Dial dials the address (see ResolveAddr) with the dmsg dialer. The providers of a service are dialed in order until
+// one succeeds.
+func (r *Resolver) Dial(ctx context.Context, d dmsg.Dialer, addr string) (net.Conn, error) {
+	addrs, err := r.ResolveAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 1 {
+		return d.Dial(ctx, addrs[0])
+	}
+	for _, a := range addrs {
+		conn, err := d.Dial(ctx, a)
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, ErrNoProviders
+}
@@ -0,0 +1,52 @@
+package dmsgsrv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/disc"
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+func TestResolver(t *testing.T) {
+	const port = uint16(80)
+
+	env := dmsgtest.NewEnv(t, dmsgtest.DefaultTimeout)
+	require.NoError(t, env.Startup(1, 2, nil))
+	defer env.Shutdown()
+
+	dcA := env.AllClients()[0]
+	dcB := env.AllClients()[1]
+	sc := disc.NewServiceMock()
+	r := NewResolver(sc)
+
+	lis, err := dcB.Listen(port)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	_, err = r.Resolve(context.TODO(), "echo")
+	require.Equal(t, disc.ErrServiceNotFound, err)
+
+	addrB := dmsg.Addr{PK: dcB.LocalPK(), Port: port}
+	require.NoError(t, Register(context.TODO(), sc, "echo", addrB, dcB.LocalSK()))
+
+	// A record of another public key is rejected.
+	err = Register(context.TODO(), sc, "echo", dmsg.Addr{PK: dcA.LocalPK(), Port: port}, dcB.LocalSK())
+	require.Equal(t, disc.ErrUnauthorized, err)
+
+	addrs, err := r.Resolve(context.TODO(), "echo")
+	require.NoError(t, err)
+	require.Equal(t, []dmsg.Addr{addrB}, addrs)
+
+	addrs, err = r.ResolveAddr(context.TODO(), addrB.String())
+	require.NoError(t, err)
+	require.Equal(t, []dmsg.Addr{addrB}, addrs)
+
+	conn, err := r.Dial(context.TODO(), dcA, AddrPrefix+"echo")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+	require.Equal(t, addrB, conn.RemoteAddr())
+}
@@ -0,0 +1,141 @@
+package dmsgtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+)
+
+// VirtualClock is a dmsg.Clock of which the time only passes when advanced (see Advance).
+// Passing it to dmsg entities (via the Clock fields of dmsg.Config and dmsg.ServerConfig) makes tests of their timers
+// (such as entry updates and retry back-offs) fast and deterministic.
+type VirtualClock struct {
+	now    time.Time
+	timers []*virtualTimer
+	mx     sync.Mutex
+	cond   *sync.Cond // broadcasts when timers are added
+}
+
+// NewVirtualClock creates a new VirtualClock starting at the given time.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	c := &VirtualClock{now: start}
+	c.cond = sync.NewCond(&c.mx)
+	return c
+}
+
+// Now implements dmsg.Clock
+func (c *VirtualClock) Now() time.Time {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.now
+}
+
+// After implements dmsg.Clock
+func (c *VirtualClock) After(d time.Duration) <-chan time.Time {
+	return c.addTimer(d, 0).ch
+}
+
+// NewTicker implements dmsg.Clock
+func (c *VirtualClock) NewTicker(d time.Duration) dmsg.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for VirtualClock.NewTicker")
+	}
+	return c.addTimer(d, d)
+}
+
+// Advance moves the time forward by 'd'. Timers which are due are fired in order of their deadlines.
+// As with time.Ticker, ticks are dropped for tickers which are not read from.
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	end := c.now.Add(d)
+	for {
+		var next *virtualTimer
+		for _, t := range c.timers {
+			if !t.at.After(end) && (next == nil || t.at.Before(next.at)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		c.now = next.at
+		next.fire(c.now)
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			c.removeTimer(next)
+		}
+	}
+	c.now = end
+}
+
+// Timers returns the number of pending timers (including tickers).
+func (c *VirtualClock) Timers() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil blocks until there are at least 'n' pending timers. This allows tests to wait for the goroutines of
+// entities to start waiting on the clock before advancing it.
+func (c *VirtualClock) BlockUntil(n int) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+func (c *VirtualClock) addTimer(d, period time.Duration) *virtualTimer {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	t := &virtualTimer{clock: c, at: c.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	if d <= 0 && period == 0 {
+		t.fire(c.now)
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// removeTimer removes the timer. It is expected that c.mx is locked.
+func (c *VirtualClock) removeTimer(t *virtualTimer) {
+	for i, t2 := range c.timers {
+		if t2 == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// virtualTimer is a timer (or ticker, if period is positive) of a VirtualClock.
+type virtualTimer struct {
+	clock  *VirtualClock
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+func (t *virtualTimer) fire(now time.Time) {
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
+
+// Chan implements dmsg.Ticker
+func (t *virtualTimer) Chan() <-chan time.Time {
+	return t.ch
+}
+
+// Stop implements dmsg.Ticker
+func (t *virtualTimer) Stop() {
+	t.clock.mx.Lock()
+	t.clock.removeTimer(t)
+	t.clock.mx.Unlock()
+}
@@ -0,0 +1,50 @@
+package dmsgtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	c := NewVirtualClock(start)
+
+	after := c.After(time.Minute)
+	ticker := c.NewTicker(time.Second * 20)
+	require.Equal(t, 2, c.Timers())
+
+	// Nothing fires before the deadline.
+	c.Advance(time.Second * 10)
+	require.Len(t, after, 0)
+	require.Len(t, ticker.Chan(), 0)
+
+	c.Advance(time.Second * 10)
+	require.Equal(t, start.Add(time.Second*20), <-ticker.Chan())
+
+	// Ticks which are not read from are dropped.
+	c.Advance(time.Minute)
+	require.Equal(t, start.Add(time.Minute), <-after)
+	require.Equal(t, start.Add(time.Second*40), <-ticker.Chan())
+	require.Len(t, ticker.Chan(), 0)
+	require.Equal(t, start.Add(time.Second*80), c.Now())
+	require.Equal(t, 1, c.Timers())
+
+	ticker.Stop()
+	require.Equal(t, 0, c.Timers())
+}
+
+func TestVirtualClock_BlockUntil(t *testing.T) {
+	c := NewVirtualClock(time.Unix(0, 0))
+
+	done := make(chan struct{})
+	go func() {
+		<-c.After(time.Hour)
+		close(done)
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	<-done
+}
@@ -2,6 +2,8 @@ package dmsgtest
 
 import (
 	"context"
+	"fmt"
+	"net/http/httptest"
 	"sort"
 	"sync"
 	"testing"
@@ -11,6 +13,7 @@ import (
 
 	"github.com/SkycoinProject/dmsg"
 	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/cmd/dmsg-discovery/discserver"
 	"github.com/SkycoinProject/dmsg/disc"
 )
 
@@ -22,13 +25,17 @@ type Env struct {
 	t       *testing.T
 	timeout time.Duration
 
-	d  disc.APIClient
-	s  map[cipher.PubKey]*dmsg.Server
-	c  map[cipher.PubKey]*dmsg.Client
-	mx sync.RWMutex
+	seed []byte            // if set, keypairs are generated deterministically from the seed
+	keyN map[string]uint64 // number of keypairs generated per entity type (for deterministic generation)
 
-	sWg sync.WaitGroup // waits for (*dmsg.Server).Serve() to return
-	cWg sync.WaitGroup // waits for (*dmsg.Client).Serve() to return
+	d    disc.APIClient
+	dSrv *httptest.Server // only set when running a real dmsg discovery server
+	s    map[cipher.PubKey]*dmsg.Server
+	c    map[cipher.PubKey]*dmsg.Client
+	mx   sync.RWMutex
+
+	sWg sync.WaitGroup // waits for (*dmsg.Server).ServeContext() to return
+	cWg sync.WaitGroup // waits for (*dmsg.Client).ServeContext() to return
 }
 
 // NewEnv creates a new dmsg environment.
@@ -45,55 +52,129 @@ func NewEnv(t *testing.T, timeout time.Duration) *Env {
 	}
 }
 
+// NewEnvWithSeed is similar to NewEnv, but the keypairs of servers and clients are generated deterministically from
+// the given seed. This makes test failures reproducible across runs.
+// The n-th server (or client) created by the Env will always have the same keypair for a given seed.
+func NewEnvWithSeed(t *testing.T, timeout time.Duration, seed []byte) *Env {
+	env := NewEnv(t, timeout)
+	env.seed = seed
+	env.keyN = make(map[string]uint64)
+	return env
+}
+
+// genKeyPair generates a keypair for an entity of the given type ("server" or "client").
+// It is expected that env.mx is locked.
+func (env *Env) genKeyPair(entityType string) (cipher.PubKey, cipher.SecKey, error) {
+	if env.seed == nil {
+		pk, sk := cipher.GenerateKeyPair()
+		return pk, sk, nil
+	}
+	n := env.keyN[entityType]
+	env.keyN[entityType]++
+	seed := append([]byte(fmt.Sprintf("%s:%d:", entityType, n)), env.seed...)
+	return cipher.GenerateDeterministicKeyPair(seed)
+}
+
 // Startup runs the specified number of dmsg servers and clients.
 // The input 'conf' is optional, and is passed when creating clients.
 func (env *Env) Startup(servers, clients int, conf *dmsg.Config) error {
+	_, _, err := env.startup(disc.NewMock(), make([]*dmsg.ServerConfig, servers), repeatConfig(conf, clients))
+	return err
+}
+
+// StartupWithDiscClient is similar to Startup, but the given discovery client is used instead of a mock discovery.
+// This allows tests to wrap the discovery client, for example, to inject failures.
+func (env *Env) StartupWithDiscClient(dc disc.APIClient, servers, clients int, conf *dmsg.Config) error {
+	_, _, err := env.startup(dc, make([]*dmsg.ServerConfig, servers), repeatConfig(conf, clients))
+	return err
+}
+
+// StartupWithConfigs runs a dmsg server for each of the given server configs, and a dmsg client for each of the given
+// client configs. Nil configs result in the defaults being used.
+// The started servers and clients are returned in the same order as their associated configs.
+func (env *Env) StartupWithConfigs(
+	srvConfs []*dmsg.ServerConfig, cliConfs []*dmsg.Config,
+) ([]*dmsg.Server, []*dmsg.Client, error) {
+	return env.startup(disc.NewMock(), srvConfs, cliConfs)
+}
+
+// StartupWithDiscovery is similar to Startup, but instead of using a mock discovery, a dmsg discovery HTTP server
+// (backed by an in-memory store) is ran on a local listener. This exercises the HTTP discovery client.
+func (env *Env) StartupWithDiscovery(servers, clients int, conf *dmsg.Config) error {
+	h, err := discserver.NewInMemory(true)
+	if err != nil {
+		return err
+	}
+	env.dSrv = httptest.NewServer(h)
+	_, _, err = env.startup(disc.NewHTTP(env.dSrv.URL), make([]*dmsg.ServerConfig, servers), repeatConfig(conf, clients))
+	return err
+}
+
+func (env *Env) startup(
+	dc disc.APIClient, srvConfs []*dmsg.ServerConfig, cliConfs []*dmsg.Config,
+) ([]*dmsg.Server, []*dmsg.Client, error) {
 	ctx, cancel := timeoutContext(env.timeout)
 	defer cancel()
 
 	env.mx.Lock()
 	defer env.mx.Unlock()
 
-	env.d = disc.NewMock()
+	env.d = dc
 
-	for i := 0; i < servers; i++ {
-		if _, err := env.newServer(ctx); err != nil {
-			return err
+	servers := make([]*dmsg.Server, 0, len(srvConfs))
+	for _, conf := range srvConfs {
+		srv, err := env.newServer(ctx, conf)
+		if err != nil {
+			return nil, nil, err
 		}
+		servers = append(servers, srv)
 	}
-	for i := 0; i < clients; i++ {
-		if _, err := env.newClient(ctx, conf); err != nil {
-			return err
+	clients := make([]*dmsg.Client, 0, len(cliConfs))
+	for _, conf := range cliConfs {
+		c, err := env.newClient(ctx, conf)
+		if err != nil {
+			return nil, nil, err
 		}
+		clients = append(clients, c)
 	}
-	return nil
+	return servers, clients, nil
 }
 
 // NewServer runs a new server.
 func (env *Env) NewServer() (*dmsg.Server, error) {
+	return env.NewServerWithConfig(nil)
+}
+
+// NewServerWithConfig runs a new server with the given config.
+// The input 'conf' is optional, and the default config is used if it is nil.
+func (env *Env) NewServerWithConfig(conf *dmsg.ServerConfig) (*dmsg.Server, error) {
 	ctx, cancel := timeoutContext(env.timeout)
 	defer cancel()
 
 	env.mx.Lock()
 	defer env.mx.Unlock()
 
-	return env.newServer(ctx)
+	return env.newServer(ctx, conf)
 }
 
-func (env *Env) newServer(ctx context.Context) (*dmsg.Server, error) {
-	pk, sk := cipher.GenerateKeyPair()
-
-	srv := dmsg.NewServer(pk, sk, env.d)
-	env.s[pk] = srv
-	env.sWg.Add(1)
+func (env *Env) newServer(ctx context.Context, conf *dmsg.ServerConfig) (*dmsg.Server, error) {
+	pk, sk, err := env.genKeyPair("server")
+	if err != nil {
+		return nil, err
+	}
 
+	// The listener is prepared before the server is recorded, so that failure does not leave a stale record.
 	l, err := nettest.NewLocalListener("tcp")
 	if err != nil {
 		return nil, err
 	}
 
+	srv := dmsg.NewServerWithConfig(pk, sk, env.d, conf)
+	env.s[pk] = srv
+	env.sWg.Add(1)
+
 	go func() {
-		if err := srv.Serve(l, ""); err != nil && env.t != nil {
+		if err := srv.ServeContext(context.Background(), l, ""); err != nil && env.t != nil {
 			env.t.Logf("dmsgtest.Env: dmsg server of pk %s stopped serving with error: %v", pk, err)
 		}
 		env.mx.Lock()
@@ -123,14 +204,19 @@ func (env *Env) NewClient(conf *dmsg.Config) (*dmsg.Client, error) {
 }
 
 func (env *Env) newClient(ctx context.Context, conf *dmsg.Config) (*dmsg.Client, error) {
-	pk, sk := cipher.GenerateKeyPair()
+	pk, sk, err := env.genKeyPair("client")
+	if err != nil {
+		return nil, err
+	}
 
 	c := dmsg.NewClient(pk, sk, env.d, conf)
 	env.c[pk] = c
 	env.cWg.Add(1)
 
 	go func() {
-		c.Serve()
+		if err := c.ServeContext(context.Background()); err != nil && env.t != nil {
+			env.t.Logf("dmsgtest.Env: dmsg client of pk %s stopped serving with error: %v", pk, err)
+		}
 		env.mx.Lock()
 		delete(env.c, pk)
 		env.mx.Unlock()
@@ -181,9 +267,13 @@ func (env *Env) AllServers() []*dmsg.Server {
 }
 
 // Shutdown closes all servers and clients of the Env.
+// The dmsg discovery server is also closed if it is ran.
 func (env *Env) Shutdown() {
 	env.CloseAllClients()
 	env.CloseAllServers()
+	if env.dSrv != nil {
+		env.dSrv.Close()
+	}
 }
 
 // CloseAllClients closes all clients of the Env.
@@ -206,6 +296,14 @@ func (env *Env) CloseAllServers() {
 	env.sWg.Wait()
 }
 
+func repeatConfig(conf *dmsg.Config, n int) []*dmsg.Config {
+	confs := make([]*dmsg.Config, n)
+	for i := range confs {
+		confs[i] = conf
+	}
+	return confs
+}
+
 func timeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
 	ctx := context.Background()
 	if timeout > 0 {
@@ -1,12 +1,17 @@
 package dmsgtest
 
 import (
+	"context"
+	"errors"
+	"io"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
 )
 
 func TestEnv(t *testing.T) {
@@ -35,6 +40,52 @@ func TestEnv(t *testing.T) {
 		}
 	})
 
+	t.Run("startup_shutdown_with_discovery", func(t *testing.T) {
+		env := NewEnv(t, timeout)
+		require.NoError(t, env.StartupWithDiscovery(3, 2, nil))
+		require.Len(t, env.AllServers(), 3)
+		require.Len(t, env.AllClients(), 2)
+		env.Shutdown()
+	})
+
+	t.Run("startup_with_configs", func(t *testing.T) {
+		env := NewEnv(t, timeout)
+		defer env.Shutdown()
+
+		srvConfs := []*dmsg.ServerConfig{nil, {EntryUpdateInterval: time.Second}, {EntryUpdateInterval: 0}}
+		cliConfs := []*dmsg.Config{{MinSessions: 1}, {MinSessions: 3}}
+
+		servers, clients, err := env.StartupWithConfigs(srvConfs, cliConfs)
+		require.NoError(t, err)
+		require.Len(t, servers, len(srvConfs))
+		require.Len(t, clients, len(cliConfs))
+		for i, c := range clients {
+			<-c.Ready()
+			require.Eventually(t, func() bool {
+				return c.SessionCount() >= cliConfs[i].MinSessions
+			}, timeout, time.Millisecond*100, i)
+		}
+	})
+
+	t.Run("deterministic_keys", func(t *testing.T) {
+		seed := []byte("dmsgtest")
+		pks := make([][]cipher.PubKey, 2)
+
+		for i := range pks {
+			env := NewEnvWithSeed(t, timeout, seed)
+			require.NoError(t, env.Startup(2, 2, nil))
+			for _, srv := range env.AllServers() {
+				pks[i] = append(pks[i], srv.LocalPK())
+			}
+			for _, c := range env.AllClients() {
+				pks[i] = append(pks[i], c.LocalPK())
+			}
+			env.Shutdown()
+		}
+		require.Len(t, pks[0], 4)
+		require.Equal(t, pks[0], pks[1])
+	})
+
 	t.Run("restart_client", func(t *testing.T) {
 		env := NewEnv(t, timeout)
 		require.NoError(t, env.Startup(3, 1, nil))
@@ -55,3 +106,78 @@ func TestEnv(t *testing.T) {
 		require.Len(t, env.AllClients(), 0)
 	})
 }
+
+func TestEnv_RunScenario(t *testing.T) {
+	sc, err := LoadScenario("testdata/kill_server.yaml")
+	require.NoError(t, err)
+
+	env := NewEnv(t, time.Second*30)
+	defer env.Shutdown()
+	require.NoError(t, env.RunScenario(sc))
+}
+
+func TestEnv_Relay(t *testing.T) {
+	const timeout = time.Second * 30
+	const port = 1
+
+	// startup starts two servers of the given config, and two clients which are each restricted to one of the servers
+	// (with a server list), so that the clients share no server.
+	startup := func(t *testing.T, srvConf *dmsg.ServerConfig) (env *Env, dialer, listener *dmsg.Client) {
+		env = NewEnv(t, timeout)
+		servers, _, err := env.StartupWithConfigs([]*dmsg.ServerConfig{srvConf, srvConf}, nil)
+		require.NoError(t, err)
+
+		opPK, opSK := cipher.GenerateKeyPair()
+		clients := make([]*dmsg.Client, len(servers))
+		for i, srv := range servers {
+			entry, err := env.d.Entry(context.TODO(), srv.LocalPK())
+			require.NoError(t, err)
+			list := disc.NewServerList(opPK, []*disc.Entry{entry})
+			require.NoError(t, list.Sign(opSK))
+
+			conf := dmsg.DefaultConfig()
+			conf.TrustedOperator = opPK
+			conf.ServerList = list
+			clients[i], err = env.NewClient(conf)
+			require.NoError(t, err)
+			<-clients[i].Ready()
+		}
+		return env, clients[0], clients[1]
+	}
+
+	t.Run("relayed", func(t *testing.T) {
+		env, dialer, listener := startup(t, &dmsg.ServerConfig{MaxRelayHops: 2})
+		defer env.Shutdown()
+
+		lis, err := listener.Listen(port)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, lis.Close()) }()
+
+		dStr, err := dialer.DialStream(context.TODO(), dmsg.Addr{PK: listener.LocalPK(), Port: port})
+		require.NoError(t, err)
+		defer func() { require.NoError(t, dStr.Close()) }()
+		rStr, err := lis.Accept()
+		require.NoError(t, err)
+		defer func() { require.NoError(t, rStr.Close()) }()
+
+		_, err = dStr.Write([]byte("relayed"))
+		require.NoError(t, err)
+		b := make([]byte, len("relayed"))
+		_, err = io.ReadFull(rStr, b)
+		require.NoError(t, err)
+		require.Equal(t, "relayed", string(b))
+	})
+
+	t.Run("relaying_disabled", func(t *testing.T) {
+		env, dialer, listener := startup(t, nil)
+		defer env.Shutdown()
+
+		lis, err := listener.Listen(port)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, lis.Close()) }()
+
+		// As the request is not relayed, the dial fails with the error of connecting to the server of the listener.
+		_, err = dialer.DialStream(context.TODO(), dmsg.Addr{PK: listener.LocalPK(), Port: port})
+		require.True(t, errors.Is(err, dmsg.ErrDiscServerNotTrusted), err)
+	})
+}
@@ -0,0 +1,187 @@
+package dmsgtest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/SkycoinProject/dmsg"
+)
+
+// Scenario actions.
+const (
+	ActionStartServer = "start_server" // starts a new dmsg server
+	ActionKillServer  = "kill_server"  // closes the dmsg server of 'index'
+	ActionStartClient = "start_client" // starts a new dmsg client
+	ActionKillClient  = "kill_client"  // closes the dmsg client of 'index'
+	ActionDial        = "dial"         // client of 'index' dials client of 'to' on 'port'
+	ActionExpect      = "expect"       // checks the number of running servers and clients
+)
+
+// Scenario describes a reproducible sequence of timed events to be executed against an Env.
+// Servers and clients are referenced by index, in the order returned by AllServers() and AllClients().
+type Scenario struct {
+	Servers     int             `yaml:"servers"`
+	Clients     int             `yaml:"clients"`
+	MinSessions int             `yaml:"min_sessions"`
+	Events      []ScenarioEvent `yaml:"events"`
+}
+
+// ScenarioEvent is an action that is to be performed at a given time after the scenario starts.
+type ScenarioEvent struct {
+	At          time.Duration `yaml:"at"`
+	Action      string        `yaml:"action"`
+	Index       int           `yaml:"index"`
+	To          int           `yaml:"to"`
+	Port        uint16        `yaml:"port"`
+	ExpectError bool          `yaml:"expect_error"`
+	Servers     int           `yaml:"servers"` // expected number of servers (only for 'expect')
+	Clients     int           `yaml:"clients"` // expected number of clients (only for 'expect')
+}
+
+// String implements fmt.Stringer
+func (e ScenarioEvent) String() string {
+	return fmt.Sprintf("%s(index=%d) at %s", e.Action, e.Index, e.At)
+}
+
+// ReadScenario decodes a YAML-encoded scenario.
+func ReadScenario(r io.Reader) (*Scenario, error) {
+	var sc Scenario
+	if err := yaml.NewDecoder(r).Decode(&sc); err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// LoadScenario reads a YAML-encoded scenario from the given file path.
+func LoadScenario(path string) (*Scenario, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() //nolint:errcheck
+
+	return ReadScenario(f)
+}
+
+// RunScenario starts up the Env as described by the scenario, and executes the scenario's events in order.
+// It returns on the first event that fails. The Env is not shut down by RunScenario.
+func (env *Env) RunScenario(sc *Scenario) error {
+	conf := dmsg.DefaultConfig()
+	if sc.MinSessions > 0 {
+		conf.MinSessions = sc.MinSessions
+	}
+	if err := env.Startup(sc.Servers, sc.Clients, conf); err != nil {
+		return fmt.Errorf("scenario startup failed: %v", err)
+	}
+
+	events := make([]ScenarioEvent, len(sc.Events))
+	copy(events, sc.Events)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+
+	start := time.Now()
+	for _, e := range events {
+		time.Sleep(time.Until(start.Add(e.At)))
+		if env.t != nil {
+			env.t.Logf("dmsgtest.Env: scenario event: %s", e)
+		}
+		if err := env.runEvent(e, conf); err != nil {
+			return fmt.Errorf("scenario event %s failed: %v", e, err)
+		}
+	}
+	return nil
+}
+
+func (env *Env) runEvent(e ScenarioEvent, conf *dmsg.Config) error {
+	switch e.Action {
+	case ActionStartServer:
+		_, err := env.NewServer()
+		return err
+
+	case ActionKillServer:
+		servers := env.AllServers()
+		if e.Index < 0 || e.Index >= len(servers) {
+			return fmt.Errorf("server index %d out of range", e.Index)
+		}
+		return servers[e.Index].Close()
+
+	case ActionStartClient:
+		_, err := env.NewClient(conf)
+		return err
+
+	case ActionKillClient:
+		clients := env.AllClients()
+		if e.Index < 0 || e.Index >= len(clients) {
+			return fmt.Errorf("client index %d out of range", e.Index)
+		}
+		return clients[e.Index].Close()
+
+	case ActionDial:
+		err := env.dialEvent(e)
+		if e.ExpectError && err == nil {
+			return fmt.Errorf("expected dial to fail")
+		}
+		if !e.ExpectError {
+			return err
+		}
+		return nil
+
+	case ActionExpect:
+		if n := len(env.AllServers()); n != e.Servers {
+			return fmt.Errorf("expected %d servers, got %d", e.Servers, n)
+		}
+		if n := len(env.AllClients()); n != e.Clients {
+			return fmt.Errorf("expected %d clients, got %d", e.Clients, n)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown action '%s'", e.Action)
+	}
+}
+
+func (env *Env) dialEvent(e ScenarioEvent) error {
+	clients := env.AllClients()
+	if e.Index < 0 || e.Index >= len(clients) || e.To < 0 || e.To >= len(clients) {
+		return fmt.Errorf("client indexes (%d -> %d) out of range", e.Index, e.To)
+	}
+	from, to := clients[e.Index], clients[e.To]
+
+	lis, err := to.Listen(e.Port)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lis.Close() }() //nolint:errcheck
+
+	ctx, cancel := timeoutContext(env.timeout)
+	defer cancel()
+
+	acceptCh := make(chan error, 1)
+	go func() {
+		stream, err := lis.AcceptStream()
+		if err == nil {
+			err = stream.Close()
+		}
+		acceptCh <- err
+	}()
+
+	stream, err := from.DialStream(ctx, dmsg.Addr{PK: to.LocalPK(), Port: e.Port}, dmsg.BypassUnreachableCache())
+	if err != nil {
+		return err
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-acceptCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -2,13 +2,28 @@ package dmsg
 
 import (
 	"context"
+	"net"
 	"sync"
+	"time"
 
+	"github.com/SkycoinProject/yamux"
 	"github.com/sirupsen/logrus"
 
 	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/SkycoinProject/dmsg/disc"
 	"github.com/SkycoinProject/dmsg/netutil"
+	"github.com/SkycoinProject/dmsg/noise"
+)
+
+const (
+	// serverAvailableConns is the number of available connections advertised by a serving dmsg server.
+	serverAvailableConns = 10
+
+	// deregisterTimeout is the maximum duration for deregistering an entry from dmsg discovery on close.
+	deregisterTimeout = time.Second * 5
+
+	// entryUpdateTimeout is the maximum duration for re-announcing a client entry in dmsg discovery.
+	entryUpdateTimeout = time.Second * 10
 )
 
 // EntityCommon contains the common fields and methods for server and client entities.
@@ -20,10 +35,31 @@ type EntityCommon struct {
 	sessions   map[cipher.PubKey]*SessionCommon
 	sessionsMx *sync.Mutex
 
-	log logrus.FieldLogger
+	log     logrus.FieldLogger
+	logConf LogConfig // log levels of subsystems (only set for clients)
+	logMx   sync.Mutex
+	clock   Clock
+
+	setSessionCallback     func(ctx context.Context) error
+	delSessionCallback     func(ctx context.Context) error
+	recycleSessionCallback func(ses *SessionCommon) // called once a session nears exhaustion of stream IDs
+
+	entries *entryTracker // tracks changes of client entries (nil for servers)
+	entryMx sync.RWMutex  // read-locked by client entry announcements, so that deregistering awaits those in flight
 
-	setSessionCallback func(ctx context.Context) error
-	delSessionCallback func(ctx context.Context) error
+	networkID string // ID of the dmsg network (empty for the default network)
+
+	sessionRekey      noise.RekeyConfig // when to rotate the encryption keys of sessions (and of streams of clients)
+	maxSessionStreams int               // advertised limit of concurrent streams opened by the remote (0 for none)
+	compressHeaders   bool              // whether compression of frame headers is advertised to the remotes of sessions
+	tracer            *frameTracer      // nil if frames are not traced
+	fds               fdBudget          // file descriptor usage of the process
+	sessionKeepAlive  time.Duration     // interval of multiplexer keepalives of sessions (0 for the default)
+	streamWindow      uint32            // maximum receive window of streams (0 for the default)
+
+	powDifficulty int        // proof-of-work difficulty required by dmsg discovery (0 if not required)
+	powNonce      uint64     // solved proof-of-work nonce of the local public key
+	powMx         sync.Mutex // ensures the proof-of-work is only solved once
 }
 
 func (c *EntityCommon) init(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClient, log logrus.FieldLogger) {
@@ -33,6 +69,19 @@ func (c *EntityCommon) init(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClien
 	c.sessions = make(map[cipher.PubKey]*SessionCommon)
 	c.sessionsMx = new(sync.Mutex)
 	c.log = log
+	c.clock = systemClock{}
+}
+
+// muxConfig returns the config of the multiplexers of sessions.
+func (c *EntityCommon) muxConfig() *yamux.Config {
+	conf := yamux.DefaultConfig()
+	if c.sessionKeepAlive > 0 {
+		conf.KeepAliveInterval = c.sessionKeepAlive
+	}
+	if c.streamWindow > 0 {
+		conf.MaxStreamWindowSize = c.streamWindow
+	}
+	return conf
 }
 
 // LocalPK returns the local public key of the entity.
@@ -62,16 +111,16 @@ func (c *EntityCommon) serverSession(pk cipher.PubKey) (ServerSession, bool) {
 }
 
 // clientSession obtains a session as a client.
-func (c *EntityCommon) clientSession(porter *netutil.Porter, pk cipher.PubKey) (ClientSession, bool) {
+func (c *EntityCommon) clientSession(porter *netutil.Porter, conf *Config, pk cipher.PubKey) (ClientSession, bool) {
 	ses, ok := c.session(pk)
-	return ClientSession{SessionCommon: ses, porter: porter}, ok
+	return ClientSession{SessionCommon: ses, porter: porter, conf: conf}, ok
 }
 
-func (c *EntityCommon) allClientSessions(porter *netutil.Porter) []ClientSession {
+func (c *EntityCommon) allClientSessions(porter *netutil.Porter, conf *Config) []ClientSession {
 	c.sessionsMx.Lock()
 	sessions := make([]ClientSession, 0, len(c.sessions))
 	for _, ses := range c.sessions {
-		sessions = append(sessions, ClientSession{SessionCommon: ses, porter: porter})
+		sessions = append(sessions, ClientSession{SessionCommon: ses, porter: porter, conf: conf})
 	}
 	c.sessionsMx.Unlock()
 	return sessions
@@ -105,9 +154,34 @@ func (c *EntityCommon) setSession(ctx context.Context, dSes *SessionCommon) bool
 	return true
 }
 
-func (c *EntityCommon) delSession(ctx context.Context, pk cipher.PubKey) {
+// replaceSession sets the session, replacing any existing session with the same remote. The replaced session (if any)
+// is returned, and is expected to be closed by the caller once drained.
+func (c *EntityCommon) replaceSession(ctx context.Context, dSes *SessionCommon) (old *SessionCommon) {
+	c.sessionsMx.Lock()
+	defer c.sessionsMx.Unlock()
+
+	old = c.sessions[dSes.RemotePK()]
+	c.sessions[dSes.RemotePK()] = dSes
+	if old == nil && c.setSessionCallback != nil {
+		if err := c.setSessionCallback(ctx); err != nil {
+			c.log.
+				WithError(err).
+				Warn("replaceSession() callback returned non-nil error.")
+		}
+	}
+	return old
+}
+
+// delSession deletes the session, unless it has been replaced (see replaceSession).
+// It returns false if the session was not deleted.
+func (c *EntityCommon) delSession(ctx context.Context, dSes *SessionCommon) bool {
 	c.sessionsMx.Lock()
-	delete(c.sessions, pk)
+	defer c.sessionsMx.Unlock()
+
+	if c.sessions[dSes.RemotePK()] != dSes {
+		return false
+	}
+	delete(c.sessions, dSes.RemotePK())
 	if c.delSessionCallback != nil {
 		if err := c.delSessionCallback(ctx); err != nil {
 			c.log.
@@ -115,49 +189,172 @@ func (c *EntityCommon) delSession(ctx context.Context, pk cipher.PubKey) {
 				Warn("delSession() callback returned non-nil error.")
 		}
 	}
-	c.sessionsMx.Unlock()
+	return true
 }
 
 // updateServerEntry updates the dmsg server's entry within dmsg discovery.
-func (c *EntityCommon) updateServerEntry(ctx context.Context, addr string) error {
+// The input 'srv' contains the advertised fields of the server entry. The available connections are set here.
+func (c *EntityCommon) updateServerEntry(ctx context.Context, srv disc.Server) error {
+	srv.AvailableConnections = serverAvailableConns
 	entry, err := c.dc.Entry(ctx, c.pk)
 	if err != nil {
-		entry = disc.NewServerEntry(c.pk, 0, addr, 10)
+		entry = disc.NewServerEntry(c.pk, 0, srv.Address, srv.AvailableConnections)
+		entry.NetworkID = c.networkID
+		*entry.Server = srv
+		if err := c.proveEntry(ctx, entry); err != nil {
+			return err
+		}
 		if err := entry.Sign(c.sk); err != nil {
 			return err
 		}
 		return c.dc.SetEntry(ctx, entry)
 	}
-	entry.Server.Address = addr
+	if entry.Server == nil {
+		entry.Server = new(disc.Server)
+	}
+	srv.Port = entry.Server.Port
+	*entry.Server = srv
+	entry.NetworkID = c.networkID
+	if err := c.proveEntry(ctx, entry); err != nil {
+		return err
+	}
 	return c.dc.UpdateEntry(ctx, c.sk, entry)
 }
 
+// deregisterServerEntry marks the dmsg server's entry within dmsg discovery as unavailable by setting its available
+// connections to 0, so that it is no longer advertised to dmsg clients.
+// It should be called once the server stops updating its entry.
+func (c *EntityCommon) deregisterServerEntry(ctx context.Context) error {
+	entry, err := c.dc.Entry(ctx, c.pk)
+	if err != nil {
+		return err
+	}
+	if entry.Server == nil {
+		return ErrDiscEntryIsNotServer
+	}
+	entry.Server.AvailableConnections = 0
+	c.subLog(LogDiscovery).WithField("entry", entry).Info("Deregistering entry.")
+	return c.dc.UpdateEntry(ctx, c.sk, entry)
+}
+
+// updateClientEntry announces the client entry with the current sessions. The sessions should be locked.
 func (c *EntityCommon) updateClientEntry(ctx context.Context, done chan struct{}) error {
+	return c.announceClientEntry(ctx, done, c.sessionPKs())
+}
+
+// sessionPKs returns the public keys of the remotes of the sessions. The sessions should be locked.
+func (c *EntityCommon) sessionPKs() []cipher.PubKey {
+	pks := make([]cipher.PubKey, 0, len(c.sessions))
+	for pk := range c.sessions {
+		pks = append(pks, pk)
+	}
+	return pks
+}
+
+// announceClientEntry announces the client entry with the given delegated servers.
+func (c *EntityCommon) announceClientEntry(ctx context.Context, done chan struct{}, srvPKs []cipher.PubKey) error {
+	c.entryMx.RLock()
+	defer c.entryMx.RUnlock()
 	if isClosed(done) {
 		return nil
 	}
 
-	srvPKs := make([]cipher.PubKey, 0, len(c.sessions))
-	for pk := range c.sessions {
-		srvPKs = append(srvPKs, pk)
-	}
+	log := c.subLog(LogDiscovery)
 	entry, err := c.dc.Entry(ctx, c.pk)
 	if err != nil {
 		entry = disc.NewClientEntry(c.pk, 0, srvPKs)
+		entry.NetworkID = c.networkID
+		if err := c.proveEntry(ctx, entry); err != nil {
+			return err
+		}
 		if err := entry.Sign(c.sk); err != nil {
 			return err
 		}
-		return c.dc.SetEntry(ctx, entry)
+		if err := c.dc.SetEntry(ctx, entry); err != nil {
+			return err
+		}
+		c.entries.observe(log, entry)
+		return nil
 	}
 	entry.Client.DelegatedServers = srvPKs
-	c.log.WithField("entry", entry).Info("Updating entry.")
+	entry.NetworkID = c.networkID
+	if err := c.proveEntry(ctx, entry); err != nil {
+		return err
+	}
+	log.WithField("entry", entry).Info("Updating entry.")
+	if err := c.dc.UpdateEntry(ctx, c.sk, entry); err != nil {
+		return err
+	}
+	c.entries.observe(log, entry)
+	return nil
+}
+
+// checkNetworkID returns ErrNetworkIDMismatch if the entry is not of the local dmsg network.
+func (c *EntityCommon) checkNetworkID(entry *disc.Entry) error {
+	if entry.NetworkID != c.networkID {
+		return ErrNetworkIDMismatch
+	}
+	return nil
+}
+
+// networkPrologue returns the noise handshake prologue of the local dmsg network.
+// As the prologue must be identical on both sides, sessions cannot be established across dmsg networks.
+func (c *EntityCommon) networkPrologue() []byte {
+	if c.networkID == "" {
+		return nil // Compatible with entities which are unaware of network IDs.
+	}
+	return []byte("dmsg-network:" + c.networkID)
+}
+
+// proveEntry sets the proof-of-work of the entry, if dmsg discovery requires one.
+// The proof-of-work is only solved once, as it is tied to the local public key.
+func (c *EntityCommon) proveEntry(ctx context.Context, entry *disc.Entry) error {
+	if c.powDifficulty <= 0 || disc.PoWDifficulty(c.pk, entry.PoW) >= c.powDifficulty {
+		return nil
+	}
+
+	c.powMx.Lock()
+	defer c.powMx.Unlock()
+
+	if disc.PoWDifficulty(c.pk, c.powNonce) < c.powDifficulty {
+		start := time.Now()
+		nonce, err := disc.SolvePoW(ctx, c.pk, c.powDifficulty)
+		if err != nil {
+			return err
+		}
+		c.subLog(LogDiscovery).WithField("difficulty", c.powDifficulty).
+			WithField("elapsed", time.Since(start)).
+			Info("Solved entry proof-of-work.")
+		c.powNonce = nonce
+	}
+	entry.PoW = c.powNonce
+	return nil
+}
+
+// deregisterClientEntry marks the dmsg client's entry within dmsg discovery as unreachable by clearing its delegated
+// servers, so that remote clients fail fast instead of attempting to dial.
+// It should be called once the client is closed, so that the entry is not announced again. Announcements which are in
+// flight are awaited.
+func (c *EntityCommon) deregisterClientEntry(ctx context.Context) error {
+	c.entryMx.Lock()
+	defer c.entryMx.Unlock()
+
+	entry, err := c.dc.Entry(ctx, c.pk)
+	if err != nil {
+		return err
+	}
+	if entry.Client == nil {
+		return ErrDiscEntryIsNotClient
+	}
+	entry.Client.DelegatedServers = []cipher.PubKey{}
+	c.subLog(LogDiscovery).WithField("entry", entry).Info("Deregistering entry.")
 	return c.dc.UpdateEntry(ctx, c.sk, entry)
 }
 
-func getServerEntry(ctx context.Context, dc disc.APIClient, srvPK cipher.PubKey) (*disc.Entry, error) {
+func getServerEntry(ctx context.Context, dc entryGetter, srvPK cipher.PubKey) (*disc.Entry, error) {
 	entry, err := dc.Entry(ctx, srvPK)
 	if err != nil {
-		return nil, ErrDiscEntryNotFound
+		return nil, ErrDiscEntryNotFound.Wrap(err)
 	}
 	if entry.Server == nil {
 		return nil, ErrDiscEntryIsNotServer
@@ -165,16 +362,38 @@ func getServerEntry(ctx context.Context, dc disc.APIClient, srvPK cipher.PubKey)
 	return entry, nil
 }
 
-func getClientEntry(ctx context.Context, dc disc.APIClient, clientPK cipher.PubKey) (*disc.Entry, error) {
+// getClientEntry obtains a client entry from dmsg discovery.
+// If the entry is obtained but invalid, it is returned alongside the error.
+func getClientEntry(ctx context.Context, dc entryGetter, clientPK cipher.PubKey) (*disc.Entry, error) {
 	entry, err := dc.Entry(ctx, clientPK)
 	if err != nil {
-		return nil, ErrDiscEntryNotFound
+		return nil, ErrDiscEntryNotFound.Wrap(err)
 	}
 	if entry.Client == nil {
 		return nil, ErrDiscEntryIsNotClient
 	}
 	if len(entry.Client.DelegatedServers) == 0 {
-		return nil, ErrDiscEntryHasNoDelegated
+		return entry, ErrDiscEntryHasNoDelegated
 	}
 	return entry, nil
 }
+
+// sessionSettings returns the settings which are advertised to the remotes of sessions.
+func (c *EntityCommon) sessionSettings() sessionSettings {
+	var ss sessionSettings
+	if c.maxSessionStreams > 0 {
+		ss.MaxStreams = uint32(c.maxSessionStreams)
+	}
+	if c.compressHeaders {
+		ss.Capabilities |= sessionCapHeaderCompression
+	}
+	return ss
+}
+
+// sessionConn wraps the connection of an established session with the features which both sides support.
+func (c *EntityCommon) sessionConn(conn net.Conn, remote sessionSettings) net.Conn {
+	if c.sessionSettings().sharedCapabilities(remote)&sessionCapHeaderCompression != 0 {
+		return newCompressedConn(conn)
+	}
+	return conn
+}
@@ -0,0 +1,133 @@
+package dmsg
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// EntryDiff describes what changed between two observed versions of a client entry in dmsg discovery.
+type EntryDiff struct {
+	PK             cipher.PubKey
+	Local          bool // whether the entry is of the local client
+	Created        bool // whether the entry was not observed before
+	OldSequence    uint64
+	NewSequence    uint64
+	AddedServers   []cipher.PubKey // delegated servers which were added
+	RemovedServers []cipher.PubKey // delegated servers which were removed
+}
+
+// ServersChanged returns true if delegated servers were added or removed.
+func (d EntryDiff) ServersChanged() bool {
+	return len(d.AddedServers) > 0 || len(d.RemovedServers) > 0
+}
+
+// IsEmpty returns true if nothing changed.
+func (d EntryDiff) IsEmpty() bool {
+	return !d.Created && d.OldSequence == d.NewSequence && !d.ServersChanged()
+}
+
+// EntryObserver is called with the changes of a client entry whenever a changed version of the entry is observed.
+// This happens when the local client updates its entry, or when a remote client's entry is fetched (such as when
+// dialing).
+type EntryObserver func(diff EntryDiff)
+
+// diffEntries obtains the changes between two versions of a client entry.
+// The input 'prev' is nil if the entry was not observed before.
+func diffEntries(prev, next *disc.Entry) EntryDiff {
+	diff := EntryDiff{
+		PK:          next.Static,
+		Created:     prev == nil,
+		NewSequence: next.Sequence,
+	}
+	var prevSrvs, nextSrvs []cipher.PubKey
+	if prev != nil {
+		diff.OldSequence = prev.Sequence
+		if prev.Client != nil {
+			prevSrvs = prev.Client.DelegatedServers
+		}
+	}
+	if next.Client != nil {
+		nextSrvs = next.Client.DelegatedServers
+	}
+	diff.AddedServers = pkDifference(nextSrvs, prevSrvs)
+	diff.RemovedServers = pkDifference(prevSrvs, nextSrvs)
+	return diff
+}
+
+// pkDifference returns public keys which are in 'a' but not in 'b'.
+func pkDifference(a, b []cipher.PubKey) []cipher.PubKey {
+	inB := make(map[cipher.PubKey]struct{}, len(b))
+	for _, pk := range b {
+		inB[pk] = struct{}{}
+	}
+	var out []cipher.PubKey
+	for _, pk := range a {
+		if _, ok := inB[pk]; !ok {
+			out = append(out, pk)
+		}
+	}
+	return out
+}
+
+// entryTracker records the last observed version of client entries, and notifies observers of changes.
+type entryTracker struct {
+	localPK   cipher.PubKey
+	last      map[cipher.PubKey]*disc.Entry
+	observers []EntryObserver
+	mx        sync.Mutex
+}
+
+func newEntryTracker(localPK cipher.PubKey) *entryTracker {
+	return &entryTracker{
+		localPK: localPK,
+		last:    make(map[cipher.PubKey]*disc.Entry),
+	}
+}
+
+func (t *entryTracker) addObserver(fn EntryObserver) {
+	t.mx.Lock()
+	t.observers = append(t.observers, fn)
+	t.mx.Unlock()
+}
+
+// observe records the given entry, logs the changes (if any) and notifies observers.
+// It is a no-op on a nil tracker.
+func (t *entryTracker) observe(log logrus.FieldLogger, entry *disc.Entry) {
+	if t == nil || entry == nil {
+		return
+	}
+
+	cp := new(disc.Entry)
+	disc.Copy(cp, entry)
+
+	t.mx.Lock()
+	diff := diffEntries(t.last[entry.Static], cp)
+	if diff.IsEmpty() {
+		t.mx.Unlock()
+		return
+	}
+	diff.Local = entry.Static == t.localPK
+	t.last[entry.Static] = cp
+	observers := t.observers
+	t.mx.Unlock()
+
+	log = log.WithField("entry_pk", diff.PK).
+		WithField("local", diff.Local).
+		WithField("old_seq", diff.OldSequence).
+		WithField("new_seq", diff.NewSequence).
+		WithField("added_servers", diff.AddedServers).
+		WithField("removed_servers", diff.RemovedServers)
+	if diff.Created || diff.ServersChanged() {
+		log.Info("Discovery entry changed.")
+	} else {
+		log.Debug("Discovery entry sequence bumped.")
+	}
+
+	for _, fn := range observers {
+		fn(diff)
+	}
+}
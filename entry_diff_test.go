@@ -0,0 +1,39 @@
+package dmsg
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestEntryTracker_Observe(t *testing.T) {
+	pk, _ := cipher.GenerateKeyPair()
+	srv1, _ := cipher.GenerateKeyPair()
+	srv2, _ := cipher.GenerateKeyPair()
+
+	tr := newEntryTracker(pk)
+	var diffs []EntryDiff
+	tr.addObserver(func(diff EntryDiff) { diffs = append(diffs, diff) })
+
+	tr.observe(logrus.New(), disc.NewClientEntry(pk, 0, []cipher.PubKey{srv1}))
+	require.Len(t, diffs, 1)
+	require.True(t, diffs[0].Created)
+	require.True(t, diffs[0].Local)
+	require.Equal(t, []cipher.PubKey{srv1}, diffs[0].AddedServers)
+
+	// Observing the same version again should not result in a diff.
+	tr.observe(logrus.New(), disc.NewClientEntry(pk, 0, []cipher.PubKey{srv1}))
+	require.Len(t, diffs, 1)
+
+	tr.observe(logrus.New(), disc.NewClientEntry(pk, 1, []cipher.PubKey{srv2}))
+	require.Len(t, diffs, 2)
+	require.False(t, diffs[1].Created)
+	require.Equal(t, uint64(0), diffs[1].OldSequence)
+	require.Equal(t, uint64(1), diffs[1].NewSequence)
+	require.Equal(t, []cipher.PubKey{srv2}, diffs[1].AddedServers)
+	require.Equal(t, []cipher.PubKey{srv1}, diffs[1].RemovedServers)
+}
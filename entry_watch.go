@@ -0,0 +1,91 @@
+package dmsg
+
+import (
+	"context"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// WatchEntry watches the entry of a remote client in dmsg discovery, so that applications can react to the remote
+// client changing its delegated servers before the next dial fails.
+// If the discovery client implements disc.EntryWatcher, entry changes are pushed by dmsg discovery. Otherwise (or if
+// the push-based watch fails), the entry is polled every EntryWatchInterval. The returned chan emits the entry when
+// it is first obtained and whenever it changes. The chan is closed when the context is done or when the client is
+// closed.
+//
+// Observers added via AddEntryObserver are also notified of changes.
+func (ce *Client) WatchEntry(ctx context.Context, pk cipher.PubKey) <-chan disc.Entry {
+	ch := make(chan disc.Entry, 1)
+
+	go func() {
+		defer close(ch)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-ce.done:
+				cancel()
+			}
+		}()
+
+		log := ce.subLog(LogDiscovery).WithField("remote_pk", pk)
+
+		// emit sends the entry if it changed, and returns false if the context is done.
+		var last *disc.Entry
+		emit := func(entry *disc.Entry) bool {
+			if last != nil && entry.Sequence == last.Sequence && entry.Timestamp == last.Timestamp {
+				return true
+			}
+			ce.entries.observe(log, entry)
+			last = entry
+			select {
+			case ch <- *entry:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if w, ok := ce.dc.(disc.EntryWatcher); ok {
+			entries, err := w.WatchEntry(ctx, pk)
+			if err != nil {
+				log.WithError(err).Debug("Failed to watch entry, falling back to polling.")
+			} else {
+				for entry := range entries {
+					if !emit(entry) {
+						return
+					}
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				log.Debug("Entry watch interrupted, falling back to polling.")
+			}
+		}
+
+		ticker := ce.clock.NewTicker(EntryWatchInterval)
+		defer ticker.Stop()
+
+		for {
+			entry, err := ce.dc.Entry(ctx, pk)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.WithError(err).Debug("Failed to poll watched entry.")
+				}
+			} else if !emit(entry) {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.Chan():
+			}
+		}
+	}()
+
+	return ch
+}
@@ -0,0 +1,49 @@
+package dmsg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestClient_WatchEntry(t *testing.T) {
+	defer func(v time.Duration) { EntryWatchInterval = v }(EntryWatchInterval)
+	EntryWatchInterval = time.Millisecond * 50
+
+	dc := disc.NewMock()
+
+	rPK, rSK := cipher.GenerateKeyPair()
+	srvPK, _ := cipher.GenerateKeyPair()
+	rEntry := disc.NewClientEntry(rPK, 0, []cipher.PubKey{})
+	require.NoError(t, rEntry.Sign(rSK))
+	require.NoError(t, dc.SetEntry(context.TODO(), rEntry))
+
+	pk, sk := cipher.GenerateKeyPair()
+	c := NewClient(pk, sk, dc, nil)
+	defer func() { require.NoError(t, c.Close()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := c.WatchEntry(ctx, rPK)
+
+	entry := <-ch
+	require.Empty(t, entry.Client.DelegatedServers)
+
+	rEntry.Client.DelegatedServers = []cipher.PubKey{srvPK}
+	require.NoError(t, dc.UpdateEntry(context.TODO(), rSK, rEntry))
+
+	select {
+	case entry = <-ch:
+		require.Equal(t, []cipher.PubKey{srvPK}, entry.Client.DelegatedServers)
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for entry update")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
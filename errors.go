@@ -1,116 +1,86 @@
 package dmsg
 
-import (
-	"fmt"
-	"sync"
-)
+import "github.com/SkycoinProject/dmsg/dmsgerr"
 
 // Errors for dmsg discovery (1xx).
 var (
-	ErrDiscEntryNotFound       = registerErr(Error{code: 100, msg: "entry is not found in discovery"})
-	ErrDiscEntryIsNotServer    = registerErr(Error{code: 101, msg: "entry is not of server in discovery"})
-	ErrDiscEntryIsNotClient    = registerErr(Error{code: 102, msg: "entry is not of client in discovery"})
-	ErrDiscEntryHasNoDelegated = registerErr(Error{code: 103, msg: "client entry in discovery has no delegated servers"})
+	ErrDiscEntryNotFound       = dmsgerr.Register(100, "entry is not found in discovery")
+	ErrDiscEntryIsNotServer    = dmsgerr.Register(101, "entry is not of server in discovery")
+	ErrDiscEntryIsNotClient    = dmsgerr.Register(102, "entry is not of client in discovery")
+	ErrDiscEntryHasNoDelegated = dmsgerr.Register(103, "client entry in discovery has no delegated servers")
+	ErrDiscServerNotTrusted    = dmsgerr.Register(104, "server is not in the trusted server list")
 )
 
 // Entity Errors (2xx).
 var (
-	ErrEntityClosed               = registerErr(Error{code: 200, msg: "local entity closed"})
-	ErrSessionClosed              = registerErr(Error{code: 201, msg: "local session closed"})
-	ErrCannotConnectToDelegated   = registerErr(Error{code: 202, msg: "cannot connect to delegated server"})
-	ErrSessionHandshakeExtraBytes = registerErr(Error{code: 203, msg: "extra bytes received during session handshake"})
+	ErrEntityClosed               = dmsgerr.Register(200, "local entity closed")
+	ErrSessionClosed              = dmsgerr.Register(201, "local session closed")
+	ErrCannotConnectToDelegated   = dmsgerr.Register(202, "cannot connect to delegated server")
+	ErrSessionHandshakeExtraBytes = dmsgerr.Register(203, "extra bytes received during session handshake")
+	ErrPeerRecentlyUnreachable    = dmsgerr.RegisterTemporary(204, "remote client was recently unreachable")
+	ErrNetworkIDMismatch          = dmsgerr.Register(205, "remote entity is of a different dmsg network")
+	ErrOOBUnsupported             = dmsgerr.Register(206, "stream does not support out-of-band messages")
+	ErrOOBTooLarge                = dmsgerr.Register(207, "out-of-band message is too large")
+	ErrStreamIDsExhausted         = dmsgerr.RegisterTemporary(208, "session has no stream IDs left")
+	ErrFDBudgetExhausted          = dmsgerr.RegisterTemporary(209, "file descriptor budget exhausted")
+	ErrStreamReset                = dmsgerr.Register(210, "stream reset by remote")
 )
 
 // Errors for dial request/response (3xx).
 var (
-	ErrReqInvalidSig       = registerErr(Error{code: 300, msg: "request has invalid signature"})
-	ErrReqInvalidTimestamp = registerErr(Error{code: 301, msg: "request timestamp should be higher than last"})
-	ErrReqInvalidSrcPK     = registerErr(Error{code: 302, msg: "request has invalid source public key"})
-	ErrReqInvalidDstPK     = registerErr(Error{code: 303, msg: "request has invalid destination public key"})
-	ErrReqInvalidSrcPort   = registerErr(Error{code: 304, msg: "request has invalid source port"})
-	ErrReqInvalidDstPort   = registerErr(Error{code: 305, msg: "request has invalid destination port"})
-	ErrReqNoListener       = registerErr(Error{code: 306, msg: "request has no associated listener", temp: true})
-	ErrReqNoNextSession    = registerErr(Error{code: 307, msg: "request cannot be forwarded because the next session is non-existent"})
-
-	ErrDialRespInvalidSig  = registerErr(Error{code: 350, msg: "response has invalid signature"})
-	ErrDialRespInvalidHash = registerErr(Error{code: 351, msg: "response has invalid hash of associated request"})
-	ErrDialRespNotAccepted = registerErr(Error{code: 352, msg: "response rejected associated request without reason"})
-
-	ErrSignedObjectInvalid = registerErr(Error{code: 370, msg: "signed object is invalid"})
+	ErrReqInvalidSig       = dmsgerr.Register(300, "request has invalid signature")
+	ErrReqInvalidTimestamp = dmsgerr.Register(301, "request timestamp should be higher than last")
+	ErrReqInvalidSrcPK     = dmsgerr.Register(302, "request has invalid source public key")
+	ErrReqInvalidDstPK     = dmsgerr.Register(303, "request has invalid destination public key")
+	ErrReqInvalidSrcPort   = dmsgerr.Register(304, "request has invalid source port")
+	ErrReqInvalidDstPort   = dmsgerr.Register(305, "request has invalid destination port")
+	ErrReqNoListener       = dmsgerr.RegisterTemporary(306, "request has no associated listener")
+	ErrReqNoNextSession    = dmsgerr.Register(307, "request cannot be forwarded because the next session is non-existent")
+	ErrReqRateLimited      = dmsgerr.RegisterTemporary(308, "request exceeds stream rate limit")
+	ErrReqQuotaExceeded    = dmsgerr.RegisterTemporary(309, "request exceeds stream quota")
+	ErrReqRelayLoop        = dmsgerr.Register(310, "request is relayed in a loop")
+	ErrReqRelayHopLimit    = dmsgerr.Register(311, "request exceeds relay hop limit")
+	ErrPortNotListening    = dmsgerr.RegisterTemporary(312, "remote port is not listening")
+	ErrSessionStreamLimit  = dmsgerr.RegisterTemporary(313, "session exceeds maximum concurrent streams")
+	ErrReqRejected         = dmsgerr.Register(314, "request is rejected by remote")
+
+	ErrDialRespInvalidSig  = dmsgerr.Register(350, "response has invalid signature")
+	ErrDialRespInvalidHash = dmsgerr.Register(351, "response has invalid hash of associated request")
+	ErrDialRespNotAccepted = dmsgerr.Register(352, "response rejected associated request without reason")
+	ErrServerBusy          = dmsgerr.RegisterTemporary(353, "server is too busy to serve request")
+
+	ErrSignedObjectInvalid = dmsgerr.Register(370, "signed object is invalid")
 )
 
 // Listener errors (4xx).
 var (
-	ErrPortOccupied    = registerErr(Error{code: 400, msg: "port already occupied"})
-	ErrAcceptChanMaxed = registerErr(Error{code: 401, msg: "listener accept chan maxed", temp: true})
+	ErrPortOccupied    = dmsgerr.Register(400, "port already occupied")
+	ErrAcceptChanMaxed = dmsgerr.RegisterTemporary(401, "listener accept chan maxed")
 )
 
-// ErrorFromCode returns a saved error (if exists) from given error code.
-func ErrorFromCode(code errorCode) (bool, error) {
-	errMx.RLock()
-	err, ok := errMap[code]
-	errMx.RUnlock()
-	return ok, err
-}
-
-type errorCode uint16
-
+// Audit log errors (5xx).
 var (
-	errMap = make(map[errorCode]error)
-	errMx  sync.RWMutex
+	ErrAuditLogClosed         = dmsgerr.Register(500, "audit log closed")
+	ErrAuditRecordInvalidHash = dmsgerr.Register(501, "audit record has invalid hash")
+	ErrAuditRecordInvalidSig  = dmsgerr.Register(502, "audit record has invalid signature")
+	ErrAuditChainBroken       = dmsgerr.Register(503, "audit log hash chain is broken")
 )
 
-func registerErr(e Error) Error {
-	e.nxt = nil
-
-	errMx.Lock()
-	if _, ok := errMap[e.code]; ok {
-		panic(fmt.Errorf("error of code %d already exists", e.code))
-	}
-	errMap[e.code] = e
-	errMx.Unlock()
-
-	return e
-}
+// Bandwidth report errors (6xx).
+var (
+	ErrBandwidthReportInvalidSig = dmsgerr.Register(600, "bandwidth report has invalid signature")
+)
 
-// Error represents a dmsg-related error.
-type Error struct {
-	code    errorCode
-	msg     string
-	timeout bool
-	temp    bool
-	nxt     error
-}
+// Error represents a dmsg-related error (see package dmsgerr).
+type Error = dmsgerr.Error
 
-// Error implements error
-func (e Error) Error() string {
-	return fmt.Sprintf("dmsg error %d - %s", e.code, e.errorString())
-}
+type errorCode = dmsgerr.Code
 
-func (e Error) errorString() string {
-	msg := e.msg
-	if e.nxt != nil {
-		if nxt, ok := e.nxt.(Error); ok {
-			msg += ": " + nxt.errorString()
-		} else {
-			msg += ": " + e.nxt.Error()
-		}
+// ErrorFromCode returns a saved error (if exists) from given error code.
+func ErrorFromCode(code errorCode) (bool, error) {
+	err, ok := dmsgerr.FromCode(code)
+	if !ok {
+		return false, nil
 	}
-	return msg
-}
-
-// Timeout implements net.Error
-func (e Error) Timeout() bool {
-	return e.timeout
-}
-
-// Temporary implements net.Error
-func (e Error) Temporary() bool {
-	return e.temp
-}
-
-// Wrap wraps an error and returns the new error.
-func (e Error) Wrap(err error) Error {
-	e.nxt = err
-	return e
+	return true, err
 }
@@ -32,15 +32,15 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	go func() { _ = srv.Serve(lis, "") }() //nolint:errcheck
+	go func() { _ = srv.ServeContext(context.Background(), lis, "") }() //nolint:errcheck
 	time.Sleep(time.Second)
 
 	// instantiate clients
 	respC := dmsg.NewClient(respPK, respSK, dc, nil)
-	go respC.Serve()
+	go func() { _ = respC.ServeContext(context.Background()) }() //nolint:errcheck
 
 	initC := dmsg.NewClient(initPK, initSK, dc, nil)
-	go initC.Serve()
+	go func() { _ = initC.ServeContext(context.Background()) }() //nolint:errcheck
 
 	time.Sleep(time.Second)
 
@@ -0,0 +1,139 @@
+// Chat runs a local dmsg network in which clients exchange chat messages. Each client listens on the chat port, and
+// each message is sent on a stream dialed to the recipient.
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+// chatPort is the dmsg port which chat messages are sent to.
+const chatPort = uint16(1563)
+
+// maxMsgSize is the maximum size of chat messages.
+const maxMsgSize = 4096
+
+func main() {
+	// run a local dmsg network of 1 server and 3 clients (with a mock discovery)
+	env := dmsgtest.NewEnv(nil, dmsgtest.DefaultTimeout)
+	if err := env.Startup(1, 3, nil); err != nil {
+		log.Fatalf("Error starting dmsg env: %v", err)
+	}
+	defer env.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	clients := env.AllClients()
+	rooms := make([]*room, len(clients))
+	for i, c := range clients {
+		r, err := newRoom(c)
+		if err != nil {
+			log.Fatalf("Error joining chat: %v", err)
+		}
+		defer func() { _ = r.Close() }() //nolint:errcheck
+		rooms[i] = r
+	}
+
+	// every client greets every other client
+	for _, r := range rooms {
+		for _, c := range clients {
+			if c.LocalPK() == r.c.LocalPK() {
+				continue
+			}
+			if err := r.Send(ctx, c.LocalPK(), "hi from "+r.c.LocalPK().String()[:8]); err != nil {
+				log.Fatalf("Error sending message: %v", err)
+			}
+		}
+	}
+	for _, r := range rooms {
+		for i := 0; i < len(clients)-1; i++ {
+			msg := <-r.Inbox()
+			log.Printf("[%s] %s: %s", r.c.LocalPK().String()[:8], msg.From.String()[:8], msg.Text)
+		}
+	}
+}
+
+// message is a received chat message.
+type message struct {
+	From cipher.PubKey
+	Text string
+}
+
+// room receives chat messages of a dmsg client, and sends chat messages to other clients.
+type room struct {
+	c     *dmsg.Client
+	lis   *dmsg.Listener
+	inbox chan message
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newRoom(c *dmsg.Client) (*room, error) {
+	lis, err := c.Listen(chatPort)
+	if err != nil {
+		return nil, err
+	}
+	r := &room{c: c, lis: lis, inbox: make(chan message, 16), done: make(chan struct{})}
+	r.wg.Add(1)
+	go r.serve()
+	return r, nil
+}
+
+// Inbox returns the chan of received messages. It is closed once the room is closed.
+func (r *room) Inbox() <-chan message { return r.inbox }
+
+// Send sends a message to the client of the public key.
+func (r *room) Send(ctx context.Context, to cipher.PubKey, text string) error {
+	stream, err := r.c.DialStream(ctx, dmsg.Addr{PK: to, Port: chatPort})
+	if err != nil {
+		return err
+	}
+	if _, err := stream.Write([]byte(text)); err != nil {
+		_ = stream.Close() //nolint:errcheck
+		return err
+	}
+	return stream.Close()
+}
+
+// Close stops receiving messages.
+func (r *room) Close() error {
+	err := r.lis.Close()
+	close(r.done)
+	r.wg.Wait()
+	close(r.inbox)
+	return err
+}
+
+func (r *room) serve() {
+	defer r.wg.Done()
+	for {
+		stream, err := r.lis.AcceptStream()
+		if err != nil {
+			return
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer func() { _ = stream.Close() }() //nolint:errcheck
+
+			// each message is sent on its own stream, which is closed by the sender
+			text, err := ioutil.ReadAll(io.LimitReader(stream, maxMsgSize))
+			if err != nil || len(text) == 0 {
+				return
+			}
+			select {
+			case r.inbox <- message{From: stream.RawRemoteAddr().PK, Text: string(text)}:
+			case <-r.done:
+			}
+		}()
+	}
+}
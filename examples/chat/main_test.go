@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+func TestRoom(t *testing.T) {
+	env := dmsgtest.NewEnv(t, dmsgtest.DefaultTimeout)
+	require.NoError(t, env.Startup(1, 2, nil))
+	defer env.Shutdown()
+
+	a, err := newRoom(env.AllClients()[0])
+	require.NoError(t, err)
+	b, err := newRoom(env.AllClients()[1])
+	require.NoError(t, err)
+
+	require.NoError(t, a.Send(context.TODO(), b.c.LocalPK(), "hello"))
+	require.Equal(t, message{From: a.c.LocalPK(), Text: "hello"}, <-b.Inbox())
+
+	require.NoError(t, a.Close())
+	require.NoError(t, b.Close())
+	_, ok := <-b.Inbox()
+	require.False(t, ok)
+}
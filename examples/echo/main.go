@@ -0,0 +1,83 @@
+// Echo runs a local dmsg network in which one client serves an echo service, and another client dials it.
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+// echoPort is the dmsg port of the echo service.
+const echoPort = uint16(7)
+
+func main() {
+	// run a local dmsg network of 1 server and 2 clients (with a mock discovery)
+	env := dmsgtest.NewEnv(nil, dmsgtest.DefaultTimeout)
+	if err := env.Startup(1, 2, nil); err != nil {
+		log.Fatalf("Error starting dmsg env: %v", err)
+	}
+	defer env.Shutdown()
+
+	srvC, cliC := env.AllClients()[0], env.AllClients()[1]
+
+	lis, err := srvC.Listen(echoPort)
+	if err != nil {
+		log.Fatalf("Error listening on port %d: %v", echoPort, err)
+	}
+	go serveEcho(lis)
+	defer func() { _ = lis.Close() }() //nolint:errcheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	replies, err := echo(ctx, cliC, lis.DmsgAddr(), []string{"Hello there!", "General Kenobi"})
+	if err != nil {
+		log.Fatalf("Error echoing: %v", err)
+	}
+	for _, r := range replies {
+		log.Printf("Echoed: %s", r)
+	}
+}
+
+// serveEcho writes everything that is read from accepted streams back to them, until the listener is closed.
+func serveEcho(lis *dmsg.Listener) {
+	for {
+		stream, err := lis.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = stream.Close() }() //nolint:errcheck
+			_, _ = io.Copy(stream, stream)        //nolint:errcheck
+		}()
+	}
+}
+
+// echo dials the echo service at 'addr' and sends each of the messages as a line, returning the echoed lines.
+func echo(ctx context.Context, c *dmsg.Client, addr dmsg.Addr, msgs []string) ([]string, error) {
+	stream, err := c.DialStream(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stream.Close() }() //nolint:errcheck
+
+	r := bufio.NewReader(stream)
+	replies := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		if _, err := fmt.Fprintln(stream, msg); err != nil {
+			return replies, err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return replies, err
+		}
+		replies = append(replies, line[:len(line)-1])
+	}
+	return replies, nil
+}
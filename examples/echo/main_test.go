@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+func TestEcho(t *testing.T) {
+	env := dmsgtest.NewEnv(t, dmsgtest.DefaultTimeout)
+	require.NoError(t, env.Startup(1, 2, nil))
+	defer env.Shutdown()
+
+	lis, err := env.AllClients()[0].Listen(echoPort)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+	go serveEcho(lis)
+
+	msgs := []string{"Hello there!", "General Kenobi"}
+	replies, err := echo(context.TODO(), env.AllClients()[1], lis.DmsgAddr(), msgs)
+	require.NoError(t, err)
+	require.Equal(t, msgs, replies)
+}
@@ -0,0 +1,77 @@
+// HTTP runs a local dmsg network in which one client serves a hello-world HTTP server on a dmsg port, and another
+// client requests it with an http.Client which dials dmsg streams.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+// httpPort is the dmsg port of the HTTP server.
+const httpPort = uint16(80)
+
+func main() {
+	// run a local dmsg network of 1 server and 2 clients (with a mock discovery)
+	env := dmsgtest.NewEnv(nil, dmsgtest.DefaultTimeout)
+	if err := env.Startup(1, 2, nil); err != nil {
+		log.Fatalf("Error starting dmsg env: %v", err)
+	}
+	defer env.Shutdown()
+
+	srvC, cliC := env.AllClients()[0], env.AllClients()[1]
+
+	lis, err := srvC.Listen(httpPort)
+	if err != nil {
+		log.Fatalf("Error listening on port %d: %v", httpPort, err)
+	}
+	go func() { _ = http.Serve(lis, helloHandler()) }() //nolint:errcheck
+	defer func() { _ = lis.Close() }()                  //nolint:errcheck
+
+	// the host of URLs is the public key of the server, and the port is its dmsg port
+	resp, err := newHTTPClient(cliC).Get(fmt.Sprintf("http://%s/hello", lis.DmsgAddr()))
+	if err != nil {
+		log.Fatalf("Error requesting: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }() //nolint:errcheck
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalf("Error reading response: %v", err)
+	}
+	log.Printf("Got response (%s): %s", resp.Status, body)
+}
+
+// helloHandler greets the remote, of which the public key is the host of the request's remote address.
+func helloHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pk, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "Hello, %s!", pk) //nolint:errcheck
+	})
+}
+
+// newHTTPClient returns an http.Client which dials dmsg streams with the dmsg client.
+// Addresses of requests are of the form '<pk>:<port>'.
+func newHTTPClient(c *dmsg.Client) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				var dAddr dmsg.Addr
+				if err := dAddr.Set(addr); err != nil {
+					return nil, err
+				}
+				return c.Dial(ctx, dAddr)
+			},
+		},
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+func TestHello(t *testing.T) {
+	env := dmsgtest.NewEnv(t, dmsgtest.DefaultTimeout)
+	require.NoError(t, env.Startup(1, 2, nil))
+	defer env.Shutdown()
+
+	srvC, cliC := env.AllClients()[0], env.AllClients()[1]
+
+	lis, err := srvC.Listen(httpPort)
+	require.NoError(t, err)
+	go func() { _ = http.Serve(lis, helloHandler()) }() //nolint:errcheck
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	resp, err := newHTTPClient(cliC).Get(fmt.Sprintf("http://%s/hello", lis.DmsgAddr()))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, resp.Body.Close()) }()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("Hello, %s!", cliC.LocalPK()), string(body))
+}
@@ -0,0 +1,121 @@
+package dmsg
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// fdWarnRatio is the ratio of the file descriptor limit above which a warning is logged.
+const fdWarnRatio = 0.8
+
+// fdRecountInterval is the maximum age of the file descriptor count which new sessions are checked against.
+const fdRecountInterval = time.Second
+
+var errFDUsageUnsupported = errors.New("file descriptor usage is not supported on this platform")
+
+// FDMetrics records the file descriptor usage of a dmsg entity (as of every FDCheckInterval).
+type FDMetrics interface {
+	// SetOpenFDs is called with the number of open file descriptors of the process.
+	SetOpenFDs(n int)
+
+	// SetFDLimit is called with the limit of open file descriptors of the process (the soft RLIMIT_NOFILE).
+	SetFDLimit(n int)
+}
+
+// fdBudget tracks the file descriptor usage of the process against its limit. File descriptors are shared by every
+// entity of the process, but each entity tracks them on its own behalf.
+// Usage is only tracked on platforms which expose it (Linux), and is treated as within budget otherwise.
+type fdBudget struct {
+	limit   int       // 0 if unknown
+	reserve int       // new sessions are refused once fewer file descriptors remain (0 to never refuse)
+	metrics FDMetrics // may be nil
+
+	open    int64 // open file descriptors as of the last count (-1 if unknown), accessed atomically
+	counted int64 // time of the last count (unix nano), accessed atomically
+	state   int32 // 1 while above the warning ratio, 2 while new sessions are refused, accessed atomically
+}
+
+func (c *EntityCommon) initFDBudget(reserve int, metrics FDMetrics) {
+	c.fds = fdBudget{reserve: reserve, metrics: metrics, open: -1}
+	limit, err := fdLimit()
+	if err != nil {
+		c.log.WithError(err).Debug("File descriptor usage is not tracked.")
+		return
+	}
+	c.fds.limit = limit
+	if metrics != nil {
+		metrics.SetFDLimit(limit)
+	}
+}
+
+// countFDs counts the open file descriptors, records them, and logs a warning once the usage approaches the limit.
+// It returns -1 if usage is unknown.
+func (c *EntityCommon) countFDs() int {
+	b := &c.fds
+	if b.limit <= 0 {
+		return -1
+	}
+	open, err := openFDs()
+	if err != nil {
+		c.log.WithError(err).Debug("Failed to count open file descriptors.")
+		return -1
+	}
+	atomic.StoreInt64(&b.open, int64(open))
+	atomic.StoreInt64(&b.counted, time.Now().UnixNano())
+	if b.metrics != nil {
+		b.metrics.SetOpenFDs(open)
+	}
+
+	var state int32
+	switch {
+	case b.reserve > 0 && open >= b.limit-b.reserve:
+		state = 2
+	case float64(open) >= float64(b.limit)*fdWarnRatio:
+		state = 1
+	}
+	if prev := atomic.SwapInt32(&b.state, state); prev != state {
+		log := c.log.WithField("open_fds", open).WithField("fd_limit", b.limit)
+		switch state {
+		case 2:
+			log.WithField("fd_reserve", b.reserve).Warn("File descriptor budget exhausted, refusing new sessions.")
+		case 1:
+			log.Warn("File descriptor usage is approaching the limit (raise RLIMIT_NOFILE with 'ulimit -n').")
+		default:
+			log.Info("File descriptor usage is within budget again.")
+		}
+	}
+	return open
+}
+
+// fdsExhausted returns true if fewer file descriptors than the reserve remain, so that new sessions are to be refused.
+func (c *EntityCommon) fdsExhausted() bool {
+	b := &c.fds
+	if b.reserve <= 0 || b.limit <= 0 {
+		return false
+	}
+	open := int(atomic.LoadInt64(&b.open))
+	if time.Since(time.Unix(0, atomic.LoadInt64(&b.counted))) > fdRecountInterval {
+		open = c.countFDs()
+	}
+	return open >= 0 && open >= b.limit-b.reserve
+}
+
+// monitorFDs counts the open file descriptors every interval, until 'done' is closed.
+func (c *EntityCommon) monitorFDs(done <-chan struct{}, interval time.Duration) {
+	if c.fds.limit <= 0 {
+		return
+	}
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	c.countFDs()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.Chan():
+			c.countFDs()
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package dmsg
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+type fdMetricsRecorder struct{ open, limit int }
+
+func (m *fdMetricsRecorder) SetOpenFDs(n int) { m.open = n }
+func (m *fdMetricsRecorder) SetFDLimit(n int) { m.limit = n }
+
+func TestFDBudget(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("file descriptor usage is only tracked on linux")
+	}
+	pk, sk := cipher.GenerateKeyPair()
+
+	var c EntityCommon
+	c.init(pk, sk, nil, logging.MustGetLogger("fd_budget"))
+	m := new(fdMetricsRecorder)
+	c.initFDBudget(0, m)
+	require.True(t, m.limit > 0)
+
+	open := c.countFDs()
+	require.True(t, open > 0)
+	require.Equal(t, open, m.open)
+	require.False(t, c.fdsExhausted())
+
+	// Sessions are refused once fewer file descriptors than the reserve remain.
+	c.initFDBudget(m.limit, m)
+	require.True(t, c.fdsExhausted())
+}
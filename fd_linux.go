@@ -0,0 +1,32 @@
+// +build linux
+
+package dmsg
+
+import (
+	"os"
+	"syscall"
+)
+
+// openFDs returns the number of open file descriptors of the process.
+func openFDs() (int, error) {
+	f, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }() //nolint:errcheck
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	return len(names) - 1, nil // excluding the descriptor which lists them
+}
+
+// fdLimit returns the limit of open file descriptors of the process (the soft RLIMIT_NOFILE).
+func fdLimit() (int, error) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, err
+	}
+	return int(rl.Cur), nil
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package dmsg
+
+func openFDs() (int, error) {
+	return 0, errFDUsageUnsupported
+}
+
+func fdLimit() (int, error) {
+	return 0, errFDUsageUnsupported
+}
@@ -0,0 +1,224 @@
+package dmsg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+)
+
+// Compressed frame headers start with a tag byte, of which bits 0-2 are the index of the frame type and flags within
+// frameStaticTable (0 if they are literal), bit 3 is set if the stream ID equals that of the previous header, and bit 4
+// is set if the length equals that of the previous header. The tag is followed by the literal type (1) and flags (2) if
+// the index is 0, the stream ID (uvarint) unless bit 3 is set, and the length (uvarint) unless bit 4 is set. Headers
+// which cannot be compressed are written as tagRawHeader followed by the uncompressed header. Payloads of data frames
+// follow their headers uncompressed.
+const (
+	tagIndexMask = 0x07
+	tagSameSID   = 1 << 3
+	tagSameLen   = 1 << 4
+	tagReserved  = 0xe0
+	tagRawHeader = 0xff
+
+	maxRetainedWriteBuf = 64 * 1024 // write buffers which grow larger (for large payloads) are not retained
+)
+
+// frameStaticTable contains the most common combinations of frame type and flags of the session multiplexer.
+// Index 0 is reserved for literal types and flags.
+var frameStaticTable = [tagIndexMask + 1]struct {
+	typ   byte
+	flags uint16
+}{
+	1: {typ: frameTypeData},
+	2: {typ: 1},                      // window update
+	3: {typ: 1, flags: 1},            // window update (SYN), which opens a stream
+	4: {typ: 1, flags: 2},            // window update (ACK), which accepts a stream
+	5: {typ: 1, flags: frameFlagFIN}, // window update (FIN), which closes a stream
+	6: {typ: 2, flags: 1},            // ping (SYN)
+	7: {typ: 2, flags: 2},            // ping (ACK)
+}
+
+var errInvalidCompressedHeader = errors.New("invalid compressed frame header")
+
+// compressedConn compresses the frame headers of a session connection (see sessionCapHeaderCompression).
+// Each header is encoded relative to the previous header of the same direction, so that the headers of consecutive
+// frames of a stream (which dominate sessions of small writes, such as those of IoT devices) take 2-4 bytes instead of
+// frameHeaderSize bytes.
+// The multiplexer reads from a single goroutine and serializes writes, so no locking is needed.
+type compressedConn struct {
+	net.Conn
+
+	// Write side.
+	wHdr  [frameHeaderSize]byte
+	wN    int    // buffered bytes of the current header
+	wSkip uint32 // remaining payload bytes of the current data frame
+	wPrev [frameHeaderSize]byte
+	wBuf  []byte
+
+	// Read side.
+	r     *bufio.Reader
+	rHdr  [frameHeaderSize]byte
+	rN    int    // bytes of rHdr which are not yet read
+	rSkip uint32 // remaining payload bytes of the current data frame
+}
+
+func newCompressedConn(conn net.Conn) *compressedConn {
+	return &compressedConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Write compresses the frame headers of 'b', and writes the result with a single write to the connection.
+func (c *compressedConn) Write(b []byte) (int, error) {
+	total := len(b)
+	out := c.wBuf[:0]
+	for len(b) > 0 {
+		if c.wSkip > 0 {
+			k := c.wSkip
+			if uint32(len(b)) < k {
+				k = uint32(len(b))
+			}
+			out = append(out, b[:k]...)
+			b, c.wSkip = b[k:], c.wSkip-k
+			continue
+		}
+		k := copy(c.wHdr[c.wN:], b)
+		b, c.wN = b[k:], c.wN+k
+		if c.wN < frameHeaderSize {
+			break
+		}
+		c.wN = 0
+		out = appendCompressedHeader(out, c.wHdr[:], c.wPrev[:])
+		c.wPrev = c.wHdr
+		if c.wHdr[1] == frameTypeData {
+			c.wSkip = binary.BigEndian.Uint32(c.wHdr[8:12])
+		}
+	}
+	if cap(out) <= maxRetainedWriteBuf {
+		c.wBuf = out
+	}
+	if len(out) > 0 {
+		if _, err := c.Conn.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// appendCompressedHeader appends the compressed form of 'hdr', given the previous header 'prev'.
+func appendCompressedHeader(out, hdr, prev []byte) []byte {
+	if hdr[0] != 0 {
+		out = append(out, tagRawHeader)
+		return append(out, hdr...)
+	}
+	flags := binary.BigEndian.Uint16(hdr[2:4])
+	sid, length := binary.BigEndian.Uint32(hdr[4:8]), binary.BigEndian.Uint32(hdr[8:12])
+
+	var tag byte
+	for i := 1; i < len(frameStaticTable); i++ {
+		if frameStaticTable[i].typ == hdr[1] && frameStaticTable[i].flags == flags {
+			tag = byte(i)
+			break
+		}
+	}
+	if sid == binary.BigEndian.Uint32(prev[4:8]) {
+		tag |= tagSameSID
+	}
+	if length == binary.BigEndian.Uint32(prev[8:12]) {
+		tag |= tagSameLen
+	}
+
+	var v [binary.MaxVarintLen32]byte
+	out = append(out, tag)
+	if tag&tagIndexMask == 0 {
+		out = append(out, hdr[1:4]...)
+	}
+	if tag&tagSameSID == 0 {
+		out = append(out, v[:binary.PutUvarint(v[:], uint64(sid))]...)
+	}
+	if tag&tagSameLen == 0 {
+		out = append(out, v[:binary.PutUvarint(v[:], uint64(length))]...)
+	}
+	return out
+}
+
+// Read reads frames with decompressed headers.
+func (c *compressedConn) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	if c.rN > 0 {
+		n := copy(b, c.rHdr[frameHeaderSize-c.rN:])
+		c.rN -= n
+		return n, nil
+	}
+	if c.rSkip > 0 {
+		if uint32(len(b)) > c.rSkip {
+			b = b[:c.rSkip]
+		}
+		n, err := c.r.Read(b)
+		c.rSkip -= uint32(n)
+		return n, err
+	}
+	if err := c.readHeader(); err != nil {
+		return 0, err
+	}
+	c.rN = frameHeaderSize
+	return c.Read(b)
+}
+
+// readHeader reads the next compressed header into rHdr (which also holds the previous header).
+func (c *compressedConn) readHeader() error {
+	tag, err := c.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if tag == tagRawHeader {
+		_, err := io.ReadFull(c.r, c.rHdr[:])
+		return c.afterHeader(err)
+	}
+	if tag&tagReserved != 0 {
+		return errInvalidCompressedHeader
+	}
+
+	if i := tag & tagIndexMask; i != 0 {
+		c.rHdr[1] = frameStaticTable[i].typ
+		binary.BigEndian.PutUint16(c.rHdr[2:4], frameStaticTable[i].flags)
+	} else if _, err := io.ReadFull(c.r, c.rHdr[1:4]); err != nil {
+		return err
+	}
+	c.rHdr[0] = 0
+	if tag&tagSameSID == 0 {
+		if err := c.readUvarint32(c.rHdr[4:8]); err != nil {
+			return err
+		}
+	}
+	if tag&tagSameLen == 0 {
+		if err := c.readUvarint32(c.rHdr[8:12]); err != nil {
+			return err
+		}
+	}
+	return c.afterHeader(nil)
+}
+
+func (c *compressedConn) readUvarint32(b []byte) error {
+	v, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return err
+	}
+	if v > math.MaxUint32 {
+		return errInvalidCompressedHeader
+	}
+	binary.BigEndian.PutUint32(b, uint32(v))
+	return nil
+}
+
+func (c *compressedConn) afterHeader(err error) error {
+	if err != nil {
+		return err
+	}
+	if c.rHdr[1] == frameTypeData {
+		c.rSkip = binary.BigEndian.Uint32(c.rHdr[8:12])
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package dmsg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// makeFrame returns a multiplexer frame (header and payload).
+func makeFrame(version, typ byte, flags uint16, sid, length uint32, payload []byte) []byte {
+	b := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	b[0], b[1] = version, typ
+	binary.BigEndian.PutUint16(b[2:4], flags)
+	binary.BigEndian.PutUint32(b[4:8], sid)
+	binary.BigEndian.PutUint32(b[8:12], length)
+	return append(b, payload...)
+}
+
+// iotFrames returns the frames of a session of an IoT-style workload: small writes on a few streams, interleaved with
+// window updates and keepalive pings.
+func iotFrames(n int) [][]byte {
+	rng := rand.New(rand.NewSource(1))
+	frames := make([][]byte, 0, n)
+	for i := 0; len(frames) < n; i++ {
+		sid := uint32(1 + 2*rng.Intn(4))
+		payload := make([]byte, 16+rng.Intn(48))
+		frames = append(frames, makeFrame(0, frameTypeData, 0, sid, uint32(len(payload)), payload))
+		switch {
+		case i%16 == 0:
+			frames = append(frames, makeFrame(0, 1, 0, sid, 1024, nil))
+		case i%64 == 0:
+			frames = append(frames, makeFrame(0, 2, 1, 0, uint32(i), nil))
+		}
+	}
+	return frames
+}
+
+func TestCompressedConn(t *testing.T) {
+	frames := [][]byte{
+		makeFrame(0, 1, 1, 1, 262144, nil),                    // window update (SYN)
+		makeFrame(0, frameTypeData, 0, 1, 5, []byte("hello")), // data
+		makeFrame(0, frameTypeData, 0, 1, 5, []byte("world")), // data of the same stream and length
+		makeFrame(0, frameTypeData, 2, 1<<31, 0, nil),         // literal flags and a large stream ID
+		makeFrame(0, 3, 0, 0, 1, nil),                         // go away
+		makeFrame(1, frameTypeData, 0, 3, 3, []byte("raw")),   // unknown version
+		makeFrame(0, 2, 2, 0, 7, nil),                         // ping (ACK)
+	}
+	frames = append(frames, iotFrames(100)...)
+	var all []byte
+	for _, f := range frames {
+		all = append(all, f...)
+	}
+
+	c1, c2 := net.Pipe()
+	w, r := newCompressedConn(c1), newCompressedConn(c2)
+	defer func() {
+		require.NoError(t, w.Close())
+		require.NoError(t, r.Close())
+	}()
+
+	go func() {
+		// Frames are written in uneven chunks, which split headers and payloads.
+		for b := all; len(b) > 0; {
+			k := 1 + rand.Intn(40)
+			if k > len(b) {
+				k = len(b)
+			}
+			if _, err := w.Write(b[:k]); err != nil {
+				return
+			}
+			b = b[k:]
+		}
+	}()
+
+	got := make([]byte, len(all))
+	_, err := io.ReadFull(r, got)
+	require.NoError(t, err)
+	require.Equal(t, all, got)
+
+	t.Run("invalid_tag", func(t *testing.T) {
+		c := newCompressedConn(nil)
+		c.r.Reset(bytes.NewReader([]byte{0x20}))
+		_, err := c.Read(make([]byte, frameHeaderSize))
+		require.Equal(t, errInvalidCompressedHeader, err)
+	})
+}
+
+// writeCounter is a connection which discards written bytes, and counts them.
+type writeCounter struct {
+	net.Conn
+	n int
+}
+
+func (c *writeCounter) Write(b []byte) (int, error) {
+	c.n += len(b)
+	return ioutil.Discard.Write(b)
+}
+
+func BenchmarkCompressedConn(b *testing.B) {
+	frames := iotFrames(1000)
+
+	run := func(b *testing.B, compress bool) {
+		wc := &writeCounter{}
+		var w io.Writer = wc
+		if compress {
+			w = &compressedConn{Conn: wc}
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := w.Write(frames[i%len(frames)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(wc.n)/float64(b.N), "wire-bytes/frame")
+	}
+	b.Run("uncompressed", func(b *testing.B) { run(b, false) })
+	b.Run("compressed", func(b *testing.B) { run(b, true) })
+}
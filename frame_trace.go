@@ -0,0 +1,149 @@
+package dmsg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// FrameRecord is a record of the frame tracer, which is written as a line of JSON for each multiplexer frame of a
+// session (see Config.FrameTrace and ServerConfig.FrameTrace). Payloads are never recorded.
+// A record of type "session" is written when a session starts, which contains the addresses of the underlying
+// connection. These records are used by the Wireshark dissector (see tools/wireshark) to label captured connections
+// with the public keys of their sessions.
+type FrameRecord struct {
+	Time       int64         `json:"time"`    // unix time in nanoseconds
+	Session    cipher.PubKey `json:"session"` // remote public key of the session
+	Dir        string        `json:"dir"`     // "in" or "out"
+	Type       string        `json:"type"`    // "session", "data", "window_update", "ping" or "go_away"
+	Flags      []string      `json:"flags,omitempty"`
+	StreamID   uint32        `json:"stream_id"`
+	Length     uint32        `json:"length"` // payload length of data frames, or the value of other frames
+	LocalAddr  string        `json:"local_addr,omitempty"`
+	RemoteAddr string        `json:"remote_addr,omitempty"`
+}
+
+// Frame header of the session multiplexer: version (1), type (1), flags (2), stream ID (4), length (4).
+const frameHeaderSize = 12
+
+var (
+	frameTypeNames = []string{"data", "window_update", "ping", "go_away"}
+	frameFlagNames = []string{"syn", "ack", "fin", "rst"}
+)
+
+// frameTracer writes frame records to a writer, which is shared by all sessions of an entity.
+type frameTracer struct {
+	enc *json.Encoder
+	mx  sync.Mutex
+}
+
+func newFrameTracer(w io.Writer) *frameTracer {
+	if w == nil {
+		return nil
+	}
+	return &frameTracer{enc: json.NewEncoder(w)}
+}
+
+// wrap returns a connection which traces the frames which are read from and written to conn.
+// It should wrap the connection once the session handshake is complete.
+func (t *frameTracer) wrap(conn net.Conn, rPK cipher.PubKey) net.Conn {
+	if t == nil {
+		return conn
+	}
+	t.write(FrameRecord{
+		Time:       time.Now().UnixNano(),
+		Session:    rPK,
+		Type:       "session",
+		LocalAddr:  conn.LocalAddr().String(),
+		RemoteAddr: conn.RemoteAddr().String(),
+	})
+	return &tracedConn{
+		Conn: conn,
+		in:   frameParser{emit: func(hdr []byte) { t.record(rPK, "in", hdr) }},
+		out:  frameParser{emit: func(hdr []byte) { t.record(rPK, "out", hdr) }},
+	}
+}
+
+func (t *frameTracer) record(rPK cipher.PubKey, dir string, hdr []byte) {
+	r := FrameRecord{
+		Time:     time.Now().UnixNano(),
+		Session:  rPK,
+		Dir:      dir,
+		Type:     "unknown",
+		StreamID: binary.BigEndian.Uint32(hdr[4:8]),
+		Length:   binary.BigEndian.Uint32(hdr[8:12]),
+	}
+	if int(hdr[1]) < len(frameTypeNames) {
+		r.Type = frameTypeNames[hdr[1]]
+	}
+	flags := binary.BigEndian.Uint16(hdr[2:4])
+	for i, name := range frameFlagNames {
+		if flags&(1<<uint(i)) != 0 {
+			r.Flags = append(r.Flags, name)
+		}
+	}
+
+	t.write(r)
+}
+
+func (t *frameTracer) write(r FrameRecord) {
+	t.mx.Lock()
+	_ = t.enc.Encode(r) //nolint:errcheck
+	t.mx.Unlock()
+}
+
+// tracedConn traces the frames of a session connection.
+// The multiplexer reads from a single goroutine and serializes writes, so each parser is only used by one goroutine.
+type tracedConn struct {
+	net.Conn
+	in  frameParser
+	out frameParser
+}
+
+func (c *tracedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.in.feed(b[:n])
+	return n, err
+}
+
+func (c *tracedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.out.feed(b[:n])
+	return n, err
+}
+
+// frameParser finds the frame headers within a byte stream of multiplexer frames.
+type frameParser struct {
+	hdr  [frameHeaderSize]byte
+	n    int    // buffered bytes of the current header
+	skip uint32 // remaining payload bytes of the current data frame
+	emit func(hdr []byte)
+}
+
+func (p *frameParser) feed(b []byte) {
+	for len(b) > 0 {
+		if p.skip > 0 {
+			k := p.skip
+			if uint32(len(b)) < k {
+				k = uint32(len(b))
+			}
+			b, p.skip = b[k:], p.skip-k
+			continue
+		}
+		k := copy(p.hdr[p.n:], b)
+		b, p.n = b[k:], p.n+k
+		if p.n < frameHeaderSize {
+			return
+		}
+		p.emit(p.hdr[:])
+		p.n = 0
+		if p.hdr[1] == 0 { // data frames are followed by their payload
+			p.skip = binary.BigEndian.Uint32(p.hdr[8:12])
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package dmsg
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameParser(t *testing.T) {
+	frame := func(typ byte, flags uint16, id, length uint32, payload string) []byte {
+		b := make([]byte, frameHeaderSize)
+		b[1] = typ
+		binary.BigEndian.PutUint16(b[2:4], flags)
+		binary.BigEndian.PutUint32(b[4:8], id)
+		binary.BigEndian.PutUint32(b[8:12], length)
+		return append(b, payload...)
+	}
+
+	var stream []byte
+	stream = append(stream, frame(1, 1, 3, 256, "")...)
+	stream = append(stream, frame(0, 0, 3, 5, "hello")...)
+	stream = append(stream, frame(0, 4, 3, 0, "")...)
+	stream = append(stream, frame(2, 2, 0, 7, "")...)
+
+	// Feed byte by byte, so that headers and payloads are split across reads.
+	var hdrs [][]byte
+	p := frameParser{emit: func(hdr []byte) { hdrs = append(hdrs, append([]byte{}, hdr...)) }}
+	for i := range stream {
+		p.feed(stream[i : i+1])
+	}
+
+	require.Len(t, hdrs, 4)
+	require.Equal(t, byte(1), hdrs[0][1])
+	require.Equal(t, byte(0), hdrs[1][1])
+	require.Equal(t, uint16(4), binary.BigEndian.Uint16(hdrs[2][2:4]))
+	require.Equal(t, uint32(7), binary.BigEndian.Uint32(hdrs[3][8:12]))
+}
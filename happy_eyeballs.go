@@ -0,0 +1,120 @@
+package dmsg
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// happyEyeballsDelay is the delay between starting connection attempts to consecutive addresses of a dmsg server.
+// The value is recommended by RFC 8305.
+const happyEyeballsDelay = time.Millisecond * 250
+
+// sortHappyEyeballs orders addresses so that IPv6 and IPv4 addresses are interleaved, starting with IPv6.
+// Addresses with hostnames are treated as IPv4 addresses. The relative order within each family is kept.
+func sortHappyEyeballs(addrs []string) []string {
+	var v6, v4 []string
+	for _, addr := range addrs {
+		if isIPv6Addr(addr) {
+			v6 = append(v6, addr)
+		} else {
+			v4 = append(v4, addr)
+		}
+	}
+	out := make([]string, 0, len(addrs))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			out = append(out, v6[i])
+		}
+		if i < len(v4) {
+			out = append(out, v4[i])
+		}
+	}
+	return out
+}
+
+func isIPv6Addr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil
+}
+
+// dialHappyEyeballs dials the given addresses in Happy Eyeballs order (RFC 8305). A new connection attempt is started
+// every 'happyEyeballsDelay', or as soon as the previous attempt fails. The first established connection is returned,
+// and all others are closed.
+func dialHappyEyeballs(ctx context.Context, dialer *net.Dialer, addrs []string) (net.Conn, error) {
+	addrs = sortHappyEyeballs(addrs)
+	if len(addrs) == 0 {
+		return nil, &net.AddrError{Err: "no addresses to dial"}
+	}
+	if len(addrs) == 1 {
+		return dialer.DialContext(ctx, "tcp", addrs[0])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(addrs))
+	dial := func(addr string) {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		results <- result{conn: conn, err: err}
+	}
+
+	// closeRemaining closes connections of attempts which complete after we are done.
+	closeRemaining := func(pending int) {
+		for ; pending > 0; pending-- {
+			if res := <-results; res.conn != nil {
+				_ = res.conn.Close() //nolint:errcheck
+			}
+		}
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var firstErr error
+	next, pending := 0, 0
+	for {
+		var timerC <-chan time.Time
+		if next < len(addrs) {
+			timerC = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			go closeRemaining(pending)
+			return nil, ctx.Err()
+
+		case <-timerC:
+			go dial(addrs[next])
+			next, pending = next+1, pending+1
+			timer.Reset(happyEyeballsDelay)
+
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				go closeRemaining(pending)
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if next < len(addrs) {
+				// Start the next attempt immediately.
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(0)
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package dmsg
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+)
+
+func TestSortHappyEyeballs(t *testing.T) {
+	addrs := []string{"1.1.1.1:80", "2.2.2.2:80", "[::1]:80", "example.com:80", "[::2]:80"}
+	exp := []string{"[::1]:80", "1.1.1.1:80", "[::2]:80", "2.2.2.2:80", "example.com:80"}
+	require.Equal(t, exp, sortHappyEyeballs(addrs))
+}
+
+func TestDialHappyEyeballs(t *testing.T) {
+	lis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close() //nolint:errcheck
+		}
+	}()
+
+	// A closed listener provides an address which refuses connections.
+	badLis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	badAddr := badLis.Addr().String()
+	require.NoError(t, badLis.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	t.Run("first_fails", func(t *testing.T) {
+		conn, err := dialHappyEyeballs(ctx, new(net.Dialer), []string{badAddr, lis.Addr().String()})
+		require.NoError(t, err)
+		require.Equal(t, lis.Addr().String(), conn.RemoteAddr().String())
+		require.NoError(t, conn.Close())
+	})
+
+	t.Run("all_fail", func(t *testing.T) {
+		_, err := dialHappyEyeballs(ctx, new(net.Dialer), []string{badAddr, badAddr})
+		require.Error(t, err)
+	})
+
+	t.Run("no_addresses", func(t *testing.T) {
+		_, err := dialHappyEyeballs(ctx, new(net.Dialer), nil)
+		require.Error(t, err)
+	})
+}
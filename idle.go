@@ -0,0 +1,32 @@
+package dmsg
+
+import (
+	"time"
+)
+
+// idleCheckDivisor sets how often traffic is checked by reapIdle, as a fraction of the idle timeout.
+const idleCheckDivisor = 4
+
+// reapIdle calls 'reap' once the traffic counter has not changed for at least 'timeout'.
+// It returns once 'reap' is called or 'done' is closed.
+func reapIdle(clock Clock, timeout time.Duration, done <-chan struct{}, traffic func() uint64, reap func()) {
+	ticker := clock.NewTicker(timeout / idleCheckDivisor)
+	defer ticker.Stop()
+
+	last, since := traffic(), clock.Now()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.Chan():
+			if n := traffic(); n != last {
+				last, since = n, now
+				continue
+			}
+			if now.Sub(since) >= timeout {
+				reap()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package dmsg
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SkycoinProject/yamux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestReapIdle(t *testing.T) {
+	const timeout = time.Millisecond * 100
+
+	var traffic uint64
+	reaped := make(chan time.Time, 1)
+	go reapIdle(systemClock{}, timeout, nil, func() uint64 { return atomic.LoadUint64(&traffic) },
+		func() { reaped <- time.Now() })
+
+	// Traffic keeps the reaper from reaping.
+	for i := 0; i < 5; i++ {
+		time.Sleep(timeout / 2)
+		atomic.AddUint64(&traffic, 1)
+	}
+	lastTraffic := time.Now()
+	require.Len(t, reaped, 0)
+
+	select {
+	case at := <-reaped:
+		require.True(t, at.Sub(lastTraffic) >= timeout-timeout/idleCheckDivisor)
+	case <-time.After(timeout * 3):
+		t.Fatal("idle traffic was not reaped")
+	}
+
+	// The reaper returns without reaping once done.
+	done := make(chan struct{})
+	close(done)
+	reapIdle(systemClock{}, timeout, done, func() uint64 { return 0 }, func() { t.Error("reaped once done") })
+}
+
+// testStreamMetrics records stream metrics.
+type testStreamMetrics struct {
+	queued  int64
+	stalled int64
+	delays  int64 // number of observed delays
+	maxWait int64 // longest observed delay
+}
+
+func (m *testStreamMetrics) AddQueuedBytes(delta int)    { atomic.AddInt64(&m.queued, int64(delta)) }
+func (m *testStreamMetrics) AddStalledStreams(delta int) { atomic.AddInt64(&m.stalled, int64(delta)) }
+
+func (m *testStreamMetrics) ObserveQueueDelay(d time.Duration) {
+	atomic.AddInt64(&m.delays, 1)
+	if int64(d) > atomic.LoadInt64(&m.maxWait) {
+		atomic.StoreInt64(&m.maxWait, int64(d))
+	}
+}
+
+func TestServer_monitorStream(t *testing.T) {
+	const threshold = time.Millisecond * 100
+
+	m := new(testStreamMetrics)
+	pk, sk := cipher.GenerateKeyPair()
+	srv := NewServerWithConfig(pk, sk, disc.NewMock(), &ServerConfig{StreamMetrics: m, StreamStallThreshold: threshold})
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	// A stream of which the receiving end is read from on demand.
+	connA, connB := net.Pipe()
+	sesA, err := yamux.Client(connA, yamux.DefaultConfig())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, sesA.Close()) }()
+	sesB, err := yamux.Server(connB, yamux.DefaultConfig())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, sesB.Close()) }()
+	yStrA, err := sesA.OpenStream()
+	require.NoError(t, err)
+	yStrB, err := sesB.AcceptStream()
+	require.NoError(t, err)
+
+	str := srv.monitorStream(halfCloseStream{yStrA}, nil, srv.log)
+
+	// Writes which the receiver keeps up with do not stall.
+	_, err = str.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(yStrB, make([]byte, 5))
+	require.NoError(t, err)
+	require.Zero(t, atomic.LoadInt64(&m.stalled))
+	require.Zero(t, atomic.LoadInt64(&m.queued))
+	require.Equal(t, int64(1), atomic.LoadInt64(&m.delays))
+
+	// Writes which exceed the receive window block until the receiver reads, and are recorded as stalled meanwhile.
+	data := make([]byte, 1<<20)
+	written := make(chan error, 1)
+	go func() {
+		_, err := str.Write(data)
+		written <- err
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&m.stalled) == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(len(data)), atomic.LoadInt64(&m.queued))
+	require.Len(t, written, 0)
+
+	// Once the receiver reads, the stream resumes.
+	_, err = io.ReadFull(yStrB, make([]byte, len(data)))
+	require.NoError(t, err)
+	require.NoError(t, <-written)
+	require.Zero(t, atomic.LoadInt64(&m.stalled))
+	require.Zero(t, atomic.LoadInt64(&m.queued))
+	require.Equal(t, int64(2), atomic.LoadInt64(&m.delays))
+	require.True(t, time.Duration(atomic.LoadInt64(&m.maxWait)) >= threshold)
+}
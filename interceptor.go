@@ -0,0 +1,50 @@
+package dmsg
+
+import (
+	"sync"
+)
+
+// StreamHandler handles a remote-initiated stream.
+type StreamHandler func(dStr *Stream) error
+
+// StreamInterceptor intercepts remote-initiated streams before they are accepted by a listener.
+// This is useful for cross-cutting concerns such as authorization, logging and metrics.
+//
+// Implementations should call 'next' to continue down the chain, or return a non-nil error (without calling 'next')
+// to reject the stream. The rejection is sent to the dialer: dmsg errors are sent as is, and other errors are sent as
+// ErrReqRejected with the message of the error as the reason (see Rejection). As the stream handshake is not complete
+// at this point, the stream should not be read from or written to within the interceptor.
+type StreamInterceptor func(dStr *Stream, next StreamHandler) error
+
+// interceptorChain is a thread-safe list of stream interceptors.
+type interceptorChain struct {
+	list []StreamInterceptor
+	mx   sync.RWMutex
+}
+
+// add appends an interceptor to the end of the chain.
+func (ic *interceptorChain) add(fn StreamInterceptor) {
+	ic.mx.Lock()
+	list := make([]StreamInterceptor, len(ic.list), len(ic.list)+1)
+	copy(list, ic.list)
+	ic.list = append(list, fn)
+	ic.mx.Unlock()
+}
+
+// handle passes the stream through the chain of interceptors, in the order they were added, before calling 'final'.
+func (ic *interceptorChain) handle(dStr *Stream, final StreamHandler) error {
+	if ic == nil {
+		return final(dStr)
+	}
+
+	ic.mx.RLock()
+	list := ic.list
+	ic.mx.RUnlock()
+
+	h := final
+	for i := len(list) - 1; i >= 0; i-- {
+		fn, next := list[i], h
+		h = func(dStr *Stream) error { return fn(dStr, next) }
+	}
+	return h(dStr)
+}
@@ -0,0 +1,40 @@
+package dmsg
+
+import (
+	"context"
+	"net"
+)
+
+// Dialer dials dmsg streams. It is implemented by *Client.
+// Consumers which only dial should depend on Dialer rather than *Client, so that they can be tested with mocks.
+type Dialer interface {
+	Dial(ctx context.Context, addr Addr, opts ...DialOption) (net.Conn, error)
+}
+
+// ListenerProvider listens on dmsg ports. It is implemented by *Client (see ListenNet).
+type ListenerProvider interface {
+	ListenNet(port uint16) (net.Listener, error)
+}
+
+// Relay serves dmsg sessions of clients, and relays streams between them. It is implemented by *Server.
+type Relay interface {
+	ServeContext(ctx context.Context, lis net.Listener, addr string) error
+	Ready() <-chan struct{}
+	Stats() ServerStats
+	Close() error
+}
+
+var (
+	_ Dialer           = (*Client)(nil)
+	_ ListenerProvider = (*Client)(nil)
+	_ Relay            = (*Server)(nil)
+)
+
+// ListenNet is Listen, but returns a net.Listener (which accepts *Stream) so that *Client implements ListenerProvider.
+func (ce *Client) ListenNet(port uint16) (net.Listener, error) {
+	lis, err := ce.Listen(port)
+	if err != nil {
+		return nil, err
+	}
+	return lis, nil
+}
@@ -0,0 +1,131 @@
+// Package introspect defines the local introspection API of dmsg clients, which is served as JSON-RPC over a unix
+// socket. It exposes the sessions and streams of a client (for debugging stuck applications in the field) and allows
+// changing log levels at runtime.
+package introspect
+
+import (
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"time"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+const (
+	// ServiceName is the name of the RPC service.
+	ServiceName = "Introspect"
+
+	// DefaultSocket is the default path of the introspection socket.
+	DefaultSocket = "/tmp/dmsg-introspect.sock"
+)
+
+// SessionInfo describes a session of a dmsg client with a dmsg server.
+type SessionInfo struct {
+	ServerPK   cipher.PubKey `json:"server_pk"`
+	RemoteAddr string        `json:"remote_addr"`
+	Streams    int           `json:"streams"` // number of established streams
+}
+
+// StreamInfo describes an established stream of a dmsg client.
+type StreamInfo struct {
+	ID           uint32        `json:"id"`
+	ServerPK     cipher.PubKey `json:"server_pk"`
+	Local        string        `json:"local"`
+	Remote       string        `json:"remote"`
+	Initiator    bool          `json:"initiator"`
+	Age          time.Duration `json:"age"`
+	BytesRead    uint64        `json:"bytes_read"`
+	BytesWritten uint64        `json:"bytes_written"`
+	PendingWrite bool          `json:"pending_write"` // whether a write is in progress (such as blocked by a full window)
+	QueuedBytes  int           `json:"queued_bytes"`  // bytes which are read from the stream but not yet consumed
+}
+
+// LogLevelArgs are the arguments of SetLogLevel.
+type LogLevelArgs struct {
+	Subsystem string `json:"subsystem"` // empty for all subsystems
+	Level     string `json:"level"`
+}
+
+// Source provides the data of the introspection API (such as a dmsg client).
+type Source interface {
+	Sessions() []SessionInfo
+	Streams() []StreamInfo
+	SetLogLevel(subsystem, level string) error
+}
+
+// Serve serves the introspection API of the source on the listener, until the listener is closed.
+func Serve(lis net.Listener, src Source) error {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(ServiceName, &gateway{src: src}); err != nil {
+		return err
+	}
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// gateway exposes a Source as RPC methods.
+type gateway struct {
+	src Source
+}
+
+// Sessions returns the sessions of the source.
+func (g *gateway) Sessions(_ *struct{}, out *[]SessionInfo) error {
+	*out = g.src.Sessions()
+	return nil
+}
+
+// Streams returns the streams of the source.
+func (g *gateway) Streams(_ *struct{}, out *[]StreamInfo) error {
+	*out = g.src.Streams()
+	return nil
+}
+
+// SetLogLevel sets the log level of a subsystem of the source.
+func (g *gateway) SetLogLevel(in *LogLevelArgs, _ *struct{}) error {
+	return g.src.SetLogLevel(in.Subsystem, in.Level)
+}
+
+// Client is a client of the introspection API.
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Dial connects to the introspection socket of the given path.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rpc: jsonrpc.NewClient(conn)}, nil
+}
+
+// Sessions returns the sessions of the dmsg client.
+func (c *Client) Sessions() ([]SessionInfo, error) {
+	var out []SessionInfo
+	err := c.rpc.Call(ServiceName+".Sessions", &struct{}{}, &out)
+	return out, err
+}
+
+// Streams returns the established streams of the dmsg client.
+func (c *Client) Streams() ([]StreamInfo, error) {
+	var out []StreamInfo
+	err := c.rpc.Call(ServiceName+".Streams", &struct{}{}, &out)
+	return out, err
+}
+
+// SetLogLevel sets the log level of a subsystem of the dmsg client (such as "session" or "stream"), or of all
+// subsystems if the subsystem is empty.
+func (c *Client) SetLogLevel(subsystem, level string) error {
+	return c.rpc.Call(ServiceName+".SetLogLevel", &LogLevelArgs{Subsystem: subsystem, Level: level}, &struct{}{})
+}
+
+// Close closes the connection to the introspection socket.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
@@ -0,0 +1,65 @@
+package introspect
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+type testSource struct {
+	sessions  []SessionInfo
+	streams   []StreamInfo
+	subsystem string
+	level     string
+}
+
+func (s *testSource) Sessions() []SessionInfo { return s.sessions }
+func (s *testSource) Streams() []StreamInfo   { return s.streams }
+
+func (s *testSource) SetLogLevel(subsystem, level string) error {
+	s.subsystem, s.level = subsystem, level
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "introspect")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	path := filepath.Join(dir, "introspect.sock")
+	lis, err := net.Listen("unix", path)
+	require.NoError(t, err)
+
+	pk, _ := cipher.GenerateKeyPair()
+	src := &testSource{
+		sessions: []SessionInfo{{ServerPK: pk, RemoteAddr: "127.0.0.1:8080", Streams: 1}},
+		streams:  []StreamInfo{{ID: 1, ServerPK: pk, Local: "a:1", Remote: "b:2", BytesRead: 3}},
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- Serve(lis, src) }()
+
+	c, err := Dial(path)
+	require.NoError(t, err)
+
+	sessions, err := c.Sessions()
+	require.NoError(t, err)
+	require.Equal(t, src.sessions, sessions)
+
+	streams, err := c.Streams()
+	require.NoError(t, err)
+	require.Equal(t, src.streams, streams)
+
+	require.NoError(t, c.SetLogLevel("stream", "debug"))
+	require.Equal(t, "stream", src.subsystem)
+	require.Equal(t, "debug", src.level)
+
+	require.NoError(t, c.Close())
+	require.NoError(t, lis.Close())
+	require.Error(t, <-errCh)
+}
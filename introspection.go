@@ -0,0 +1,152 @@
+package dmsg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/dmsg/introspect"
+)
+
+// serveIntrospection serves the introspection API (see package introspect) on the unix socket of the given path,
+// until the client is closed.
+func (ce *Client) serveIntrospection(path string) {
+	log := ce.log.WithField("socket", path)
+
+	// Remove the socket of a previous run, unless it is still served.
+	if conn, err := net.Dial("unix", path); err == nil {
+		_ = conn.Close() //nolint:errcheck
+		log.Error("Introspection socket is already served by another process.")
+		return
+	}
+	_ = os.Remove(path) //nolint:errcheck
+
+	lis, err := listenPrivateUnix(path)
+	if err != nil {
+		log.WithError(err).Error("Failed to listen on introspection socket.")
+		return
+	}
+	go func() {
+		<-ce.done
+		log.WithError(lis.Close()).Debug("Closed introspection socket.")
+		_ = os.Remove(path) //nolint:errcheck
+	}()
+
+	log.Info("Serving introspection socket.")
+	err = introspect.Serve(lis, clientIntrospection{ce: ce})
+	log.WithError(err).Debug("Stopped serving introspection socket.")
+}
+
+// listenPrivateUnix listens on a unix socket of the given path, which is only accessible by the owner. The socket is
+// created in a directory which is only accessible by the owner, and is only moved to the path once its permissions are
+// restricted, so that it is never accessible by others regardless of the umask. The socket is not removed on close.
+func listenPrivateUnix(path string) (*net.UnixListener, error) {
+	dir, err := ioutil.TempDir(filepath.Dir(path), ".dmsg")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }() //nolint:errcheck
+
+	tmpPath := filepath.Join(dir, "s") // kept short, as socket paths are limited to about 100 bytes
+	lis, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	lis.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		_ = lis.Close() //nolint:errcheck
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = lis.Close() //nolint:errcheck
+		return nil, err
+	}
+	return lis, nil
+}
+
+// clientIntrospection implements introspect.Source for a client.
+type clientIntrospection struct {
+	ce *Client
+}
+
+// Sessions implements introspect.Source
+func (ci clientIntrospection) Sessions() []introspect.SessionInfo {
+	sessions := ci.ce.AllSessions()
+	out := make([]introspect.SessionInfo, 0, len(sessions))
+	for _, ses := range sessions {
+		out = append(out, introspect.SessionInfo{
+			ServerPK:   ses.RemotePK(),
+			RemoteAddr: ses.ys.RemoteAddr().String(),
+			Streams:    ses.StreamCount(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ServerPK.Hex() < out[j].ServerPK.Hex() })
+	return out
+}
+
+// Streams implements introspect.Source
+func (ci clientIntrospection) Streams() []introspect.StreamInfo {
+	var out []introspect.StreamInfo
+	for _, ses := range ci.ce.AllSessions() {
+		for _, s := range ses.allStreams() {
+			out = append(out, s.Introspect())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Age > out[j].Age })
+	return out
+}
+
+// SetLogLevel implements introspect.Source
+func (ci clientIntrospection) SetLogLevel(subsystem, level string) error {
+	return ci.ce.setLogLevel(subsystem, level)
+}
+
+// Introspect returns the state of the stream, as reported by the introspection API.
+func (s *Stream) Introspect() introspect.StreamInfo {
+	return introspect.StreamInfo{
+		ID:           s.StreamID(),
+		ServerPK:     s.ses.RemotePK(),
+		Local:        s.lAddr.String(),
+		Remote:       s.rAddr.String(),
+		Initiator:    s.ns.Initiator(),
+		Age:          time.Since(s.opened),
+		BytesRead:    atomic.LoadUint64(&s.bytesRead),
+		BytesWritten: atomic.LoadUint64(&s.bytesWritten),
+		PendingWrite: atomic.LoadInt32(&s.writing) == 1,
+		QueuedBytes:  int(atomic.LoadInt32(&s.queued)),
+	}
+}
+
+// setLogLevel sets the log level of the given subsystem (see LogConfig), or of all subsystems if the subsystem is
+// empty. The level applies to loggers which are obtained afterwards (such as of new sessions and streams).
+func (c *EntityCommon) setLogLevel(subsystem, level string) error {
+	if _, err := logrus.ParseLevel(level); err != nil {
+		return err
+	}
+
+	c.logMx.Lock()
+	defer c.logMx.Unlock()
+
+	switch subsystem {
+	case "":
+		c.logConf = LogConfig{Session: level, Stream: level, Discovery: level, Handshake: level}
+	case LogSession:
+		c.logConf.Session = level
+	case LogStream:
+		c.logConf.Stream = level
+	case LogDiscovery:
+		c.logConf.Discovery = level
+	case LogHandshake:
+		c.logConf.Handshake = level
+	default:
+		return fmt.Errorf("unknown logging subsystem '%s'", subsystem)
+	}
+	return nil
+}
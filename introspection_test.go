@@ -0,0 +1,46 @@
+package dmsg
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenPrivateUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmsg-introspect")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, os.RemoveAll(dir)) }()
+
+	path := filepath.Join(dir, "dmsg.sock")
+	lis, err := listenPrivateUnix(path)
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.ModeSocket, info.Mode()&os.ModeSocket)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The directory in which the socket was created is removed.
+	names, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, names, 1)
+
+	// The socket is served on the path it was moved to.
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err == nil {
+			err = conn.Close()
+		}
+		accepted <- err
+	}()
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	require.NoError(t, <-accepted)
+	require.NoError(t, conn.Close())
+	require.NoError(t, lis.Close())
+}
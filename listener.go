@@ -9,7 +9,8 @@ import (
 
 // Listener listens for remote-initiated streams.
 type Listener struct {
-	addr Addr // local listening address
+	addr         Addr              // local listening address
+	interceptors *interceptorChain // intercepts streams before they are accepted (may be nil)
 
 	accept chan *Stream
 	mx     sync.Mutex // protects 'accept'
@@ -0,0 +1,234 @@
+// Package loadtest generates traffic over dmsg streams towards a remote echo service, and measures latencies and
+// drops. It is intended for capacity planning of dmsg servers.
+package loadtest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/ports"
+)
+
+// DefaultPort is the dmsg port that the echo service listens on by default.
+const DefaultPort = ports.Echo
+
+// headerSize is the size of the message header (sequence number and send timestamp).
+const headerSize = 16
+
+var (
+	// ErrMsgTooSmall occurs when the configured message size cannot fit the message header.
+	ErrMsgTooSmall = fmt.Errorf("message size should be at least %d bytes", headerSize)
+	// ErrNoStreams occurs when no streams could be dialed to the target.
+	ErrNoStreams = errors.New("failed to dial any streams to target")
+)
+
+// Config configures a load test.
+type Config struct {
+	Streams      int           // number of concurrent streams to the target
+	MsgSize      int           // size of each message in bytes
+	MsgRate      int           // messages written per second per stream (0 for no limit)
+	Duration     time.Duration // duration in which messages are written
+	DrainTimeout time.Duration // duration to wait for outstanding echoes after writing stops
+}
+
+// DefaultConfig returns the default load test config.
+func DefaultConfig() Config {
+	return Config{
+		Streams:      10,
+		MsgSize:      1024,
+		MsgRate:      10,
+		Duration:     time.Second * 30,
+		DrainTimeout: time.Second * 5,
+	}
+}
+
+// ServeEcho accepts streams from the given listener and echos back everything that is read.
+// It returns when the listener is closed.
+func ServeEcho(lis *dmsg.Listener) error {
+	for {
+		stream, err := lis.AcceptStream()
+		if err != nil {
+			return err
+		}
+		go func() {
+			_, _ = io.Copy(stream, stream) //nolint:errcheck
+			_ = stream.Close()             //nolint:errcheck
+		}()
+	}
+}
+
+// Run opens 'conf.Streams' streams from 'c' to the echo service at 'dst', and drives traffic as specified by 'conf'.
+// An error is only returned if no streams could be dialed. Otherwise, failures are recorded in the returned Report.
+func Run(ctx context.Context, c *dmsg.Client, dst dmsg.Addr, conf Config) (*Report, error) {
+	if conf.MsgSize < headerSize {
+		return nil, ErrMsgTooSmall
+	}
+
+	streams := make([]*dmsg.Stream, 0, conf.Streams)
+	rep := &Report{Config: conf}
+	for i := 0; i < conf.Streams; i++ {
+		stream, err := c.DialStream(ctx, dst)
+		if err != nil {
+			rep.DialErrors++
+			continue
+		}
+		streams = append(streams, stream)
+	}
+	if len(streams) == 0 {
+		return rep, ErrNoStreams
+	}
+
+	wCtx, cancel := context.WithTimeout(ctx, conf.Duration)
+	defer cancel()
+
+	start := time.Now()
+	results := make(chan streamResult, len(streams))
+	for _, stream := range streams {
+		go func(stream *dmsg.Stream) {
+			results <- runStream(wCtx, stream, conf)
+		}(stream)
+	}
+	for range streams {
+		rep.add(<-results)
+	}
+	rep.Elapsed = time.Since(start)
+	rep.Streams = len(streams)
+
+	sort.Slice(rep.latencies, func(i, j int) bool { return rep.latencies[i] < rep.latencies[j] })
+	return rep, nil
+}
+
+// streamResult is the result of a single stream of a load test.
+type streamResult struct {
+	sent      uint64 // accessed atomically
+	received  uint64 // accessed atomically
+	writeDone int32  // accessed atomically, set to 1 when writing stops
+	failed    bool   // whether the stream failed before the test completed
+	latencies []time.Duration
+}
+
+// runStream writes messages to the stream until the context is done, then waits for outstanding echoes.
+func runStream(ctx context.Context, stream *dmsg.Stream, conf Config) streamResult {
+	defer func() { _ = stream.Close() }() //nolint:errcheck
+
+	var res streamResult
+	readDone := make(chan error, 1)
+	go func() {
+		readDone <- readEchoes(stream, conf.MsgSize, &res)
+	}()
+
+	var tick <-chan time.Time
+	if conf.MsgRate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(conf.MsgRate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	msg := cipher.RandByte(conf.MsgSize)
+	for seq := uint64(0); ; seq++ {
+		if tick != nil {
+			select {
+			case <-ctx.Done():
+			case <-tick:
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		binary.BigEndian.PutUint64(msg[0:8], seq)
+		binary.BigEndian.PutUint64(msg[8:16], uint64(time.Now().UnixNano()))
+		if _, err := stream.Write(msg); err != nil {
+			res.failed = true
+			break
+		}
+		atomic.AddUint64(&res.sent, 1)
+	}
+
+	// Wait for outstanding echoes (if any).
+	atomic.StoreInt32(&res.writeDone, 1)
+	deadline := time.Now().Add(conf.DrainTimeout)
+	if atomic.LoadUint64(&res.received) == atomic.LoadUint64(&res.sent) {
+		deadline = time.Now()
+	}
+	_ = stream.SetReadDeadline(deadline) //nolint:errcheck
+	<-readDone
+	return res
+}
+
+// readEchoes reads echoed messages and records their round-trip latencies.
+// It returns once writing stops and all sent messages are received, or when reading fails.
+func readEchoes(stream *dmsg.Stream, msgSize int, res *streamResult) error {
+	buf := make([]byte, msgSize)
+	for {
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			return err
+		}
+		sentAt := time.Unix(0, int64(binary.BigEndian.Uint64(buf[8:16])))
+		res.latencies = append(res.latencies, time.Since(sentAt))
+		received := atomic.AddUint64(&res.received, 1)
+		if atomic.LoadInt32(&res.writeDone) == 1 && received == atomic.LoadUint64(&res.sent) {
+			return nil
+		}
+	}
+}
+
+// Report contains the results of a load test.
+type Report struct {
+	Config Config
+
+	Streams      int           // number of streams successfully dialed
+	DialErrors   int           // number of streams that failed to dial
+	StreamErrors int           // number of streams that failed before the test completed
+	Sent         uint64        // number of messages sent
+	Received     uint64        // number of messages echoed back
+	Elapsed      time.Duration // total duration of the test (inclusive of draining)
+	latencies    []time.Duration
+}
+
+func (r *Report) add(res streamResult) {
+	r.Sent += res.sent
+	r.Received += res.received
+	if res.failed {
+		r.StreamErrors++
+	}
+	r.latencies = append(r.latencies, res.latencies...)
+}
+
+// Dropped returns the number of messages that were sent but not echoed back.
+func (r *Report) Dropped() uint64 {
+	if r.Received > r.Sent {
+		return 0
+	}
+	return r.Sent - r.Received
+}
+
+// Latency returns the round-trip latency at the given percentile (0 to 100).
+// Zero is returned if no messages were echoed back.
+func (r *Report) Latency(percentile float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies)-1) * percentile / 100)
+	if i < 0 {
+		i = 0
+	} else if i >= len(r.latencies) {
+		i = len(r.latencies) - 1
+	}
+	return r.latencies[i]
+}
+
+// Throughput returns the number of bytes echoed back per second.
+func (r *Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Received) * float64(r.Config.MsgSize) / r.Elapsed.Seconds()
+}
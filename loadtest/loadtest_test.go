@@ -0,0 +1,48 @@
+package loadtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg"
+	"github.com/SkycoinProject/dmsg/dmsgtest"
+)
+
+func TestRun(t *testing.T) {
+	env := dmsgtest.NewEnv(t, dmsgtest.DefaultTimeout)
+	require.NoError(t, env.Startup(1, 2, nil))
+	defer env.Shutdown()
+
+	clients := env.AllClients()
+	lis, err := clients[1].Listen(DefaultPort)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+	go ServeEcho(lis) //nolint:errcheck
+
+	conf := Config{
+		Streams:      3,
+		MsgSize:      128,
+		MsgRate:      50,
+		Duration:     time.Second,
+		DrainTimeout: time.Second * 5,
+	}
+	rep, err := Run(context.TODO(), clients[0], dmsg.Addr{PK: clients[1].LocalPK(), Port: DefaultPort}, conf)
+	require.NoError(t, err)
+	require.Equal(t, conf.Streams, rep.Streams)
+	require.Zero(t, rep.DialErrors)
+	require.Zero(t, rep.StreamErrors)
+	require.NotZero(t, rep.Sent)
+	require.Zero(t, rep.Dropped())
+	require.True(t, rep.Latency(50) > 0)
+	require.True(t, rep.Latency(99) >= rep.Latency(50))
+
+	t.Run("msg_too_small", func(t *testing.T) {
+		conf := DefaultConfig()
+		conf.MsgSize = headerSize - 1
+		_, err := Run(context.TODO(), clients[0], dmsg.Addr{PK: clients[1].LocalPK(), Port: DefaultPort}, conf)
+		require.Equal(t, ErrMsgTooSmall, err)
+	})
+}
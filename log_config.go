@@ -0,0 +1,74 @@
+package dmsg
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// Logging subsystems of dmsg clients (see LogConfig).
+const (
+	LogSession   = "session"   // establishment and teardown of sessions
+	LogStream    = "stream"    // established streams
+	LogDiscovery = "discovery" // entries and lookups in dmsg discovery
+	LogHandshake = "handshake" // dialing of sessions and streams
+)
+
+// LogConfig sets the log levels (such as "debug" or "warn") of the subsystems of a dmsg client, so that verbose logs of
+// one subsystem can be enabled without those of the others. Subsystems with an empty level log via the client's logger
+// as is.
+type LogConfig struct {
+	Session   string
+	Stream    string
+	Discovery string
+	Handshake string
+}
+
+func (lc LogConfig) level(subsystem string) string {
+	switch subsystem {
+	case LogSession:
+		return lc.Session
+	case LogStream:
+		return lc.Stream
+	case LogDiscovery:
+		return lc.Discovery
+	case LogHandshake:
+		return lc.Handshake
+	default:
+		return ""
+	}
+}
+
+// printWarnings prints warnings for invalid levels.
+func (lc LogConfig) printWarnings(log logrus.FieldLogger) {
+	for _, subsystem := range []string{LogSession, LogStream, LogDiscovery, LogHandshake} {
+		if lvl := lc.level(subsystem); lvl != "" {
+			if _, err := logrus.ParseLevel(lvl); err != nil {
+				log.WithError(err).Warnf("Field 'LogConfig' has invalid level for subsystem '%s' : It is ignored.",
+					subsystem)
+			}
+		}
+	}
+}
+
+// subLog returns the logger of the given subsystem. If the subsystem has a level (see LogConfig), the returned logger
+// writes to the outputs of the entity's logger with the level of the subsystem.
+func (c *EntityCommon) subLog(subsystem string) logrus.FieldLogger {
+	c.logMx.Lock()
+	lvl := c.logConf.level(subsystem)
+	c.logMx.Unlock()
+
+	level, err := logrus.ParseLevel(lvl)
+	if err != nil {
+		return c.log
+	}
+	entry := c.log.WithField("subsystem", subsystem)
+	base := entry.Logger
+	l := &logrus.Logger{
+		Out:          base.Out,
+		Hooks:        base.Hooks,
+		Formatter:    base.Formatter,
+		ReportCaller: base.ReportCaller,
+		Level:        level,
+		ExitFunc:     base.ExitFunc,
+	}
+	return l.WithFields(entry.Data)
+}
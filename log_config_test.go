@@ -0,0 +1,40 @@
+package dmsg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityCommon_subLog(t *testing.T) {
+	var buf bytes.Buffer
+	base := logrus.New()
+	base.Out = &buf
+	base.Level = logrus.InfoLevel
+
+	c := EntityCommon{log: base, logConf: LogConfig{Stream: "debug", Session: "warn"}}
+
+	c.subLog(LogStream).Debug("stream debug")
+	c.subLog(LogSession).Info("session info")
+	c.subLog(LogDiscovery).Debug("discovery debug")
+	c.subLog(LogDiscovery).Info("discovery info")
+
+	out := buf.String()
+	require.Contains(t, out, "stream debug")
+	require.Contains(t, out, "subsystem=stream")
+	require.NotContains(t, out, "session info")
+	require.NotContains(t, out, "discovery debug")
+	require.Contains(t, out, "discovery info")
+}
+
+func TestEntityCommon_setLogLevel(t *testing.T) {
+	var c EntityCommon
+	require.NoError(t, c.setLogLevel(LogStream, "debug"))
+	require.Equal(t, LogConfig{Stream: "debug"}, c.logConf)
+	require.NoError(t, c.setLogLevel("", "warn"))
+	require.Equal(t, LogConfig{Session: "warn", Stream: "warn", Discovery: "warn", Handshake: "warn"}, c.logConf)
+	require.Error(t, c.setLogLevel(LogStream, "invalid"))
+	require.Error(t, c.setLogLevel("invalid", "debug"))
+}
@@ -0,0 +1,105 @@
+package dmsg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/dmsgerr"
+)
+
+// discardLog discards all log entries (as its level is below all levels which are logged by dmsg).
+var discardLog logrus.FieldLogger = &logrus.Logger{
+	Out:       ioutil.Discard,
+	Formatter: new(logrus.TextFormatter),
+	Hooks:     make(logrus.LevelHooks),
+	Level:     logrus.PanicLevel,
+}
+
+// logSampler limits the log entries of a server per class of event (or error) per client, so that a misbehaving client
+// (such as one which reconnects in a loop) cannot flood the logs and mask other issues.
+// A nil logSampler logs all entries.
+type logSampler struct {
+	rate int // entries per second per class per client
+
+	buckets map[logSampleKey]*logSampleBucket
+	sweep   time.Time // last time stale buckets were removed
+	mx      sync.Mutex
+}
+
+type logSampleKey struct {
+	pk    cipher.PubKey
+	class string
+}
+
+type logSampleBucket struct {
+	second     int64 // unix second of the current window
+	n          int   // entries logged within the window
+	suppressed int   // entries suppressed since the last logged entry
+}
+
+func newLogSampler(rate int) *logSampler {
+	return &logSampler{
+		rate:    rate,
+		buckets: make(map[logSampleKey]*logSampleBucket),
+		sweep:   time.Now(),
+	}
+}
+
+// log returns 'log' if an entry of the given class of the given client may be logged, with the number of entries
+// suppressed since the last logged entry as the 'suppressed' field (if any). Otherwise, a logger which discards
+// entries is returned.
+func (ls *logSampler) log(log logrus.FieldLogger, pk cipher.PubKey, class string) logrus.FieldLogger {
+	if ls == nil {
+		return log
+	}
+
+	ls.mx.Lock()
+	defer ls.mx.Unlock()
+
+	now := time.Now()
+	if now.Sub(ls.sweep) > time.Minute {
+		for k, b := range ls.buckets {
+			if b.second < ls.sweep.Unix() {
+				delete(ls.buckets, k)
+			}
+		}
+		ls.sweep = now
+	}
+
+	key := logSampleKey{pk: pk, class: class}
+	b, ok := ls.buckets[key]
+	if !ok {
+		b = new(logSampleBucket)
+		ls.buckets[key] = b
+	}
+	if sec := now.Unix(); b.second != sec {
+		b.second, b.n = sec, 0
+	}
+	if b.n >= ls.rate {
+		b.suppressed++
+		return discardLog
+	}
+	b.n++
+	if b.suppressed > 0 {
+		log = log.WithField("suppressed", b.suppressed)
+		b.suppressed = 0
+	}
+	return log
+}
+
+// logClass returns the sampling class of a log entry of the given event, which is distinguished by the code (or type)
+// of the error (if any).
+func logClass(event string, err error) string {
+	if err == nil {
+		return event
+	}
+	if code, ok := dmsgerr.CodeOf(err); ok {
+		return fmt.Sprintf("%s/%d", event, code)
+	}
+	return fmt.Sprintf("%s/%T", event, err)
+}
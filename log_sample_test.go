@@ -0,0 +1,52 @@
+package dmsg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestLogSampler(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log := &logrus.Logger{Out: buf, Formatter: new(logrus.TextFormatter), Hooks: make(logrus.LevelHooks),
+		Level: logrus.InfoLevel}
+
+	pkA, _ := cipher.GenerateKeyPair()
+	pkB, _ := cipher.GenerateKeyPair()
+
+	// Start at the beginning of a second, so that all entries below are within the same window.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	ls := newLogSampler(2)
+	for i := 0; i < 5; i++ {
+		ls.log(log, pkA, "session_start").Info("A started.")
+	}
+	ls.log(log, pkA, logClass("stream_stop", io.EOF)).Info("A stopped.")
+	ls.log(log, pkB, "session_start").Info("B started.")
+	require.Equal(t, 2, strings.Count(buf.String(), "A started."))
+	require.Equal(t, 1, strings.Count(buf.String(), "A stopped."))
+	require.Equal(t, 1, strings.Count(buf.String(), "B started."))
+
+	// Suppressed entries are counted in the next logged entry of the class.
+	time.Sleep(time.Second)
+	buf.Reset()
+	ls.log(log, pkA, "session_start").Info("A started.")
+	require.Contains(t, buf.String(), "suppressed=3")
+
+	// A nil sampler logs all entries.
+	var nilLS *logSampler
+	require.Equal(t, logrus.FieldLogger(log), nilLS.log(log, pkA, "session_start"))
+}
+
+func TestLogClass(t *testing.T) {
+	require.Equal(t, "stream_stop", logClass("stream_stop", nil))
+	require.Equal(t, "stream_reject/353", logClass("stream_reject", ErrServerBusy.Wrap(io.EOF)))
+	require.Equal(t, "stream_stop/*errors.errorString", logClass("stream_stop", io.EOF))
+}
@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -24,3 +26,82 @@ func NewDmsgMetrics(service string) *DmsgMetrics {
 		}),
 	}
 }
+
+// StreamMetrics records the send queues of streams served by a dmsg server (implements dmsg.StreamMetrics).
+type StreamMetrics struct {
+	QueuedBytes    prometheus.Gauge
+	StalledStreams prometheus.Gauge
+	QueueDelay     prometheus.Summary
+}
+
+// NewStreamMetrics constructs new StreamMetrics.
+func NewStreamMetrics(service string) *StreamMetrics {
+	return NewStreamMetricsWith(prometheus.DefaultRegisterer, service)
+}
+
+// NewStreamMetricsWith constructs new StreamMetrics which are registered with the given registerer (see Registerer).
+func NewStreamMetricsWith(reg prometheus.Registerer, service string) *StreamMetrics {
+	m := &StreamMetrics{
+		QueuedBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: service + "_stream_queued_bytes",
+			Help: "The number of bytes queued for delivery to receiving clients of streams",
+		}),
+		StalledStreams: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: service + "_stream_stalled",
+			Help: "The number of streams of which the receiving client is stalled",
+		}),
+		QueueDelay: prometheus.NewSummary(prometheus.SummaryOpts{
+			Name: service + "_stream_queue_delay_seconds",
+			Help: "Time which queued bytes took to be delivered to receiving clients of streams",
+		}),
+	}
+	reg.MustRegister(m.QueuedBytes, m.StalledStreams, m.QueueDelay)
+	return m
+}
+
+// AddQueuedBytes implements dmsg.StreamMetrics
+func (m *StreamMetrics) AddQueuedBytes(delta int) {
+	m.QueuedBytes.Add(float64(delta))
+}
+
+// AddStalledStreams implements dmsg.StreamMetrics
+func (m *StreamMetrics) AddStalledStreams(delta int) {
+	m.StalledStreams.Add(float64(delta))
+}
+
+// ObserveQueueDelay implements dmsg.StreamMetrics
+func (m *StreamMetrics) ObserveQueueDelay(d time.Duration) {
+	m.QueueDelay.Observe(d.Seconds())
+}
+
+// FDMetrics records the file descriptor usage of the process of a dmsg entity (implements dmsg.FDMetrics).
+type FDMetrics struct {
+	OpenFDs prometheus.Gauge
+	FDLimit prometheus.Gauge
+}
+
+// NewFDMetricsWith constructs new FDMetrics which are registered with the given registerer (see Registerer).
+func NewFDMetricsWith(reg prometheus.Registerer, service string) *FDMetrics {
+	m := &FDMetrics{
+		OpenFDs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: service + "_open_fds",
+			Help: "The number of open file descriptors of the process",
+		}),
+		FDLimit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: service + "_fd_limit",
+			Help: "The limit of open file descriptors of the process (RLIMIT_NOFILE)",
+		}),
+	}
+	reg.MustRegister(m.OpenFDs, m.FDLimit)
+	return m
+}
+
+// SetOpenFDs implements dmsg.FDMetrics
+func (m *FDMetrics) SetOpenFDs(n int) {
+	m.OpenFDs.Set(float64(n))
+}
+
+// SetFDLimit implements dmsg.FDMetrics
+func (m *FDMetrics) SetFDLimit(n int) {
+	m.FDLimit.Set(float64(n))
+}
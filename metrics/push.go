@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPushInterval is the default interval at which metrics are pushed to a Pushgateway.
+const DefaultPushInterval = time.Second * 15
+
+// Registerer returns a registerer which adds the given constant labels (such as the public key and region of the
+// instance) to all metrics which are registered with it. Metrics are registered with prometheus.DefaultRegisterer.
+func Registerer(labels map[string]string) prometheus.Registerer {
+	if len(labels) == 0 {
+		return prometheus.DefaultRegisterer
+	}
+	return prometheus.WrapRegistererWith(labels, prometheus.DefaultRegisterer)
+}
+
+// PushPeriodically pushes the metrics of prometheus.DefaultGatherer to the Pushgateway of the given URL at the given
+// interval, until the context is canceled. This is intended for instances which cannot be scraped (such as instances
+// behind NAT). Metrics are grouped by the given job and grouping labels (which should identify the instance).
+func PushPeriodically(
+	ctx context.Context, log logrus.FieldLogger, url, job string, grouping map[string]string, interval time.Duration,
+) {
+	if interval <= 0 {
+		interval = DefaultPushInterval
+	}
+	p := push.New(url, job).Gatherer(prometheus.DefaultGatherer)
+	for k, v := range grouping {
+		p = p.Grouping(k, v)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Push(); err != nil {
+			log.WithError(err).WithField("url", url).Warn("Failed to push metrics.")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
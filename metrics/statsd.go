@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// StatsD records the send queues of streams served by a dmsg server (implements dmsg.StreamMetrics) and the file
+// descriptor usage of the process (implements dmsg.FDMetrics), and sends them to a StatsD daemon (such as statsd_exporter, or Telegraf for InfluxDB) over UDP.
+// Metrics are sent as they are recorded, and are lost if the daemon is unreachable.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+}
+
+// NewStatsD constructs a StatsD which sends to the StatsD daemon of the given address.
+// Names of metrics are prefixed with the service name (such as "dmsgserver.stream_queued_bytes").
+func NewStatsD(addr, service string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsD{conn: conn, prefix: service + "."}, nil
+}
+
+// Close closes the connection to the StatsD daemon.
+func (m *StatsD) Close() error {
+	return m.conn.Close()
+}
+
+// AddQueuedBytes implements dmsg.StreamMetrics
+func (m *StatsD) AddQueuedBytes(delta int) {
+	m.send("stream_queued_bytes", gaugeDelta(delta), "g")
+}
+
+// AddStalledStreams implements dmsg.StreamMetrics
+func (m *StatsD) AddStalledStreams(delta int) {
+	m.send("stream_stalled", gaugeDelta(delta), "g")
+}
+
+// ObserveQueueDelay implements dmsg.StreamMetrics
+func (m *StatsD) ObserveQueueDelay(d time.Duration) {
+	m.send("stream_queue_delay", fmt.Sprintf("%.3f", float64(d)/float64(time.Millisecond)), "ms")
+}
+
+// SetOpenFDs implements dmsg.FDMetrics
+func (m *StatsD) SetOpenFDs(n int) {
+	m.send("open_fds", strconv.Itoa(n), "g")
+}
+
+// SetFDLimit implements dmsg.FDMetrics
+func (m *StatsD) SetFDLimit(n int) {
+	m.send("fd_limit", strconv.Itoa(n), "g")
+}
+
+func (m *StatsD) send(name, value, typ string) {
+	_, _ = fmt.Fprintf(m.conn, "%s%s:%s|%s", m.prefix, name, value, typ) //nolint:errcheck
+}
+
+// gaugeDelta formats a gauge change, which StatsD distinguishes from an absolute value by the explicit sign.
+func gaugeDelta(delta int) string {
+	if delta < 0 {
+		return fmt.Sprintf("%d", delta)
+	}
+	return fmt.Sprintf("+%d", delta)
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	m, err := NewStatsD(conn.LocalAddr().String(), "dmsgserver")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, m.Close()) }()
+
+	read := func() string {
+		buf := make([]byte, 512)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	m.AddQueuedBytes(512)
+	require.Equal(t, "dmsgserver.stream_queued_bytes:+512|g", read())
+	m.AddStalledStreams(-1)
+	require.Equal(t, "dmsgserver.stream_stalled:-1|g", read())
+	m.ObserveQueueDelay(time.Millisecond * 1500)
+	require.Equal(t, "dmsgserver.stream_queue_delay:1500.000|ms", read())
+	m.SetOpenFDs(42)
+	require.Equal(t, "dmsgserver.open_fds:42|g", read())
+}
@@ -4,33 +4,43 @@ import (
 	"io"
 )
 
+// CloseWriter is implemented by connections which support closing the write side only (such as *net.TCPConn).
+type CloseWriter interface {
+	CloseWrite() error
+}
+
 // CopyReadWriteCloser copies reads and writes between two connections.
-// It returns when a connection returns an error.
+// When a connection reaches EOF and the other connection implements CloseWriter, the write side of the other
+// connection is closed and copying continues in the opposite direction (half-close).
+// It returns when both directions are done, or when a connection returns an error.
 func CopyReadWriteCloser(conn1, conn2 io.ReadWriteCloser) error {
-	errCh1 := make(chan error, 1)
-	go func() {
-		_, err := io.Copy(conn2, conn1)
-		errCh1 <- err
-		close(errCh1)
-	}()
+	type result struct {
+		halfClosed bool
+		err        error
+	}
+	resCh := make(chan result, 2)
 
-	errCh2 := make(chan error, 1)
-	go func() {
-		_, err := io.Copy(conn1, conn2)
-		errCh2 <- err
-		close(errCh2)
-	}()
+	copyHalf := func(dst, src io.ReadWriteCloser) {
+		_, err := io.Copy(dst, src)
+		if cw, ok := dst.(CloseWriter); ok && err == nil {
+			if err = cw.CloseWrite(); err == nil {
+				resCh <- result{halfClosed: true}
+				return
+			}
+		}
+		resCh <- result{err: err}
+	}
+	go copyHalf(conn2, conn1)
+	go copyHalf(conn1, conn2)
 
-	select {
-	case err := <-errCh1:
-		_ = conn1.Close() //nolint:errcheck
-		_ = conn2.Close() //nolint:errcheck
-		<-errCh2
-		return err
-	case err := <-errCh2:
-		_ = conn2.Close() //nolint:errcheck
-		_ = conn1.Close() //nolint:errcheck
-		<-errCh1
-		return err
+	res, pending := <-resCh, 1
+	if res.halfClosed {
+		res, pending = <-resCh, 0
+	}
+	_ = conn1.Close() //nolint:errcheck
+	_ = conn2.Close() //nolint:errcheck
+	if pending > 0 {
+		<-resCh
 	}
+	return res.err
 }
@@ -0,0 +1,50 @@
+package netutil
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tcpPipe returns both ends of a TCP connection.
+func tcpPipe(t *testing.T) (*net.TCPConn, *net.TCPConn) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	c1, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	c2, err := lis.Accept()
+	require.NoError(t, err)
+	return c1.(*net.TCPConn), c2.(*net.TCPConn)
+}
+
+func TestCopyReadWriteCloser_HalfClose(t *testing.T) {
+	a, aRelay := tcpPipe(t)
+	bRelay, b := tcpPipe(t)
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- CopyReadWriteCloser(aRelay, bRelay) }()
+
+	// A writes its request and half-closes.
+	_, err := a.Write([]byte("request"))
+	require.NoError(t, err)
+	require.NoError(t, a.CloseWrite())
+
+	// B reads the request until EOF, and can still respond.
+	req, err := ioutil.ReadAll(b)
+	require.NoError(t, err)
+	require.Equal(t, "request", string(req))
+	_, err = b.Write([]byte("response"))
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+
+	resp, err := ioutil.ReadAll(a)
+	require.NoError(t, err)
+	require.Equal(t, "response", string(resp))
+	require.NoError(t, a.Close())
+
+	require.NoError(t, <-errCh)
+}
@@ -46,6 +46,29 @@ func (p *Porter) Reserve(port uint16, v interface{}) (bool, func()) {
 	return true, p.makePortFreer(port)
 }
 
+// ReserveAll reserves all of the given ports with the same value, or none of them if any of the ports is already
+// reserved. It returns a boolean informing whether the ports are reserved, and a function to clear the reservations.
+func (p *Porter) ReserveAll(ports []uint16, v interface{}) (bool, func()) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, port := range ports {
+		if _, ok := p.ports[port]; ok {
+			return false, nil
+		}
+	}
+	frees := make([]func(), 0, len(ports))
+	for _, port := range ports {
+		p.ports[port] = v
+		frees = append(frees, p.makePortFreer(port))
+	}
+	return true, func() {
+		for _, free := range frees {
+			free()
+		}
+	}
+}
+
 // ReserveEphemeral reserves a new ephemeral port.
 // It returns the reserved ephemeral port, a function to clear the reservation and an error (if any).
 func (p *Porter) ReserveEphemeral(ctx context.Context, v interface{}) (uint16, func(), error) {
@@ -0,0 +1,194 @@
+package netutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// PublicIPFunc obtains the public IP of the local host.
+type PublicIPFunc func(ctx context.Context) (net.IP, error)
+
+// Errors which may be returned by public IP detection.
+var (
+	ErrInvalidPublicIP   = errors.New("public IP detection returned an invalid IP")
+	ErrInvalidSTUNResp   = errors.New("invalid STUN response")
+	ErrNoSTUNMappedAddr  = errors.New("STUN response has no mapped address")
+	ErrUnsupportedDetect = errors.New("unsupported public IP detection method")
+)
+
+// PublicIPFromString returns a PublicIPFunc from a detection method string.
+// Supported formats are 'http://<echo-url>', 'https://<echo-url>' and 'stun:<host>:<port>'.
+func PublicIPFromString(method string) (PublicIPFunc, error) {
+	switch {
+	case strings.HasPrefix(method, "http://"), strings.HasPrefix(method, "https://"):
+		return HTTPPublicIP(method), nil
+	case strings.HasPrefix(method, "stun:"):
+		return STUNPublicIP(strings.TrimPrefix(method, "stun:")), nil
+	default:
+		return nil, fmt.Errorf("%v: %s", ErrUnsupportedDetect, method)
+	}
+}
+
+// HTTPPublicIP returns a PublicIPFunc which obtains the public IP from a HTTP echo service.
+// The service is expected to respond with the caller's IP as plain text.
+func HTTPPublicIP(url string) PublicIPFunc {
+	return func(ctx context.Context) (net.IP, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }() //nolint:errcheck
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("public IP echo service responded with status %d", resp.StatusCode)
+		}
+		b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64))
+		if err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(string(bytes.TrimSpace(b)))
+		if ip == nil {
+			return nil, ErrInvalidPublicIP
+		}
+		return ip, nil
+	}
+}
+
+// STUN constants (RFC 5389).
+const (
+	stunBindingReq     = 0x0001
+	stunBindingResp    = 0x0101
+	stunMagicCookie    = 0x2112A442
+	stunHeaderSize     = 20
+	stunAttrMapped     = 0x0001
+	stunAttrXORMapped  = 0x0020
+	stunFamilyIPv4     = 0x01
+	stunFamilyIPv6     = 0x02
+	stunMaxMessageSize = 1280
+)
+
+// STUNPublicIP returns a PublicIPFunc which obtains the public IP via a STUN binding request to the given server.
+func STUNPublicIP(server string) PublicIPFunc {
+	return func(ctx context.Context) (net.IP, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "udp", server)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = conn.Close() }() //nolint:errcheck
+
+		if deadline, ok := ctx.Deadline(); ok {
+			if err := conn.SetDeadline(deadline); err != nil {
+				return nil, err
+			}
+		}
+
+		req := make([]byte, stunHeaderSize)
+		binary.BigEndian.PutUint16(req[0:2], stunBindingReq)
+		binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+		if _, err := rand.Read(req[8:20]); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+
+		resp := make([]byte, stunMaxMessageSize)
+		n, err := conn.Read(resp)
+		if err != nil {
+			return nil, err
+		}
+		return parseSTUNResponse(resp[:n], req[8:20])
+	}
+}
+
+// parseSTUNResponse obtains the mapped IP from a STUN binding response of the given transaction ID.
+func parseSTUNResponse(b, txID []byte) (net.IP, error) {
+	if len(b) < stunHeaderSize ||
+		binary.BigEndian.Uint16(b[0:2]) != stunBindingResp ||
+		binary.BigEndian.Uint32(b[4:8]) != stunMagicCookie ||
+		!bytes.Equal(b[8:20], txID) {
+		return nil, ErrInvalidSTUNResp
+	}
+	attrs := b[stunHeaderSize:]
+	if l := int(binary.BigEndian.Uint16(b[2:4])); l <= len(attrs) {
+		attrs = attrs[:l]
+	}
+
+	var mapped net.IP
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:2])
+		l := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if len(attrs) < 4+l {
+			return nil, ErrInvalidSTUNResp
+		}
+		val := attrs[4 : 4+l]
+
+		switch typ {
+		case stunAttrXORMapped:
+			ip, err := stunAttrIP(val)
+			if err != nil {
+				return nil, err
+			}
+			// The IP is XOR'ed with the magic cookie followed by the transaction ID.
+			key := append(append([]byte{}, b[4:8]...), txID...)
+			for i := range ip {
+				ip[i] ^= key[i]
+			}
+			return ip, nil
+		case stunAttrMapped:
+			ip, err := stunAttrIP(val)
+			if err != nil {
+				return nil, err
+			}
+			mapped = ip
+		}
+
+		// Attributes are padded to a multiple of 4 bytes.
+		if l%4 != 0 {
+			l += 4 - l%4
+		}
+		if len(attrs) < 4+l {
+			break
+		}
+		attrs = attrs[4+l:]
+	}
+	if mapped == nil {
+		return nil, ErrNoSTUNMappedAddr
+	}
+	return mapped, nil
+}
+
+// stunAttrIP obtains the (possibly XOR'ed) IP from a MAPPED-ADDRESS or XOR-MAPPED-ADDRESS attribute value.
+func stunAttrIP(val []byte) (net.IP, error) {
+	if len(val) < 4 {
+		return nil, ErrInvalidSTUNResp
+	}
+	switch val[1] {
+	case stunFamilyIPv4:
+		if len(val) < 8 {
+			return nil, ErrInvalidSTUNResp
+		}
+		return net.IP(append([]byte{}, val[4:8]...)), nil
+	case stunFamilyIPv6:
+		if len(val) < 20 {
+			return nil, ErrInvalidSTUNResp
+		}
+		return net.IP(append([]byte{}, val[4:20]...)), nil
+	default:
+		return nil, ErrInvalidSTUNResp
+	}
+}
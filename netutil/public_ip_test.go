@@ -0,0 +1,71 @@
+package netutil
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPPublicIP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, "203.0.113.7") //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	ipFunc, err := PublicIPFromString(srv.URL)
+	require.NoError(t, err)
+
+	ip, err := ipFunc(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, "203.0.113.7", ip.String())
+}
+
+func TestSTUNPublicIP(t *testing.T) {
+	pubIP := net.ParseIP("198.51.100.23").To4()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	// Fake STUN server which responds with an XOR-MAPPED-ADDRESS attribute.
+	go func() {
+		req := make([]byte, stunMaxMessageSize)
+		n, addr, err := conn.ReadFrom(req)
+		if err != nil || n < stunHeaderSize {
+			return
+		}
+		resp := make([]byte, stunHeaderSize+12)
+		binary.BigEndian.PutUint16(resp[0:2], stunBindingResp)
+		binary.BigEndian.PutUint16(resp[2:4], 12)
+		copy(resp[4:20], req[4:20])
+		binary.BigEndian.PutUint16(resp[20:22], stunAttrXORMapped)
+		binary.BigEndian.PutUint16(resp[22:24], 8)
+		resp[25] = stunFamilyIPv4
+		for i := range pubIP {
+			resp[28+i] = pubIP[i] ^ req[4+i]
+		}
+		_, _ = conn.WriteTo(resp, addr) //nolint:errcheck
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	ipFunc, err := PublicIPFromString("stun:" + conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	ip, err := ipFunc(ctx)
+	require.NoError(t, err)
+	require.True(t, pubIP.Equal(ip))
+}
+
+func TestPublicIPFromString(t *testing.T) {
+	_, err := PublicIPFromString("ftp://example.com")
+	require.Error(t, err)
+}
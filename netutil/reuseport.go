@@ -0,0 +1,114 @@
+package netutil
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrReusePortUnsupported is returned by ListenReusePort on platforms which do not support SO_REUSEPORT.
+var ErrReusePortUnsupported = errors.New("SO_REUSEPORT is not supported on this platform")
+
+// ListenReusePort listens on the given TCP address with 'n' sockets which have SO_REUSEPORT set, so that the kernel
+// distributes incoming connections between the sockets. Each socket is served by an independent accept loop, and the
+// accepted connections are returned by the Accept method of the returned listener.
+// This removes the single accept loop as a bottleneck when many connections arrive at once (such as when clients
+// reconnect after a network outage). It is only supported on Linux.
+func ListenReusePort(network, addr string, n int) (net.Listener, error) {
+	if n < 1 {
+		n = 1
+	}
+	ls := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		// The port of the first socket is used for the rest, in case 'addr' has port 0.
+		if i == 1 {
+			addr = ls[0].Addr().String()
+		}
+		l, err := listenReusePort(network, addr)
+		if err != nil {
+			for _, l := range ls {
+				_ = l.Close() //nolint:errcheck
+			}
+			return nil, err
+		}
+		ls = append(ls, l)
+	}
+	return newMultiListener(ls), nil
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// multiListener merges the accepted connections of multiple listeners.
+type multiListener struct {
+	ls     []net.Listener
+	accept chan acceptResult
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newMultiListener(ls []net.Listener) *multiListener {
+	ml := &multiListener{
+		ls:     ls,
+		accept: make(chan acceptResult),
+		done:   make(chan struct{}),
+	}
+	for _, l := range ls {
+		go ml.acceptLoop(l)
+	}
+	return ml
+}
+
+func (ml *multiListener) acceptLoop(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+			continue
+		}
+		select {
+		case ml.accept <- acceptResult{conn: conn, err: err}:
+			if err != nil {
+				return
+			}
+		case <-ml.done:
+			if conn != nil {
+				_ = conn.Close() //nolint:errcheck
+			}
+			return
+		}
+	}
+}
+
+// Accept implements net.Listener
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case res := <-ml.accept:
+		if res.err != nil {
+			_ = ml.Close() //nolint:errcheck
+		}
+		return res.conn, res.err
+	case <-ml.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+// Close implements net.Listener
+func (ml *multiListener) Close() error {
+	var err error
+	ml.once.Do(func() {
+		close(ml.done)
+		for _, l := range ml.ls {
+			if cErr := l.Close(); cErr != nil && err == nil {
+				err = cErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr implements net.Listener
+func (ml *multiListener) Addr() net.Addr {
+	return ml.ls[0].Addr()
+}
@@ -0,0 +1,9 @@
+// +build !linux
+
+package netutil
+
+import "net"
+
+func listenReusePort(_, _ string) (net.Listener, error) {
+	return nil, ErrReusePortUnsupported
+}
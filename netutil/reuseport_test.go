@@ -0,0 +1,39 @@
+// +build linux
+
+package netutil
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenReusePort(t *testing.T) {
+	const n = 4
+
+	lis, err := ListenReusePort("tcp", "127.0.0.1:0", n)
+	require.NoError(t, err)
+
+	for i := 0; i < n*4; i++ {
+		conn, err := net.Dial("tcp", lis.Addr().String())
+		require.NoError(t, err)
+
+		aConn, err := lis.Accept()
+		require.NoError(t, err)
+
+		_, err = conn.Write([]byte{byte(i)})
+		require.NoError(t, err)
+		b := make([]byte, 1)
+		_, err = aConn.Read(b)
+		require.NoError(t, err)
+		require.Equal(t, byte(i), b[0])
+
+		require.NoError(t, conn.Close())
+		require.NoError(t, aConn.Close())
+	}
+
+	require.NoError(t, lis.Close())
+	_, err = lis.Accept()
+	require.Error(t, err)
+}
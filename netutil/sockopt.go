@@ -0,0 +1,59 @@
+package netutil
+
+import (
+	"net"
+	"time"
+)
+
+// SocketOptions are options of TCP connections. Zero values leave the defaults of the OS and the net package.
+type SocketOptions struct {
+	// DelayWrites enables Nagle's algorithm (TCP_NODELAY is unset), so that small writes are coalesced at the cost of
+	// latency. By default, TCP_NODELAY is set.
+	DelayWrites bool
+
+	// KeepAlivePeriod is the period between TCP keep-alive probes. A negative value disables keep-alives.
+	KeepAlivePeriod time.Duration
+
+	// ReadBuffer is the size of the receive buffer of the OS (SO_RCVBUF).
+	ReadBuffer int
+
+	// WriteBuffer is the size of the send buffer of the OS (SO_SNDBUF).
+	WriteBuffer int
+}
+
+// Apply applies the socket options to the connection. Connections which are not of type *net.TCPConn are left as is.
+func (o SocketOptions) Apply(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if o.DelayWrites {
+		if err := tcpConn.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	if o.KeepAlivePeriod < 0 {
+		if err := tcpConn.SetKeepAlive(false); err != nil {
+			return err
+		}
+	}
+	if o.KeepAlivePeriod > 0 {
+		if err := tcpConn.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tcpConn.SetKeepAlivePeriod(o.KeepAlivePeriod); err != nil {
+			return err
+		}
+	}
+	if o.ReadBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(o.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if o.WriteBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(o.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package netutil
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"nhooyr.io/websocket"
+)
+
+// errClosedListener is returned when using a closed WSListener.
+var errClosedListener = errors.New("use of closed websocket listener")
+
+// WSListener accepts websocket connections over HTTP, and exposes them as a net.Listener.
+// Data is transferred via binary websocket messages.
+type WSListener struct {
+	lis    net.Listener
+	srv    *http.Server
+	accept chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewWSListener serves websocket upgrades on the given listener.
+func NewWSListener(lis net.Listener) *WSListener {
+	wl := &WSListener{
+		lis:    lis,
+		accept: make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+	wl.srv = &http.Server{Handler: http.HandlerFunc(wl.handle)}
+	go func() { _ = wl.srv.Serve(lis) }() //nolint:errcheck
+	return wl
+}
+
+func (wl *WSListener) handle(w http.ResponseWriter, r *http.Request) {
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	// The request context is only valid until the handler returns, so we block until the connection is closed.
+	conn := &wsConn{Conn: websocket.NetConn(r.Context(), ws, websocket.MessageBinary), closed: make(chan struct{})}
+	select {
+	case wl.accept <- conn:
+	case <-wl.done:
+		_ = ws.Close(websocket.StatusGoingAway, "listener closed") //nolint:errcheck
+		return
+	}
+	<-conn.closed
+}
+
+// Accept implements net.Listener
+func (wl *WSListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-wl.accept:
+		return conn, nil
+	case <-wl.done:
+		return nil, &net.OpError{Op: "accept", Net: "ws", Addr: wl.lis.Addr(), Err: errClosedListener}
+	}
+}
+
+// Close implements net.Listener
+// Accepted connections are not closed.
+func (wl *WSListener) Close() error {
+	err := errClosedListener
+	wl.once.Do(func() {
+		close(wl.done)
+		err = wl.srv.Close()
+	})
+	return err
+}
+
+// Addr implements net.Listener
+func (wl *WSListener) Addr() net.Addr {
+	return wl.lis.Addr()
+}
+
+// DialWS dials a websocket connection to the given address, and exposes it as a net.Conn.
+// The address may be a 'ws://' or 'wss://' URL, or a 'host:port' pair (which is dialed via 'ws://').
+func DialWS(ctx context.Context, addr string) (net.Conn, error) {
+	url := addr
+	if !strings.HasPrefix(url, "ws://") && !strings.HasPrefix(url, "wss://") {
+		url = "ws://" + addr
+	}
+	ws, _, err := websocket.Dial(ctx, url, nil) //nolint:bodyclose
+	if err != nil {
+		return nil, err
+	}
+	return websocket.NetConn(context.Background(), ws, websocket.MessageBinary), nil
+}
+
+// wsConn signals when it is closed.
+type wsConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+// Close implements net.Conn
+func (c *wsConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { close(c.closed) })
+	return err
+}
@@ -0,0 +1,49 @@
+package netutil
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+)
+
+func TestWSListener(t *testing.T) {
+	lis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+
+	wl := NewWSListener(lis)
+	defer func() { require.NoError(t, wl.Close()) }()
+
+	// Echo server.
+	go func() {
+		for {
+			conn, err := wl.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(conn, conn) //nolint:errcheck
+				_ = conn.Close()           //nolint:errcheck
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := DialWS(ctx, wl.Addr().String())
+	require.NoError(t, err)
+
+	msg := []byte("hello over websocket")
+	_, err = conn.Write(msg)
+	require.NoError(t, err)
+
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+	require.NoError(t, conn.Close())
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
+	"runtime"
+	"time"
 
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 
@@ -23,36 +25,56 @@ type Config struct {
 	LocalSK   cipher.SecKey // Local instance static secret key.
 	RemotePK  cipher.PubKey // Remote instance static public key.
 	Initiator bool          // Whether the local instance initiates the connection.
+	Prologue  []byte        // Optional data which must be identical on both sides for the handshake to succeed.
+	Rekey     RekeyConfig   // Optional triggers for rotating the transport keys.
+	Settings  []byte        // Optional settings which are sent to the remote during the handshake.
 }
 
 // Noise handles the handshake and the frame's cryptography.
 // All operations on Noise are not guaranteed to be thread-safe.
 type Noise struct {
 	pk   cipher.PubKey
-	sk   cipher.SecKey
 	init bool
 
 	pattern noise.HandshakePattern
 	hs      *noise.HandshakeState
 	enc     *noise.CipherState
 	dec     *noise.CipherState
+	secrets *secrets // key material of the handshake, which is wiped once the handshake finishes
+
+	settings  []byte // local settings, sent after the capabilities in handshake payloads
+	rSettings []byte // remote settings, received during handshake
 
 	encNonce uint64 // increment after encryption
 	decNonce uint64 // expect increment with each subsequent packet
+
+	rekeyConf RekeyConfig
+	rekey     bool // whether both sides support rekeying (negotiated during handshake)
+	encEpoch  uint64
+	encCipher noise.Cipher
+	encBytes  uint64    // bytes encrypted within the current epoch
+	encSince  time.Time // start of the current epoch
+	decEpoch  uint64
+	decCipher noise.Cipher
+	decPrev   noise.Cipher // cipher of the previous epoch, for messages which are decrypted out of order
 }
 
 // New creates a new Noise with:
-//	- provided pattern for handshake.
-//	- Secp256k1 for the curve.
+//   - provided pattern for handshake.
+//   - Secp256k1 for the curve.
 func New(pattern noise.HandshakePattern, config Config) (*Noise, error) {
+	s := new(secrets)
+	runtime.SetFinalizer(s, (*secrets).wipe) // for handshakes which never finish
+
 	nc := noise.Config{
-		CipherSuite: noise.NewCipherSuite(Secp256k1{}, noise.CipherChaChaPoly, noise.HashSHA256),
+		CipherSuite: noise.NewCipherSuite(trackedSecp256k1{secrets: s}, noise.CipherChaChaPoly, noise.HashSHA256),
 		Random:      rand.Reader,
 		Pattern:     pattern,
 		Initiator:   config.Initiator,
+		Prologue:    config.Prologue,
 		StaticKeypair: noise.DHKey{
 			Public:  config.LocalPK[:],
-			Private: config.LocalSK[:],
+			Private: s.copy(config.LocalSK[:]),
 		},
 	}
 	if !config.RemotePK.Null() {
@@ -61,58 +83,95 @@ func New(pattern noise.HandshakePattern, config Config) (*Noise, error) {
 
 	hs, err := noise.NewHandshakeState(nc)
 	if err != nil {
+		s.wipe()
 		return nil, err
 	}
 	return &Noise{
-		pk:      config.LocalPK,
-		sk:      config.LocalSK,
-		init:    config.Initiator,
-		pattern: pattern,
-		hs:      hs,
+		pk:        config.LocalPK,
+		init:      config.Initiator,
+		pattern:   pattern,
+		hs:        hs,
+		secrets:   s,
+		settings:  config.Settings,
+		rekeyConf: config.Rekey,
 	}, nil
 }
 
 // KKAndSecp256k1 creates a new Noise with:
-//	- KK pattern for handshake.
-//	- Secp256k1 for the curve.
+//   - KK pattern for handshake.
+//   - Secp256k1 for the curve.
 func KKAndSecp256k1(config Config) (*Noise, error) {
 	return New(noise.HandshakeKK, config)
 }
 
 // XKAndSecp256k1 creates a new Noise with:
-//  - XK pattern for handshake.
-//	- Secp256 for the curve.
+//   - XK pattern for handshake.
+//   - Secp256 for the curve.
 func XKAndSecp256k1(config Config) (*Noise, error) {
 	return New(noise.HandshakeXK, config)
 }
 
 // MakeHandshakeMessage generates handshake message for a current handshake state.
+// The local capabilities and settings are sent as the payload (which is ignored by remotes which are unaware of them).
 func (ns *Noise) MakeHandshakeMessage() (res []byte, err error) {
+	payload := append([]byte{ns.localCaps()}, ns.settings...)
 	if ns.hs.MessageIndex() < len(ns.pattern.Messages)-1 {
-		res, _, _, err = ns.hs.WriteMessage(nil, nil)
+		res, _, _, err = ns.hs.WriteMessage(nil, payload)
 		return
 	}
 
-	res, ns.dec, ns.enc, err = ns.hs.WriteMessage(nil, nil)
+	res, ns.dec, ns.enc, err = ns.hs.WriteMessage(nil, payload)
+	ns.finishHandshake()
 	return res, err
 }
 
 // ProcessHandshakeMessage processes a received handshake message and appends the payload.
 func (ns *Noise) ProcessHandshakeMessage(msg []byte) (err error) {
+	var payload []byte
 	if ns.hs.MessageIndex() < len(ns.pattern.Messages)-1 {
-		_, _, _, err = ns.hs.ReadMessage(nil, msg)
+		payload, _, _, err = ns.hs.ReadMessage(nil, msg)
+		ns.processCaps(payload)
 		return
 	}
 
-	_, ns.enc, ns.dec, err = ns.hs.ReadMessage(nil, msg)
+	payload, ns.enc, ns.dec, err = ns.hs.ReadMessage(nil, msg)
+	ns.processCaps(payload)
+	ns.finishHandshake()
 	return err
 }
 
+// finishHandshake prepares the transport ciphers, and wipes the key material of the handshake (such as the ephemeral
+// keys), so that it cannot be recovered to decrypt recorded traffic.
+func (ns *Noise) finishHandshake() {
+	if ns.enc == nil || ns.dec == nil {
+		return
+	}
+	ns.prepareCiphers()
+	ns.secrets.wipe()
+}
+
 // HandshakeFinished indicate whether handshake was completed.
 func (ns *Noise) HandshakeFinished() bool {
 	return ns.hs.MessageIndex() == len(ns.pattern.Messages)
 }
 
+// ChannelBinding returns the hash of the handshake, which is identical for both sides and unique to the channel.
+// It is only valid once the handshake is finished.
+func (ns *Noise) ChannelBinding() []byte {
+	return ns.hs.ChannelBinding()
+}
+
+// RemoteSettings returns the settings which the remote sent during the handshake (see Config.Settings).
+// It is empty if the remote sent no settings.
+func (ns *Noise) RemoteSettings() []byte {
+	return ns.rSettings
+}
+
+// Initiator returns true if the local instance initiates the handshake.
+func (ns *Noise) Initiator() bool {
+	return ns.init
+}
+
 // LocalStatic returns the local static public key.
 func (ns *Noise) LocalStatic() cipher.PubKey {
 	return ns.pk
@@ -131,9 +190,10 @@ func (ns *Noise) RemoteStatic() cipher.PubKey {
 // be used with external lock.
 func (ns *Noise) EncryptUnsafe(plaintext []byte) []byte {
 	ns.encNonce++
+	c := ns.encryptCipher(len(plaintext))
 	buf := make([]byte, nonceSize)
 	binary.BigEndian.PutUint64(buf, ns.encNonce)
-	return append(buf, ns.enc.Cipher().Encrypt(nil, ns.encNonce, nil, plaintext)...)
+	return append(buf, c.Encrypt(nil, ns.encNonce, nil, plaintext)...)
 }
 
 // DecryptUnsafe decrypts ciphertext without interlocking, should only
@@ -148,7 +208,7 @@ func (ns *Noise) DecryptUnsafe(ciphertext []byte) ([]byte, error) {
 		return nil, fmt.Errorf("received decryption nonce (%d) is not larger than previous (%d)", recvSeq, ns.decNonce)
 	}
 	ns.decNonce = recvSeq
-	return ns.dec.Cipher().Decrypt(nil, recvSeq, nil, ciphertext[nonceSize:])
+	return ns.decrypt(recvSeq, ciphertext[nonceSize:])
 }
 
 // NonceMap is a map of used nonces.
@@ -164,5 +224,5 @@ func (ns *Noise) DecryptWithNonceMap(nm NonceMap, ciphertext []byte) ([]byte, er
 	if _, ok := nm[recvSeq]; ok {
 		return nil, fmt.Errorf("received decryption nonce (%d) is repeated", recvSeq)
 	}
-	return ns.dec.Cipher().Decrypt(nil, recvSeq, nil, ciphertext[nonceSize:])
+	return ns.decrypt(recvSeq, ciphertext[nonceSize:])
 }
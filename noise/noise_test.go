@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 	"github.com/stretchr/testify/assert"
@@ -138,3 +139,130 @@ func TestXKAndSecp256k1(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, []byte("baz"), decrypted)
 }
+
+func TestPrologue(t *testing.T) {
+	pkI, skI := cipher.GenerateKeyPair()
+	pkR, skR := cipher.GenerateKeyPair()
+
+	handshake := func(prologueI, prologueR []byte) error {
+		nI, err := KKAndSecp256k1(Config{LocalPK: pkI, LocalSK: skI, RemotePK: pkR, Initiator: true, Prologue: prologueI})
+		require.NoError(t, err)
+		nR, err := KKAndSecp256k1(Config{LocalPK: pkR, LocalSK: skR, RemotePK: pkI, Prologue: prologueR})
+		require.NoError(t, err)
+
+		msg, err := nI.MakeHandshakeMessage()
+		require.NoError(t, err)
+		if err := nR.ProcessHandshakeMessage(msg); err != nil {
+			return err
+		}
+		msg, err = nR.MakeHandshakeMessage()
+		require.NoError(t, err)
+		return nI.ProcessHandshakeMessage(msg)
+	}
+
+	require.NoError(t, handshake(nil, nil))
+	require.NoError(t, handshake([]byte("test"), []byte("test")))
+	require.Error(t, handshake([]byte("test"), []byte("prod")))
+	require.Error(t, handshake(nil, []byte("prod")))
+}
+
+func TestSettings(t *testing.T) {
+	pkI, skI := cipher.GenerateKeyPair()
+	pkR, skR := cipher.GenerateKeyPair()
+
+	nI, err := KKAndSecp256k1(Config{LocalPK: pkI, LocalSK: skI, RemotePK: pkR, Initiator: true,
+		Settings: []byte("foo")})
+	require.NoError(t, err)
+	nR, err := KKAndSecp256k1(Config{LocalPK: pkR, LocalSK: skR, RemotePK: pkI})
+	require.NoError(t, err)
+
+	msg, err := nI.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nR.ProcessHandshakeMessage(msg))
+	msg, err = nR.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nI.ProcessHandshakeMessage(msg))
+
+	assert.Equal(t, []byte("foo"), nR.RemoteSettings())
+	assert.Empty(t, nI.RemoteSettings())
+
+	// Rekeying is not enabled unless configured.
+	assert.False(t, nI.Rekeying())
+	assert.False(t, nR.Rekeying())
+}
+
+func TestRekey(t *testing.T) {
+	pkI, skI := cipher.GenerateKeyPair()
+	pkR, skR := cipher.GenerateKeyPair()
+
+	nI, err := KKAndSecp256k1(Config{LocalPK: pkI, LocalSK: skI, RemotePK: pkR, Initiator: true,
+		Rekey: RekeyConfig{Bytes: 6}})
+	require.NoError(t, err)
+	nR, err := KKAndSecp256k1(Config{LocalPK: pkR, LocalSK: skR, RemotePK: pkI,
+		Rekey: RekeyConfig{Interval: time.Hour}})
+	require.NoError(t, err)
+
+	msg, err := nI.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nR.ProcessHandshakeMessage(msg))
+	msg, err = nR.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nI.ProcessHandshakeMessage(msg))
+	require.True(t, nI.Rekeying())
+	require.True(t, nR.Rekeying())
+
+	// Every second message starts a new epoch, as the byte trigger is reached.
+	nm := make(NonceMap)
+	var held []byte
+	for i := 0; i < 6; i++ {
+		encrypted := nI.EncryptUnsafe([]byte("foo"))
+		if i == 2 {
+			held = encrypted // decrypted out of order, after the next epoch starts
+			continue
+		}
+		decrypted, err := nR.DecryptWithNonceMap(nm, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("foo"), decrypted)
+	}
+	require.Equal(t, uint64(2), nI.encEpoch)
+	require.Equal(t, uint64(2), nR.decEpoch)
+
+	decrypted, err := nR.DecryptWithNonceMap(nm, held)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("foo"), decrypted)
+
+	// Messages of skipped epochs are rejected.
+	nI.encNonce = (nI.encEpoch + maxEpochSkip + 1) * RekeyEpoch
+	_, err = nR.DecryptUnsafe(nI.EncryptUnsafe([]byte("foo")))
+	require.Equal(t, ErrInvalidEpoch, err)
+}
+
+func TestWipeSecrets(t *testing.T) {
+	pkI, skI := cipher.GenerateKeyPair()
+	pkR, skR := cipher.GenerateKeyPair()
+
+	nI, err := KKAndSecp256k1(Config{LocalPK: pkI, LocalSK: skI, RemotePK: pkR, Initiator: true})
+	require.NoError(t, err)
+	nR, err := KKAndSecp256k1(Config{LocalPK: pkR, LocalSK: skR, RemotePK: pkI})
+	require.NoError(t, err)
+
+	msg, err := nI.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nR.ProcessHandshakeMessage(msg))
+
+	// The static key copies, ephemeral keys and DH results are kept until the handshake finishes.
+	require.NotEmpty(t, *nI.secrets)
+	live := LiveSecrets()
+
+	msg, err = nR.MakeHandshakeMessage()
+	require.NoError(t, err)
+	require.NoError(t, nI.ProcessHandshakeMessage(msg))
+	require.Empty(t, *nI.secrets)
+	require.Empty(t, *nR.secrets)
+	require.True(t, LiveSecrets() < live)
+
+	// The session keys are not affected.
+	decrypted, err := nR.DecryptUnsafe(nI.EncryptUnsafe([]byte("foo")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("foo"), decrypted)
+}
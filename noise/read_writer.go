@@ -68,36 +68,49 @@ func (rw *ReadWriter) Read(p []byte) (int, error) {
 		return rw.input.Read(p)
 	}
 
+	// Frames without payload (see WriteEmptyFrame) are skipped.
+	for {
+		plaintext, err := rw.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		if len(plaintext) > 0 {
+			defer zero(plaintext) // the remainder is copied to rw.input
+			return ioutil.BufRead(&rw.input, plaintext, p)
+		}
+	}
+}
+
+// ReadFrame reads a single frame and returns the decrypted payload. The payload is empty if decryption fails.
+// ReadFrame should not be used together with Read, as payload buffered by Read is not returned.
+func (rw *ReadWriter) ReadFrame() ([]byte, error) {
+	rw.rMx.Lock()
+	defer rw.rMx.Unlock()
+
+	return rw.readFrame()
+}
+
+func (rw *ReadWriter) readFrame() ([]byte, error) {
 	ciphertext, err := ReadRawFrame(rw.rawInput)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	plaintext, err := rw.ns.DecryptUnsafe(ciphertext)
 	if err != nil {
 		// TODO(evanlinjin): log error here.
-		return 0, nil
-	}
-	if len(plaintext) == 0 {
-		return 0, nil
+		return nil, nil
 	}
-	return ioutil.BufRead(&rw.input, plaintext, p)
+	return plaintext, nil
 }
 
 func (rw *ReadWriter) Write(p []byte) (n int, err error) {
 	rw.wMx.Lock()
 	defer rw.wMx.Unlock()
 
-	// Check for timeout errors.
-	if _, err = rw.origin.Write(nil); err != nil {
+	if err = rw.prepareWrite(); err != nil {
 		return 0, err
 	}
 
-	for rw.wPad.Len() > 0 {
-		if _, err = rw.wPad.WriteTo(rw.origin); err != nil {
-			return 0, err
-		}
-	}
-
 	for len(p) > 0 {
 		// Enforce max frame size.
 		wn := len(p)
@@ -105,11 +118,7 @@ func (rw *ReadWriter) Write(p []byte) (n int, err error) {
 			wn = maxPayloadSize
 		}
 
-		writtenB, err := WriteRawFrame(rw.origin, rw.ns.EncryptUnsafe(p[:wn]))
-		if !IsCompleteFrame(writtenB) {
-			rw.wPad.Reset(FillIncompleteFrame(writtenB))
-		}
-		if err != nil {
+		if err = rw.writeFrame(p[:wn]); err != nil {
 			return n, err
 		}
 
@@ -120,6 +129,39 @@ func (rw *ReadWriter) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+// WriteEmptyFrame writes a frame without payload, such as to keep an otherwise quiet connection alive.
+// Such frames are skipped by Read.
+func (rw *ReadWriter) WriteEmptyFrame() error {
+	rw.wMx.Lock()
+	defer rw.wMx.Unlock()
+
+	if err := rw.prepareWrite(); err != nil {
+		return err
+	}
+	return rw.writeFrame(nil)
+}
+
+// prepareWrite checks for timeout errors, and completes the padding of a previously incomplete frame.
+func (rw *ReadWriter) prepareWrite() error {
+	if _, err := rw.origin.Write(nil); err != nil {
+		return err
+	}
+	for rw.wPad.Len() > 0 {
+		if _, err := rw.wPad.WriteTo(rw.origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rw *ReadWriter) writeFrame(p []byte) error {
+	writtenB, err := WriteRawFrame(rw.origin, rw.ns.EncryptUnsafe(p))
+	if !IsCompleteFrame(writtenB) {
+		rw.wPad.Reset(FillIncompleteFrame(writtenB))
+	}
+	return err
+}
+
 // Handshake performs a Noise handshake using the provided io.ReadWriter.
 func (rw *ReadWriter) Handshake(hsTimeout time.Duration) error {
 	errCh := make(chan error, 1)
@@ -157,6 +157,22 @@ func TestReadWriterKKPattern(t *testing.T) {
 	require.NoError(t, <-errCh)
 	assert.Equal(t, 3, n)
 	assert.Equal(t, []byte("bar"), buf)
+
+	// Empty frames are skipped by Read.
+	go func() {
+		if err := rwI.WriteEmptyFrame(); err != nil {
+			errCh <- err
+			return
+		}
+		_, err := rwI.Write([]byte("baz"))
+		errCh <- err
+	}()
+
+	n, err = rwR.Read(buf)
+	require.NoError(t, err)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []byte("baz"), buf)
 }
 
 func TestReadWriterXKPattern(t *testing.T) {
@@ -0,0 +1,131 @@
+package noise
+
+import (
+	"errors"
+	"time"
+
+	"github.com/flynn/noise"
+)
+
+// Capability flags, which are exchanged as the payload of handshake messages.
+const (
+	capRekey byte = 1 << iota // rekeying of transport keys is configured
+)
+
+// RekeyEpoch is the number of nonces of an epoch. If rekeying is supported by both sides, transport keys are rotated
+// (as per the REKEY function of the Noise specification) whenever the nonce enters a new epoch.
+// Triggers of RekeyConfig rotate the keys earlier, by advancing the nonce to the start of the next epoch.
+const RekeyEpoch = 1 << 20
+
+// maxEpochSkip is the maximum number of epochs which a received nonce may be ahead of the current epoch.
+const maxEpochSkip = 2
+
+// ErrInvalidEpoch is returned when a received nonce is of an epoch which cannot be decrypted.
+var ErrInvalidEpoch = errors.New("received nonce is of an invalid rekey epoch")
+
+// RekeyConfig configures when transport keys are rotated, so that a compromised key exposes a bounded amount of
+// traffic. Keys are only rotated if both sides configure rekeying. Zero values disable the respective trigger, and
+// rekeying altogether if both are zero.
+type RekeyConfig struct {
+	Bytes    uint64        // rotate keys after this many bytes are encrypted with a key
+	Interval time.Duration // rotate keys after a key is used for this long
+}
+
+func (c RekeyConfig) enabled() bool {
+	return c.Bytes > 0 || c.Interval > 0
+}
+
+// Rekeying returns true if both sides configured rekeying. It is only valid once the handshake is finished.
+func (ns *Noise) Rekeying() bool {
+	return ns.rekey
+}
+
+// Epochs returns the epochs of the encryption and decryption keys, which is the number of times that each was rotated.
+func (ns *Noise) Epochs() (enc, dec uint64) {
+	return ns.encEpoch, ns.decEpoch
+}
+
+// localCaps returns the capability flags which are sent to the remote.
+func (ns *Noise) localCaps() byte {
+	var caps byte
+	if ns.rekeyConf.enabled() {
+		caps |= capRekey
+	}
+	return caps
+}
+
+func (ns *Noise) processCaps(payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	if payload[0]&capRekey != 0 && ns.rekeyConf.enabled() {
+		ns.rekey = true
+	}
+	if len(payload) > 1 {
+		ns.rSettings = append([]byte(nil), payload[1:]...)
+	}
+}
+
+// prepareCiphers should be called once the handshake is finished.
+func (ns *Noise) prepareCiphers() {
+	ns.encCipher = ns.enc.Cipher()
+	ns.decCipher = ns.dec.Cipher()
+	ns.encSince = time.Now()
+}
+
+// encryptCipher returns the cipher for encrypting a plaintext of the given size with ns.encNonce.
+// If a rekey trigger is reached, the nonce is advanced to the start of the next epoch first.
+func (ns *Noise) encryptCipher(n int) noise.Cipher {
+	if !ns.rekey {
+		return ns.enc.Cipher()
+	}
+	if (ns.rekeyConf.Bytes > 0 && ns.encBytes+uint64(n) > ns.rekeyConf.Bytes) ||
+		(ns.rekeyConf.Interval > 0 && time.Since(ns.encSince) >= ns.rekeyConf.Interval) {
+		if next := (ns.encEpoch + 1) * RekeyEpoch; ns.encNonce < next {
+			ns.encNonce = next
+		}
+	}
+	for epoch := ns.encNonce / RekeyEpoch; ns.encEpoch < epoch; ns.encEpoch++ {
+		ns.encCipher = rekey(ns.encCipher)
+		ns.encBytes, ns.encSince = 0, time.Now()
+	}
+	ns.encBytes += uint64(n)
+	return ns.encCipher
+}
+
+// decrypt decrypts the ciphertext of the given nonce with the cipher of the nonce's epoch.
+// The current epoch only advances once a message of the next epoch is authenticated.
+func (ns *Noise) decrypt(nonce uint64, ciphertext []byte) ([]byte, error) {
+	if !ns.rekey {
+		return ns.dec.Cipher().Decrypt(nil, nonce, nil, ciphertext)
+	}
+
+	epoch := nonce / RekeyEpoch
+	switch {
+	case epoch == ns.decEpoch:
+		return ns.decCipher.Decrypt(nil, nonce, nil, ciphertext)
+	case epoch+1 == ns.decEpoch && ns.decPrev != nil:
+		return ns.decPrev.Decrypt(nil, nonce, nil, ciphertext)
+	case epoch > ns.decEpoch && epoch-ns.decEpoch <= maxEpochSkip:
+		prev, c := ns.decCipher, ns.decCipher
+		for e := ns.decEpoch; e < epoch; e++ {
+			prev, c = c, rekey(c)
+		}
+		plaintext, err := c.Decrypt(nil, nonce, nil, ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		ns.decEpoch, ns.decCipher, ns.decPrev = epoch, c, prev
+		return plaintext, nil
+	default:
+		return nil, ErrInvalidEpoch
+	}
+}
+
+// rekey returns the cipher of the key derived from the key of the given cipher, as per the REKEY function of the
+// Noise specification.
+func rekey(c noise.Cipher) noise.Cipher {
+	var k [32]byte
+	copy(k[:], c.Encrypt(nil, ^uint64(0), nil, k[:]))
+	return noise.CipherChaChaPoly.Cipher(k)
+}
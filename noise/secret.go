@@ -0,0 +1,78 @@
+package noise
+
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/SkycoinProject/skycoin/src/cipher"
+	"github.com/flynn/noise"
+)
+
+// liveSecrets is the number of allocated secrets which are not yet wiped.
+var liveSecrets int64
+
+// LiveSecrets returns the number of buffers of key material (such as ephemeral keys and DH results of handshakes)
+// which are not yet wiped. This is intended for auditing that key material is not retained, as key material of a
+// handshake is wiped once the handshake finishes (for forward secrecy).
+// Key material of handshakes which never finish is wiped once the Noise is garbage collected.
+func LiveSecrets() int64 {
+	return atomic.LoadInt64(&liveSecrets)
+}
+
+// secrets tracks buffers of key material, so that they can be wiped.
+type secrets [][]byte
+
+// alloc allocates a secret of size n (see allocSecret).
+func (s *secrets) alloc(n int) []byte {
+	b := allocSecret(n)
+	*s = append(*s, b)
+	atomic.AddInt64(&liveSecrets, 1)
+	return b
+}
+
+// copy allocates a secret which contains a copy of b.
+func (s *secrets) copy(b []byte) []byte {
+	out := s.alloc(len(b))
+	copy(out, b)
+	return out
+}
+
+// wipe zeroes and frees all secrets.
+func (s *secrets) wipe() {
+	for _, b := range *s {
+		zero(b)
+		freeSecret(b)
+	}
+	atomic.AddInt64(&liveSecrets, -int64(len(*s)))
+	*s = nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// trackedSecp256k1 implements `noise.DHFunc` with Secp256k1, and keeps the generated private keys and DH results in
+// secrets, so that they can be wiped once the handshake finishes.
+type trackedSecp256k1 struct {
+	Secp256k1
+	secrets *secrets
+}
+
+// GenerateKeypair helps to implement `noise.DHFunc`.
+func (dh trackedSecp256k1) GenerateKeypair(_ io.Reader) (noise.DHKey, error) {
+	pk, sk := cipher.GenerateKeyPair()
+	defer zero(sk[:])
+	return noise.DHKey{
+		Private: dh.secrets.copy(sk[:]),
+		Public:  pk[:],
+	}, nil
+}
+
+// DH helps to implement `noise.DHFunc`.
+func (dh trackedSecp256k1) DH(sk, pk []byte) []byte {
+	res := dh.Secp256k1.DH(sk, pk)
+	defer zero(res)
+	return dh.secrets.copy(res)
+}
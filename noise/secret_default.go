@@ -0,0 +1,12 @@
+// +build !memguard !linux
+
+package noise
+
+// allocSecret allocates memory for key material.
+// Build with the memguard tag (on linux) for protected memory.
+func allocSecret(n int) []byte {
+	return make([]byte, n)
+}
+
+// freeSecret frees memory which is allocated with allocSecret. The memory should be zeroed beforehand.
+func freeSecret([]byte) {}
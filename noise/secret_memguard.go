@@ -0,0 +1,37 @@
+// +build memguard,linux
+
+package noise
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// allocSecret allocates memory for key material outside of the Go heap, so that it is never copied by the runtime.
+// The memory is locked (so that it is never swapped to disk) and excluded from core dumps.
+// Locking is best-effort, as it is limited by RLIMIT_MEMLOCK.
+func allocSecret(n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	b, err := unix.Mmap(-1, 0, n, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANON)
+	if err != nil {
+		noiseLogger.WithError(err).Warn("Failed to map protected memory, falling back to the heap.")
+		return make([]byte, n)
+	}
+	if err := unix.Mlock(b); err != nil {
+		noiseLogger.WithError(err).Debug("Failed to lock protected memory.")
+	}
+	if err := unix.Madvise(b, unix.MADV_DONTDUMP); err != nil {
+		noiseLogger.WithError(err).Debug("Failed to exclude protected memory from core dumps.")
+	}
+	return b
+}
+
+// freeSecret frees memory which is allocated with allocSecret. The memory should be zeroed beforehand.
+func freeSecret(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	// Unmapping fails for memory which is from the heap (as mapping failed), which is left to the garbage collector.
+	_ = unix.Munmap(b) //nolint:errcheck
+}
@@ -0,0 +1,83 @@
+package dmsg
+
+import (
+	"sync"
+)
+
+// PortClaim is a set of ports which are claimed by an embedder of the client (such as the router of a skywire visor)
+// via ClaimPorts. Streams accepted on claimed ports are passed to the claim's handler directly, rather than being
+// queued for a Listener, so that the embedder needs no accept loop of its own.
+type PortClaim struct {
+	ports        []uint16
+	handler      StreamHandler
+	interceptors *interceptorChain
+
+	release func()
+	done    chan struct{}
+	once    sync.Once
+}
+
+// ClaimPorts claims the given ports, so that remote-initiated streams on them are passed to 'handler' (each in its own
+// goroutine) once they pass the client's interceptors. The handler is responsible for closing the stream. Streams
+// for which the handler returns an error are closed.
+//
+// Either all of the ports are claimed, or ErrPortOccupied is returned and none of them are. The ports are released
+// together with Release.
+func (ce *Client) ClaimPorts(handler StreamHandler, ports ...uint16) (*PortClaim, error) {
+	pc := &PortClaim{
+		ports:        append([]uint16(nil), ports...),
+		handler:      handler,
+		interceptors: ce.interceptors,
+		done:         make(chan struct{}),
+	}
+	ok, release := ce.porter.ReserveAll(pc.ports, pc)
+	if !ok {
+		return nil, ErrPortOccupied
+	}
+	pc.release = release
+	return pc, nil
+}
+
+// Ports returns the claimed ports.
+func (pc *PortClaim) Ports() []uint16 {
+	return append([]uint16(nil), pc.ports...)
+}
+
+// Release releases all of the claimed ports, so that no further streams are passed to the handler. Streams which are
+// already passed to the handler are not closed.
+func (pc *PortClaim) Release() error {
+	released := false
+	pc.once.Do(func() {
+		released = true
+		close(pc.done)
+		pc.release()
+	})
+	if !released {
+		return ErrEntityClosed
+	}
+	return nil
+}
+
+// Close implements io.Closer
+// It is Release, so that claims are released when the client is closed.
+func (pc *PortClaim) Close() error {
+	return pc.Release()
+}
+
+// introduceStream passes an accepted stream to the handler.
+func (pc *PortClaim) introduceStream(s *Stream) error {
+	select {
+	case <-pc.done:
+		_ = s.Close() //nolint:errcheck
+		return ErrEntityClosed
+	default:
+	}
+
+	go func() {
+		if err := pc.handler(s); err != nil {
+			s.log.WithError(err).Debug("Stream handler of port claim returned error, closing stream.")
+			_ = s.Close() //nolint:errcheck
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package ports contains well-known dmsg ports and a registry which detects port collisions between dmsg-based
+// services.
+package ports
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/SkycoinProject/dmsg/netutil"
+)
+
+// Well-known dmsg ports.
+const (
+	Transport = uint16(1)  // skywire transports
+	Echo      = uint16(7)  // echo service (used for load-testing)
+	PTY       = uint16(22) // dmsgpty
+	HTTP      = uint16(80) // http over dmsg
+)
+
+var (
+	// ErrInvalidPort occurs when registering port 0 or a port within the ephemeral range.
+	ErrInvalidPort = errors.New("port is invalid or within the ephemeral range")
+	// ErrEmptyName occurs when registering a port with an empty service name.
+	ErrEmptyName = errors.New("service name is empty")
+)
+
+// CollisionError occurs when a service attempts to register a port or name that is already registered.
+type CollisionError struct {
+	Name         string
+	Port         uint16
+	ExistingName string
+	ExistingPort uint16
+}
+
+// Error implements error.
+func (e CollisionError) Error() string {
+	return fmt.Sprintf("service %q on port %d collides with registered service %q on port %d",
+		e.Name, e.Port, e.ExistingName, e.ExistingPort)
+}
+
+// Registry records which dmsg ports are used by which services.
+type Registry struct {
+	byName map[string]uint16
+	byPort map[uint16]string
+	mx     sync.RWMutex
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]uint16),
+		byPort: make(map[uint16]string),
+	}
+}
+
+// Register records that the given service uses the given port.
+// Registering the exact same name and port pair more than once is allowed.
+func (r *Registry) Register(name string, port uint16) error {
+	if name == "" {
+		return ErrEmptyName
+	}
+	if port == 0 || port >= netutil.PorterMinEphemeral {
+		return ErrInvalidPort
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if existing, ok := r.byPort[port]; ok {
+		if existing == name {
+			return nil
+		}
+		return CollisionError{Name: name, Port: port, ExistingName: existing, ExistingPort: port}
+	}
+	if existing, ok := r.byName[name]; ok {
+		return CollisionError{Name: name, Port: port, ExistingName: name, ExistingPort: existing}
+	}
+	r.byName[name] = port
+	r.byPort[port] = name
+	return nil
+}
+
+// MustRegister calls Register and panics on error.
+func (r *Registry) MustRegister(name string, port uint16) {
+	if err := r.Register(name, port); err != nil {
+		panic(err)
+	}
+}
+
+// Port returns the port registered under the given service name.
+func (r *Registry) Port(name string) (uint16, bool) {
+	r.mx.RLock()
+	port, ok := r.byName[name]
+	r.mx.RUnlock()
+	return port, ok
+}
+
+// Name returns the service name registered under the given port.
+func (r *Registry) Name(port uint16) (string, bool) {
+	r.mx.RLock()
+	name, ok := r.byPort[port]
+	r.mx.RUnlock()
+	return name, ok
+}
+
+// Ports returns all registered ports in ascending order.
+func (r *Registry) Ports() []uint16 {
+	r.mx.RLock()
+	ports := make([]uint16, 0, len(r.byPort))
+	for port := range r.byPort {
+		ports = append(ports, port)
+	}
+	r.mx.RUnlock()
+
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+// defaultRegistry contains the well-known ports.
+var defaultRegistry = func() *Registry {
+	r := NewRegistry()
+	r.MustRegister("transport", Transport)
+	r.MustRegister("echo", Echo)
+	r.MustRegister("pty", PTY)
+	r.MustRegister("http", HTTP)
+	return r
+}()
+
+// Register records that the given service uses the given port in the default registry.
+func Register(name string, port uint16) error { return defaultRegistry.Register(name, port) }
+
+// MustRegister calls Register on the default registry and panics on error.
+func MustRegister(name string, port uint16) { defaultRegistry.MustRegister(name, port) }
+
+// Port returns the port registered under the given service name in the default registry.
+func Port(name string) (uint16, bool) { return defaultRegistry.Port(name) }
+
+// Name returns the service name registered under the given port in the default registry.
+func Name(port uint16) (string, bool) { return defaultRegistry.Name(port) }
+
+// Ports returns all ports registered in the default registry in ascending order.
+func Ports() []uint16 { return defaultRegistry.Ports() }
@@ -0,0 +1,48 @@
+package ports
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/netutil"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register("pty", PTY))
+	require.NoError(t, r.Register("pty", PTY), "re-registering the same pair should succeed")
+
+	t.Run("port_collision", func(t *testing.T) {
+		err := r.Register("ssh", PTY)
+		require.Equal(t, CollisionError{Name: "ssh", Port: PTY, ExistingName: "pty", ExistingPort: PTY}, err)
+	})
+
+	t.Run("name_collision", func(t *testing.T) {
+		err := r.Register("pty", 2222)
+		require.Equal(t, CollisionError{Name: "pty", Port: 2222, ExistingName: "pty", ExistingPort: PTY}, err)
+	})
+
+	t.Run("invalid_input", func(t *testing.T) {
+		require.Equal(t, ErrInvalidPort, r.Register("zero", 0))
+		require.Equal(t, ErrInvalidPort, r.Register("ephemeral", netutil.PorterMinEphemeral))
+		require.Equal(t, ErrEmptyName, r.Register("", 1000))
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		port, ok := r.Port("pty")
+		require.True(t, ok)
+		require.Equal(t, PTY, port)
+
+		name, ok := r.Name(PTY)
+		require.True(t, ok)
+		require.Equal(t, "pty", name)
+
+		require.Equal(t, []uint16{PTY}, r.Ports())
+	})
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	require.Equal(t, []uint16{Transport, Echo, PTY, HTTP}, Ports())
+	require.Error(t, Register("other-http", HTTP))
+}
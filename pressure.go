@@ -0,0 +1,76 @@
+package dmsg
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// shedLoadLoop periodically compares the heap usage of the server against ServerConfig.MemoryBudget.
+// While the budget is exceeded, new streams are rejected with ErrServerBusy and the session with the most streams is
+// closed on every check. Closed sessions are sent a go-away frame first, so that clients stop opening streams and
+// reconnect (possibly via other servers).
+func (s *Server) shedLoadLoop(interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.Chan():
+			s.checkMemory()
+		}
+	}
+}
+
+// checkMemory compares the heap usage against the memory budget, and sheds load if it is exceeded.
+func (s *Server) checkMemory() {
+	heap := s.heapInuse()
+	if heap <= s.conf.MemoryBudget {
+		if atomic.CompareAndSwapInt32(&s.pressure, 1, 0) {
+			s.log.WithField("heap_inuse", heap).Info("Memory usage is within budget again.")
+		}
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.pressure, 0, 1) {
+		s.log.WithField("heap_inuse", heap).
+			WithField("budget", s.conf.MemoryBudget).
+			Warn("Memory budget exceeded, shedding load.")
+	}
+	s.shedHeaviestSession()
+}
+
+func readHeapInuse() uint64 {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return mem.HeapInuse
+}
+
+// underPressure returns true while the memory budget is exceeded.
+func (s *Server) underPressure() bool {
+	return atomic.LoadInt32(&s.pressure) == 1
+}
+
+// shedHeaviestSession closes the session with the most streams (if any).
+func (s *Server) shedHeaviestSession() {
+	var heaviest *SessionCommon
+	streams := 0
+
+	s.sessionsMx.Lock()
+	for _, ses := range s.sessions {
+		if n := ses.ys.NumStreams(); n > streams {
+			heaviest, streams = ses, n
+		}
+	}
+	s.sessionsMx.Unlock()
+
+	if heaviest == nil {
+		return
+	}
+	log := s.log.WithField("remote_pk", heaviest.RemotePK()).WithField("streams", streams)
+	if err := heaviest.ys.GoAway(); err != nil {
+		log.WithError(err).Debug("Failed to send go-away frame.")
+	}
+	log.WithError(heaviest.Close()).Warn("Closed session to shed load.")
+}
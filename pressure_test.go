@@ -0,0 +1,97 @@
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestServer_checkMemory(t *testing.T) {
+	dc := disc.NewMock()
+
+	// The heap usage of the server is injected, so that the budget is only exceeded when the test says so.
+	var heap uint64
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServerWithConfig(srvPK, srvSK, dc, &ServerConfig{MemoryBudget: 100})
+	srv.heapInuse = func() uint64 { return atomic.LoadUint64(&heap) }
+	srvLis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(srvLis, "") }() //nolint:errcheck
+	<-srv.Ready()
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	pkA, skA := cipher.GenerateKeyPair()
+	clientA := NewClient(pkA, skA, dc, nil)
+	go clientA.Serve()
+	<-clientA.Ready()
+	defer func() { require.NoError(t, clientA.Close()) }()
+
+	lis, err := clientA.Listen(1)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, lis.Close()) }()
+
+	pkB, skB := cipher.GenerateKeyPair()
+	clientB := NewClient(pkB, skB, dc, nil)
+	defer func() { require.NoError(t, clientB.Close()) }()
+
+	// dial dials a stream from client B to client A. The unreachable cache is bypassed, as client A may be
+	// reconnecting after its session is shed.
+	dial := func() (*Stream, error) {
+		return clientB.DialStream(context.TODO(), Addr{PK: pkA, Port: 1}, BypassUnreachableCache())
+	}
+
+	dStr, err := dial()
+	require.NoError(t, err)
+	rStr, err := lis.AcceptStream()
+	require.NoError(t, err)
+	defer func() {
+		_ = dStr.Close() //nolint:errcheck
+		_ = rStr.Close() //nolint:errcheck
+	}()
+
+	// Within budget, nothing is shed.
+	atomic.StoreUint64(&heap, 50)
+	srv.checkMemory()
+	require.False(t, srv.underPressure())
+
+	// Once the budget is exceeded, the session with the stream is closed, and new streams are rejected.
+	atomic.StoreUint64(&heap, 200)
+	srv.checkMemory()
+	require.True(t, srv.underPressure())
+	require.NoError(t, dStr.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = dStr.Read(make([]byte, 1))
+	require.Error(t, err)
+	var netErr interface{ Timeout() bool }
+	require.False(t, errors.As(err, &netErr) && netErr.Timeout(), err)
+
+	require.False(t, srv.acquireStream())
+	require.Eventually(t, func() bool {
+		_, err := dial()
+		return errors.Is(err, ErrServerBusy)
+	}, 10*time.Second, 50*time.Millisecond)
+
+	// Once memory usage is within budget again, new streams are admitted.
+	atomic.StoreUint64(&heap, 50)
+	srv.checkMemory()
+	require.False(t, srv.underPressure())
+	require.True(t, srv.acquireStream())
+	srv.releaseStream()
+
+	var dStr2 *Stream
+	require.Eventually(t, func() bool {
+		dStr2, err = dial()
+		return err == nil
+	}, 10*time.Second, 50*time.Millisecond)
+	rStr2, err := lis.AcceptStream()
+	require.NoError(t, err)
+	require.NoError(t, dStr2.Close())
+	require.NoError(t, rStr2.Close())
+}
@@ -0,0 +1,205 @@
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SkycoinProject/yamux"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// relayHeader follows stream requests which are relayed between dmsg servers.
+type relayHeader struct {
+	Path []cipher.PubKey // servers which the request has traversed, in order
+}
+
+// readRelayPath reads the relay header which follows a stream request relayed by the remote server.
+func (ss *ServerSession) readRelayPath(yStr *yamux.Stream) ([]cipher.PubKey, error) {
+	if err := yStr.SetReadDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+		return nil, err
+	}
+	defer func() { _ = yStr.SetReadDeadline(time.Time{}) }() //nolint:errcheck
+
+	obj, err := ss.readObject(yStr)
+	if err != nil {
+		return nil, err
+	}
+	var hdr relayHeader
+	if err := decodeGob(&hdr, obj); err != nil {
+		return nil, err
+	}
+	if len(hdr.Path) == 0 || hdr.Path[len(hdr.Path)-1] != ss.rPK {
+		return nil, errors.New("relay path does not end with the relaying server")
+	}
+	prev := hdr.Path
+	if ss.isClusterPeer() {
+		prev = prev[:len(prev)-1] // the relaying instance shares our public key
+	}
+	if containsPK(prev, ss.LocalPK()) {
+		return nil, ErrReqRelayLoop
+	}
+	return hdr.Path, nil
+}
+
+// nextSession obtains the session which a stream request to 'dstPK' is forwarded through.
+// If the destination client has no session with this server, the request is forwarded to the instance of the cluster
+// which has (if any), or otherwise relayed to a delegated server of the destination client. The returned path (which
+// includes this server) should then be sent along with the request.
+func (ss *ServerSession) nextSession(
+	dstPK cipher.PubKey, path []cipher.PubKey,
+) (ServerSession, []cipher.PubKey, error) {
+	if ss2, ok := ss.entity.serverSession(dstPK); ok {
+		return ss2, nil, nil
+	}
+	if ss.srv == nil || ss.isClusterPeer() {
+		return ServerSession{}, nil, ErrReqNoNextSession
+	}
+	path = append(path[:len(path):len(path)], ss.LocalPK())
+	if ss2, ok := ss.srv.clusterSession(dstPK); ok {
+		return ss2, path, nil
+	}
+	ss2, err := ss.srv.relaySession(dstPK, path)
+	return ss2, path, err
+}
+
+// relaySession obtains a session with a delegated server of the destination client, establishing one if needed.
+// The input 'path' contains the servers which the request has traversed (ending with this server).
+func (s *Server) relaySession(dstPK cipher.PubKey, path []cipher.PubKey) (ServerSession, error) {
+	if s.conf.MaxRelayHops <= 0 {
+		return ServerSession{}, ErrReqNoNextSession
+	}
+	if len(path) > s.conf.MaxRelayHops {
+		return ServerSession{}, ErrReqRelayHopLimit
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	go func() {
+		awaitDone(ctx, s.done)
+		cancel()
+	}()
+
+	log := s.log.WithField("dst_pk", dstPK)
+
+	entry, err := getClientEntry(ctx, s.dc, dstPK)
+	if err != nil {
+		log.WithError(err).Debug("Failed to obtain entry of relay destination.")
+		return ServerSession{}, ErrReqNoNextSession
+	}
+	if err := s.checkNetworkID(entry); err != nil {
+		return ServerSession{}, err
+	}
+
+	for _, srvPK := range entry.Client.DelegatedServers {
+		if containsPK(path, srvPK) {
+			continue
+		}
+		ss, err := s.ensureRelaySession(ctx, srvPK)
+		if err != nil {
+			log.WithError(err).WithField("srv_pk", srvPK).Debug("Failed to establish relay session.")
+			continue
+		}
+		return ss, nil
+	}
+	return ServerSession{}, ErrReqNoNextSession
+}
+
+// ensureRelaySession obtains a session with the given server, dialing it if it does not exist.
+func (s *Server) ensureRelaySession(ctx context.Context, srvPK cipher.PubKey) (ServerSession, error) {
+	mx := s.dialLock(srvPK.Hex())
+	mx.Lock()
+	defer mx.Unlock()
+
+	if ss, ok := s.serverSession(srvPK); ok {
+		return ss, nil
+	}
+
+	entry, err := getServerEntry(ctx, s.dc, srvPK)
+	if err != nil {
+		return ServerSession{}, err
+	}
+	if err := s.checkNetworkID(entry); err != nil {
+		return ServerSession{}, err
+	}
+	s.log.WithField("remote_pk", srvPK).Info("Dialing relay session...")
+
+	deadline := time.Now().Add(s.handshakeTimeout())
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialServerConn(ctx, &dialer, entry.Server)
+	if err != nil {
+		return ServerSession{}, err
+	}
+	if err := s.conf.SocketOptions.Apply(conn); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return ServerSession{}, err
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return ServerSession{}, err
+	}
+	ss := ServerSession{SessionCommon: new(SessionCommon), srv: s}
+	if err := ss.initClient(&s.EntityCommon, conn, srvPK); err != nil {
+		_ = conn.Close() //nolint:errcheck
+		return ServerSession{}, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = ss.Close() //nolint:errcheck
+		return ServerSession{}, err
+	}
+
+	if !s.setSession(ctx, ss.SessionCommon) {
+		_ = ss.Close() //nolint:errcheck
+		return ServerSession{}, errors.New("session already exists")
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.serveRelaySession(ss)
+	}()
+	return ss, nil
+}
+
+// serveRelaySession serves a relay session dialed by this server, so that the remote server may also relay requests
+// through it.
+func (s *Server) serveRelaySession(ss ServerSession) {
+	log := s.log.WithField("remote_pk", ss.RemotePK())
+	log.Info("Serving relay session.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		awaitDone(ctx, s.done)
+		log.WithError(ss.Close()).Info("Stopped relay session.")
+	}()
+
+	ss.Serve()
+	s.delSession(ctx, ss.SessionCommon)
+	cancel()
+}
+
+// dialLock obtains the mutex which serializes the establishment of relay or cluster sessions with the given remote
+// (identified by public key or address).
+func (s *Server) dialLock(remote string) *sync.Mutex {
+	s.dialMx.Lock()
+	defer s.dialMx.Unlock()
+
+	mx, ok := s.dialLocks[remote]
+	if !ok {
+		mx = new(sync.Mutex)
+		s.dialLocks[remote] = mx
+	}
+	return mx
+}
+
+func containsPK(pks []cipher.PubKey, pk cipher.PubKey) bool {
+	for _, v := range pks {
+		if v == pk {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package dmsg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestServer_relaySession(t *testing.T) {
+	dc := disc.NewMock()
+
+	// The destination client is delegated to two servers, neither of which is reachable.
+	dstPK, dstSK := cipher.GenerateKeyPair()
+	srvPK1, _ := cipher.GenerateKeyPair()
+	srvPK2, _ := cipher.GenerateKeyPair()
+	entry := disc.NewClientEntry(dstPK, 0, []cipher.PubKey{srvPK1, srvPK2})
+	require.NoError(t, entry.Sign(dstSK))
+	require.NoError(t, dc.SetEntry(context.TODO(), entry))
+
+	pk, sk := cipher.GenerateKeyPair()
+	prevPK, _ := cipher.GenerateKeyPair()
+
+	cases := []struct {
+		name    string
+		maxHops int
+		path    []cipher.PubKey
+		want    error
+	}{
+		{"relaying_disabled", 0, []cipher.PubKey{pk}, ErrReqNoNextSession},
+		{"too_many_hops", 1, []cipher.PubKey{prevPK, pk}, ErrReqRelayHopLimit},
+		{"loop", 3, []cipher.PubKey{srvPK1, srvPK2, pk}, ErrReqNoNextSession},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := NewServerWithConfig(pk, sk, dc, &ServerConfig{MaxRelayHops: c.maxHops})
+			defer func() { require.NoError(t, srv.Close()) }()
+
+			// Requests are not relayed to servers which they have traversed, so no relay session is dialed.
+			_, err := srv.relaySession(dstPK, c.path)
+			require.Equal(t, c.want, err)
+			require.Zero(t, srv.SessionCount())
+		})
+	}
+}
+
+func TestContainsPK(t *testing.T) {
+	pk1, _ := cipher.GenerateKeyPair()
+	pk2, _ := cipher.GenerateKeyPair()
+
+	require.False(t, containsPK(nil, pk1))
+	require.True(t, containsPK([]cipher.PubKey{pk2, pk1}, pk1))
+	require.False(t, containsPK([]cipher.PubKey{pk2}, pk1))
+}
@@ -0,0 +1,64 @@
+package dmsg
+
+import (
+	"context"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// Resolver resolves the entries of public keys locally (such as from static peers or LAN peer discovery), so that
+// dials do not wait on dmsg discovery, and so that dmsg can operate without it.
+//
+// Resolve should return an error (such as disc.ErrKeyNotFound) if the public key cannot be resolved, in which case
+// the next resolver of the chain (see Resolvers of Config) is tried, and then dmsg discovery.
+type Resolver interface {
+	Resolve(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error)
+}
+
+// ResolverFunc implements Resolver.
+type ResolverFunc func(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error)
+
+// Resolve implements Resolver.
+func (f ResolverFunc) Resolve(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	return f(ctx, pk)
+}
+
+// StaticResolver resolves the entries of a fixed set of peers (such as from a config file).
+type StaticResolver map[cipher.PubKey]*disc.Entry
+
+// Resolve implements Resolver.
+func (r StaticResolver) Resolve(_ context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	entry, ok := r[pk]
+	if !ok {
+		return nil, disc.ErrKeyNotFound
+	}
+	res := new(disc.Entry)
+	disc.Copy(res, entry)
+	return res, nil
+}
+
+// entryGetter obtains entries of public keys (such as disc.APIClient).
+type entryGetter interface {
+	Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error)
+}
+
+// resolverChain obtains entries from a chain of resolvers, falling back to dmsg discovery.
+type resolverChain struct {
+	resolvers []Resolver
+	dc        entryGetter
+}
+
+// Entry obtains the entry of the public key from the first resolver which resolves it. Entries of other public keys
+// than the one which is resolved are skipped.
+func (rc resolverChain) Entry(ctx context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+	for _, r := range rc.resolvers {
+		if entry, err := r.Resolve(ctx, pk); err == nil && entry != nil && entry.Static == pk {
+			return entry, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return rc.dc.Entry(ctx, pk)
+}
@@ -0,0 +1,53 @@
+package dmsg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestResolverChain(t *testing.T) {
+	pkA, _ := cipher.GenerateKeyPair()
+	pkB, _ := cipher.GenerateKeyPair()
+	pkC, _ := cipher.GenerateKeyPair()
+	pkD, _ := cipher.GenerateKeyPair()
+
+	dc := disc.NewMock()
+	require.NoError(t, dc.SetEntry(context.TODO(), &disc.Entry{Static: pkC, Client: &disc.Client{}}))
+
+	var calls int
+	rc := resolverChain{
+		resolvers: []Resolver{
+			ResolverFunc(func(_ context.Context, pk cipher.PubKey) (*disc.Entry, error) {
+				calls++
+				if pk == pkB {
+					return &disc.Entry{Static: pkD}, nil // entries of other public keys are skipped
+				}
+				return nil, errors.New("unavailable")
+			}),
+			StaticResolver{pkA: {Static: pkA}, pkB: {Static: pkB}},
+		},
+		dc: dc,
+	}
+
+	entry, err := rc.Entry(context.TODO(), pkA)
+	require.NoError(t, err)
+	require.Equal(t, pkA, entry.Static)
+
+	entry, err = rc.Entry(context.TODO(), pkB)
+	require.NoError(t, err)
+	require.Equal(t, pkB, entry.Static)
+
+	// Unresolved public keys fall back to discovery.
+	entry, err = rc.Entry(context.TODO(), pkC)
+	require.NoError(t, err)
+	require.Equal(t, pkC, entry.Static)
+	_, err = rc.Entry(context.TODO(), pkD)
+	require.Error(t, err)
+	require.Equal(t, 4, calls)
+}
@@ -0,0 +1,127 @@
+package dmsg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/nettest"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestServeContext(t *testing.T) {
+	dc := disc.NewMock()
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServer(srvPK, srvSK, dc)
+	lis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+
+	srvCtx, srvCancel := context.WithCancel(context.Background())
+	srvErr := make(chan error, 1)
+	go func() { srvErr <- srv.ServeContext(srvCtx, lis, "") }()
+	<-srv.Ready()
+
+	cliPK, cliSK := cipher.GenerateKeyPair()
+	c := NewClient(cliPK, cliSK, dc, nil)
+
+	// Canceling the context closes the client.
+	cliCtx, cliCancel := context.WithCancel(context.Background())
+	cliErr := make(chan error, 1)
+	go func() { cliErr <- c.ServeContext(cliCtx) }()
+	<-c.Ready()
+	cliCancel()
+	require.Equal(t, context.Canceled, <-cliErr)
+	require.True(t, isClosed(c.done))
+
+	// Closing the server stops it without error.
+	require.NoError(t, srv.Close())
+	select {
+	case err := <-srvErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop serving once closed")
+	}
+	srvCancel()
+}
+
+func TestServer_ServeContext(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+
+	t.Run("context_canceled", func(t *testing.T) {
+		srv := NewServer(pk, sk, disc.NewMock())
+		lis, err := nettest.NewLocalListener("tcp")
+		require.NoError(t, err)
+
+		// Canceling the context closes the server.
+		ctx, cancel := context.WithCancel(context.Background())
+		srvErr := make(chan error, 1)
+		go func() { srvErr <- srv.ServeContext(ctx, lis, "") }()
+		<-srv.Ready()
+		cancel()
+		select {
+		case err := <-srvErr:
+			require.Equal(t, context.Canceled, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("server did not stop serving once the context was canceled")
+		}
+		require.True(t, isClosed(srv.done))
+	})
+
+	t.Run("invalid_config", func(t *testing.T) {
+		lis, err := nettest.NewLocalListener("tcp")
+		require.NoError(t, err)
+		defer func() { require.NoError(t, lis.Close()) }()
+
+		srv := NewServerWithConfig(pk, sk, disc.NewMock(), &ServerConfig{MaxRelayHops: -1})
+		require.Equal(t, "MaxRelayHops", srv.ServeContext(context.TODO(), lis, "").(ConfigError).Field)
+		require.Equal(t, ErrNilDiscovery, NewServer(pk, sk, nil).ServeContext(context.TODO(), lis, ""))
+	})
+}
+
+func TestClient_CloseContext(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	c := NewClient(pk, sk, disc.NewMock(), nil)
+
+	// Sessions are closed even if the context is done before deregistration from discovery.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, c.CloseContext(ctx))
+	require.True(t, isClosed(c.done))
+	require.Zero(t, c.SessionCount())
+}
+
+func TestServer_Close(t *testing.T) {
+	dc := disc.NewMock()
+
+	// The entry is updated often, so that an update racing with deregistration would be noticed.
+	conf := DefaultServerConfig()
+	conf.EntryUpdateInterval = 10 * time.Millisecond
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServerWithConfig(srvPK, srvSK, dc, conf)
+	lis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(lis, "") }() //nolint:errcheck
+	<-srv.Ready()
+
+	// availableConnections returns the available connections of the server entry in discovery.
+	availableConnections := func() int {
+		entry, err := dc.Entry(context.TODO(), srvPK)
+		require.NoError(t, err)
+		return entry.Server.AvailableConnections
+	}
+	require.NotZero(t, availableConnections())
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, srv.Close())
+	require.Zero(t, availableConnections())
+	time.Sleep(50 * time.Millisecond)
+	require.Zero(t, availableConnections())
+
+	entries, err := dc.AvailableServers(context.TODO())
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
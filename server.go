@@ -2,8 +2,13 @@ package dmsg
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/SkycoinProject/skycoin/src/util/logging"
 	"github.com/sirupsen/logrus"
@@ -11,11 +16,198 @@ import (
 	"github.com/SkycoinProject/dmsg/cipher"
 	"github.com/SkycoinProject/dmsg/disc"
 	"github.com/SkycoinProject/dmsg/netutil"
+	"github.com/SkycoinProject/dmsg/noise"
 )
 
+// publicIPTimeout is the maximum duration for detecting the public IP of the server.
+const publicIPTimeout = time.Second * 10
+
+// ServerConfig configures a dmsg server entity.
+type ServerConfig struct {
+	// EntryUpdateInterval is the interval at which the server re-announces its entry in dmsg discovery (optional).
+	// A value of 0 (the default) results in the entry only being announced when the server starts serving.
+	EntryUpdateInterval time.Duration
+
+	// ExtraAddrs are additional public addresses which are advertised alongside the address passed to Serve.
+	// This allows the server to be reachable via both IPv4 and IPv6.
+	ExtraAddrs []string
+
+	// Region is advertised in the server's entry so that clients can filter servers by region (optional).
+	Region string
+
+	// PublicIP, if set, is used to detect the public address of the server when no address is passed to Serve.
+	// The detected address consists of the public IP and the port of the net.Listener.
+	PublicIP netutil.PublicIPFunc
+
+	// PublicIPCheckInterval is the interval at which the public address is re-detected (if PublicIP is set).
+	// The server's entry in dmsg discovery is updated when the address changes.
+	PublicIPCheckInterval time.Duration
+
+	// PoWDifficulty is the proof-of-work difficulty required by dmsg discovery for entry registration.
+	// A value of 0 results in entries being registered without a proof-of-work.
+	PoWDifficulty int
+
+	// NetworkID isolates dmsg networks which share binaries or dmsg discovery (such as test, staging and production).
+	// Sessions are only established with clients of the same network ID. Empty is the default network.
+	NetworkID string
+
+	// AuditLog, if set, records the establishment and teardown of sessions (see OpenAuditLog).
+	// The audit log is not closed when the server closes.
+	AuditLog *AuditLog
+
+	// StreamRateLimit is the maximum rate (in streams per second) at which a client may request streams via its
+	// session. Exceeding requests are rejected. A value of 0 disables the rate limit.
+	StreamRateLimit int
+
+	// MaxSessionStreams is the maximum number of concurrent streams served per session. Exceeding requests are
+	// rejected. The quota is advertised to clients during the session handshake, so that clients refuse to exceed it
+	// with ErrSessionStreamLimit. A value of 0 disables the quota.
+	MaxSessionStreams int
+
+	// CompressFrameHeaders compresses the frame headers of sessions with clients which also enable it (see
+	// CompressFrameHeaders of Config).
+	CompressFrameHeaders bool
+
+	// HandshakeFloodThreshold is the number of failed session handshakes from a host within HandshakeFloodWindow
+	// which is considered a handshake flood. A value of 0 disables detection.
+	HandshakeFloodThreshold int
+
+	// AbuseReporter, if set, is notified when the stream rate limit or quota is exceeded, or a handshake flood is
+	// detected.
+	AbuseReporter AbuseReporter
+
+	// MaxRelayHops is the maximum number of servers which a stream request may traverse when it is relayed between
+	// servers (as the destination client has no session with the server of the source client).
+	// A value of 0 (the default) disables relaying.
+	MaxRelayHops int
+
+	// Cluster, if set, runs the server as an instance of a cluster of servers with the same public key.
+	// Instances of a cluster do not deregister the shared entry from dmsg discovery on close.
+	Cluster *ClusterConfig
+
+	// MaxStreams is the maximum number of concurrent streams served by the server. Exceeding requests are rejected
+	// with ErrServerBusy, so that clients may retry via other servers. A value of 0 disables the limit.
+	MaxStreams int
+
+	// SocketOptions are applied to the TCP connections of sessions (such as TCP_NODELAY and keep-alive settings).
+	// This includes sessions with other servers for relaying and clustering.
+	SocketOptions netutil.SocketOptions
+
+	// AcceptRateLimit is the maximum rate (in connections per second) at which connections are accepted. Exceeding
+	// connections are closed immediately, so that reconnection storms are spread out. A value of 0 disables the limit.
+	AcceptRateLimit int
+
+	// MaxPendingHandshakes is the maximum number of concurrent session handshakes. Connections accepted while the
+	// maximum is reached are closed immediately, so that floods of connections which never complete the handshake do
+	// not exhaust the server's memory. A value of 0 disables the limit.
+	MaxPendingHandshakes int
+
+	// SessionHandshakeTimeout is the maximum duration allowed for the handshake of a session, so that stalled
+	// handshakes do not hold on to pending handshakes (see MaxPendingHandshakes). It also applies to sessions which
+	// the server dials (relay and cluster sessions). A value of 0 results in DefaultSessionHandshakeTimeout being used.
+	SessionHandshakeTimeout time.Duration
+
+	// MemoryBudget is the maximum heap usage (in bytes) of the server. Once exceeded, new streams are rejected with
+	// ErrServerBusy and the sessions with the most streams are closed (one per MemoryCheckInterval), so that the
+	// server sheds load rather than running out of memory. A value of 0 disables the budget.
+	MemoryBudget uint64
+
+	// FDMetrics, if set, records the file descriptor usage of the process (see FDCheckInterval).
+	FDMetrics FDMetrics
+
+	// FDReserve is the number of file descriptors below the limit (RLIMIT_NOFILE) which are reserved for existing
+	// sessions and streams. Once fewer remain, accepted connections are closed straight away, rather than sessions
+	// failing midway with EMFILE. A value of 0 disables this. Only supported on Linux.
+	FDReserve int
+
+	// StreamMetrics, if set, records the data queued by the server while forwarding streams.
+	StreamMetrics StreamMetrics
+
+	// StreamStallThreshold is the duration after which a blocked write to the receiving client of a stream is logged
+	// as a stall (with the IDs of the stream). This distinguishes slow receivers from relaying issues.
+	// A value of 0 disables stall detection.
+	StreamStallThreshold time.Duration
+
+	// SessionIdleTimeout is the duration after which sessions which receive no traffic are closed. Keepalive pings of
+	// the clients' multiplexers count as traffic, so that only abandoned sessions are closed.
+	// A value of 0 disables this.
+	SessionIdleTimeout time.Duration
+
+	// StreamIdleTimeout is the duration after which streams which have no traffic in either direction are closed.
+	// Clients keep quiet streams open by sending keepalive frames (see StreamKeepAlive of Config).
+	// A value of 0 disables this.
+	StreamIdleTimeout time.Duration
+
+	// FrameTrace, if set, receives a record (see FrameRecord) of each multiplexer frame of sessions, for debugging
+	// ordering and flow-control issues. Payloads are not recorded.
+	FrameTrace io.Writer
+
+	// SessionRekey sets when the encryption keys of sessions with dmsg clients are rotated. Keys are only rotated if
+	// the dmsg client also configures rekeying. Zero values disable rekeying by volume and time respectively, and
+	// rekeying altogether if both are zero.
+	SessionRekey noise.RekeyConfig
+
+	// Clock, if set, replaces the system clock for the server's timers (such as entry updates and health checks).
+	// This is intended for tests.
+	Clock Clock
+
+	// Standby, if set, runs the server as the hot standby of an active server with the same keypair.
+	// The server only advertises its entry in dmsg discovery once it takes over from the active server.
+	Standby *StandbyConfig
+
+	// LogSampleRate is the maximum number of log entries per second of each class of session and stream events (or
+	// errors) of a client. Exceeding entries are suppressed, and counted in the 'suppressed' field of the next logged
+	// entry of the class, so that a misbehaving client cannot flood the logs. A value of 0 disables sampling.
+	LogSampleRate int
+
+	// BandwidthReportInterval is the interval at which the bandwidth relayed for each client is summarized into a
+	// signed BandwidthReport. The most recent DefaultBandwidthReportHistory reports are retained (see
+	// BandwidthReports). A value of 0 disables bandwidth accounting.
+	BandwidthReportInterval time.Duration
+
+	// BandwidthReporter, if set, is notified of each bandwidth report.
+	BandwidthReporter BandwidthReporter
+}
+
+// DefaultServerConfig returns the default configuration for a dmsg server entity.
+func DefaultServerConfig() *ServerConfig {
+	return &ServerConfig{
+		PublicIPCheckInterval: DefaultPublicIPCheckInterval,
+		LogSampleRate:         DefaultLogSampleRate,
+	}
+}
+
 // Server represents a dsmg server entity.
 type Server struct {
+	bytesIn  uint64 // bytes read from all sessions, accessed atomically
+	bytesOut uint64 // bytes written to all sessions, accessed atomically
+
 	EntityCommon
+	conf    *ServerConfig
+	started time.Time
+
+	addr   string // address advertised in dmsg discovery
+	addrMx sync.Mutex
+
+	records []disc.AddrRecord // typed addresses of additional underlays
+
+	handshakes *handshakeTracker // nil if handshake flood detection is disabled
+	accepts    *rateLimiter      // nil if the accept rate is not limited
+	pendingHS  int32             // number of pending session handshakes
+	logs       *logSampler       // nil if logs are not sampled
+	bandwidth  *bandwidthLedger  // nil if bandwidth accounting is disabled
+
+	dialLocks map[string]*sync.Mutex // serializes establishment of relay and cluster sessions per remote
+	dialMx    sync.Mutex
+
+	peers   map[string]ServerSession // sessions with other instances of the cluster, by address
+	peersMx sync.Mutex
+
+	standby  int32 // 1 while the server is a standby which has not taken over
+	streams  int32 // number of streams being served
+	pressure int32 // 1 while the memory budget is exceeded
+
+	heapInuse func() uint64 // returns the heap usage which is compared against the memory budget
 
 	ready     chan struct{} // Closed once dmsg.Server is serving.
 	readyOnce sync.Once
@@ -23,34 +215,176 @@ type Server struct {
 	done chan struct{}
 	once sync.Once
 	wg   sync.WaitGroup
+
+	confErr error // returned by Serve if the config is invalid
 }
 
-// NewServer creates a new dmsg server entity.
+// NewServer creates a new dmsg server entity with the default config.
 func NewServer(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClient) *Server {
+	return NewServerWithConfig(pk, sk, dc, nil)
+}
+
+// NewServerWithConfig creates a new dmsg server entity.
+// The input 'conf' is optional, and the default config is used if it is nil.
+// If the config is invalid (see Validate) or 'dc' is nil, Serve returns the error.
+func NewServerWithConfig(pk cipher.PubKey, sk cipher.SecKey, dc disc.APIClient, conf *ServerConfig) *Server {
+	if conf == nil {
+		conf = DefaultServerConfig()
+	}
 	s := new(Server)
 	s.EntityCommon.init(pk, sk, dc, logging.MustGetLogger("dmsg_server"))
+	s.conf = conf
+	s.confErr = validateEntity(dc, conf.Validate())
+	s.started = time.Now()
+	s.powDifficulty = conf.PoWDifficulty
+	s.networkID = conf.NetworkID
+	s.sessionRekey = conf.SessionRekey
+	s.maxSessionStreams = conf.MaxSessionStreams
+	s.compressHeaders = conf.CompressFrameHeaders
+	s.tracer = newFrameTracer(conf.FrameTrace)
+	if conf.Clock != nil {
+		s.clock = conf.Clock
+	}
+	s.initFDBudget(conf.FDReserve, conf.FDMetrics)
+	if conf.AcceptRateLimit > 0 {
+		s.accepts = newRateLimiter(conf.AcceptRateLimit)
+	}
+	if conf.HandshakeFloodThreshold > 0 {
+		s.handshakes = newHandshakeTracker(conf.HandshakeFloodThreshold, HandshakeFloodWindow)
+	}
+	if conf.LogSampleRate > 0 {
+		s.logs = newLogSampler(conf.LogSampleRate)
+	}
+	if conf.BandwidthReportInterval > 0 {
+		s.bandwidth = newBandwidthLedger(s.clock.Now(), DefaultBandwidthReportHistory)
+	}
+	if conf.Standby != nil {
+		s.standby = 1
+	}
+	s.heapInuse = readHeapInuse
+	s.dialLocks = make(map[string]*sync.Mutex)
+	s.peers = make(map[string]ServerSession)
 	s.ready = make(chan struct{})
 	s.done = make(chan struct{})
 	return s
 }
 
 // Close implements io.Closer
+// The server's entry is deregistered from dmsg discovery before all sessions are closed.
 func (s *Server) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext is Close, but deregistration from dmsg discovery is abandoned once the context is done (or after
+// 'deregisterTimeout'). Sessions are closed regardless.
+func (s *Server) CloseContext(ctx context.Context) error {
 	if s == nil {
 		return nil
 	}
 	s.once.Do(func() {
 		close(s.done)
 		s.wg.Wait()
+
+		// The entry is deregistered once the entry updates stopped, so that it is not announced again.
+		if s.conf.Cluster == nil && !s.IsStandby() {
+			ctx, cancel := context.WithTimeout(ctx, deregisterTimeout)
+			if err := s.deregisterServerEntry(ctx); err != nil {
+				s.log.WithError(err).Warn("Failed to deregister entry from discovery.")
+			}
+			cancel()
+		}
 	})
 	return nil
 }
 
+// UnderlayListener is a listener of an underlay type, and the public address it is advertised with.
+type UnderlayListener struct {
+	Type     string       // underlay type (disc.UnderlayTCP or disc.UnderlayWS)
+	Listener net.Listener // for websocket underlays, websocket upgrades are served on this listener
+	Addr     string       // public address (if empty, the address of the listener is used)
+}
+
 // Serve serves the server.
+//
+// Deprecated: use ServeContext.
 func (s *Server) Serve(lis net.Listener, addr string) error {
+	return s.ServeContext(context.Background(), lis, addr)
+}
+
+// ServeContext serves the server on the listener, advertising the given address (or the listener's address, if
+// empty). It blocks until the server is closed, or until the context is done (in which case the server is closed and
+// the context error is returned).
+func (s *Server) ServeContext(ctx context.Context, lis net.Listener, addr string) error {
+	return s.ServeUnderlaysContext(ctx, UnderlayListener{Type: disc.UnderlayTCP, Listener: lis, Addr: addr})
+}
+
+// ServeUnderlays serves the server on multiple underlay listeners.
+//
+// Deprecated: use ServeUnderlaysContext.
+func (s *Server) ServeUnderlays(uls ...UnderlayListener) error {
+	return s.ServeUnderlaysContext(context.Background(), uls...)
+}
+
+// ServeUnderlaysContext serves the server on multiple underlay listeners, which are all advertised in one discovery
+// entry. The first listener is the primary listener and should be of type TCP. Additional listeners are advertised as
+// typed address records. Cancellation is as with ServeContext.
+func (s *Server) ServeUnderlaysContext(ctx context.Context, uls ...UnderlayListener) error {
+	if s.confErr != nil {
+		return s.confErr
+	}
+
+	sCtx, cancel := context.WithCancel(ctx)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		select {
+		case <-sCtx.Done():
+			if ctx.Err() != nil {
+				s.log.WithError(s.Close()).Info("Closed server as context is done.")
+			}
+		case <-s.done:
+		}
+	}()
+
+	err := s.serveUnderlays(uls)
+	cancel()
+	<-watchDone
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Server) serveUnderlays(uls []UnderlayListener) error {
+	if len(uls) == 0 || uls[0].Type != disc.UnderlayTCP {
+		return errors.New("primary underlay listener should be of type tcp")
+	}
+	lis, addr := uls[0].Listener, uls[0].Addr
+
 	var log logrus.FieldLogger //nolint:gosimple
 	log = s.log.WithField("local_addr", addr).WithField("local_pk", s.pk)
 
+	// Prepare additional underlay listeners.
+	extraLis := make([]net.Listener, 0, len(uls)-1)
+	records := make([]disc.AddrRecord, 0, len(uls)-1)
+	for _, ul := range uls[1:] {
+		l := ul.Listener
+		switch ul.Type {
+		case disc.UnderlayTCP:
+		case disc.UnderlayWS:
+			l = netutil.NewWSListener(l)
+		default:
+			return fmt.Errorf("unsupported underlay type '%s'", ul.Type)
+		}
+		rAddr := ul.Addr
+		if rAddr == "" {
+			rAddr = ul.Listener.Addr().String()
+		}
+		extraLis = append(extraLis, l)
+		records = append(records, disc.AddrRecord{Type: ul.Type, Address: rAddr})
+	}
+	s.records = records
+
 	log.Info("Serving server.")
 	s.wg.Add(1)
 
@@ -63,18 +397,96 @@ func (s *Server) Serve(lis net.Listener, addr string) error {
 		<-s.done
 		log.WithError(lis.Close()).
 			Info("Stopping server, net.Listener closed.")
+		for _, l := range extraLis {
+			log.WithError(l.Close()).
+				WithField("underlay_addr", l.Addr()).
+				Info("Stopping server, underlay net.Listener closed.")
+		}
 	}()
 
-	log.Info("Updating discovery entry...")
+	detect := addr == "" && s.conf.PublicIP != nil
 	if addr == "" {
 		addr = lis.Addr().String()
 	}
+	if detect {
+		if pubAddr, err := s.detectPublicAddr(lis.Addr()); err != nil {
+			log.WithError(err).Warn("Failed to detect public address, advertising listener address instead.")
+		} else {
+			addr = pubAddr
+		}
+	}
+	s.setAddr(addr)
+
+	if s.conf.Standby != nil {
+		s.readyOnce.Do(func() { close(s.ready) })
+		if !s.awaitTakeover(log) {
+			return nil
+		}
+	}
+
+	log.WithField("addr", addr).Info("Updating discovery entry...")
 	if err := s.updateEntryLoop(addr); err != nil {
 		return err
 	}
+	if s.conf.EntryUpdateInterval > 0 {
+		s.wg.Add(1)
+		go func() {
+			s.updateEntryPeriodically(s.conf.EntryUpdateInterval)
+			s.wg.Done()
+		}()
+	}
+	if s.conf.Cluster != nil {
+		s.wg.Add(1)
+		go func() {
+			s.refreshClusterRoutes(ClusterRouteRefreshInterval)
+			s.wg.Done()
+		}()
+	}
+	if s.bandwidth != nil {
+		s.wg.Add(1)
+		go func() {
+			s.reportBandwidthPeriodically(s.conf.BandwidthReportInterval)
+			s.wg.Done()
+		}()
+	}
+	if s.conf.MemoryBudget > 0 {
+		s.wg.Add(1)
+		go func() {
+			s.shedLoadLoop(MemoryCheckInterval)
+			s.wg.Done()
+		}()
+	}
+	s.wg.Add(1)
+	go func() {
+		s.monitorFDs(s.done, FDCheckInterval)
+		s.wg.Done()
+	}()
+	if detect && s.conf.PublicIPCheckInterval > 0 {
+		s.wg.Add(1)
+		go func() {
+			s.watchPublicAddr(lis.Addr(), s.conf.PublicIPCheckInterval)
+			s.wg.Done()
+		}()
+	}
 
 	log.Info("Accepting sessions...")
+	for _, l := range extraLis {
+		s.wg.Add(1)
+		go func(l net.Listener) {
+			if err := s.acceptSessions(l); err != nil {
+				log.WithError(err).WithField("underlay_addr", l.Addr()).Warn("Stopped accepting sessions.")
+			}
+			s.wg.Done()
+		}(l)
+	}
 	s.readyOnce.Do(func() { close(s.ready) })
+	return s.acceptSessions(lis)
+}
+
+// acceptSessions accepts and handles sessions from the given listener until it is closed.
+// Temporary errors (such as EMFILE) are retried with a backoff, so that existing sessions are kept serving.
+func (s *Server) acceptSessions(lis net.Listener) error {
+	var backoff time.Duration
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
@@ -82,8 +494,29 @@ func (s *Server) Serve(lis net.Listener, addr string) error {
 			if isClosed(s.done) {
 				return nil
 			}
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				if backoff *= 2; backoff == 0 {
+					backoff = time.Millisecond * 5
+				} else if backoff > time.Second {
+					backoff = time.Second
+				}
+				s.log.WithError(err).WithField("backoff", backoff).Warn("Failed to accept connection, retrying...")
+				select {
+				case <-s.done:
+					return nil
+				case <-s.clock.After(backoff):
+				}
+				continue
+			}
 			return err
 		}
+		backoff = 0
+		if !s.admitConn(conn) {
+			continue
+		}
+		if err := s.conf.SocketOptions.Apply(conn); err != nil {
+			s.log.WithError(err).WithField("remote_addr", conn.RemoteAddr()).Warn("Failed to apply socket options.")
+		}
 
 		s.wg.Add(1)
 		go func(conn net.Conn) {
@@ -93,7 +526,28 @@ func (s *Server) Serve(lis net.Listener, addr string) error {
 	}
 }
 
-// Ready returns a chan which blocks until the server begins serving.
+// admitConn returns false (and closes the connection) if the accept rate limit or the maximum number of pending
+// session handshakes is exceeded. If true is returned, the connection is counted as a pending handshake.
+func (s *Server) admitConn(conn net.Conn) bool {
+	reason := ""
+	if s.fdsExhausted() {
+		reason = "file descriptor budget exhausted"
+	} else if s.accepts != nil && !s.accepts.allow() {
+		reason = "accept rate limit exceeded"
+	} else if n := atomic.AddInt32(&s.pendingHS, 1); s.conf.MaxPendingHandshakes > 0 &&
+		int(n) > s.conf.MaxPendingHandshakes {
+		atomic.AddInt32(&s.pendingHS, -1)
+		reason = "maximum pending handshakes exceeded"
+	}
+	if reason == "" {
+		return true
+	}
+	s.log.WithField("remote_addr", conn.RemoteAddr()).WithField("reason", reason).Debug("Rejected connection.")
+	_ = conn.Close() //nolint:errcheck
+	return false
+}
+
+// Ready returns a chan which blocks until the server begins serving (or standing by, if the server is a standby).
 func (s *Server) Ready() <-chan struct{} {
 	return s.ready
 }
@@ -109,36 +563,275 @@ func (s *Server) updateEntryLoop(addr string) error {
 		}
 	}()
 	return netutil.NewDefaultRetrier(s.log).Do(ctx, func() error {
-		return s.updateServerEntry(ctx, addr)
+		return s.updateServerEntry(ctx, disc.Server{
+			Address:   addr,
+			Addresses: s.conf.ExtraAddrs,
+			Records:   s.records,
+			Region:    s.conf.Region,
+		})
 	})
 }
 
+// updateEntryPeriodically re-announces the server's entry in dmsg discovery every interval, until the server closes.
+func (s *Server) updateEntryPeriodically(interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.Chan():
+			if err := s.updateEntryLoop(s.getAddr()); err != nil && !isClosed(s.done) {
+				s.log.WithError(err).Warn("Failed to update discovery entry.")
+			}
+		}
+	}
+}
+
+// detectPublicAddr obtains the public address of the server from the public IP and the port of the listener.
+func (s *Server) detectPublicAddr(lisAddr net.Addr) (string, error) {
+	_, port, err := net.SplitHostPort(lisAddr.String())
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publicIPTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+			cancel()
+		}
+	}()
+
+	ip, err := s.conf.PublicIP(ctx)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+// watchPublicAddr re-detects the public address every interval, and updates the server's entry in dmsg discovery
+// when it changes.
+func (s *Server) watchPublicAddr(lisAddr net.Addr, interval time.Duration) {
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.Chan():
+			addr, err := s.detectPublicAddr(lisAddr)
+			if err != nil {
+				if !isClosed(s.done) {
+					s.log.WithError(err).Warn("Failed to detect public address.")
+				}
+				continue
+			}
+			if addr == s.getAddr() {
+				continue
+			}
+			s.log.WithField("old_addr", s.getAddr()).
+				WithField("new_addr", addr).
+				Info("Public address changed, updating discovery entry...")
+			s.setAddr(addr)
+			if err := s.updateEntryLoop(addr); err != nil && !isClosed(s.done) {
+				s.log.WithError(err).Warn("Failed to update discovery entry.")
+			}
+		}
+	}
+}
+
+func (s *Server) getAddr() string {
+	s.addrMx.Lock()
+	defer s.addrMx.Unlock()
+	return s.addr
+}
+
+func (s *Server) setAddr(addr string) {
+	s.addrMx.Lock()
+	s.addr = addr
+	s.addrMx.Unlock()
+}
+
 func (s *Server) handleSession(conn net.Conn) {
 	var log logrus.FieldLogger //nolint:gosimple
 	log = s.log.WithField("remote_tcp", conn.RemoteAddr())
 
-	dSes, err := makeServerSession(&s.EntityCommon, conn)
+	cConn := &countingConn{Conn: conn, totalIn: &s.bytesIn, totalOut: &s.bytesOut}
+	conn = cConn
+
+	dSes, err := s.handshakeSession(conn)
 	if err != nil {
 		log = log.WithError(err)
 		if err := conn.Close(); err != nil {
 			s.log.WithError(err).
 				Debug("On handleSession() failure, close connection resulted in error.")
 		}
+		if s.handshakes != nil && s.handshakes.fail(conn.RemoteAddr()) {
+			s.reportAbuse(AbuseHandshakeFlood, cipher.PubKey{}, conn.RemoteAddr(),
+				fmt.Sprintf("%d failed session handshakes within %s", s.handshakes.threshold, s.handshakes.window))
+		}
 		return
 	}
+	if dSes.RemotePK() == s.pk {
+		s.servePeerSession(dSes)
+		return
+	}
+	dSes.guard = s.sessionGuard(dSes.RemotePK(), conn.RemoteAddr())
+	dSes.srv = s
 
 	log = log.WithField("remote_pk", dSes.RemotePK())
-	log.Info("Started session.")
+	s.logs.log(log, dSes.RemotePK(), "session_start").Info("Started session.")
+
+	s.bandwidth.track(dSes.RemotePK(), cConn)
+	defer s.bandwidth.untrack(cConn)
+
+	start := time.Now()
+	s.audit(log, AuditRecord{
+		Time:       start.UnixNano(),
+		Event:      AuditSessionStart,
+		RemotePK:   dSes.RemotePK(),
+		RemoteAddr: conn.RemoteAddr().String(),
+	})
+	defer func() {
+		in, out := cConn.counts()
+		s.audit(log, AuditRecord{
+			Event:      AuditSessionEnd,
+			RemotePK:   dSes.RemotePK(),
+			RemoteAddr: conn.RemoteAddr().String(),
+			Duration:   time.Since(start),
+			BytesIn:    in,
+			BytesOut:   out,
+		})
+	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		awaitDone(ctx, s.done)
-		log.WithError(dSes.Close()).Info("Stopped session.")
+		err := dSes.Close()
+		s.logs.log(log, dSes.RemotePK(), logClass("session_stop", err)).WithError(err).Info("Stopped session.")
 	}()
+	if s.conf.SessionIdleTimeout > 0 {
+		received := func() uint64 { in, _ := cConn.counts(); return in }
+		go reapIdle(s.clock, s.conf.SessionIdleTimeout, ctx.Done(), received, func() {
+			log.WithError(dSes.Close()).Info("Closed idle session.")
+		})
+	}
 
-	if s.setSession(ctx, dSes.SessionCommon) {
-		dSes.Serve()
+	// A newer session of the client takes over new streams (such as when the client recycles a session whose stream
+	// IDs are near exhaustion). The replaced session is still served until the client closes it.
+	if old := s.replaceSession(ctx, dSes.SessionCommon); old != nil {
+		s.logs.log(log, dSes.RemotePK(), "session_replace").Info("Session replaced an existing session of the client.")
+	}
+	s.setClusterRoute(ctx, dSes.RemotePK())
+	dSes.Serve()
+	if s.delSession(ctx, dSes.SessionCommon) {
+		s.delClusterRoute(ctx, dSes.RemotePK())
 	}
-	s.delSession(ctx, dSes.RemotePK())
 	cancel()
 }
+
+// handshakeSession performs the session handshake within a deadline, so that stalled handshakes do not pile up.
+// The pending handshake (see admitConn) is released once done.
+func (s *Server) handshakeSession(conn net.Conn) (ServerSession, error) {
+	defer atomic.AddInt32(&s.pendingHS, -1)
+
+	if err := conn.SetDeadline(time.Now().Add(s.handshakeTimeout())); err != nil {
+		return ServerSession{}, err
+	}
+	dSes, err := makeServerSession(&s.EntityCommon, conn)
+	if err != nil {
+		return dSes, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = dSes.Close() //nolint:errcheck
+		return dSes, err
+	}
+	return dSes, nil
+}
+
+// handshakeTimeout returns the maximum duration of session handshakes (see ServerConfig.SessionHandshakeTimeout).
+func (s *Server) handshakeTimeout() time.Duration {
+	if s.conf.SessionHandshakeTimeout > 0 {
+		return s.conf.SessionHandshakeTimeout
+	}
+	return DefaultSessionHandshakeTimeout
+}
+
+// audit appends a record to the audit log (if any).
+func (s *Server) audit(log logrus.FieldLogger, r AuditRecord) {
+	if s.conf.AuditLog == nil {
+		return
+	}
+	if err := s.conf.AuditLog.Append(r); err != nil {
+		log.WithError(err).WithField("event", r.Event).Error("Failed to append audit record.")
+	}
+}
+
+// sessionGuard returns the guard which enforces the stream limits of a session (or nil if there are no limits).
+func (s *Server) sessionGuard(rPK cipher.PubKey, rAddr net.Addr) *sessionGuard {
+	if s.conf.StreamRateLimit <= 0 && s.conf.MaxSessionStreams <= 0 {
+		return nil
+	}
+	g := &sessionGuard{
+		maxStreams: int32(s.conf.MaxSessionStreams),
+		report: func(kind AbuseKind, detail string) {
+			s.reportAbuse(kind, rPK, rAddr, detail)
+		},
+	}
+	if s.conf.StreamRateLimit > 0 {
+		g.limiter = newRateLimiter(s.conf.StreamRateLimit)
+	}
+	return g
+}
+
+// acquireStream returns false if the server is already serving the maximum number of streams, or if the memory
+// budget is exceeded.
+func (s *Server) acquireStream() bool {
+	if s.underPressure() {
+		return false
+	}
+	n := atomic.AddInt32(&s.streams, 1)
+	if s.conf.MaxStreams > 0 && int(n) > s.conf.MaxStreams {
+		atomic.AddInt32(&s.streams, -1)
+		return false
+	}
+	return true
+}
+
+func (s *Server) releaseStream() {
+	atomic.AddInt32(&s.streams, -1)
+}
+
+// ServerStats contains statistics of a dmsg server.
+type ServerStats struct {
+	Started   time.Time       // when the server was created
+	Sessions  int             // number of client sessions
+	Streams   int             // number of streams being served
+	BytesIn   uint64          // bytes read from all sessions
+	BytesOut  uint64          // bytes written to all sessions
+	ClientPKs []cipher.PubKey // public keys of the clients of the sessions
+}
+
+// Stats returns statistics of the server.
+func (s *Server) Stats() ServerStats {
+	s.sessionsMx.Lock()
+	pks := make([]cipher.PubKey, 0, len(s.sessions))
+	for pk := range s.sessions {
+		pks = append(pks, pk)
+	}
+	s.sessionsMx.Unlock()
+
+	return ServerStats{
+		Started:   s.started,
+		Sessions:  len(pks),
+		Streams:   int(atomic.LoadInt32(&s.streams)),
+		BytesIn:   atomic.LoadUint64(&s.bytesIn),
+		BytesOut:  atomic.LoadUint64(&s.bytesOut),
+		ClientPKs: pks,
+	}
+}
@@ -0,0 +1,71 @@
+package dmsg
+
+import (
+	"context"
+	"sync"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+// serverCache records the delegated server which last served a dial to each remote client, so that subsequent dials
+// to the remote client try that server first. Entries are evicted once a dial via the server fails.
+type serverCache struct {
+	size int
+	m    map[cipher.PubKey]cipher.PubKey // remote pk -> server pk
+	mx   sync.Mutex
+}
+
+func newServerCache(size int) *serverCache {
+	return &serverCache{
+		size: size,
+		m:    make(map[cipher.PubKey]cipher.PubKey),
+	}
+}
+
+// prioritize returns the given delegated servers of the remote client, with the cached server (if any) first.
+func (sc *serverCache) prioritize(pk cipher.PubKey, srvPKs []cipher.PubKey) []cipher.PubKey {
+	sc.mx.Lock()
+	cached, ok := sc.m[pk]
+	sc.mx.Unlock()
+
+	if !ok {
+		return srvPKs
+	}
+	for i, srvPK := range srvPKs {
+		if srvPK == cached {
+			out := make([]cipher.PubKey, 0, len(srvPKs))
+			out = append(out, cached)
+			out = append(out, srvPKs[:i]...)
+			return append(out, srvPKs[i+1:]...)
+		}
+	}
+	return srvPKs
+}
+
+// update records the result of a dial to the given remote client via the given server.
+// Dials which are cancelled by the caller, or which reach the remote client, do not evict the cached server.
+func (sc *serverCache) update(pk, srvPK cipher.PubKey, err error) {
+	if sc.size <= 0 || srvPK.Null() {
+		return
+	}
+	if isAnyErr(err, context.Canceled, ErrPortNotListening, ErrReqRejected) {
+		return
+	}
+
+	sc.mx.Lock()
+	defer sc.mx.Unlock()
+
+	if err != nil {
+		if sc.m[pk] == srvPK {
+			delete(sc.m, pk)
+		}
+		return
+	}
+	if _, ok := sc.m[pk]; !ok && len(sc.m) >= sc.size {
+		for evict := range sc.m {
+			delete(sc.m, evict)
+			break
+		}
+	}
+	sc.m[pk] = srvPK
+}
@@ -0,0 +1,37 @@
+package dmsg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+func TestServerCache(t *testing.T) {
+	pk, _ := GenKeyPair(t, "remote")
+	srvA, _ := GenKeyPair(t, "server A")
+	srvB, _ := GenKeyPair(t, "server B")
+	srvPKs := []cipher.PubKey{srvA, srvB}
+
+	sc := newServerCache(1)
+	require.Equal(t, srvPKs, sc.prioritize(pk, srvPKs))
+
+	// The server which served the dial is tried first.
+	sc.update(pk, srvB, nil)
+	require.Equal(t, []cipher.PubKey{srvB, srvA}, sc.prioritize(pk, srvPKs))
+	require.Equal(t, []cipher.PubKey{srvA, srvB}, srvPKs)
+
+	// Dials which reach the remote client do not evict the server, but other failures do.
+	sc.update(pk, srvB, &DialError{Phase: DialPhaseRemoteRefused, Err: ErrPortNotListening})
+	require.Equal(t, srvB, sc.prioritize(pk, srvPKs)[0])
+	sc.update(pk, srvB, errors.New("failed"))
+	require.Equal(t, srvPKs, sc.prioritize(pk, srvPKs))
+
+	// The cache is bounded.
+	pk2, _ := GenKeyPair(t, "remote 2")
+	sc.update(pk, srvB, nil)
+	sc.update(pk2, srvB, nil)
+	require.Len(t, sc.m, 1)
+}
@@ -0,0 +1,62 @@
+package dmsg
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+// verifiedServerList returns the server list of the config if it is signed by the trusted operator.
+// Nil is returned if the list is missing or invalid, in which case no server is trusted.
+func verifiedServerList(log logrus.FieldLogger, conf *Config) *disc.ServerList {
+	if conf.TrustedOperator.Null() || conf.ServerList == nil {
+		return nil
+	}
+	if err := conf.ServerList.Verify(conf.TrustedOperator); err != nil {
+		log.WithError(err).Error("Invalid server list: No dmsg server will be trusted.")
+		return nil
+	}
+	return conf.ServerList
+}
+
+// isTrustedServer returns true if sessions can be established with the server of the given public key.
+func (ce *Client) isTrustedServer(pk cipher.PubKey) bool {
+	if ce.conf.TrustedOperator.Null() {
+		return true
+	}
+	return ce.servers != nil && ce.servers.Contains(pk)
+}
+
+// trustedServers returns the trusted servers of the discovered entries.
+// If dmsg discovery has none of the trusted servers, the entries of the server list are used to bootstrap.
+func (ce *Client) trustedServers(entries []*disc.Entry) []*disc.Entry {
+	out := make([]*disc.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if ce.isTrustedServer(entry.Static) {
+			out = append(out, entry)
+		}
+	}
+	if len(out) == 0 && ce.servers != nil {
+		ce.log.Info("No trusted servers in discovery, bootstrapping from server list.")
+		for _, entry := range ce.servers.Servers {
+			if entry.Server != nil {
+				out = append(out, entry)
+			}
+		}
+	}
+	return out
+}
+
+// serverListEntry returns the snapshotted entry of the given server from the server list (if any).
+func (ce *Client) serverListEntry(pk cipher.PubKey) *disc.Entry {
+	if ce.servers == nil {
+		return nil
+	}
+	for _, entry := range ce.servers.Servers {
+		if entry.Static == pk && entry.Server != nil {
+			return entry
+		}
+	}
+	return nil
+}
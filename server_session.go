@@ -1,24 +1,29 @@
 package dmsg
 
 import (
+	"errors"
 	"io"
 	"net"
+	"time"
 
 	"github.com/SkycoinProject/yamux"
+	"github.com/sirupsen/logrus"
 
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/dmsgerr"
 	"github.com/SkycoinProject/dmsg/netutil"
-	"github.com/SkycoinProject/dmsg/noise"
 )
 
 // ServerSession represents a session from the perspective of a dmsg server.
 type ServerSession struct {
 	*SessionCommon
+	guard *sessionGuard // nil if stream limits are not enforced
+	srv   *Server       // used to relay requests to other servers (nil disables relaying)
 }
 
 func makeServerSession(entity *EntityCommon, conn net.Conn) (ServerSession, error) {
 	var sSes ServerSession
 	sSes.SessionCommon = new(SessionCommon)
-	sSes.nMap = make(noise.NonceMap)
 	if err := sSes.SessionCommon.initServer(entity, conn); err != nil {
 		return sSes, err
 	}
@@ -45,56 +50,157 @@ func (ss *ServerSession) Serve() {
 		if err != nil {
 			switch err {
 			case yamux.ErrSessionShutdown, io.EOF:
-				ss.log.WithError(err).Info("Stopping session...")
+				ss.sampledLog("session_stopping", err).WithError(err).Info("Stopping session...")
 			default:
-				ss.log.WithError(err).Warn("Failed to accept stream, stopping session...")
+				ss.sampledLog("session_stopping", err).WithError(err).Warn("Failed to accept stream, stopping session...")
 			}
 			return
 		}
 
-		ss.log.Info("Serving stream.")
+		if err := ss.acquireStream(); err != nil {
+			ss.sampledLog("stream_reject", err).WithError(err).Warn("Rejecting stream.")
+			go ss.rejectStream(yStr, err)
+			continue
+		}
+
+		ss.sampledLog("stream_start", nil).Info("Serving stream.")
 		go func(yStr *yamux.Stream) {
 			err := ss.serveStream(yStr)
-			ss.log.WithError(err).Info("Stopped stream.")
+			ss.releaseStream()
+			ss.sampledLog("stream_stop", err).WithError(err).Info("Stopped stream.")
 		}(yStr)
 	}
 }
 
+// sampledLog returns the logger of the session for an entry of the given event and error, which discards the entry if
+// the entries of the class are sampled out (see ServerConfig.LogSampleRate).
+func (ss *ServerSession) sampledLog(event string, err error) logrus.FieldLogger {
+	if ss.srv == nil {
+		return ss.log
+	}
+	return ss.srv.logs.log(ss.log, ss.RemotePK(), logClass(event, err))
+}
+
+// acquireStream checks the stream limits of the session and the server before a stream is served.
+// If nil is returned, releaseStream should be called once the stream is served.
+func (ss *ServerSession) acquireStream() error {
+	if err := ss.guard.acquire(); err != nil {
+		return err
+	}
+	if ss.srv != nil && !ss.srv.acquireStream() {
+		ss.guard.release()
+		return ErrServerBusy
+	}
+	return nil
+}
+
+func (ss *ServerSession) releaseStream() {
+	ss.guard.release()
+	if ss.srv != nil {
+		ss.srv.releaseStream()
+	}
+}
+
+// rejectStream reads the stream request and responds with a rejection which is signed by the server, so that the
+// client can distinguish the reason (such as ErrServerBusy) from other failures.
+func (ss *ServerSession) rejectStream(yStr *yamux.Stream, reason error) {
+	defer func() {
+		ss.log.WithError(yStr.Close()).Debug("Closed rejected stream.")
+	}()
+
+	if err := yStr.SetDeadline(time.Now().Add(HandshakeTimeout)); err != nil {
+		return
+	}
+	obj, err := ss.readObject(yStr)
+	if err != nil {
+		return
+	}
+	ss.writeRejection(yStr, obj.Hash(), reason)
+}
+
+// rejectRequest informs the source client of a request which failed to be forwarded, and closes the stream.
+// If the destination rejected the request, its signed response 'resp' is forwarded. Otherwise, the server writes its
+// own rejection if the reason is one which servers reject requests with.
+func (ss *ServerSession) rejectRequest(yStr *yamux.Stream, req StreamRequest, resp SignedObject, reason error) {
+	if resp != nil {
+		if err := ss.writeObject(yStr, resp); err != nil {
+			ss.log.WithError(err).Debug("Failed to forward stream rejection.")
+		}
+	} else if code, ok := dmsgerr.CodeOf(reason); ok && isServerRejectionCode(code) {
+		ss.writeRejection(yStr, req.raw.Hash(), reason)
+	}
+	ss.log.WithError(yStr.Close()).Debug("Closed rejected stream.")
+}
+
+// writeRejection writes a rejection of the request of the given hash, which is signed by the server.
+func (ss *ServerSession) writeRejection(yStr *yamux.Stream, reqHash cipher.SHA256, reason error) {
+	resp := StreamResponse{
+		ReqHash:  reqHash,
+		Accepted: false,
+		ErrCode:  ErrServerBusy.Code(),
+		Reason:   rejectionReason(reason),
+	}
+	if code, ok := dmsgerr.CodeOf(reason); ok {
+		resp.ErrCode = code
+	}
+	if err := ss.writeObject(yStr, MakeSignedStreamResponse(&resp, ss.localSK())); err != nil {
+		ss.log.WithError(err).Debug("Failed to write stream rejection.")
+	}
+}
+
 func (ss *ServerSession) serveStream(yStr *yamux.Stream) error {
-	readRequest := func() (StreamRequest, error) {
+	readRequest := func() (StreamRequest, []cipher.PubKey, error) {
 		obj, err := ss.readObject(yStr)
 		if err != nil {
-			return StreamRequest{}, err
+			return StreamRequest{}, nil, err
 		}
 		req, err := obj.ObtainStreamRequest()
 		if err != nil {
-			return StreamRequest{}, err
+			return StreamRequest{}, nil, err
 		}
 		// TODO(evanlinjin): Implement timestamp tracker.
 		if err := req.Verify(0); err != nil {
-			return StreamRequest{}, err
+			return StreamRequest{}, nil, err
+		}
+		if req.SrcAddr.PK == ss.rPK {
+			return req, nil, nil
 		}
-		if req.SrcAddr.PK != ss.rPK {
-			return StreamRequest{}, ErrReqInvalidSrcPK
+		// Requests of other source clients are only accepted if relayed by another server.
+		path, err := ss.readRelayPath(yStr)
+		if errors.Is(err, ErrReqRelayLoop) {
+			return StreamRequest{}, nil, err
 		}
-		return req, nil
+		if err != nil {
+			return StreamRequest{}, nil, ErrReqInvalidSrcPK
+		}
+		return req, path, nil
 	}
 
 	// Read request.
-	req, err := readRequest()
+	req, path, err := readRequest()
 	if err != nil {
 		return err
 	}
 
 	// Obtain next session.
-	ss2, ok := ss.entity.serverSession(req.DstAddr.PK)
-	if !ok {
-		return ErrReqNoNextSession
+	ss2, path, err := ss.nextSession(req.DstAddr.PK, path)
+	if err != nil {
+		ss.rejectRequest(yStr, req, nil, err)
+		return err
+	}
+
+	// Respect the stream limit advertised by the next hop.
+	release, err := ss2.opened.acquire()
+	if err != nil {
+		ss.rejectRequest(yStr, req, nil, err)
+		return err
 	}
+	defer release()
 
 	// Forward request and obtain/check response.
-	yStr2, resp, err := ss2.forwardRequest(req)
+	yStr2, resp, err := ss2.forwardRequest(req, path)
 	if err != nil {
+		ss.rejectRequest(yStr, req, resp, err)
 		return err
 	}
 
@@ -104,10 +210,34 @@ func (ss *ServerSession) serveStream(yStr *yamux.Stream) error {
 	}
 
 	// Serve stream.
-	return netutil.CopyReadWriteCloser(yStr, yStr2)
+	log := ss.log.
+		WithField("src", req.SrcAddr.ShortString()).WithField("src_stream", yStr.StreamID()).
+		WithField("dst", req.DstAddr.ShortString()).WithField("dst_stream", yStr2.StreamID())
+	relayed, stop := ss.srv.reapIdleStream(log, yStr, yStr2)
+	defer stop()
+	return netutil.CopyReadWriteCloser(
+		ss.srv.monitorStream(halfCloseStream{yStr}, relayed, log),
+		ss.srv.monitorStream(halfCloseStream{yStr2}, relayed, log))
+}
+
+// halfCloseStream implements netutil.CloseWriter for yamux streams, so that half-closes of streams are relayed.
+// Closing a yamux stream only closes the local (write) side, and the stream remains readable until the remote closes.
+type halfCloseStream struct {
+	*yamux.Stream
+}
+
+// CloseWrite implements netutil.CloseWriter
+func (s halfCloseStream) CloseWrite() error {
+	return s.Stream.Close()
 }
 
-func (ss *ServerSession) forwardRequest(req StreamRequest) (yStr *yamux.Stream, respObj SignedObject, err error) {
+// forwardRequest forwards the request via the session. If 'path' is non-nil, the request is relayed to another server
+// and the relay path is sent along with the request.
+// If the destination rejects the request, its signed response is returned alongside the error so that it can be
+// forwarded to the source client.
+func (ss *ServerSession) forwardRequest(
+	req StreamRequest, path []cipher.PubKey,
+) (yStr *yamux.Stream, respObj SignedObject, err error) {
 	defer func() {
 		if err != nil && yStr != nil {
 			ss.log.
@@ -116,12 +246,17 @@ func (ss *ServerSession) forwardRequest(req StreamRequest) (yStr *yamux.Stream,
 		}
 	}()
 
-	if yStr, err = ss.ys.OpenStream(); err != nil {
+	if yStr, err = ss.openStream(); err != nil {
 		return nil, nil, err
 	}
 	if err = ss.writeObject(yStr, req.raw); err != nil {
 		return nil, nil, err
 	}
+	if path != nil {
+		if err = ss.writeObject(yStr, encodeGob(relayHeader{Path: path})); err != nil {
+			return nil, nil, err
+		}
+	}
 	if respObj, err = ss.readObject(yStr); err != nil {
 		return nil, nil, err
 	}
@@ -129,8 +264,14 @@ func (ss *ServerSession) forwardRequest(req StreamRequest) (yStr *yamux.Stream,
 	if resp, err = respObj.ObtainStreamResponse(); err != nil {
 		return nil, nil, err
 	}
-	if err = resp.Verify(req); err != nil {
+	if err = serverRejection(ss.rPK, req, resp); err != nil {
+		return nil, nil, err // relayed via another server, which rejected the request
+	}
+	if err = resp.verifyOrigin(req); err != nil {
 		return nil, nil, err
 	}
+	if err = resp.Verify(req); err != nil {
+		return nil, respObj, err
+	}
 	return yStr, respObj, nil
 }
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/SkycoinProject/yamux"
 	"github.com/sirupsen/logrus"
@@ -21,11 +22,23 @@ type SessionCommon struct {
 	rPK    cipher.PubKey // remote pk
 
 	ys   *yamux.Session
+	sw   *sessionWriter
 	ns   *noise.Noise
 	nMap noise.NonceMap
 	rMx  sync.Mutex
 	wMx  sync.Mutex
 
+	streamN   int32                // number of established streams (only used by client sessions)
+	streams   map[*Stream]struct{} // established streams (only used by client sessions)
+	streamsMx sync.Mutex
+
+	opened   streamLimit // streams opened by the local side, limited by the settings of the remote
+	accepted streamLimit // streams accepted from the remote, limited by the local settings (only used by clients)
+
+	lastOpenedID   uint32 // ID of the last stream opened by the local side, accessed atomically
+	lastAcceptedID uint32 // ID of the last stream accepted from the remote, accessed atomically
+	recycling      int32  // 1 once the session is being recycled, accessed atomically
+
 	log logrus.FieldLogger
 }
 
@@ -35,6 +48,9 @@ func (sc *SessionCommon) initClient(entity *EntityCommon, conn net.Conn, rPK cip
 		LocalSK:   entity.sk,
 		RemotePK:  rPK,
 		Initiator: true,
+		Prologue:  entity.networkPrologue(),
+		Rekey:     entity.sessionRekey,
+		Settings:  entity.sessionSettings().encode(),
 	})
 	if err != nil {
 		return err
@@ -48,17 +64,22 @@ func (sc *SessionCommon) initClient(entity *EntityCommon, conn net.Conn, rPK cip
 		return ErrSessionHandshakeExtraBytes
 	}
 
-	ySes, err := yamux.Client(conn, yamux.DefaultConfig())
+	conn = entity.sessionConn(conn, decodeSessionSettings(ns.RemoteSettings()))
+	sw := newSessionWriter(entity.tracer.wrap(conn, rPK))
+	ySes, err := yamux.Client(sw, entity.muxConfig())
 	if err != nil {
+		_ = sw.Close() //nolint:errcheck
 		return err
 	}
 
 	sc.entity = entity
 	sc.rPK = rPK
 	sc.ys = ySes
+	sc.sw = sw
 	sc.ns = ns
 	sc.nMap = make(noise.NonceMap)
-	sc.log = entity.log.WithField("session", ns.RemoteStatic())
+	sc.applySettings(decodeSessionSettings(ns.RemoteSettings()))
+	sc.log = entity.subLog(LogSession).WithField("session", ns.RemoteStatic())
 	return nil
 }
 
@@ -67,6 +88,9 @@ func (sc *SessionCommon) initServer(entity *EntityCommon, conn net.Conn) error {
 		LocalPK:   entity.pk,
 		LocalSK:   entity.sk,
 		Initiator: false,
+		Prologue:  entity.networkPrologue(),
+		Rekey:     entity.sessionRekey,
+		Settings:  entity.sessionSettings().encode(),
 	})
 	if err != nil {
 		return err
@@ -80,22 +104,37 @@ func (sc *SessionCommon) initServer(entity *EntityCommon, conn net.Conn) error {
 		return ErrSessionHandshakeExtraBytes
 	}
 
-	ySes, err := yamux.Server(conn, yamux.DefaultConfig())
+	conn = entity.sessionConn(conn, decodeSessionSettings(ns.RemoteSettings()))
+	sw := newSessionWriter(entity.tracer.wrap(conn, ns.RemoteStatic()))
+	ySes, err := yamux.Server(sw, entity.muxConfig())
 	if err != nil {
+		_ = sw.Close() //nolint:errcheck
 		return err
 	}
 
 	sc.entity = entity
 	sc.rPK = ns.RemoteStatic()
 	sc.ys = ySes
+	sc.sw = sw
 	sc.ns = ns
 	sc.nMap = make(noise.NonceMap)
-	sc.log = entity.log.WithField("session", ns.RemoteStatic())
+	sc.applySettings(decodeSessionSettings(ns.RemoteSettings()))
+	sc.log = entity.subLog(LogSession).WithField("session", ns.RemoteStatic())
 	return nil
 }
 
+// applySettings applies the local settings and the settings advertised by the remote.
+func (sc *SessionCommon) applySettings(remote sessionSettings) {
+	sc.opened.max = int32(remote.MaxStreams)
+	sc.accepted.max = int32(sc.entity.maxSessionStreams)
+}
+
 // writeEncryptedGob encrypts with noise and prefixed with uint16 (2 additional bytes).
+// Objects written to streams of the session (stream handshakes) are written ahead of queued data of other streams.
 func (sc *SessionCommon) writeObject(w io.Writer, obj SignedObject) error {
+	if yStr, ok := w.(*yamux.Stream); ok && sc.sw != nil {
+		defer sc.sw.expedite(yStr.StreamID())()
+	}
 	sc.wMx.Lock()
 	p := sc.ns.EncryptUnsafe(obj)
 	sc.wMx.Unlock()
@@ -134,6 +173,101 @@ func (sc *SessionCommon) LocalPK() cipher.PubKey { return sc.entity.pk }
 // RemotePK returns the remote public key of the session.
 func (sc *SessionCommon) RemotePK() cipher.PubKey { return sc.rPK }
 
+// trackStream records an established stream within the session.
+// The returned function untracks the stream, and only performs its action once.
+func (sc *SessionCommon) trackStream(s *Stream) (untrack func()) {
+	atomic.AddInt32(&sc.streamN, 1)
+	sc.streamsMx.Lock()
+	if sc.streams == nil {
+		sc.streams = make(map[*Stream]struct{})
+	}
+	sc.streams[s] = struct{}{}
+	sc.streamsMx.Unlock()
+
+	once := new(sync.Once)
+	return func() {
+		once.Do(func() {
+			atomic.AddInt32(&sc.streamN, -1)
+			sc.streamsMx.Lock()
+			delete(sc.streams, s)
+			sc.streamsMx.Unlock()
+		})
+	}
+}
+
+// allStreams returns the established streams within the session.
+func (sc *SessionCommon) allStreams() []*Stream {
+	sc.streamsMx.Lock()
+	streams := make([]*Stream, 0, len(sc.streams))
+	for s := range sc.streams {
+		streams = append(streams, s)
+	}
+	sc.streamsMx.Unlock()
+	return streams
+}
+
+// StreamCount returns the number of established streams within the session.
+func (sc *SessionCommon) StreamCount() int {
+	return int(atomic.LoadInt32(&sc.streamN))
+}
+
+// sessionSettings are exchanged during the session handshake (as with SETTINGS frames of HTTP/2), so that each side
+// can respect the limits of the other.
+// Fields are encoded in order, so that new fields can be appended while remotes which are unaware of them ignore them.
+type sessionSettings struct {
+	MaxStreams   uint32 // maximum number of concurrent streams which the remote may open (0 for no limit)
+	Capabilities uint32 // optional features which are supported (and enabled) locally (see sessionCap*)
+}
+
+const sessionSettingsSize = 8
+
+// Capabilities of sessions. Features are only used if both sides of a session advertise them.
+const (
+	// sessionCapHeaderCompression compresses the frame headers of the session (see compressedConn).
+	sessionCapHeaderCompression uint32 = 1 << iota
+)
+
+func (ss sessionSettings) encode() []byte {
+	b := make([]byte, sessionSettingsSize)
+	binary.BigEndian.PutUint32(b, ss.MaxStreams)
+	binary.BigEndian.PutUint32(b[4:], ss.Capabilities)
+	return b
+}
+
+// decodeSessionSettings decodes settings, where fields which are missing (such as from older remotes) are zero.
+func decodeSessionSettings(b []byte) sessionSettings {
+	var ss sessionSettings
+	if len(b) >= 4 {
+		ss.MaxStreams = binary.BigEndian.Uint32(b)
+	}
+	if len(b) >= 8 {
+		ss.Capabilities = binary.BigEndian.Uint32(b[4:])
+	}
+	return ss
+}
+
+// sharedCapabilities returns the capabilities which are supported by both sides of the session.
+func (ss sessionSettings) sharedCapabilities(remote sessionSettings) uint32 {
+	return ss.Capabilities & remote.Capabilities
+}
+
+// streamLimit counts concurrent streams of one direction of a session against a maximum.
+type streamLimit struct {
+	max int32 // 0 for no limit
+	n   int32 // accessed atomically
+}
+
+// acquire reserves a stream, and returns ErrSessionStreamLimit if the maximum is reached.
+// If nil is returned, the returned function releases the stream, and only performs its action once.
+func (l *streamLimit) acquire() (release func(), err error) {
+	if n := atomic.AddInt32(&l.n, 1); l.max > 0 && n > l.max {
+		atomic.AddInt32(&l.n, -1)
+		return nil, ErrSessionStreamLimit
+	}
+	once := new(sync.Once)
+	return func() { once.Do(func() { atomic.AddInt32(&l.n, -1) }) }, nil
+}
+
 // Close closes the session.
 func (sc *SessionCommon) Close() (err error) {
 	if sc != nil {
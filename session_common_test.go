@@ -0,0 +1,63 @@
+package dmsg
+
+import (
+	"testing"
+
+	"github.com/SkycoinProject/skycoin/src/util/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionSettings(t *testing.T) {
+	ss := sessionSettings{MaxStreams: 12}
+	require.Equal(t, ss, decodeSessionSettings(ss.encode()))
+
+	// Settings of remotes which send none, or which append unknown fields.
+	require.Equal(t, sessionSettings{}, decodeSessionSettings(nil))
+	require.Equal(t, ss, decodeSessionSettings(append(ss.encode(), 1, 2, 3)))
+}
+
+func TestStreamLimit(t *testing.T) {
+	l := streamLimit{max: 2}
+	release, err := l.acquire()
+	require.NoError(t, err)
+	_, err = l.acquire()
+	require.NoError(t, err)
+	_, err = l.acquire()
+	require.Equal(t, ErrSessionStreamLimit, err)
+
+	// Releasing more than once only releases the stream once.
+	release()
+	release()
+	_, err = l.acquire()
+	require.NoError(t, err)
+	_, err = l.acquire()
+	require.Equal(t, ErrSessionStreamLimit, err)
+
+	// A zero maximum enforces nothing.
+	var nl streamLimit
+	for i := 0; i < 10; i++ {
+		_, err := nl.acquire()
+		require.NoError(t, err)
+	}
+}
+
+func TestSessionCommon_observeStreamID(t *testing.T) {
+	recycled := make(chan *SessionCommon, 2)
+	entity := &EntityCommon{recycleSessionCallback: func(ses *SessionCommon) { recycled <- ses }}
+	sc := &SessionCommon{entity: entity, log: logging.MustGetLogger("session")}
+
+	sc.observeStreamID(&sc.lastOpenedID, 3)
+	sc.observeStreamID(&sc.lastOpenedID, 1) // out of order
+	require.Equal(t, uint32(3), sc.lastOpenedID)
+	require.Equal(t, streamIDsLeft(3), sc.StreamIDsLeft())
+	require.Len(t, recycled, 0)
+
+	// The session is only recycled once, when either side nears exhaustion.
+	id := maxStreamID - 2*StreamIDRecycleThreshold + 2
+	sc.observeStreamID(&sc.lastAcceptedID, id)
+	require.Equal(t, StreamIDRecycleThreshold-1, sc.StreamIDsLeft())
+	require.Equal(t, sc, <-recycled)
+	sc.observeStreamID(&sc.lastOpenedID, maxStreamID)
+	require.Equal(t, uint32(0), sc.StreamIDsLeft())
+	require.Len(t, recycled, 0)
+}
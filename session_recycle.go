@@ -0,0 +1,120 @@
+package dmsg
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+
+	"github.com/SkycoinProject/yamux"
+)
+
+// Stream IDs are allocated by yamux in increments of 2 (odd IDs by the client side of the session and even IDs by the
+// server side), and are never reused within a session. Once the IDs of a side are exhausted, it cannot open streams.
+// Client sessions are therefore recycled before this happens (see StreamIDRecycleThreshold).
+
+// maxStreamID is the stream ID at which yamux considers stream IDs to be exhausted.
+const maxStreamID = math.MaxUint32 - 1
+
+// streamIDsLeft returns the number of stream IDs left after the given stream ID.
+func streamIDsLeft(id uint32) uint32 {
+	if id >= maxStreamID {
+		return 0
+	}
+	return (maxStreamID - id) / 2
+}
+
+// openStream opens a yamux stream, recording its ID.
+// ErrStreamIDsExhausted is returned if the local side has no stream IDs left.
+func (sc *SessionCommon) openStream() (*yamux.Stream, error) {
+	yStr, err := sc.ys.OpenStream()
+	if err == yamux.ErrStreamsExhausted {
+		sc.observeStreamID(&sc.lastOpenedID, maxStreamID)
+		return nil, ErrStreamIDsExhausted
+	}
+	if err != nil {
+		return nil, err
+	}
+	sc.observeStreamID(&sc.lastOpenedID, yStr.StreamID())
+	return yStr, nil
+}
+
+// acceptStream accepts a yamux stream, recording its ID.
+func (sc *SessionCommon) acceptStream() (*yamux.Stream, error) {
+	yStr, err := sc.ys.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	sc.observeStreamID(&sc.lastAcceptedID, yStr.StreamID())
+	return yStr, nil
+}
+
+// observeStreamID records the stream ID as the last of a side of the session. Once the stream IDs left of either side
+// fall below StreamIDRecycleThreshold, the session is recycled (once) via the entity's recycleSessionCallback.
+func (sc *SessionCommon) observeStreamID(last *uint32, id uint32) {
+	for {
+		prev := atomic.LoadUint32(last)
+		if id <= prev || atomic.CompareAndSwapUint32(last, prev, id) {
+			break
+		}
+	}
+	if streamIDsLeft(id) >= StreamIDRecycleThreshold || sc.entity.recycleSessionCallback == nil {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&sc.recycling, 0, 1) {
+		sc.log.WithField("stream_id", id).Info("Stream IDs are near exhaustion, recycling session...")
+		go sc.entity.recycleSessionCallback(sc)
+	}
+}
+
+// StreamIDsLeft returns the number of stream IDs left to the side of the session which has the fewest left.
+func (sc *SessionCommon) StreamIDsLeft() uint32 {
+	opened := streamIDsLeft(atomic.LoadUint32(&sc.lastOpenedID))
+	if accepted := streamIDsLeft(atomic.LoadUint32(&sc.lastAcceptedID)); accepted < opened {
+		return accepted
+	}
+	return opened
+}
+
+// recycleSession replaces the session with a fresh session with the same server, so that new streams are served by
+// the fresh session. The old session is closed once its streams are closed.
+func (ce *Client) recycleSession(old *SessionCommon) {
+	log := ce.subLog(LogSession).WithField("remote_pk", old.RemotePK())
+
+	if err := ce.redialSession(old); err != nil {
+		log.WithError(err).Warn("Failed to recycle session, it is closed once its streams are closed.")
+	} else {
+		log.Info("Recycled session.")
+	}
+
+	for old.StreamCount() > 0 && !isClosed(ce.done) {
+		select {
+		case <-ce.done:
+		case <-ce.clock.After(SessionDrainInterval):
+		}
+	}
+	log.WithError(old.Close()).Info("Closed recycled session.")
+}
+
+// redialSession dials a session which replaces 'old', unless 'old' is already replaced or deleted.
+func (ce *Client) redialSession(old *SessionCommon) error {
+	srvPK := old.RemotePK()
+	mx := ce.sessionLock(srvPK)
+	mx.Lock()
+	defer mx.Unlock()
+
+	if ses, ok := ce.session(srvPK); !ok || ses != old {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ce.conf.SessionHandshakeTimeout)
+	defer cancel()
+
+	entry, err := getServerEntry(ctx, ce.entryGetter(), srvPK)
+	if err != nil {
+		if entry = ce.serverListEntry(srvPK); entry == nil {
+			return err
+		}
+	}
+	_, err = ce.dialSession(ctx, entry, old)
+	return err
+}
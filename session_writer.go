@@ -0,0 +1,217 @@
+package dmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+)
+
+// sessionWriteQueueSize is the size (in bytes) of queued data frames of a session above which the multiplexer blocks
+// on writing further data frames. Control frames are always queued.
+const sessionWriteQueueSize = 1 << 20
+
+// Frame types and flags of the session multiplexer (see frame_trace.go for the header layout).
+const (
+	frameTypeData = 0
+
+	frameFlagFIN = 1 << 2
+	frameFlagRST = 1 << 3
+)
+
+var errSessionWriterClosed = errors.New("session writer closed")
+
+// queuedFrame is a complete multiplexer frame (header and payload) which is queued to be written.
+type queuedFrame struct {
+	sid uint32
+	b   []byte
+}
+
+// sessionWriter schedules the multiplexer frames which are written to a session connection, so that control frames
+// are written ahead of queued data frames. Control frames are stream handshakes (including the stream requests and
+// responses written with SessionCommon.writeObject), window updates, stream closes, keepalive pings and go-aways.
+// Otherwise, a congested session delays keepalive pings until the session appears dead, and delays stream closes
+// behind the data of other streams.
+//
+// Frames of a stream are never reordered with respect to each other in ways that matter: a close (FIN or RST) of a
+// stream with queued data frames is queued behind them.
+type sessionWriter struct {
+	net.Conn
+
+	hdr  [frameHeaderSize]byte
+	n    int    // buffered bytes of the current header
+	body []byte // current data frame (header and payload), nil while a header is being read
+	need uint32 // remaining payload bytes of the current data frame
+
+	ctrl      []queuedFrame
+	data      []queuedFrame
+	dataBytes int
+	queued    map[uint32]int // number of queued data frames of each stream
+	expedited map[uint32]int // streams of which data frames are control frames (while their handshake is written)
+	err       error          // error of writing to the connection (or errSessionWriterClosed)
+
+	cond *sync.Cond
+	mx   sync.Mutex
+}
+
+// newSessionWriter wraps the session connection, and starts writing to it in the background.
+func newSessionWriter(conn net.Conn) *sessionWriter {
+	w := &sessionWriter{
+		Conn:      conn,
+		queued:    make(map[uint32]int),
+		expedited: make(map[uint32]int),
+	}
+	w.cond = sync.NewCond(&w.mx)
+	go w.writeLoop()
+	return w
+}
+
+// Write queues the frames of 'b'. The multiplexer serializes writes, and writes each frame in order.
+// It blocks while the queued data frames exceed sessionWriteQueueSize.
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+	total := len(b)
+	for len(b) > 0 {
+		if w.body != nil {
+			k := w.need
+			if uint32(len(b)) < k {
+				k = uint32(len(b))
+			}
+			w.body = append(w.body, b[:k]...)
+			b, w.need = b[k:], w.need-k
+			if w.need == 0 {
+				w.enqueue(w.body)
+				w.body = nil
+			}
+			continue
+		}
+		k := copy(w.hdr[w.n:], b)
+		b, w.n = b[k:], w.n+k
+		if w.n < frameHeaderSize {
+			break
+		}
+		w.n = 0
+		frame := append(make([]byte, 0, frameHeaderSize), w.hdr[:]...)
+		if length := binary.BigEndian.Uint32(w.hdr[8:12]); w.hdr[1] == frameTypeData && length > 0 {
+			w.body, w.need = append(make([]byte, 0, frameHeaderSize+int(length)), frame...), length
+			continue
+		}
+		w.enqueue(frame)
+	}
+
+	for w.dataBytes > sessionWriteQueueSize && w.err == nil {
+		w.cond.Wait()
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return total, nil
+}
+
+// enqueue queues a complete frame.
+func (w *sessionWriter) enqueue(frame []byte) {
+	f := queuedFrame{sid: binary.BigEndian.Uint32(frame[4:8]), b: frame}
+	isData := frame[1] == frameTypeData
+	closes := binary.BigEndian.Uint16(frame[2:4])&(frameFlagFIN|frameFlagRST) != 0
+
+	switch {
+	case w.queued[f.sid] > 0 && (isData || closes):
+		// Keep the order of data frames and closes of the stream.
+	case !isData || w.expedited[f.sid] > 0:
+		w.ctrl = append(w.ctrl, f)
+		w.cond.Broadcast()
+		return
+	}
+	if isData {
+		w.queued[f.sid]++
+		w.dataBytes += len(frame)
+	}
+	w.data = append(w.data, f)
+	w.cond.Broadcast()
+}
+
+// expedite treats the data frames of the stream as control frames, until the returned function is called.
+// It is used while stream handshakes are written.
+func (w *sessionWriter) expedite(sid uint32) func() {
+	w.mx.Lock()
+	w.expedited[sid]++
+	w.mx.Unlock()
+
+	return func() {
+		w.mx.Lock()
+		if w.expedited[sid]--; w.expedited[sid] <= 0 {
+			delete(w.expedited, sid)
+		}
+		w.mx.Unlock()
+	}
+}
+
+// next pops the next frames to write: all queued control frames, or otherwise the next data frame (with the frames
+// queued behind it for order).
+func (w *sessionWriter) next() (net.Buffers, error) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	for len(w.ctrl) == 0 && len(w.data) == 0 && w.err == nil {
+		w.cond.Wait()
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	if len(w.ctrl) > 0 {
+		bufs := make(net.Buffers, 0, len(w.ctrl))
+		for _, f := range w.ctrl {
+			bufs = append(bufs, f.b)
+		}
+		w.ctrl = w.ctrl[:0]
+		return bufs, nil
+	}
+
+	f := w.data[0]
+	w.data[0] = queuedFrame{}
+	w.data = w.data[1:]
+	if f.b[1] == frameTypeData {
+		if w.queued[f.sid]--; w.queued[f.sid] <= 0 {
+			delete(w.queued, f.sid)
+		}
+		w.dataBytes -= len(f.b)
+		w.cond.Broadcast()
+	}
+	return net.Buffers{f.b}, nil
+}
+
+func (w *sessionWriter) writeLoop() {
+	for {
+		bufs, err := w.next()
+		if err != nil {
+			return
+		}
+		if _, err := bufs.WriteTo(w.Conn); err != nil {
+			w.fail(err)
+			_ = w.Conn.Close() //nolint:errcheck
+			return
+		}
+	}
+}
+
+func (w *sessionWriter) fail(err error) {
+	w.mx.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.cond.Broadcast()
+	w.mx.Unlock()
+}
+
+// Close implements io.Closer
+// Queued frames are discarded.
+func (w *sessionWriter) Close() error {
+	w.fail(errSessionWriterClosed)
+	return w.Conn.Close()
+}
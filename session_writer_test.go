@@ -0,0 +1,82 @@
+package dmsg
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionWriter(t *testing.T) {
+	const (
+		typeWindowUpdate = 1
+		typePing         = 2
+	)
+	frame := func(typ uint8, flags uint16, sid uint32, payload string) []byte {
+		b := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+		b[1] = typ
+		binary.BigEndian.PutUint16(b[2:4], flags)
+		binary.BigEndian.PutUint32(b[4:8], sid)
+		if typ == frameTypeData {
+			binary.BigEndian.PutUint32(b[8:12], uint32(len(payload)))
+		}
+		return append(b, payload...)
+	}
+
+	c1, c2 := net.Pipe()
+	w := newSessionWriter(c1)
+	defer func() { require.NoError(t, w.Close()) }()
+
+	// The first data frame is written straight away (and blocks until it is read), so the rest are queued.
+	write := func(b []byte) {
+		// Frames may be split across writes.
+		for _, part := range [][]byte{b[:5], b[5:]} {
+			_, err := w.Write(part)
+			require.NoError(t, err)
+		}
+	}
+	write(frame(frameTypeData, 0, 1, "a"))
+	for pending := true; pending; {
+		w.mx.Lock()
+		pending = len(w.data) > 0
+		w.mx.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+	write(frame(frameTypeData, 0, 1, "b"))
+	write(frame(typeWindowUpdate, frameFlagFIN, 1, ""))
+	write(frame(typePing, 0, 0, ""))
+	done := w.expedite(3)
+	write(frame(frameTypeData, 0, 3, "hs"))
+	done()
+	write(frame(frameTypeData, 0, 3, "c"))
+	write(frame(typeWindowUpdate, 0, 5, ""))
+
+	type result struct {
+		typ  uint8
+		sid  uint32
+		body string
+	}
+	want := []result{
+		{frameTypeData, 1, "a"},
+		{typePing, 0, ""},
+		{frameTypeData, 3, "hs"},
+		{typeWindowUpdate, 5, ""},
+		{frameTypeData, 1, "b"},
+		{typeWindowUpdate, 1, ""}, // the FIN stays behind the data of its stream
+		{frameTypeData, 3, "c"},
+	}
+	for i, exp := range want {
+		hdr := make([]byte, frameHeaderSize)
+		_, err := io.ReadFull(c2, hdr)
+		require.NoError(t, err)
+		body := make([]byte, binary.BigEndian.Uint32(hdr[8:12]))
+		if hdr[1] == frameTypeData {
+			_, err = io.ReadFull(c2, body)
+			require.NoError(t, err)
+		}
+		require.Equal(t, exp, result{hdr[1], binary.BigEndian.Uint32(hdr[4:8]), string(body)}, i)
+	}
+}
@@ -0,0 +1,76 @@
+package dmsg
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StandbyConfig configures a dmsg server as the hot standby of an active dmsg server with the same keypair.
+// The standby health checks the active server, and takes over the advertisement of the shared entry in dmsg discovery
+// once the active server fails. The recovered active server should then be restarted as a standby.
+type StandbyConfig struct {
+	// ActiveAddr is the address of the active server, which is health checked by dialing it.
+	ActiveAddr string
+
+	// CheckInterval is the interval between health checks (DefaultStandbyCheckInterval is used if 0).
+	CheckInterval time.Duration
+
+	// FailureThreshold is the number of consecutive failed health checks after which the standby takes over
+	// (DefaultStandbyFailureThreshold is used if 0).
+	FailureThreshold int
+}
+
+// IsStandby returns true if the server is a standby which has not (yet) taken over from the active server.
+func (s *Server) IsStandby() bool {
+	return atomic.LoadInt32(&s.standby) == 1
+}
+
+// awaitTakeover health checks the active server until it fails, and returns true once the standby should take over.
+// It returns false if the server is closed before then.
+func (s *Server) awaitTakeover(log logrus.FieldLogger) bool {
+	interval := s.conf.Standby.CheckInterval
+	if interval <= 0 {
+		interval = DefaultStandbyCheckInterval
+	}
+	threshold := s.conf.Standby.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultStandbyFailureThreshold
+	}
+	log = log.WithField("active_addr", s.conf.Standby.ActiveAddr)
+	log.Info("Standing by...")
+
+	ticker := s.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	fails := 0
+	for {
+		select {
+		case <-s.done:
+			return false
+		case <-ticker.Chan():
+			if err := checkActiveServer(s.conf.Standby.ActiveAddr, interval); err != nil {
+				fails++
+				log.WithError(err).WithField("failures", fails).Warn("Active server failed health check.")
+				if fails >= threshold {
+					log.Info("Taking over from active server.")
+					atomic.StoreInt32(&s.standby, 0)
+					return true
+				}
+				continue
+			}
+			fails = 0
+		}
+	}
+}
+
+// checkActiveServer checks whether the active server accepts connections.
+func checkActiveServer(addr string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
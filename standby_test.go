@@ -0,0 +1,55 @@
+package dmsg
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/disc"
+)
+
+func TestServer_AwaitTakeover(t *testing.T) {
+	active, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := active.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close() //nolint:errcheck
+		}
+	}()
+
+	pk, sk := cipher.GenerateKeyPair()
+	srv := NewServerWithConfig(pk, sk, disc.NewMock(), &ServerConfig{
+		Standby: &StandbyConfig{
+			ActiveAddr:       active.Addr().String(),
+			CheckInterval:    time.Millisecond * 10,
+			FailureThreshold: 2,
+		},
+	})
+	require.True(t, srv.IsStandby())
+
+	takeover := make(chan bool, 1)
+	go func() { takeover <- srv.awaitTakeover(srv.log) }()
+
+	// The standby should not take over while the active server is healthy.
+	select {
+	case <-takeover:
+		t.Fatal("standby took over from a healthy active server")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	require.NoError(t, active.Close())
+	select {
+	case ok := <-takeover:
+		require.True(t, ok)
+		require.False(t, srv.IsStandby())
+	case <-time.After(time.Second * 5):
+		t.Fatal("standby did not take over from a failed active server")
+	}
+}
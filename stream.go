@@ -1,8 +1,13 @@
 package dmsg
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/SkycoinProject/yamux"
@@ -12,44 +17,166 @@ import (
 	"github.com/SkycoinProject/dmsg/noise"
 )
 
+// MaxOOBSize is the maximum size of an out-of-band message.
+const MaxOOBSize = maxFramePayload
+
+// maxFramePayload is the maximum payload size of a single frame of streams which support out-of-band messages.
+const maxFramePayload = noise.MaxWriteSize - 1
+
+// fingerprintSize is the number of bytes of the channel binding hash which are represented in stream fingerprints.
+const fingerprintSize = 16
+
+// Frame types of streams which support out-of-band messages.
+// Each noise frame of such streams is prefixed with the frame type.
+const (
+	frameData byte = iota
+	frameOOB
+	frameKeepAlive
+	frameReset
+)
+
+// streamResetTimeout is the maximum duration that resetting a stream waits to write the reset frame.
+const streamResetTimeout = time.Second
+
 // Stream represents a dmsg connection between two dmsg clients.
 type Stream struct {
+	linger       int64  // time.Duration (see SetLinger), accessed atomically
+	bytesRead    uint64 // accessed atomically
+	bytesWritten uint64 // accessed atomically
+
 	ses  *ClientSession // back reference
 	yStr *yamux.Stream
 
+	writeMx sync.Mutex // held by writes, so that Close can wait for pending writes
+	frameMx sync.Mutex // held when writing a frame (if oob is set), so that oob messages go between payload frames
+	readMx  sync.Mutex
+	readBuf bytes.Buffer // payload of a partially read frame (only used if oob is set)
+	readErr error        // ErrStreamReset once the remote resets the stream, guarded by readMx
+	oobFn   func(msg []byte)
+	oobMx   sync.Mutex
+
+	oob bool // whether out-of-band messages are used (negotiated during handshake)
+
+	hsStart    time.Time     // when the handshake started
+	hsDuration time.Duration // duration of the handshake (0 until the handshake finishes)
+	opened     time.Time     // when the stream was established
+
+	writing int32 // 1 while a write is in progress, accessed atomically
+	queued  int32 // bytes of readBuf, accessed atomically (see Introspect)
+
+	delayWrites bool        // whether small writes are coalesced (see SetNoDelay), guarded by writeMx
+	pending     []byte      // coalesced writes which are not yet written, guarded by writeMx
+	flushTimer  *time.Timer // flushes pending writes once the coalesce delay passes, guarded by writeMx
+	flushErr    error       // error of flushing pending writes in the background, guarded by writeMx
+
 	// The following fields are to be filled after handshake.
-	lAddr  Addr
-	rAddr  Addr
-	ns     *noise.Noise
-	nsConn *noise.ReadWriter
-	close  func() // to be called when closing
-	log    logrus.FieldLogger
+	lAddr   Addr
+	rAddr   Addr
+	ns      *noise.Noise
+	nsConn  *noise.ReadWriter
+	close   func() // to be called when closing
+	release func() // to be called when closing, releases the stream from the stream limit of the session
+	untrack func() // to be called when closing an established stream
+	log     logrus.FieldLogger
 }
 
 func newInitiatingStream(cSes *ClientSession) (*Stream, error) {
-	yStr, err := cSes.ys.OpenStream()
+	yStr, err := cSes.openStream()
 	if err != nil {
 		return nil, err
 	}
-	return &Stream{ses: cSes, yStr: yStr}, nil
+	return &Stream{ses: cSes, yStr: yStr, linger: int64(cSes.conf.StreamLinger), hsStart: time.Now()}, nil
 }
 
 func newRespondingStream(cSes *ClientSession) (*Stream, error) {
-	yStr, err := cSes.ys.AcceptStream()
+	yStr, err := cSes.acceptStream()
 	if err != nil {
 		return nil, err
 	}
-	return &Stream{ses: cSes, yStr: yStr}, nil
+	return &Stream{ses: cSes, yStr: yStr, linger: int64(cSes.conf.StreamLinger), hsStart: time.Now()}, nil
 }
 
 // Close closes the dmsg stream.
+// Pending writes are given up to the linger duration to complete (see SetLinger), after which they are discarded and
+// the stream is reset. This includes coalesced writes which are not yet written (see SetNoDelay).
 func (s *Stream) Close() error {
 	if s == nil {
 		return nil
 	}
+	s.awaitWrites()
 	if s.close != nil {
 		s.close()
 	}
+	if s.release != nil {
+		s.release()
+	}
+	if s.untrack != nil {
+		s.untrack()
+	}
+	return s.yStr.Close()
+}
+
+// SetLinger sets the behavior of Close when writes are still pending.
+// If 'd' is 0, Close does not wait for pending writes.
+// If 'd' is positive, Close blocks for up to 'd' for pending writes to complete before resetting the stream.
+// If 'd' is negative, Close resets the stream straight away.
+// Resetting discards pending writes, returns blocked reads and writes, and makes reads of the remote return
+// ErrStreamReset. Remotes which do not support out-of-band messages (see SupportsOOB) observe a regular close instead.
+// The initial value is taken from Config.StreamLinger.
+func (s *Stream) SetLinger(d time.Duration) {
+	atomic.StoreInt64(&s.linger, int64(d))
+}
+
+// awaitWrites waits for pending writes to complete, for up to the linger duration.
+// The stream is reset if writes are still pending afterwards.
+func (s *Stream) awaitWrites() {
+	linger := time.Duration(atomic.LoadInt64(&s.linger))
+	if linger == 0 {
+		return
+	}
+	if linger > 0 {
+		done := make(chan struct{})
+		go func() {
+			s.writeMx.Lock()
+			_ = s.flushLocked() //nolint:errcheck
+			s.writeMx.Unlock()
+			close(done)
+		}()
+		t := time.NewTimer(linger)
+		defer t.Stop()
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+	}
+	s.reset()
+}
+
+// reset discards pending writes and writes a reset frame (if supported by the remote), after which blocked reads and
+// writes return.
+func (s *Stream) reset() {
+	_ = s.yStr.SetWriteDeadline(time.Now()) //nolint:errcheck
+	if s.oob {
+		s.frameMx.Lock()
+		_ = s.yStr.SetWriteDeadline(time.Now().Add(streamResetTimeout)) //nolint:errcheck
+		if _, err := s.nsConn.Write([]byte{frameReset}); err != nil {
+			s.log.WithError(err).Debug("Failed to write reset frame of stream.")
+		}
+		s.frameMx.Unlock()
+	}
+	_ = s.yStr.SetDeadline(time.Now()) //nolint:errcheck
+}
+
+// CloseWrite closes the writing side of the dmsg stream, so that the remote reads io.EOF once all written data is read.
+// The stream remains readable until the remote closes its writing side. Close should still be called afterwards.
+func (s *Stream) CloseWrite() error {
+	s.writeMx.Lock()
+	err := s.flushLocked()
+	s.writeMx.Unlock()
+	if err != nil {
+		return err
+	}
 	return s.yStr.Close()
 }
 
@@ -78,6 +205,7 @@ func (s *Stream) writeRequest(rAddr Addr) (req StreamRequest, err error) {
 		SrcAddr:   s.lAddr,
 		DstAddr:   s.rAddr,
 		NoiseMsg:  nsMsg,
+		OOB:       true,
 	}
 	obj := MakeSignedStreamRequest(&req, s.ses.localSK())
 
@@ -104,6 +232,7 @@ func (s *Stream) readRequest() (req StreamRequest, err error) {
 
 	// Prepare fields.
 	s.prepareFields(false, req.DstAddr, req.SrcAddr)
+	s.oob = req.OOB
 
 	if err = s.ns.ProcessHandshakeMessage(req.NoiseMsg); err != nil {
 		return
@@ -113,33 +242,67 @@ func (s *Stream) readRequest() (req StreamRequest, err error) {
 
 func (s *Stream) writeResponse(reqHash cipher.SHA256) error {
 	// Obtain associated local listener.
-	pVal, ok := s.ses.porter.PortValue(s.lAddr.Port)
-	if !ok {
-		return ErrReqNoListener
-	}
-	lis, ok := pVal.(*Listener)
-	if !ok {
-		return ErrReqNoListener
+	// If there is none, the rejection is written so that the dialer can distinguish it from the remote being offline.
+	// Streams on ports claimed via ClaimPorts are passed to the claim's handler instead.
+	var (
+		interceptors *interceptorChain
+		introduce    func(*Stream) error
+	)
+	pVal, _ := s.ses.porter.PortValue(s.lAddr.Port)
+	switch v := pVal.(type) {
+	case *Listener:
+		interceptors, introduce = v.interceptors, v.introduceStream
+	case *PortClaim:
+		interceptors, introduce = v.interceptors, v.introduceStream
+	default:
+		return s.writeRejection(reqHash, ErrPortNotListening)
 	}
 
-	// Prepare and write response.
-	nsMsg, err := s.ns.MakeHandshakeMessage()
-	if err != nil {
-		return err
-	}
-	resp := StreamResponse{
-		ReqHash:  reqHash,
-		Accepted: true,
-		NoiseMsg: nsMsg,
+	// Pass stream through the listener's interceptors before accepting.
+	// If an interceptor rejects the stream, the rejection is written with the interceptor's error as the reason.
+	intercepted := true
+	err := interceptors.handle(s, func(s *Stream) error {
+		intercepted = false
+
+		// Prepare and write response.
+		nsMsg, err := s.ns.MakeHandshakeMessage()
+		if err != nil {
+			return err
+		}
+		resp := StreamResponse{
+			ReqHash:  reqHash,
+			Accepted: true,
+			NoiseMsg: nsMsg,
+			OOB:      s.oob,
+		}
+		obj := MakeSignedStreamResponse(&resp, s.ses.localSK())
+
+		if err := s.ses.writeObject(s.yStr, obj); err != nil {
+			return err
+		}
+		s.finishHandshake()
+
+		// Push stream to listener.
+		s.track()
+		return introduce(s)
+	})
+	if err != nil && intercepted {
+		reason, ok := err.(Error)
+		if !ok {
+			reason = ErrReqRejected.Wrap(err)
+		}
+		return s.writeRejection(reqHash, reason)
 	}
-	obj := MakeSignedStreamResponse(&resp, s.ses.localSK())
+	return err
+}
 
-	if err := s.ses.writeObject(s.yStr, obj); err != nil {
-		return err
+// writeRejection writes a rejection of the request of the given hash, and returns the reason.
+func (s *Stream) writeRejection(reqHash cipher.SHA256, reason Error) error {
+	resp := StreamResponse{ReqHash: reqHash, Accepted: false, ErrCode: reason.Code(), Reason: rejectionReason(reason)}
+	if err := s.ses.writeObject(s.yStr, MakeSignedStreamResponse(&resp, s.ses.localSK())); err != nil {
+		s.log.WithError(err).Debug("Failed to write stream rejection.")
 	}
-
-	// Push stream to listener.
-	return lis.introduceStream(s)
+	return reason
 }
 
 func (s *Stream) readResponse(req StreamRequest) error {
@@ -151,10 +314,47 @@ func (s *Stream) readResponse(req StreamRequest) error {
 	if err != nil {
 		return err
 	}
+	if err := serverRejection(s.ses.RemotePK(), req, resp); err != nil {
+		return err
+	}
 	if err := resp.Verify(req); err != nil {
 		return err
 	}
-	return s.ns.ProcessHandshakeMessage(resp.NoiseMsg)
+	s.oob = resp.OOB
+	if err := s.ns.ProcessHandshakeMessage(resp.NoiseMsg); err != nil {
+		return err
+	}
+	s.finishHandshake()
+	return nil
+}
+
+func (s *Stream) finishHandshake() {
+	s.hsDuration = time.Since(s.hsStart)
+}
+
+// HandshakeInfo contains the authentication metadata of a dmsg stream.
+type HandshakeInfo struct {
+	RemotePK  cipher.PubKey // public key of the remote client, as authenticated by the noise handshake
+	ServerPK  cipher.PubKey // public key of the dmsg server which the stream is established via
+	Initiator bool          // whether the local client dialed the stream
+	OOB       bool          // whether out-of-band messages are supported (see SendOOB)
+	Rekeying  bool          // whether the encryption keys of the stream are rotated
+	Started   time.Time     // when the handshake started
+	Duration  time.Duration // duration of the handshake (0 if the handshake is not finished, such as within interceptors)
+}
+
+// HandshakeInfo returns the authentication metadata of the stream, so that services can make authorization decisions
+// and log the provenance of streams.
+func (s *Stream) HandshakeInfo() HandshakeInfo {
+	return HandshakeInfo{
+		RemotePK:  s.ns.RemoteStatic(),
+		ServerPK:  s.ses.RemotePK(),
+		Initiator: s.ns.Initiator(),
+		OOB:       s.oob,
+		Rekeying:  s.ns.Rekeying(),
+		Started:   s.hsStart,
+		Duration:  s.hsDuration,
+	}
 }
 
 func (s *Stream) prepareFields(init bool, lAddr, rAddr Addr) {
@@ -163,16 +363,19 @@ func (s *Stream) prepareFields(init bool, lAddr, rAddr Addr) {
 		LocalSK:   s.ses.localSK(),
 		RemotePK:  rAddr.PK,
 		Initiator: init,
+		Rekey:     s.ses.entity.sessionRekey,
 	})
 	if err != nil {
-		s.log.WithError(err).Panic("Failed to prepare stream noise object.")
+		s.ses.log.WithError(err).Panic("Failed to prepare stream noise object.")
 	}
 
 	s.lAddr = lAddr
 	s.rAddr = rAddr
 	s.ns = ns
 	s.nsConn = noise.NewReadWriter(s.yStr, s.ns)
-	s.log = s.ses.log.WithField("stream", s.lAddr.ShortString()+"->"+s.rAddr.ShortString())
+	s.log = s.ses.entity.subLog(LogStream).
+		WithField("session", s.ses.RemotePK()).
+		WithField("stream", s.lAddr.ShortString()+"->"+s.rAddr.ShortString())
 }
 
 // LocalAddr returns the local address of the dmsg stream.
@@ -201,13 +404,181 @@ func (s *Stream) StreamID() uint32 {
 }
 
 // Read implements io.Reader
+// Out-of-band messages which are read from the stream are passed to the handler set with SetOOBHandler.
+// Once reading fails for reasons other than a timeout (such as once the remote closes the stream), the stream is no
+// longer tracked as established, so that (*Client).Shutdown does not wait for it.
 func (s *Stream) Read(b []byte) (int, error) {
-	return s.nsConn.Read(b)
+	n, err := s.read(b)
+	s.countBytes(n, 0)
+	if err != nil && s.untrack != nil {
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			s.untrack()
+		}
+	}
+	return n, err
+}
+
+func (s *Stream) read(b []byte) (int, error) {
+	if !s.oob {
+		return s.nsConn.Read(b)
+	}
+
+	s.readMx.Lock()
+	defer s.readMx.Unlock()
+
+	for s.readBuf.Len() == 0 {
+		if s.readErr != nil {
+			return 0, s.readErr
+		}
+		frame, err := s.nsConn.ReadFrame()
+		if err != nil {
+			return 0, err
+		}
+		if len(frame) == 0 {
+			continue
+		}
+		switch frame[0] {
+		case frameData:
+			s.readBuf.Write(frame[1:])
+		case frameOOB:
+			s.handleOOB(frame[1:])
+		case frameKeepAlive:
+			// Discarded, as keepalives only keep relaying servers from closing the stream.
+		case frameReset:
+			s.readErr = ErrStreamReset
+		default:
+			s.log.WithField("frame_type", frame[0]).Debug("Ignoring frame of unknown type.")
+		}
+	}
+	n, err := s.readBuf.Read(b)
+	atomic.StoreInt32(&s.queued, int32(s.readBuf.Len()))
+	return n, err
 }
 
 // Write implements io.Writer
 func (s *Stream) Write(b []byte) (int, error) {
-	return s.nsConn.Write(b)
+	s.writeMx.Lock()
+	defer s.writeMx.Unlock()
+
+	atomic.StoreInt32(&s.writing, 1)
+	defer atomic.StoreInt32(&s.writing, 0)
+
+	n, err := s.coalesce(b)
+	s.countBytes(0, n)
+	return n, err
+}
+
+func (s *Stream) write(b []byte) (int, error) {
+	if !s.oob {
+		return s.nsConn.Write(b)
+	}
+
+	n := 0
+	for len(b) > 0 {
+		wn := len(b)
+		if wn > maxFramePayload {
+			wn = maxFramePayload
+		}
+		if err := s.writeFrame(frameData, b[:wn]); err != nil {
+			return n, err
+		}
+		n += wn
+		b = b[wn:]
+	}
+	return n, nil
+}
+
+// ChannelBinding returns the hash of the noise handshake between the two clients of the stream, which is identical on
+// both ends. Stream payloads are encrypted end-to-end with keys which are derived from the handshake (and so only from
+// the keys of the two clients). dmsg servers relay the handshake messages but cannot derive the keys, so applications
+// can verify that no server reads the payloads by comparing the channel binding out-of-band (see Fingerprint), or by
+// signing it with application-level credentials.
+func (s *Stream) ChannelBinding() []byte {
+	return s.ns.ChannelBinding()
+}
+
+// Fingerprint returns a short, human-comparable representation of the channel binding (such as
+// "1a2b-3c4d-5e6f-7a8b-9c0d-1e2f-3a4b-5c6d"). Both ends of the stream obtain the same fingerprint.
+func (s *Stream) Fingerprint() string {
+	h := cipher.SumSHA256(s.ChannelBinding())
+	groups := make([]string, 0, fingerprintSize/2)
+	for i := 0; i < fingerprintSize; i += 2 {
+		groups = append(groups, hex.EncodeToString(h[i:i+2]))
+	}
+	return strings.Join(groups, "-")
+}
+
+// SendOOB sends an out-of-band message (of up to MaxOOBSize bytes) to the remote, such as a window resize or a cancel
+// signal. The message is written ahead of pending writes (it is only written after the current payload frame).
+// The remote passes the message to its OOB handler as it reads the stream (see SetOOBHandler).
+// ErrOOBUnsupported is returned if the remote does not support out-of-band messages.
+func (s *Stream) SendOOB(msg []byte) error {
+	if !s.oob {
+		return ErrOOBUnsupported
+	}
+	if len(msg) > MaxOOBSize {
+		return ErrOOBTooLarge
+	}
+	return s.writeFrame(frameOOB, msg)
+}
+
+// SetOOBHandler sets the function which out-of-band messages are passed to. It is called from within Read, so it
+// should not block. Out-of-band messages which are read when no handler is set are discarded.
+func (s *Stream) SetOOBHandler(fn func(msg []byte)) {
+	s.oobMx.Lock()
+	s.oobFn = fn
+	s.oobMx.Unlock()
+}
+
+// SupportsOOB returns true if out-of-band messages can be sent on the stream.
+func (s *Stream) SupportsOOB() bool {
+	return s.oob
+}
+
+func (s *Stream) handleOOB(msg []byte) {
+	s.oobMx.Lock()
+	fn := s.oobFn
+	s.oobMx.Unlock()
+
+	if fn == nil {
+		s.log.Debug("Discarding out-of-band message as there is no handler.")
+		return
+	}
+	fn(msg)
+}
+
+// keepAlive writes a keepalive frame whenever nothing is written to the stream within the interval, so that quiet
+// streams are not closed by the idle timeouts of dmsg servers. Keepalive frames are discarded by the remote.
+// It returns once writing fails (such as once the stream is closed).
+func (s *Stream) keepAlive(interval time.Duration) {
+	clock := s.ses.entity.clock
+	last := atomic.LoadUint64(&s.bytesWritten)
+	for {
+		<-clock.After(interval)
+		if n := atomic.LoadUint64(&s.bytesWritten); n != last {
+			last = n
+			continue
+		}
+		var err error
+		if s.oob {
+			err = s.writeFrame(frameKeepAlive, nil)
+		} else {
+			err = s.nsConn.WriteEmptyFrame()
+		}
+		if err != nil {
+			s.log.WithError(err).Debug("Stopped keepalives of stream.")
+			return
+		}
+	}
+}
+
+// writeFrame writes a single frame of the given type.
+func (s *Stream) writeFrame(t byte, p []byte) error {
+	s.frameMx.Lock()
+	defer s.frameMx.Unlock()
+
+	_, err := s.nsConn.Write(append([]byte{t}, p...))
+	return err
 }
 
 // SetDeadline implements net.Conn
@@ -0,0 +1,75 @@
+package dmsg
+
+import "time"
+
+// SetNoDelay sets whether small writes to the stream are written immediately (which is the default), or are coalesced
+// for up to Config.StreamCoalesceDelay so that chatty protocols write fewer (and larger) frames.
+// Setting 'noDelay' to true flushes pending writes, and returns the error of writing them.
+func (s *Stream) SetNoDelay(noDelay bool) error {
+	s.writeMx.Lock()
+	defer s.writeMx.Unlock()
+
+	s.delayWrites = !noDelay
+	if noDelay {
+		return s.flushLocked()
+	}
+	return nil
+}
+
+// coalesce writes 'b' to the stream, or adds it to the pending writes if writes are delayed.
+// Pending writes are flushed once they fill a frame, or once the coalesce delay passes since the first of them.
+// Errors of flushing in the background are returned by the next write.
+// It must be called with writeMx held.
+func (s *Stream) coalesce(b []byte) (int, error) {
+	if s.flushErr != nil {
+		return 0, s.flushErr
+	}
+	if !s.delayWrites {
+		return s.write(b)
+	}
+
+	if len(s.pending)+len(b) > maxFramePayload {
+		if err := s.flushLocked(); err != nil {
+			return 0, err
+		}
+		if len(b) >= maxFramePayload {
+			return s.write(b)
+		}
+	}
+	if len(s.pending) == 0 {
+		s.flushTimer = time.AfterFunc(s.ses.conf.StreamCoalesceDelay, s.flushPending)
+	}
+	s.pending = append(s.pending, b...)
+	if len(s.pending) == maxFramePayload {
+		if err := s.flushLocked(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// flushPending is called once the coalesce delay passes.
+func (s *Stream) flushPending() {
+	s.writeMx.Lock()
+	defer s.writeMx.Unlock()
+
+	if err := s.flushLocked(); err != nil {
+		s.log.WithError(err).Debug("Failed to flush pending writes of stream.")
+	}
+}
+
+// flushLocked writes the pending writes of the stream.
+// It must be called with writeMx held.
+func (s *Stream) flushLocked() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	s.flushTimer.Stop()
+
+	_, err := s.write(s.pending)
+	s.pending = s.pending[:0]
+	if err != nil && s.flushErr == nil {
+		s.flushErr = err
+	}
+	return err
+}
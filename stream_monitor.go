@@ -0,0 +1,114 @@
+package dmsg
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/SkycoinProject/yamux"
+	"github.com/sirupsen/logrus"
+)
+
+// StreamMetrics records the send queues of streams served by a dmsg server.
+// Data of a stream is queued by the server while writing it to the receiving client blocks (such as when the receiver
+// reads slowly).
+type StreamMetrics interface {
+	// AddQueuedBytes is called with the change of the number of bytes queued across all streams.
+	AddQueuedBytes(delta int)
+
+	// AddStalledStreams is called with the change of the number of stalled streams (see StreamStallThreshold of
+	// ServerConfig).
+	AddStalledStreams(delta int)
+
+	// ObserveQueueDelay is called with how long queued data took to be written to the receiving client.
+	ObserveQueueDelay(d time.Duration)
+}
+
+// monitoredStream records the send queue of a served stream (see StreamMetrics), and logs a warning with the stream
+// IDs when a write stalls for longer than the stall threshold.
+type monitoredStream struct {
+	halfCloseStream
+	metrics   StreamMetrics      // may be nil
+	threshold time.Duration      // 0 disables stall detection
+	relayed   *uint64            // counts the bytes to be relayed in either direction (may be nil)
+	log       logrus.FieldLogger // contains the stream IDs
+}
+
+// monitorStream wraps the stream if the server records stream metrics or detects stalls.
+// The stream is written to by the server when forwarding data to the receiving client.
+// If 'relayed' is non-nil, it counts the bytes written to the stream.
+func (s *Server) monitorStream(str halfCloseStream, relayed *uint64, log logrus.FieldLogger) io.ReadWriteCloser {
+	if s == nil || (s.conf.StreamMetrics == nil && s.conf.StreamStallThreshold <= 0 && relayed == nil) {
+		return str
+	}
+	return monitoredStream{
+		halfCloseStream: str,
+		metrics:         s.conf.StreamMetrics,
+		threshold:       s.conf.StreamStallThreshold,
+		relayed:         relayed,
+		log:             log,
+	}
+}
+
+// reapIdleStream closes the relayed yamux streams once no data is relayed between them for StreamIdleTimeout.
+// The returned counter is to be passed to monitorStream for both streams (it is nil if idle streams are not closed),
+// and 'stop' should be called once the streams are served.
+func (s *Server) reapIdleStream(log logrus.FieldLogger, strs ...*yamux.Stream) (relayed *uint64, stop func()) {
+	if s == nil || s.conf.StreamIdleTimeout <= 0 {
+		return nil, func() {}
+	}
+	relayed = new(uint64)
+	done := make(chan struct{})
+	traffic := func() uint64 { return atomic.LoadUint64(relayed) }
+	go reapIdle(s.clock, s.conf.StreamIdleTimeout, done, traffic, func() {
+		log.Info("Closing idle stream.")
+		// Closing a yamux stream only closes the write side, so deadlines ensure that relaying stops.
+		for _, str := range strs {
+			_ = str.SetDeadline(time.Now()) //nolint:errcheck
+			_ = str.Close()                 //nolint:errcheck
+		}
+	})
+	return relayed, func() { close(done) }
+}
+
+// Write implements io.Writer
+func (s monitoredStream) Write(b []byte) (int, error) {
+	if s.relayed != nil {
+		atomic.AddUint64(s.relayed, uint64(len(b)))
+	}
+	if s.metrics != nil {
+		s.metrics.AddQueuedBytes(len(b))
+	}
+
+	// The state is 0 while writing, 1 once stalled, and 2 once done (so that a late stall callback does nothing).
+	var state int32
+	if s.threshold > 0 {
+		timer := time.AfterFunc(s.threshold, func() {
+			if !atomic.CompareAndSwapInt32(&state, 0, 1) {
+				return
+			}
+			if s.metrics != nil {
+				s.metrics.AddStalledStreams(1)
+			}
+			s.log.WithField("queued_bytes", len(b)).WithField("threshold", s.threshold).
+				Warn("Stream stalled: the receiving client is not reading.")
+		})
+		defer timer.Stop()
+	}
+
+	start := time.Now()
+	n, err := s.halfCloseStream.Write(b)
+	delay := time.Since(start)
+
+	if atomic.SwapInt32(&state, 2) == 1 {
+		if s.metrics != nil {
+			s.metrics.AddStalledStreams(-1)
+		}
+		s.log.WithError(err).WithField("stalled_for", delay).Info("Stream resumed after stall.")
+	}
+	if s.metrics != nil {
+		s.metrics.AddQueuedBytes(-len(b))
+		s.metrics.ObserveQueueDelay(delay)
+	}
+	return n, err
+}
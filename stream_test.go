@@ -2,8 +2,10 @@ package dmsg
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"sync"
 	"testing"
@@ -193,6 +195,335 @@ func TestStream(t *testing.T) {
 		require.NoError(t, lis.Close())
 	})
 
+	t.Run("test_oob", func(t *testing.T) {
+		const port = 8084
+		lis, makePipe := makePiper(clientA, clientB, port)
+		connA, connB, stop, err := makePipe()
+		require.NoError(t, err)
+
+		strA, strB := connA.(*Stream), connB.(*Stream)
+		require.True(t, strA.SupportsOOB())
+		require.True(t, strB.SupportsOOB())
+
+		oobCh := make(chan []byte, 1)
+		strB.SetOOBHandler(func(msg []byte) { oobCh <- msg })
+
+		_, err = strA.Write([]byte("payload"))
+		require.NoError(t, err)
+		require.NoError(t, strA.SendOOB([]byte("oob")))
+		require.Equal(t, ErrOOBTooLarge, strA.SendOOB(make([]byte, MaxOOBSize+1)))
+		_, err = strA.Write([]byte("more"))
+		require.NoError(t, err)
+
+		// Out-of-band messages are not part of the read payload.
+		readB := make([]byte, len("payloadmore"))
+		_, err = io.ReadFull(strB, readB)
+		require.NoError(t, err)
+		require.Equal(t, "payloadmore", string(readB))
+		require.Equal(t, "oob", string(<-oobCh))
+
+		// Closing logic.
+		stop()
+		require.NoError(t, lis.Close())
+	})
+
+	t.Run("test_no_delay", func(t *testing.T) {
+		const port = 8087
+		lis, makePipe := makePiper(clientA, clientB, port)
+		connA, connB, stop, err := makePipe()
+		require.NoError(t, err)
+
+		strA := connA.(*Stream)
+		require.NoError(t, strA.SetNoDelay(false))
+
+		// Coalesced writes are flushed once the delay passes.
+		for _, p := range []string{"a", "b", "c"} {
+			_, err = strA.Write([]byte(p))
+			require.NoError(t, err)
+		}
+		readB := make([]byte, 3)
+		_, err = io.ReadFull(connB, readB)
+		require.NoError(t, err)
+		require.Equal(t, "abc", string(readB))
+
+		// Pending writes are flushed when writes are no longer delayed.
+		strA.writeMx.Lock()
+		_, err = strA.coalesce([]byte("de"))
+		pending := len(strA.pending)
+		strA.writeMx.Unlock()
+		require.NoError(t, err)
+		require.Equal(t, 2, pending)
+		require.NoError(t, strA.SetNoDelay(true))
+		readB = make([]byte, 2)
+		_, err = io.ReadFull(connB, readB)
+		require.NoError(t, err)
+		require.Equal(t, "de", string(readB))
+
+		// Closing logic.
+		stop()
+		require.NoError(t, lis.Close())
+	})
+
+	t.Run("test_linger", func(t *testing.T) {
+		const port = 8088
+		lis, makePipe := makePiper(clientA, clientB, port)
+		defer func() { require.NoError(t, lis.Close()) }()
+
+		// By default, Close does not wait, and the remote reads written data followed by io.EOF.
+		connA, connB, _, err := makePipe()
+		require.NoError(t, err)
+		_, err = connA.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, connA.Close())
+		readB, err := ioutil.ReadAll(connB)
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(readB))
+		require.NoError(t, connB.Close())
+
+		// With a positive linger, Close waits for pending writes to complete.
+		connA, connB, _, err = makePipe()
+		require.NoError(t, err)
+		largeData := cipher.RandByte(1024 * 1024)
+		writeErr := make(chan error, 1)
+		go func() {
+			_, err := connA.Write(largeData)
+			writeErr <- err
+		}()
+		time.Sleep(100 * time.Millisecond) // the write blocks until the remote reads
+		connA.(*Stream).SetLinger(time.Minute)
+		closeErr := make(chan error, 1)
+		go func() { closeErr <- connA.Close() }()
+		readB, err = ioutil.ReadAll(connB)
+		require.NoError(t, err)
+		require.Equal(t, largeData, readB)
+		require.NoError(t, <-writeErr)
+		require.NoError(t, <-closeErr)
+		require.NoError(t, connB.Close())
+
+		// Once the linger passes, pending writes are discarded and the stream is reset.
+		connA, connB, _, err = makePipe()
+		require.NoError(t, err)
+		go func() {
+			_, err := connA.Write(largeData)
+			writeErr <- err
+		}()
+		time.Sleep(100 * time.Millisecond)
+		connA.(*Stream).SetLinger(50 * time.Millisecond)
+		require.NoError(t, connA.Close())
+		require.Error(t, <-writeErr)
+		_, err = io.Copy(ioutil.Discard, connB)
+		require.Error(t, err)
+		require.NoError(t, connB.Close())
+
+		// With a negative linger, Close resets the stream straight away.
+		connA, connB, _, err = makePipe()
+		require.NoError(t, err)
+		_, err = connA.Write([]byte("hello"))
+		require.NoError(t, err)
+		connA.(*Stream).SetLinger(-1)
+		require.NoError(t, connA.Close())
+		readB, err = ioutil.ReadAll(connB)
+		require.Equal(t, ErrStreamReset, err)
+		require.Equal(t, "hello", string(readB))
+		require.NoError(t, connB.Close())
+	})
+
+	t.Run("test_fingerprint", func(t *testing.T) {
+		const port = 8085
+		lis, makePipe := makePiper(clientA, clientB, port)
+		connA, connB, stop, err := makePipe()
+		require.NoError(t, err)
+
+		strA, strB := connA.(*Stream), connB.(*Stream)
+		require.Equal(t, strA.ChannelBinding(), strB.ChannelBinding())
+		require.Equal(t, strA.Fingerprint(), strB.Fingerprint())
+		require.Len(t, strA.Fingerprint(), fingerprintSize/2*5-1)
+
+		// Each stream has a distinct channel binding.
+		connA2, _, stop2, err := makePipe()
+		require.NoError(t, err)
+		require.NotEqual(t, strA.Fingerprint(), connA2.(*Stream).Fingerprint())
+
+		// Closing logic.
+		stop()
+		stop2()
+		require.NoError(t, lis.Close())
+	})
+
+	t.Run("test_handshake_info", func(t *testing.T) {
+		const port = 8086
+		lis, makePipe := makePiper(clientA, clientB, port)
+		connA, connB, stop, err := makePipe()
+		require.NoError(t, err)
+
+		infoA, infoB := connA.(*Stream).HandshakeInfo(), connB.(*Stream).HandshakeInfo()
+		require.Equal(t, clientB.LocalPK(), infoA.RemotePK)
+		require.Equal(t, clientA.LocalPK(), infoB.RemotePK)
+		require.True(t, infoA.Initiator)
+		require.False(t, infoB.Initiator)
+		require.True(t, infoA.OOB && infoB.OOB)
+		require.False(t, infoA.Rekeying || infoB.Rekeying) // not configured
+		require.True(t, infoA.Duration > 0)
+		require.True(t, infoB.Duration > 0)
+		require.False(t, infoA.ServerPK.Null())
+
+		// Closing logic.
+		stop()
+		require.NoError(t, lis.Close())
+	})
+
+	t.Run("test_port_not_listening", func(t *testing.T) {
+		_, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: 9999})
+		dErr, ok := err.(*DialError)
+		require.True(t, ok, err)
+		require.Equal(t, ErrPortNotListening, dErr.Err)
+		require.Equal(t, DialPhaseRemoteRefused, dErr.Phase)
+	})
+
+	t.Run("test_rejected_by_interceptor", func(t *testing.T) {
+		const port = 9998
+		lis, err := clientB.Listen(port)
+		require.NoError(t, err)
+		clientB.AddStreamInterceptor(func(dStr *Stream, next StreamHandler) error {
+			if dStr.LocalAddr().(Addr).Port == port {
+				return errors.New("remote is banned")
+			}
+			return next(dStr)
+		})
+
+		_, err = clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+		dErr, ok := err.(*DialError)
+		require.True(t, ok, err)
+		require.True(t, errors.Is(err, ErrReqRejected), err)
+		require.Equal(t, DialPhaseRemoteRefused, dErr.Phase)
+
+		var rej *Rejection
+		require.True(t, errors.As(err, &rej))
+		require.Equal(t, "remote is banned", rej.Reason)
+		require.NoError(t, lis.Close())
+	})
+
+	t.Run("test_interceptor_chain", func(t *testing.T) {
+		const port, hiddenPort = 9997, 9996
+		lis, err := clientB.Listen(port)
+		require.NoError(t, err)
+		hiddenLis, err := clientB.Listen(hiddenPort)
+		require.NoError(t, err)
+
+		// Interceptors added after Listen also apply, and are called in the order they are added.
+		var mx sync.Mutex
+		var calls []string
+		record := func(name string) StreamInterceptor {
+			return func(dStr *Stream, next StreamHandler) error {
+				if dStr.LocalAddr().(Addr).Port != port {
+					return next(dStr)
+				}
+				mx.Lock()
+				calls = append(calls, name)
+				mx.Unlock()
+				return next(dStr)
+			}
+		}
+		clientB.AddStreamInterceptor(record("first"))
+		clientB.AddStreamInterceptor(record("second"))
+		clientB.AddStreamInterceptor(func(dStr *Stream, next StreamHandler) error {
+			if dStr.LocalAddr().(Addr).Port == hiddenPort {
+				return ErrPortNotListening
+			}
+			return next(dStr)
+		})
+
+		dStr, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: port})
+		require.NoError(t, err)
+		rStr, err := lis.AcceptStream()
+		require.NoError(t, err)
+		require.Equal(t, dStr.LocalAddr(), rStr.RemoteAddr())
+		mx.Lock()
+		require.Equal(t, []string{"first", "second"}, calls)
+		mx.Unlock()
+		require.NoError(t, dStr.Close())
+		require.NoError(t, rStr.Close())
+
+		// Dmsg errors are sent to the dialer as is.
+		_, err = clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: hiddenPort})
+		dErr, ok := err.(*DialError)
+		require.True(t, ok, err)
+		require.True(t, errors.Is(err, ErrPortNotListening), err)
+		require.False(t, errors.Is(err, ErrReqRejected), err)
+		require.Equal(t, DialPhaseRemoteRefused, dErr.Phase)
+
+		require.NoError(t, lis.Close())
+		require.NoError(t, hiddenLis.Close())
+	})
+
+	t.Run("test_port_claim", func(t *testing.T) {
+		accepted := make(chan *Stream, 1)
+		pc, err := clientB.ClaimPorts(func(dStr *Stream) error {
+			accepted <- dStr
+			return nil
+		}, 9001, 9002)
+		require.NoError(t, err)
+		require.Equal(t, []uint16{9001, 9002}, pc.Ports())
+
+		// Claims are atomic: no ports are claimed if any is occupied.
+		_, err = clientB.ClaimPorts(nil, 9003, 9002)
+		require.Equal(t, ErrPortOccupied, err)
+		lis, err := clientB.Listen(9003)
+		require.NoError(t, err)
+		require.NoError(t, lis.Close())
+
+		dStr, err := clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: 9002})
+		require.NoError(t, err)
+		rStr := <-accepted
+		require.Equal(t, dStr.LocalAddr(), rStr.RemoteAddr())
+		require.NoError(t, dStr.Close())
+		require.NoError(t, rStr.Close())
+
+		// Released ports are not listening.
+		require.NoError(t, pc.Release())
+		require.Equal(t, ErrEntityClosed, pc.Release())
+		_, err = clientA.DialStream(context.TODO(), Addr{PK: clientB.LocalPK(), Port: 9001})
+		require.True(t, errors.Is(err, ErrPortNotListening), err)
+	})
+
+	t.Run("test_preconnect", func(t *testing.T) {
+		require.NoError(t, clientA.EnsureSession(context.TODO(), pkSrv))
+		require.NoError(t, clientA.Preconnect(context.TODO(), pkB))
+
+		pkC, _ := GenKeyPair(t, "client C")
+		err := clientA.Preconnect(context.TODO(), pkC)
+		dErr, ok := err.(*DialError)
+		require.True(t, ok, err)
+		require.Equal(t, DialPhaseDiscovery, dErr.Phase)
+	})
+
+	t.Run("test_server_stats", func(t *testing.T) {
+		const port = 8089
+		before := srv.Stats()
+		require.Equal(t, 2, before.Sessions)
+		require.ElementsMatch(t, []cipher.PubKey{pkA, pkB}, before.ClientPKs)
+
+		lis, makePipe := makePiper(clientA, clientB, port)
+		connA, connB, stop, err := makePipe()
+		require.NoError(t, err)
+		require.True(t, srv.Stats().Streams >= 1)
+
+		// Relayed data is counted in both directions.
+		data := cipher.RandByte(1024)
+		_, err = connA.Write(data)
+		require.NoError(t, err)
+		_, err = io.ReadFull(connB, make([]byte, len(data)))
+		require.NoError(t, err)
+		after := srv.Stats()
+		require.True(t, after.BytesIn >= before.BytesIn+uint64(len(data)))
+		require.True(t, after.BytesOut >= before.BytesOut+uint64(len(data)))
+		require.Equal(t, before.Started, after.Started)
+
+		// Closing logic.
+		stop()
+		require.NoError(t, lis.Close())
+	})
+
 	// Closing logic.
 	require.NoError(t, clientB.Close())
 	require.NoError(t, clientA.Close())
@@ -200,6 +531,89 @@ func TestStream(t *testing.T) {
 	require.NoError(t, <-chSrv)
 }
 
+func TestStream_Rekey(t *testing.T) {
+	const rekeyBytes = 2048
+	dc := disc.NewMock()
+
+	srvPK, srvSK := cipher.GenerateKeyPair()
+	srv := NewServer(srvPK, srvSK, dc)
+	srvLis, err := nettest.NewLocalListener("tcp")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(srvLis, "") }() //nolint:errcheck
+	<-srv.Ready()
+	defer func() { require.NoError(t, srv.Close()) }()
+
+	// newClient returns a served client which listens on port 1.
+	newClient := func(rekey noise.RekeyConfig) (*Client, *Listener) {
+		pk, sk := cipher.GenerateKeyPair()
+		conf := DefaultConfig()
+		conf.SessionRekey = rekey
+		c := NewClient(pk, sk, dc, conf)
+		go c.Serve()
+		<-c.Ready()
+		lis, err := c.Listen(1)
+		require.NoError(t, err)
+		return c, lis
+	}
+	clientA, lisA := newClient(noise.RekeyConfig{Bytes: rekeyBytes})
+	clientB, lisB := newClient(noise.RekeyConfig{Bytes: rekeyBytes})
+	clientC, lisC := newClient(noise.RekeyConfig{})
+	defer func() {
+		for _, lis := range []*Listener{lisA, lisB, lisC} {
+			require.NoError(t, lis.Close())
+		}
+		for _, c := range []*Client{clientA, clientB, clientC} {
+			require.NoError(t, c.Close())
+		}
+	}()
+
+	// transfer writes 10 payloads of 1000 bytes from client A to the listener, and returns both ends of the stream.
+	transfer := func(lis *Listener) (*Stream, *Stream) {
+		dStr, err := clientA.DialStream(context.TODO(), lis.DmsgAddr())
+		require.NoError(t, err)
+		rStr, err := lis.AcceptStream()
+		require.NoError(t, err)
+
+		payload := cipher.RandByte(1000)
+		for i := 0; i < 10; i++ {
+			_, err := dStr.Write(payload)
+			require.NoError(t, err)
+			read := make([]byte, len(payload))
+			_, err = io.ReadFull(rStr, read)
+			require.NoError(t, err)
+			require.Equal(t, payload, read)
+		}
+		return dStr, rStr
+	}
+
+	t.Run("rotated_after_bytes", func(t *testing.T) {
+		dStr, rStr := transfer(lisB)
+		defer func() {
+			require.NoError(t, dStr.Close())
+			require.NoError(t, rStr.Close())
+		}()
+		require.True(t, dStr.HandshakeInfo().Rekeying && rStr.HandshakeInfo().Rekeying)
+
+		// Every key encrypts at most two payloads, so the payload key is rotated at least four times.
+		encEpoch, _ := dStr.ns.Epochs()
+		_, decEpoch := rStr.ns.Epochs()
+		require.True(t, encEpoch >= 4, encEpoch)
+		require.Equal(t, encEpoch, decEpoch)
+	})
+
+	t.Run("not_configured_by_remote", func(t *testing.T) {
+		dStr, rStr := transfer(lisC)
+		defer func() {
+			require.NoError(t, dStr.Close())
+			require.NoError(t, rStr.Close())
+		}()
+		require.False(t, dStr.HandshakeInfo().Rekeying || rStr.HandshakeInfo().Rekeying)
+
+		encEpoch, _ := dStr.ns.Epochs()
+		require.Zero(t, encEpoch)
+	})
+}
+
 func GenKeyPair(t *testing.T, seed string) (cipher.PubKey, cipher.SecKey) {
 	pk, sk, err := cipher.GenerateDeterministicKeyPair([]byte(seed))
 	require.NoError(t, err)
@@ -0,0 +1,82 @@
+package dmsg
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Telemetry receives events of a dmsg client, so that embedding applications can feed them to their own metric
+// systems (see Config.Telemetry). Callbacks are called synchronously and concurrently, so they should not block.
+// NopTelemetry can be embedded to only implement some of the callbacks.
+type Telemetry interface {
+	// DialStart is called when a stream is dialed.
+	DialStart(dst Addr)
+
+	// DialEnd is called when dialing a stream ends (err is nil if the stream is established).
+	DialEnd(dst Addr, elapsed time.Duration, err error)
+
+	// StreamOpen is called when a stream is established (dialed or accepted).
+	StreamOpen(local, remote Addr)
+
+	// StreamClose is called when an established stream is closed, with the totals of the stream.
+	StreamClose(local, remote Addr, bytesRead, bytesWritten uint64, age time.Duration)
+
+	// BytesMoved is called with the number of payload bytes of each read from and write to a stream.
+	BytesMoved(read, written int)
+}
+
+// NopTelemetry implements Telemetry with callbacks which do nothing.
+type NopTelemetry struct{}
+
+// DialStart implements Telemetry
+func (NopTelemetry) DialStart(Addr) {}
+
+// DialEnd implements Telemetry
+func (NopTelemetry) DialEnd(Addr, time.Duration, error) {}
+
+// StreamOpen implements Telemetry
+func (NopTelemetry) StreamOpen(Addr, Addr) {}
+
+// StreamClose implements Telemetry
+func (NopTelemetry) StreamClose(Addr, Addr, uint64, uint64, time.Duration) {}
+
+// BytesMoved implements Telemetry
+func (NopTelemetry) BytesMoved(int, int) {}
+
+// track tracks the established stream within the session, and reports it to the telemetry (if any).
+// Keepalives of the stream are started if enabled (see StreamKeepAlive of Config).
+func (s *Stream) track() {
+	s.opened = time.Now()
+	untrack := s.ses.trackStream(s)
+	if s.ses.conf.StreamKeepAlive > 0 {
+		go s.keepAlive(s.ses.conf.StreamKeepAlive)
+	}
+	t := s.ses.conf.Telemetry
+	if t == nil {
+		s.untrack = untrack
+		return
+	}
+
+	opened := s.opened
+	t.StreamOpen(s.lAddr, s.rAddr)
+	once := new(sync.Once)
+	s.untrack = func() {
+		untrack()
+		once.Do(func() {
+			t.StreamClose(s.lAddr, s.rAddr,
+				atomic.LoadUint64(&s.bytesRead), atomic.LoadUint64(&s.bytesWritten), time.Since(opened))
+		})
+	}
+}
+
+func (s *Stream) countBytes(read, written int) {
+	if read == 0 && written == 0 {
+		return
+	}
+	atomic.AddUint64(&s.bytesRead, uint64(read))
+	atomic.AddUint64(&s.bytesWritten, uint64(written))
+	if t := s.ses.conf.Telemetry; t != nil {
+		t.BytesMoved(read, written)
+	}
+}
@@ -0,0 +1,45 @@
+package dmsg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/SkycoinProject/dmsg/cipher"
+)
+
+type testTelemetry struct {
+	NopTelemetry
+	open, closed  int
+	read, written uint64
+}
+
+func (t *testTelemetry) StreamOpen(Addr, Addr) { t.open++ }
+
+func (t *testTelemetry) StreamClose(_, _ Addr, read, written uint64, _ time.Duration) {
+	t.closed++
+	t.read, t.written = read, written
+}
+
+func TestStream_track(t *testing.T) {
+	tel := new(testTelemetry)
+	ses := &ClientSession{SessionCommon: new(SessionCommon), conf: &Config{Telemetry: tel}}
+	pk, _ := cipher.GenerateKeyPair()
+	s := &Stream{ses: ses, lAddr: Addr{PK: pk, Port: 1}, rAddr: Addr{PK: pk, Port: 2}}
+
+	s.track()
+	require.Equal(t, 1, tel.open)
+	require.Equal(t, 1, ses.StreamCount())
+
+	s.countBytes(3, 0)
+	s.countBytes(0, 5)
+
+	// The stream is only reported as closed once.
+	s.untrack()
+	s.untrack()
+	require.Equal(t, 1, tel.closed)
+	require.Equal(t, uint64(3), tel.read)
+	require.Equal(t, uint64(5), tel.written)
+	require.Equal(t, 0, ses.StreamCount())
+}
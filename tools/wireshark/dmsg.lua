@@ -0,0 +1,192 @@
+-- Wireshark dissector for dmsg sessions over TCP.
+--
+-- A session starts with the noise handshake (XK pattern): two messages from the client and one from the server, each
+-- prefixed with its uint16 length. The multiplexer frames which follow have plaintext headers (version, type, flags,
+-- stream ID and length), and the payloads of data frames are encrypted.
+--
+-- Install by copying this file to the Wireshark plugins directory (see "About Wireshark > Folders").
+-- Connections are labelled with the public keys of clients if the "Frame trace file" preference is set to the frame
+-- trace file of the dmsg server (see the 'frame_trace_file' config of dmsg-server).
+
+local dmsg = Proto("dmsg", "dmsg Session Protocol")
+
+local frame_types = { [0] = "Data", [1] = "Window Update", [2] = "Ping", [3] = "Go Away" }
+local header_size = 12
+
+local f = dmsg.fields
+f.hs_len = ProtoField.uint16("dmsg.handshake.length", "Handshake Message Length")
+f.hs_msg = ProtoField.bytes("dmsg.handshake.message", "Handshake Message")
+f.version = ProtoField.uint8("dmsg.version", "Version")
+f.type = ProtoField.uint8("dmsg.type", "Type", base.DEC, frame_types)
+f.flags = ProtoField.uint16("dmsg.flags", "Flags", base.HEX)
+f.flag_syn = ProtoField.bool("dmsg.flags.syn", "SYN", 16, nil, 0x1)
+f.flag_ack = ProtoField.bool("dmsg.flags.ack", "ACK", 16, nil, 0x2)
+f.flag_fin = ProtoField.bool("dmsg.flags.fin", "FIN", 16, nil, 0x4)
+f.flag_rst = ProtoField.bool("dmsg.flags.rst", "RST", 16, nil, 0x8)
+f.stream_id = ProtoField.uint32("dmsg.stream_id", "Stream ID")
+f.length = ProtoField.uint32("dmsg.length", "Length")
+f.payload = ProtoField.bytes("dmsg.payload", "Encrypted Payload")
+f.session = ProtoField.string("dmsg.session", "Client Public Key")
+
+dmsg.prefs.ports = Pref.range("Server ports", "8080,8081", "TCP ports of dmsg servers", 65535)
+dmsg.prefs.trace = Pref.string("Frame trace file", "", "Frame trace file (JSONL) of the dmsg server")
+
+local registered_ports = nil
+local sessions = nil -- client public keys, by "<addr>|<addr>" of the connection
+local hs_left = {}   -- remaining handshake messages, by direction of a connection
+local hs_at = {}     -- remaining handshake messages at the start of a packet, by packet number
+
+-- addr formats an address as Go does, so that it matches the addresses of the frame trace file.
+local function addr(ip, port)
+	local s = tostring(ip)
+	if s:find(":", 1, true) then
+		return "[" .. s .. "]:" .. port
+	end
+	return s .. ":" .. port
+end
+
+-- is_server_port returns true if the port is within the "Server ports" preference (such as "8080,8081-8083").
+local function is_server_port(port)
+	for part in dmsg.prefs.ports:gmatch("[^,]+") do
+		local lo, hi = part:match("^%s*(%d+)%s*-%s*(%d+)%s*$")
+		if not lo then
+			lo = part:match("^%s*(%d+)%s*$")
+			hi = lo
+		end
+		if lo and port >= tonumber(lo) and port <= tonumber(hi) then
+			return true
+		end
+	end
+	return false
+end
+
+local function load_sessions()
+	sessions = {}
+	if dmsg.prefs.trace == "" then
+		return
+	end
+	local fh = io.open(dmsg.prefs.trace, "r")
+	if not fh then
+		return
+	end
+	for line in fh:lines() do
+		if line:find('"type":"session"', 1, true) then
+			local pk = line:match('"session":"(%x+)"')
+			local l = line:match('"local_addr":"([^"]+)"')
+			local r = line:match('"remote_addr":"([^"]+)"')
+			if pk and l and r then
+				sessions[l .. "|" .. r] = pk
+				sessions[r .. "|" .. l] = pk
+			end
+		end
+	end
+	fh:close()
+end
+
+function dmsg.prefs_changed()
+	local tcp = DissectorTable.get("tcp.port")
+	if registered_ports then
+		tcp:remove(registered_ports, dmsg)
+	end
+	registered_ports = dmsg.prefs.ports
+	tcp:add(registered_ports, dmsg)
+	sessions = nil
+end
+
+function dmsg.init()
+	hs_left = {}
+	hs_at = {}
+	sessions = nil
+end
+
+local function dissect_frame(tvb, offset, size, tree)
+	local typ = tvb(offset + 1, 1):uint()
+	local sid = tvb(offset + 4, 4):uint()
+	local t = tree:add(dmsg, tvb(offset, size),
+		string.format("%s, Stream %d", frame_types[typ] or "Unknown", sid))
+	t:add(f.version, tvb(offset, 1))
+	t:add(f.type, tvb(offset + 1, 1))
+	local flags = t:add(f.flags, tvb(offset + 2, 2))
+	flags:add(f.flag_syn, tvb(offset + 2, 2))
+	flags:add(f.flag_ack, tvb(offset + 2, 2))
+	flags:add(f.flag_fin, tvb(offset + 2, 2))
+	flags:add(f.flag_rst, tvb(offset + 2, 2))
+	t:add(f.stream_id, tvb(offset + 4, 4))
+	t:add(f.length, tvb(offset + 8, 4))
+	if size > header_size then
+		t:add(f.payload, tvb(offset + header_size, size - header_size))
+	end
+end
+
+function dmsg.dissector(tvb, pinfo, tree)
+	if sessions == nil then
+		load_sessions()
+	end
+
+	local src, dst = addr(pinfo.src, pinfo.src_port), addr(pinfo.dst, pinfo.dst_port)
+	local dir = src .. ">" .. dst
+	local left = hs_at[pinfo.number]
+	if left == nil then
+		left = hs_left[dir]
+		if left == nil then
+			-- The client sends two handshake messages, and the server sends one.
+			left = is_server_port(pinfo.dst_port) and 2 or 1
+		end
+		hs_at[pinfo.number] = left
+	end
+
+	pinfo.cols.protocol = "DMSG"
+	local subtree = tree:add(dmsg, tvb(), "dmsg")
+	local pk = sessions[src .. "|" .. dst]
+	if pk then
+		subtree:add(f.session, pk)
+	end
+
+	local offset, len = 0, tvb:len()
+	local function need(n)
+		if not pinfo.visited then
+			hs_left[dir] = left
+		end
+		pinfo.desegment_offset = offset
+		pinfo.desegment_len = n
+	end
+
+	while offset < len do
+		local avail = len - offset
+		if left > 0 then
+			if avail < 2 then
+				return need(DESEGMENT_ONE_MORE_SEGMENT)
+			end
+			local n = tvb(offset, 2):uint()
+			if avail < 2 + n then
+				return need(2 + n - avail)
+			end
+			local t = subtree:add(dmsg, tvb(offset, 2 + n), "Noise Handshake Message")
+			t:add(f.hs_len, tvb(offset, 2))
+			if n > 0 then
+				t:add(f.hs_msg, tvb(offset + 2, n))
+			end
+			offset = offset + 2 + n
+			left = left - 1
+		else
+			if avail < header_size then
+				return need(DESEGMENT_ONE_MORE_SEGMENT)
+			end
+			local size = header_size
+			if tvb(offset + 1, 1):uint() == 0 then
+				size = size + tvb(offset + 8, 4):uint()
+			end
+			if avail < size then
+				return need(size - avail)
+			end
+			dissect_frame(tvb, offset, size, subtree)
+			offset = offset + size
+		end
+	end
+	if not pinfo.visited then
+		hs_left[dir] = left
+	end
+end
+
+DissectorTable.get("tcp.port"):add(dmsg.prefs.ports, dmsg)
+registered_ports = dmsg.prefs.ports
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/SkycoinProject/dmsg/cipher"
+	"github.com/SkycoinProject/dmsg/dmsgerr"
 )
 
 const (
@@ -16,14 +17,60 @@ const (
 	// HandshakePayloadVersion contains payload version to maintain compatibility with future versions
 	// of HandshakeData format.
 	HandshakePayloadVersion = "2.0"
+
+	// MinStreamWindowSize is the minimum (and default) receive window of streams (see (*Config).StreamWindowSize).
+	MinStreamWindowSize = 256 * 1024
 )
 
 var (
-	// HandshakeTimeout defines the duration a stream handshake should take.
+	// HandshakeTimeout defines the default duration a stream handshake should take.
 	HandshakeTimeout = time.Second * 20
 
 	// AcceptBufferSize defines the size of the accepts buffer.
 	AcceptBufferSize = 20
+
+	// DialParallelism defines the maximum number of delegated servers that a client concurrently attempts to
+	// establish sessions with when dialing a remote client.
+	DialParallelism = 3
+
+	// UnreachableCacheTTL defines how long a remote client which failed to be dialed is considered unreachable.
+	// Dials to such remote clients fail fast with ErrPeerRecentlyUnreachable. A value of 0 disables this behavior.
+	UnreachableCacheTTL = time.Second * 10
+
+	// DialServerCacheSize defines the number of remote clients for which the delegated server which last served a
+	// dial is remembered, so that subsequent dials try that server first. A value of 0 disables this behavior.
+	DialServerCacheSize = 1024
+
+	// EntryWatchInterval defines the interval at which entries watched via (*Client).WatchEntry are polled.
+	EntryWatchInterval = time.Second * 10
+
+	// HandshakeFloodWindow defines the window within which failed session handshakes from a host are counted against
+	// (*ServerConfig).HandshakeFloodThreshold.
+	HandshakeFloodWindow = time.Minute
+
+	// ClusterRouteRefreshInterval defines the interval at which clustered servers refresh the routes of their sessions.
+	// It should be shorter than the TTL of the routes (see cluster.DefaultRouteTTL).
+	ClusterRouteRefreshInterval = time.Minute
+
+	// ServerBusyBackoff defines the initial backoff before a dial which was rejected with ErrServerBusy is retried
+	// (see (*Config).ServerBusyRetries).
+	ServerBusyBackoff = time.Millisecond * 500
+
+	// MemoryCheckInterval defines the interval at which the heap usage of a server is compared against
+	// (*ServerConfig).MemoryBudget.
+	MemoryCheckInterval = time.Second * 5
+
+	// FDCheckInterval defines the interval at which entities count the open file descriptors of the process (see
+	// FDMetrics and FDReserve of (*Config) and (*ServerConfig)).
+	FDCheckInterval = time.Second * 10
+
+	// StreamIDRecycleThreshold defines the number of stream IDs left (in either direction) at which a client session
+	// is recycled: a fresh session with the same server takes over new streams, and the old session is closed once
+	// its streams are closed.
+	StreamIDRecycleThreshold uint32 = 1 << 16
+
+	// SessionDrainInterval defines the interval at which a recycled session is checked for remaining streams.
+	SessionDrainInterval = time.Second * 5
 )
 
 // Addr implements net.Addr for dmsg addresses.
@@ -167,6 +214,7 @@ type StreamRequest struct {
 	SrcAddr   Addr
 	DstAddr   Addr
 	NoiseMsg  []byte
+	OOB       bool // Whether the dialer supports out-of-band messages.
 
 	raw SignedObject `enc:"-"` // back reference.
 }
@@ -203,15 +251,31 @@ type StreamResponse struct {
 	ReqHash  cipher.SHA256 // Hash of associated dial request.
 	Accepted bool          // Whether the request is accepted.
 	ErrCode  errorCode     // Check if not accepted.
+	Reason   string        // Reason given by the rejecting end (optional, only if not accepted).
 	NoiseMsg []byte
+	OOB      bool // Whether out-of-band messages are used (only if supported by both ends).
 
 	raw SignedObject `enc:"-"` // back reference.
 }
 
 // Verify verifies the StreamResponse.
 func (resp StreamResponse) Verify(req StreamRequest) error {
+	if err := resp.verifyOrigin(req); err != nil {
+		return err
+	}
+
+	// Check whether response states that the request is accepted.
+	if !resp.Accepted {
+		return rejectionError(resp.ErrCode, resp.Reason)
+	}
+
+	return nil
+}
+
+// verifyOrigin checks that the response is of the given request, and that it is signed by the destination.
+func (resp StreamResponse) verifyOrigin(req StreamRequest) error {
 	// Check fields.
-	if resp.ReqHash != req.raw.Hash() {
+	if !resp.ReqHash.Equal(req.raw.Hash()) {
 		return ErrDialRespInvalidHash
 	}
 
@@ -219,17 +283,73 @@ func (resp StreamResponse) Verify(req StreamRequest) error {
 	if err := cipher.VerifyPubKeySignedPayload(req.DstAddr.PK, resp.raw.Sig(), resp.raw.Object()); err != nil {
 		return ErrDialRespInvalidSig.Wrap(err)
 	}
+	return nil
+}
 
-	// Check whether response states that the request is accepted.
-	if !resp.Accepted {
-		ok, err := ErrorFromCode(resp.ErrCode)
-		if !ok {
-			err = ErrDialRespNotAccepted
-		}
+// serverRejection returns the reason if the response is a rejection of the request by the dmsg server of the given
+// public key (such as ErrServerBusy). Such rejections are signed by the server instead of the destination.
+func serverRejection(srvPK cipher.PubKey, req StreamRequest, resp StreamResponse) error {
+	if resp.Accepted || !resp.ReqHash.Equal(req.raw.Hash()) || !isServerRejectionCode(resp.ErrCode) {
+		return nil
+	}
+	if err := cipher.VerifyPubKeySignedPayload(srvPK, resp.raw.Sig(), resp.raw.Object()); err != nil {
+		return nil
+	}
+	return rejectionError(resp.ErrCode, resp.Reason)
+}
+
+// maxRejectionReasonLen is the maximum length of the reason of a stream rejection. Longer reasons are truncated.
+const maxRejectionReasonLen = 256
+
+// Rejection is the reason given by the remote client (or dmsg server) which rejected a stream request, such as the
+// error returned by a stream interceptor. Dial errors wrap it if a reason is given (see errors.As).
+type Rejection struct {
+	Reason string
+}
+
+// Error implements error
+func (r *Rejection) Error() string {
+	return r.Reason
+}
+
+// rejectionError returns the error of a rejection of the given code and reason.
+// Codes which are unknown to the local end result in ErrDialRespNotAccepted.
+func rejectionError(code errorCode, reason string) error {
+	err, ok := dmsgerr.FromCode(code)
+	if !ok {
+		err = ErrDialRespNotAccepted
+	}
+	if reason == "" {
 		return err
 	}
+	return err.Wrap(&Rejection{Reason: truncateReason(reason)})
+}
 
-	return nil
+// rejectionReason returns the reason to send alongside a rejection of the given error, which is the error wrapped by
+// it (if any). The message of the error itself is known to the remote by its code.
+func rejectionReason(err error) string {
+	if nxt := errors.Unwrap(err); nxt != nil {
+		return truncateReason(nxt.Error())
+	}
+	return ""
+}
+
+func truncateReason(reason string) string {
+	if len(reason) > maxRejectionReasonLen {
+		return reason[:maxRejectionReasonLen]
+	}
+	return reason
+}
+
+// isServerRejectionCode returns true if dmsg servers may reject stream requests with the given error code.
+func isServerRejectionCode(code errorCode) bool {
+	switch code {
+	case ErrServerBusy.Code(), ErrReqRateLimited.Code(), ErrReqQuotaExceeded.Code(), ErrSessionStreamLimit.Code(),
+		ErrReqNoNextSession.Code(), ErrReqRelayLoop.Code(), ErrReqRelayHopLimit.Code():
+		return true
+	default:
+		return false
+	}
 }
 
 // SignBytes signs the provided bytes with the given secret key.
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"net"
+	"time"
 )
 
 func awaitDone(ctx context.Context, done chan struct{}) {
@@ -13,6 +15,25 @@ func awaitDone(ctx context.Context, done chan struct{}) {
 	}
 }
 
+// interruptOnDone sets a deadline in the past on the connection once the context is done, so that blocking reads and
+// writes (such as of handshakes) return. The returned func stops this, and should be called once they have returned.
+func interruptOnDone(ctx context.Context, conn net.Conn) (stop func()) {
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Unix(1, 0)) //nolint:errcheck
+		case <-stopCh:
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-doneCh
+	}
+}
+
 func isClosed(done chan struct{}) bool {
 	select {
 	case <-done: